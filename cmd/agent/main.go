@@ -3,11 +3,16 @@ package main
 import (
 	"context"
 	"crypto/rsa"
+	"errors"
+	"flag"
 	"math/rand"
+	"os"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/Axel791/metricsalert/internal/shared"
+	"github.com/Axel791/metricsalert/internal/shared/logging"
 
 	"github.com/shirou/gopsutil/cpu"
 	"github.com/shirou/gopsutil/mem"
@@ -30,10 +35,14 @@ var (
 	buildCommit  = "N/A"
 )
 
+// configWatchInterval - период проверки файлов конфигурации на изменения.
+const configWatchInterval = 5 * time.Second
+
 // collectMetricsLoop собирает runtime-метрики.
 func collectMetricsLoop(
 	ctx context.Context,
 	pollInterval time.Duration,
+	pollIntervalCh <-chan time.Duration,
 	mu *sync.RWMutex,
 	metrics *api.Metrics,
 	pollCount *int64,
@@ -48,6 +57,8 @@ func collectMetricsLoop(
 		select {
 		case <-ctx.Done():
 			return
+		case interval := <-pollIntervalCh:
+			ticker.Reset(interval)
 		case <-ticker.C:
 			metric := collector.Collector()
 
@@ -89,12 +100,15 @@ func collectMetricsLoop(
 	}
 }
 
-// reportMetricsLoop делает снимок метрик и кладёт его в канал.
+// reportMetricsLoop делает снимок метрик и кладёт его в канал. PollCount
+// в снимке заменяется приращением с прошлого отчёта.
 func reportMetricsLoop(
 	ctx context.Context,
 	reportInterval time.Duration,
+	reportIntervalCh <-chan time.Duration,
 	mu *sync.RWMutex,
 	metrics *api.Metrics,
+	pollCounts *sender.PollCountTracker,
 	sendCh chan<- api.Metrics,
 	wg *sync.WaitGroup,
 ) {
@@ -107,56 +121,103 @@ func reportMetricsLoop(
 		select {
 		case <-ctx.Done():
 			return
+		case interval := <-reportIntervalCh:
+			ticker.Reset(interval)
 		case <-ticker.C:
 			mu.RLock()
 			currentMetrics := *metrics
 			mu.RUnlock()
+			currentMetrics.PollCount = pollCounts.Take(currentMetrics.PollCount)
 
-			sendCh <- currentMetrics
+			select {
+			case sendCh <- currentMetrics:
+			case <-ctx.Done():
+				return
+			}
 		}
 	}
 }
 
 // startWorkerPool запускает воркеров, которые читают из sendCh.
+// Число воркеров меняется на лету через rateLimitCh.
 func startWorkerPool(
 	ctx context.Context,
 	rateLimit int,
+	rateLimitCh <-chan int,
 	sendCh <-chan api.Metrics,
 	metricClient *sender.MetricClient,
+	pollCounts *sender.PollCountTracker,
 	log *logrus.Logger,
 	wg *sync.WaitGroup,
 ) {
 	defer wg.Done()
 
-	var innerWG sync.WaitGroup
-	innerWG.Add(rateLimit)
-
-	for i := 0; i < rateLimit; i++ {
-		go func(workerID int) {
-			defer innerWG.Done()
-			for {
-				select {
-				case <-ctx.Done():
-					return
-				case m, ok := <-sendCh:
-					if !ok { // канал закрыт
-						return
-					}
-					if err := metricClient.SendMetrics(m); err != nil {
-						log.Errorf("Worker %d: error sending metrics: %v", workerID, err)
-					}
-				}
-			}
-		}(i)
+	var (
+		innerWG sync.WaitGroup
+		cancels []context.CancelFunc
+	)
+
+	resize := func(size int) {
+		for len(cancels) < size {
+			workerCtx, cancel := context.WithCancel(ctx)
+			cancels = append(cancels, cancel)
+
+			innerWG.Add(1)
+			go sendWorker(workerCtx, len(cancels)-1, sendCh, metricClient, pollCounts, log, &innerWG)
+		}
+		for len(cancels) > size {
+			last := len(cancels) - 1
+			cancels[last]()
+			cancels = cancels[:last]
+		}
 	}
 
-	innerWG.Wait()
+	resize(rateLimit)
+	for {
+		select {
+		case <-ctx.Done():
+			innerWG.Wait()
+			return
+		case size := <-rateLimitCh:
+			resize(size)
+		}
+	}
+}
+
+// sendWorker отправляет снимки из sendCh, пока не отменён ctx. Приращение
+// PollCount отправленного снимка отмечается в pollCounts.
+func sendWorker(
+	ctx context.Context,
+	workerID int,
+	sendCh <-chan api.Metrics,
+	metricClient *sender.MetricClient,
+	pollCounts *sender.PollCountTracker,
+	log *logrus.Logger,
+	wg *sync.WaitGroup,
+) {
+	defer wg.Done()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case m, ok := <-sendCh:
+			if !ok { // канал закрыт
+				return
+			}
+			if err := metricClient.SendMetrics(m); err != nil {
+				log.Errorf("Worker %d: error sending metrics: %v", workerID, err)
+				continue
+			}
+			pollCounts.Delivered(m.PollCount)
+		}
+	}
 }
 
 // collectSystemMetricsLoop собирает системные метрики.
 func collectSystemMetricsLoop(
 	ctx context.Context,
 	pollInterval time.Duration,
+	pollIntervalCh <-chan time.Duration,
 	mu *sync.RWMutex,
 	metrics *api.Metrics,
 	log *logrus.Logger,
@@ -171,6 +232,8 @@ func collectSystemMetricsLoop(
 		select {
 		case <-ctx.Done():
 			return
+		case interval := <-pollIntervalCh:
+			ticker.Reset(interval)
 		case <-ticker.C:
 			vmStat, err := mem.VirtualMemory()
 			if err != nil {
@@ -192,37 +255,219 @@ func collectSystemMetricsLoop(
 	}
 }
 
-// runAgent объединяет запуск сборщиков метрик, worker pool и т.д.
-func runAgent(
-	address string,
-	reportInterval, pollInterval time.Duration,
+// resendSpool досылает пачки, сохранённые при прошлой остановке агента.
+// Неотправленные пачки остаются в спуле до следующей попытки.
+func resendSpool(
+	ctx context.Context,
+	spool *sender.Spool,
+	metricClient *sender.MetricClient,
 	log *logrus.Logger,
-	cryptoKey, key string,
-	rateLimit int,
+	wg *sync.WaitGroup,
 ) {
-	if !validators.IsValidAddress(address, true) {
-		log.Fatalf("invalid address: %s\n", address)
+	defer wg.Done()
+
+	batches, err := spool.Load()
+	if err != nil {
+		log.Errorf("error loading spool: %v", err)
+		return
+	}
+	if len(batches) == 0 {
+		return
+	}
+
+	for i, batch := range batches {
+		if err = metricClient.SendBatch(ctx, batch); err != nil {
+			log.Errorf("error resending spooled batch: %v", err)
+			if err = spool.Clear(); err != nil {
+				log.Errorf("error clearing spool: %v", err)
+				return
+			}
+			for _, rest := range batches[i:] {
+				if err = spool.Save(rest); err != nil {
+					log.Errorf("error saving spool: %v", err)
+				}
+			}
+			return
+		}
 	}
 
-	authService := services.NewAuthServiceHandler(key)
+	if err = spool.Clear(); err != nil {
+		log.Errorf("error clearing spool: %v", err)
+		return
+	}
+	log.Infof("resent %d spooled batches", len(batches))
+}
+
+// sendFinalBatch отправляет последний снимок метрик при остановке агента.
+// Если сервер недоступен до истечения timeout, снимок сохраняется в спул.
+//
+// Если агент остановлен до первого сбора, отправлять нечего. PollCount
+// отправляется приращением, которое сервер ещё не принял: так доходят и
+// приращения отчётов, не отправленных из-за ошибки или остановки.
+func sendFinalBatch(
+	timeout time.Duration,
+	mu *sync.RWMutex,
+	metrics *api.Metrics,
+	pollCounts *sender.PollCountTracker,
+	collectors sender.Collectors,
+	spool *sender.Spool,
+	metricClient *sender.MetricClient,
+	log *logrus.Logger,
+) {
+	mu.RLock()
+	snapshot := *metrics
+	mu.RUnlock()
+
+	// PollCount растёт с каждым сбором runtime-метрик, TotalMemory не бывает
+	// нулевым после сбора системных.
+	if snapshot.PollCount == 0 && snapshot.TotalMemory == 0 {
+		log.Info("no metrics collected, final metrics batch skipped")
+		return
+	}
+	snapshot.PollCount = pollCounts.Undelivered(snapshot.PollCount)
+	batch := sender.BuildMetricsList(snapshot, collectors)
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	err := metricClient.SendBatch(ctx, batch)
+	if err == nil {
+		log.Info("final metrics batch sent")
+		return
+	}
+	log.Errorf("error sending final metrics batch: %v", err)
+
+	if !spool.Enabled() {
+		return
+	}
+	if err = spool.Save(batch); err != nil {
+		log.Errorf("error spooling final metrics batch: %v", err)
+		return
+	}
+	log.Info("final metrics batch spooled")
+}
+
+// agentReloaders - каналы, через которые перезагрузка конфигурации
+// передаёт новые значения работающим циклам агента.
+type agentReloaders struct {
+	collectInterval chan time.Duration
+	systemInterval  chan time.Duration
+	reportInterval  chan time.Duration
+	rateLimit       chan int
+}
+
+func newAgentReloaders() *agentReloaders {
+	return &agentReloaders{
+		collectInterval: make(chan time.Duration, 1),
+		systemInterval:  make(chan time.Duration, 1),
+		reportInterval:  make(chan time.Duration, 1),
+		rateLimit:       make(chan int, 1),
+	}
+}
+
+// replaceValue кладёт в канал новое значение, вытесняя ещё не прочитанное.
+func replaceValue[T any](ch chan T, value T) {
+	select {
+	case <-ch:
+	default:
+	}
+	ch <- value
+}
+
+// configureLogging применяет уровень и формат логов к логгеру агента и к
+// глобальному логгеру logrus. При ошибке остаются прежние настройки.
+func configureLogging(log *logrus.Logger, cfg config.LogConfig) {
+	if err := logging.Configure(log, cfg.Level, cfg.Format); err != nil {
+		log.Warnf("error configuring logging: %v", err)
+	}
+}
+
+// watchConfig перечитывает конфигурацию по SIGHUP или при изменении файлов
+// и применяет настройки, которые можно менять без перезапуска.
+func watchConfig(
+	ctx context.Context,
+	log *logrus.Logger,
+	configFile string,
+	cfg *config.Config,
+	reloaders *agentReloaders,
+	shutdownTimeout *atomic.Int64,
+) {
+	reloadCh := shared.CatchReload(ctx, configWatchInterval, configFile, ".env")
+	current := *cfg
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-reloadCh:
+		}
+
+		newCfg, _, err := config.AgentLoadConfig(os.Args[1:])
+		if err != nil {
+			log.Errorf("error reloading config, keeping current settings: %v", err)
+			continue
+		}
+
+		changes := config.Diff(&current, newCfg)
+		if current.Log != newCfg.Log {
+			configureLogging(log, newCfg.Log)
+		}
+		if current.Collectors.PollInterval != newCfg.Collectors.PollInterval {
+			replaceValue(reloaders.collectInterval, newCfg.Collectors.PollInterval)
+			replaceValue(reloaders.systemInterval, newCfg.Collectors.PollInterval)
+		}
+		if current.Sender.ReportInterval != newCfg.Sender.ReportInterval {
+			replaceValue(reloaders.reportInterval, newCfg.Sender.ReportInterval)
+		}
+		if current.Sender.RateLimit != newCfg.Sender.RateLimit {
+			replaceValue(reloaders.rateLimit, newCfg.Sender.RateLimit)
+		}
+		shutdownTimeout.Store(int64(newCfg.ShutdownTimeout))
+		shared.LogChanges(log, changes)
+
+		// Настройки, требующие перезапуска, остаются прежними до него.
+		current.Log = newCfg.Log
+		current.Collectors.PollInterval = newCfg.Collectors.PollInterval
+		current.Sender.ReportInterval = newCfg.Sender.ReportInterval
+		current.Sender.RateLimit = newCfg.Sender.RateLimit
+		current.ShutdownTimeout = newCfg.ShutdownTimeout
+	}
+}
+
+// runAgent объединяет запуск сборщиков метрик, worker pool и т.д.
+func runAgent(cfg *config.Config, configFile string, log *logrus.Logger) {
+	if !validators.IsValidAddress(cfg.Address, true) {
+		log.Fatalf("invalid address: %s\n", cfg.Address)
+	}
+
+	authService := services.NewAuthServiceHandler(cfg.Security.Key)
 	var rsaPub *rsa.PublicKey
-	if cryptoKey != "" {
+	if cfg.Security.CryptoKey != "" {
 		var err error
-		rsaPub, err = cryptoutil.LoadPublic(cryptoKey)
+		rsaPub, err = cryptoutil.LoadPublic(cfg.Security.CryptoKey)
 		if err != nil {
 			log.Fatalf("RSA key error: %v", err)
 		}
 		log.Info("RSA encryption enabled")
 	}
 
-	metricClient := sender.NewMetricClient(address, log, authService, rsaPub)
+	metricClient := sender.NewMetricClient(cfg.Address, log, authService, rsaPub, cfg.Sender.AgentID)
+	collectors := sender.Collectors{Runtime: cfg.Collectors.Runtime, System: cfg.Collectors.System}
+	metricClient.SetCollectors(collectors)
+	spool := sender.NewSpool(cfg.Sender.SpoolPath)
+
+	pollInterval := cfg.Collectors.PollInterval
+
+	var shutdownTimeout atomic.Int64
+	shutdownTimeout.Store(int64(cfg.ShutdownTimeout))
 
-	sendCh := make(chan api.Metrics, rateLimit)
+	sendCh := make(chan api.Metrics, cfg.Sender.RateLimit)
 
 	var (
 		mu         sync.RWMutex
 		metricsDTO api.Metrics
 		pollCount  int64
+		pollCounts sender.PollCountTracker
 	)
 
 	// ------------- ДОБАВЛЕНО -----------------------------------
@@ -230,30 +475,51 @@ func runAgent(
 	wg := &sync.WaitGroup{}       // ждём завершения всех воркеров
 	// -----------------------------------------------------------
 
-	// Запускаем горутину по сбору runtime-метрик.
+	reloaders := newAgentReloaders()
+	go watchConfig(ctx, log, configFile, cfg, reloaders, &shutdownTimeout)
+
+	// Досылаем то, что не успели отправить при прошлой остановке.
 	wg.Add(1)
-	go collectMetricsLoop(ctx, pollInterval, &mu, &metricsDTO, &pollCount, wg)
+	go resendSpool(ctx, spool, metricClient, log, wg)
+
+	// Запускаем горутину по сбору runtime-метрик.
+	if cfg.Collectors.Runtime {
+		wg.Add(1)
+		go collectMetricsLoop(ctx, pollInterval, reloaders.collectInterval, &mu, &metricsDTO, &pollCount, wg)
+	}
 
 	// Запускаем горутину по сбору системных метрик.
-	wg.Add(1)
-	go collectSystemMetricsLoop(ctx, pollInterval, &mu, &metricsDTO, log, wg)
+	if cfg.Collectors.System {
+		wg.Add(1)
+		go collectSystemMetricsLoop(ctx, pollInterval, reloaders.systemInterval, &mu, &metricsDTO, log, wg)
+	}
 
 	// Запускаем горутину формирования отчётов.
 	wg.Add(1)
-	go reportMetricsLoop(ctx, reportInterval, &mu, &metricsDTO, sendCh, wg)
+	go reportMetricsLoop(
+		ctx, cfg.Sender.ReportInterval, reloaders.reportInterval, &mu, &metricsDTO, &pollCounts, sendCh, wg,
+	)
 
 	// Запускаем worker pool для отправки метрик.
 	wg.Add(1)
-	go startWorkerPool(ctx, rateLimit, sendCh, metricClient, log, wg)
+	go startWorkerPool(
+		ctx, cfg.Sender.RateLimit, reloaders.rateLimit, sendCh, metricClient, &pollCounts, log, wg,
+	)
 
 	// Ждём отмены контекста (первый сигнал).
 	<-ctx.Done()
 
-	close(sendCh)
-
 	// Дожидаемся корректного завершения всех горутин.
 	wg.Wait()
 
+	close(sendCh)
+
+	// Последний собранный снимок иначе был бы потерян.
+	sendFinalBatch(
+		time.Duration(shutdownTimeout.Load()), &mu, &metricsDTO, &pollCounts, collectors,
+		spool, metricClient, log,
+	)
+
 	log.Info("agent stopped gracefully")
 }
 
@@ -265,22 +531,29 @@ func main() {
 	})
 	log.SetLevel(logrus.InfoLevel)
 
-	log.Infof("Build version: %s", buildVersion)
-	log.Infof("Build date:    %s", buildDate)
-	log.Infof("Build commit:  %s", buildCommit)
-
-	path := "agent_config.json"
-	shared.LoadEnvFromFile(log, path)
-
-	cfg, err := config.AgentLoadConfig()
+	cfg, loader, err := config.AgentLoadConfig(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
 	if err != nil {
 		log.Fatalf("error loading config: %v\n", err)
 	}
-	address, reportInterval, pollInterval, cryptoKey, key, rateLimit := config.ParseFlags(cfg)
+	if loader.PrintConfig() {
+		if err = loader.Report(os.Stdout); err != nil {
+			log.Fatalf("error printing config: %v", err)
+		}
+		return
+	}
+
+	configureLogging(log, cfg.Log)
 
-	cfg.CryptoKey = cryptoKey
-	cfg.Key = key
-	cfg.RateLimit = rateLimit
+	log.Infof("Build version: %s", buildVersion)
+	log.Infof("Build date:    %s", buildDate)
+	log.Infof("Build commit:  %s", buildCommit)
 
-	runAgent(address, reportInterval, pollInterval, log, cryptoKey, key, rateLimit)
+	configFile := loader.File()
+	if configFile == "" {
+		configFile = config.DefaultConfigFile
+	}
+	runAgent(cfg, configFile, log)
 }
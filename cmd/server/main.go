@@ -2,10 +2,15 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
+	"io"
 	"net/http"
+	"os"
 	"time"
 
 	"github.com/Axel791/metricsalert/internal/shared"
+	"github.com/Axel791/metricsalert/internal/shared/logging"
 
 	"github.com/go-chi/chi/v5"
 
@@ -15,11 +20,18 @@ import (
 
 	"github.com/Axel791/metricsalert/internal/server/handlers/deprecated"
 
+	"github.com/Axel791/metricsalert/internal/server/alerts"
+	"github.com/Axel791/metricsalert/internal/server/audit"
 	"github.com/Axel791/metricsalert/internal/server/config"
 	"github.com/Axel791/metricsalert/internal/server/handlers"
 	serverMiddleware "github.com/Axel791/metricsalert/internal/server/middleware"
+	"github.com/Axel791/metricsalert/internal/server/openapi"
 	"github.com/Axel791/metricsalert/internal/server/repositories"
+	"github.com/Axel791/metricsalert/internal/server/retention"
 	"github.com/Axel791/metricsalert/internal/server/services"
+	"github.com/Axel791/metricsalert/internal/server/staleness"
+	"github.com/Axel791/metricsalert/internal/server/stream"
+	"github.com/Axel791/metricsalert/internal/server/telemetry"
 	"github.com/Axel791/metricsalert/internal/shared/validators"
 
 	_ "net/http/pprof"
@@ -34,6 +46,103 @@ var (
 	buildCommit  = "N/A"
 )
 
+// configWatchInterval - период проверки файлов конфигурации на изменения.
+const configWatchInterval = 5 * time.Second
+
+// configureLogging применяет уровень и формат логов к логгеру сервера и к
+// глобальному логгеру logrus. При ошибке остаются прежние настройки.
+func configureLogging(log *logrus.Logger, cfg config.LogConfig) {
+	if err := logging.Configure(log, cfg.Level, cfg.Format); err != nil {
+		log.Warnf("error configuring logging: %v", err)
+	}
+}
+
+// storageBackend возвращает название бэкенда хранилища для /health.
+func storageBackend(storage repositories.Store) string {
+	if instrumented, ok := storage.(*repositories.InstrumentedStore); ok {
+		return instrumented.Backend()
+	}
+	return "unknown"
+}
+
+// auditSinks открывает приёмники журнала аудита обновлений метрик.
+func auditSinks(cfg config.AuditConfig) ([]audit.Sink, error) {
+	var sinks []audit.Sink
+	if cfg.File != "" {
+		sink, err := audit.NewFileSink(cfg.File)
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, sink)
+	}
+	if cfg.URL != "" {
+		sinks = append(sinks, audit.NewHTTPSink(cfg.URL, cfg.HTTPTimeout))
+	}
+	return sinks, nil
+}
+
+// watchConfig перечитывает конфигурацию по SIGHUP или при изменении файлов
+// и применяет настройки, которые можно менять без перезапуска.
+func watchConfig(
+	ctx context.Context,
+	log *logrus.Logger,
+	configFile string,
+	cfg *config.Config,
+	storage repositories.Store,
+	alertRules *alerts.RuleSet,
+	compactor *retention.Compactor,
+	metricsService *services.MetricsService,
+	evictor *staleness.Evictor,
+) {
+	reloadCh := shared.CatchReload(ctx, configWatchInterval, configFile, ".env")
+	current := *cfg
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-reloadCh:
+		}
+
+		newCfg, _, err := config.ServerLoadConfig(os.Args[1:])
+		if err != nil {
+			log.Errorf("error reloading config, keeping current settings: %v", err)
+			continue
+		}
+
+		changes := config.Diff(&current, newCfg)
+		if current.Log != newCfg.Log {
+			configureLogging(log, newCfg.Log)
+		}
+		if current.Storage.StoreInterval != newCfg.Storage.StoreInterval {
+			if setter, ok := storage.(repositories.IntervalSetter); ok {
+				setter.SetStoreInterval(newCfg.Storage.StoreInterval)
+			}
+		}
+		alertRules.SetRules(newCfg.Alerts.Rules)
+		if compactor != nil {
+			compactor.SetPolicies(newCfg.Retention.RetentionPolicies())
+		}
+		metricsService.SetStalenessPolicy(newCfg.Staleness.StalenessPolicy())
+		if evictor != nil {
+			evictor.SetPolicy(newCfg.Staleness.StalenessPolicy())
+		}
+		shared.LogChanges(log, changes)
+
+		// Настройки, требующие перезапуска, остаются прежними до него.
+		current.Log = newCfg.Log
+		current.Storage.StoreInterval = newCfg.Storage.StoreInterval
+		current.Alerts.Rules = newCfg.Alerts.Rules
+		current.Retention.Raw = newCfg.Retention.Raw
+		current.Retention.Minute = newCfg.Retention.Minute
+		current.Retention.Hour = newCfg.Retention.Hour
+		current.Retention.Policies = newCfg.Retention.Policies
+		current.Staleness.TTL = newCfg.Staleness.TTL
+		current.Staleness.Action = newCfg.Staleness.Action
+		current.Staleness.Rules = newCfg.Staleness.Rules
+	}
+}
+
 func main() {
 	log := logrus.New()
 	log.SetFormatter(&logrus.TextFormatter{
@@ -42,44 +151,71 @@ func main() {
 	})
 	log.SetLevel(logrus.InfoLevel)
 
-	path := "server_config.json"
-	shared.LoadEnvFromFile(log, path)
+	cfg, loader, err := config.ServerLoadConfig(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		log.Fatalf("error loading config: %v", err)
+	}
+	if loader.PrintConfig() {
+		if err = loader.Report(os.Stdout); err != nil {
+			log.Fatalf("error printing config: %v", err)
+		}
+		return
+	}
 
 	ctx := shared.CatchShutdown()
 
+	configureLogging(log, cfg.Log)
+
 	log.Infof("Build version: %s", buildVersion)
 	log.Infof("Build date:    %s", buildDate)
 	log.Infof("Build commit:  %s", buildCommit)
 
-	cfg, err := config.ServerLoadConfig()
-	if err != nil {
-		log.Fatalf("error loading config: %v", err)
-	}
-
-	addr, databaseDSN, storeIntervalFlag, filePathFlag, restoreFlag, key, cryptoKey := config.ParseFlags(cfg)
-
-	cfg.Address = addr
-	cfg.DatabaseDSN = databaseDSN
-	cfg.StoreInterval = storeIntervalFlag
-	cfg.FileStoragePath = filePathFlag
-	cfg.Restore = restoreFlag
-	cfg.Key = key
-	cfg.CryptoKey = cryptoKey
-
 	if !validators.IsValidAddress(cfg.Address, false) {
 		log.Fatalf("invalid address: %s", cfg.Address)
 	}
 
 	// --- подключаем БД --------------------------------------------------
-	dbConn, err := db.ConnectDB(cfg.DatabaseDSN, cfg)
-	if err != nil {
-		log.Fatalf("error connecting to database: %v", err)
+	poolCfg := db.PoolConfig{
+		MaxOpenConns:    cfg.Storage.MaxOpenConns,
+		MaxIdleConns:    cfg.Storage.MaxIdleConns,
+		ConnMaxLifetime: cfg.Storage.ConnMaxLifetime,
+		ConnMaxIdleTime: cfg.Storage.ConnMaxIdleTime,
 	}
-	defer func() {
-		if dbConn != nil {
-			_ = dbConn.Close()
+	retryCfg := db.RetryConfig{
+		MaxAttempts:        cfg.Storage.RetryMaxAttempts,
+		BaseDelay:          cfg.Storage.RetryBaseDelay,
+		MaxDelay:           cfg.Storage.RetryMaxDelay,
+		BreakerThreshold:   cfg.Storage.BreakerThreshold,
+		BreakerOpenTimeout: cfg.Storage.BreakerOpenTimeout,
+	}
+
+	var fallback *repositories.FallbackStore
+	dbConn, err := db.ConnectDB(cfg.Storage.DatabaseDSN, cfg.Storage.MigrationsPath, poolCfg)
+	// Хранилище и история работают через одно подключение и делят один
+	// автомат защиты, чтобы у соединения было одно состояние.
+	var dbRetrier *db.Retrier
+	if dbConn != nil {
+		dbRetrier = db.NewRetrier(retryCfg)
+	}
+	if err != nil {
+		if !cfg.Storage.Fallback {
+			log.Fatalf("error connecting to database: %v", err)
 		}
-	}()
+		// Сервер стартует на хранилище в памяти и переносит накопленные
+		// метрики в базу, когда она станет доступна.
+		log.Errorf("error connecting to database, starting in fallback mode: %v", err)
+		// Новое подключение получает свой retrier.
+		fallback = repositories.NewFallbackStore(func(context.Context) (repositories.Store, error) {
+			conn, err := db.ConnectDB(cfg.Storage.DatabaseDSN, cfg.Storage.MigrationsPath, poolCfg)
+			if err != nil {
+				return nil, err
+			}
+			return repositories.NewMetricRepository(conn, db.NewRetrier(retryCfg)), nil
+		}, cfg.Storage.ReconnectInterval)
+	}
 
 	// --- создаём сервисы безопасности ----------------------------------
 	var (
@@ -87,8 +223,8 @@ func main() {
 		signSvc   services.SignService   // HMAC-подписи
 	)
 
-	if cfg.CryptoKey != "" {
-		cryptoSvc, err = services.NewCryptoService(cfg.CryptoKey)
+	if cfg.Security.CryptoKey != "" {
+		cryptoSvc, err = services.NewCryptoService(cfg.Security.CryptoKey)
 		if err != nil {
 			log.Fatalf("crypto key error: %v", err)
 		}
@@ -96,14 +232,20 @@ func main() {
 	}
 
 	// HMAC-подпись используется, если RSA не включён
-	if cfg.Key != "" && cryptoSvc == nil {
-		signSvc = services.NewSignService(cfg.Key)
+	if cfg.Security.Key != "" && cryptoSvc == nil {
+		signSvc = services.NewSignService(cfg.Security.Key)
 		log.Info("HMAC signature enabled")
 	}
 
+	// --- телеметрия сервера --------------------------------------------
+	serverMetrics := telemetry.NewServerMetrics(telemetry.NewRegistry())
+	db.SetTelemetry(serverMetrics)
+
 	// --- роутер и middleware -------------------------------------------
 	router := chi.NewRouter()
+	router.Use(serverMiddleware.RequestID(log))
 	router.Use(serverMiddleware.WithLogging)
+	router.Use(serverMiddleware.Metrics(serverMetrics))
 
 	if cryptoSvc != nil {
 		router.Use(serverMiddleware.CryptoMiddleware(cryptoSvc))
@@ -115,56 +257,226 @@ func main() {
 	router.Use(serverMiddleware.GzipMiddleware)
 	router.Use(middleware.StripSlashes)
 
+	// --- история метрик ------------------------------------------------
+	// В резервном режиме история хранится в памяти до перезапуска сервера.
+	var (
+		history   repositories.History
+		compactor *retention.Compactor
+	)
+	if cfg.Retention.Enabled {
+		if dbConn != nil {
+			history = repositories.NewPostgresHistory(dbConn, dbRetrier)
+		} else {
+			history = repositories.NewMemoryHistory()
+		}
+		compactor = retention.NewCompactor(history, cfg.Retention.RetentionPolicies(), log)
+		go compactor.Run(ctx, cfg.Retention.Interval)
+	}
+
 	// --- хранилище и сервис метрик -------------------------------------
+	// Изменения метрик рассылаются подписчикам GET /api/v1/metrics/stream.
+	// Хранилище публикует каждую запись, через какой бы путь она ни прошла.
+	broker := stream.NewBroker(cfg.Stream.BufferSize, serverMetrics)
+
 	opts := repositories.StoreOptions{
-		FilePath:        cfg.FileStoragePath,
-		RestoreFromFile: cfg.Restore,
-		StoreInterval:   time.Duration(cfg.StoreInterval) * time.Second,
-		UseFileStore:    cfg.UseFileStorage,
+		FilePath:        cfg.Storage.FilePath,
+		RestoreFromFile: cfg.Storage.Restore,
+		StoreInterval:   cfg.Storage.StoreInterval,
+		UseFileStore:    cfg.Storage.UseFile,
+		BoltPath:        cfg.Storage.BoltPath,
+		DBRetrier:       dbRetrier,
+		Fallback:        fallback,
+		History:         history,
+		Publisher:       broker,
+		Telemetry:       serverMetrics,
 	}
 
-	storage, err := repositories.StoreFactory(context.Background(), dbConn, opts)
+	storage, err := repositories.StoreFactory(ctx, dbConn, opts)
 	if err != nil {
 		log.Fatalf("error creating storage: %v", err)
 	}
 	metricsService := services.NewMetricsService(storage)
+	metricsService.SetStalenessPolicy(cfg.Staleness.StalenessPolicy())
 
-	// --- актуальные маршруты -------------------------------------------
-	router.Method(http.MethodPost, "/update",
-		handlers.NewUpdateMetricHandler(metricsService, log))
-	router.Method(http.MethodPost, "/updates",
-		handlers.NewUpdatesMetricsHandler(metricsService, log))
-	router.Method(http.MethodPost, "/value",
-		handlers.NewGetMetricHandler(metricsService, log))
+	// Метрики, устаревшие по правилам с действием evict, удаляются.
+	var evictor *staleness.Evictor
+	if cfg.Staleness.Interval > 0 {
+		evictor = staleness.NewEvictor(storage, cfg.Staleness.StalenessPolicy(), log)
+		go evictor.Run(ctx, cfg.Staleness.Interval)
+	}
+
+	var dbSource db.Source = db.StaticSource{Conn: dbConn}
+	if fallback != nil {
+		dbSource = fallback
+		go fallback.Run(ctx)
+	}
+
+	// Панель метрик проверяет значения по правилам алертов при показе.
+	alertRules := alerts.NewRuleSet(cfg.Alerts.Rules)
+
+	if cfg.Telemetry.ReportInterval > 0 {
+		reporter := telemetry.NewReporter(serverMetrics.Registry, storage, log)
+		go reporter.Run(ctx, cfg.Telemetry.ReportInterval)
+	}
+
+	configFile := loader.File()
+	if configFile == "" {
+		configFile = config.DefaultConfigFile
+	}
+	go watchConfig(ctx, log, configFile, cfg, storage, alertRules, compactor, metricsService, evictor)
+
+	// --- журнал аудита --------------------------------------------------
+	sinks, err := auditSinks(cfg.Audit)
+	if err != nil {
+		log.Fatalf("error opening audit sink: %v", err)
+	}
+	updateAuditor := audit.Discard
+	adminAuditor := audit.Recorder(audit.NewLogRecorder(log))
+	var asyncAuditor *audit.AsyncRecorder
+	if len(sinks) > 0 {
+		asyncAuditor = audit.NewAsyncRecorder(sinks, cfg.Audit.QueueSize, serverMetrics, log)
+		updateAuditor = asyncAuditor
+		adminAuditor = audit.MultiRecorder{adminAuditor, asyncAuditor}
+	}
+
+	// --- API /api/v1 ---------------------------------------------------
+	router.Route("/api/v1", func(v1 chi.Router) {
+		v1.NotFound(handlers.NotFoundJSON)
+		v1.MethodNotAllowed(handlers.MethodNotAllowedJSON)
+
+		v1.Method(http.MethodGet, "/metrics",
+			handlers.NewListMetricsHandler(metricsService, log))
+		v1.Method(http.MethodPost, "/metrics",
+			handlers.NewBatchMetricsHandler(metricsService, updateAuditor, log))
+		v1.Method(http.MethodGet, "/metrics/stream",
+			handlers.NewMetricsStreamHandler(broker, metricsService, cfg.Stream.Heartbeat, log))
+		v1.Method(http.MethodGet, "/metrics/{metricType}/{name}",
+			handlers.NewReadMetricHandler(metricsService, log))
+		v1.Method(http.MethodPut, "/metrics/{metricType}/{name}",
+			handlers.NewPutMetricHandler(metricsService, updateAuditor, log))
+		v1.Method(http.MethodGet, "/openapi.json", openapi.Handler())
+
+		// административные маршруты
+		v1.Group(func(admin chi.Router) {
+			admin.Use(serverMiddleware.AdminAuth(cfg.Security.AdminToken))
+			admin.Method(http.MethodDelete, "/metrics/{metricType}/{name}",
+				handlers.NewDeleteMetricHandler(metricsService, adminAuditor, log))
+			admin.Method(http.MethodPost, "/metrics/{metricType}/{name}/reset",
+				handlers.NewResetCounterHandler(metricsService, adminAuditor, log))
+		})
+	})
+
+	// --- прочие маршруты -----------------------------------------------
 	router.Get("/healthcheck", handlers.NewHealthCheckHandler)
 	router.Method(http.MethodGet, "/",
-		handlers.NewGetMetricsHTMLHandler(metricsService))
+		handlers.NewGetMetricsHTMLHandler(metricsService, history, alertRules, log))
+	router.Method(http.MethodGet, "/dashboard/*", handlers.DashboardAssetsHandler("/dashboard/"))
 	router.Method(http.MethodGet, "/ping",
-		handlers.NewDatabaseHealthCheckHandler(cfg.DatabaseDSN))
+		handlers.NewDatabaseHealthCheckHandler(dbSource, cfg.Storage.PingTimeout))
+	router.Method(http.MethodGet, "/health",
+		handlers.NewHealthHandler(dbSource, storageBackend(storage), serverMetrics, cfg.Storage.PingTimeout, log))
 
 	// --- устаревшие маршруты -------------------------------------------
-	router.Method(http.MethodPost, "/update/{metricType}/{name}/{value}",
-		deprecated.NewUpdateMetricHandler(storage))
-	router.Method(http.MethodGet, "/value/{metricType}/{name}",
+	// Оставлены для совместимости с агентами прежних версий и отвечают с
+	// заголовком Deprecation.
+	legacy := router.With(serverMiddleware.Deprecated("/api/v1/metrics"))
+	legacy.Method(http.MethodPost, "/update",
+		handlers.NewUpdateMetricHandler(metricsService, updateAuditor, log))
+	legacy.Method(http.MethodPost, "/updates",
+		handlers.NewUpdatesMetricsHandler(metricsService, updateAuditor, log))
+	legacy.Method(http.MethodPost, "/value",
+		handlers.NewGetMetricHandler(metricsService, log))
+	legacy.Method(http.MethodPost, "/update/{metricType}/{name}/{value}",
+		deprecated.NewUpdateMetricHandler(metricsService, updateAuditor, log))
+	legacy.Method(http.MethodGet, "/value/{metricType}/{name}",
 		deprecated.NewGetMetricHandler(storage))
 
-	// --- pprof ----------------------------------------------------------
+	// --- pprof и телеметрия -------------------------------------------
+	var internalServer *http.Server
+	if cfg.Telemetry.Address != "" {
+		internalMux := http.NewServeMux()
+		internalMux.Handle("/debug/pprof/", http.DefaultServeMux)
+		internalMux.Handle("/metrics", serverMetrics.Handler())
+
+		internalServer = &http.Server{Addr: cfg.Telemetry.Address, Handler: internalMux}
+		go func() {
+			log.Infof("internal server (pprof, /metrics) started on %s", cfg.Telemetry.Address)
+			if err := internalServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				log.Errorf("internal server: %v", err)
+			}
+		}()
+	}
+
+	// --- старт ----------------------------------------------------------
+	server := &http.Server{Addr: cfg.Address, Handler: router}
+	// Потоки метрик не завершаются сами, поэтому при остановке их нужно
+	// закрыть, иначе Shutdown ждёт до истечения таймаута.
+	server.RegisterOnShutdown(broker.Close)
+	serverErr := make(chan error, 1)
 	go func() {
-		if err = http.ListenAndServe("localhost:6060", nil); err != nil {
-			log.Errorf("pprof server: %v", err)
+		log.Infof("server started on %s", cfg.Address)
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			serverErr <- err
 		}
 	}()
 
-	// --- старт ----------------------------------------------------------
-	log.Infof("server started on %s", cfg.Address)
-	if err = http.ListenAndServe(cfg.Address, router); err != nil {
-		log.Fatalf("error starting server: %v", err)
+	select {
+	case <-ctx.Done():
+		log.Info("shutdown signal received")
+	case err = <-serverErr:
+		log.Errorf("error starting server: %v", err)
 	}
 
-	<-ctx.Done()
-	_, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-
+	// --- остановка ------------------------------------------------------
+	shutdownCtx, cancel := context.WithTimeout(
+		context.Background(), cfg.ShutdownTimeout,
+	)
 	defer cancel()
 
+	// Shutdown перестаёт принимать новые соединения и ждёт завершения
+	// обрабатываемых запросов, поэтому сохранение идёт уже после него.
+	if err = server.Shutdown(shutdownCtx); err != nil {
+		log.Errorf("error shutting down server: %v", err)
+	}
+	if internalServer != nil {
+		if err = internalServer.Shutdown(shutdownCtx); err != nil {
+			log.Errorf("error shutting down internal server: %v", err)
+		}
+	}
+	if asyncAuditor != nil {
+		if err = asyncAuditor.Close(shutdownCtx); err != nil {
+			log.Errorf("error closing audit log: %v", err)
+		}
+	}
+
+	if flusher, ok := storage.(repositories.Flusher); ok {
+		if err = flusher.Flush(shutdownCtx); err != nil {
+			log.Errorf("error flushing storage: %v", err)
+		} else {
+			log.Info("storage flushed")
+		}
+	}
+
+	if closer, ok := storage.(io.Closer); ok {
+		if err = closer.Close(); err != nil {
+			log.Errorf("error closing storage: %v", err)
+		}
+	}
+
+	if fallback != nil {
+		if pending := fallback.PendingWrites(); pending > 0 {
+			log.Warnf("%d metrics received in fallback mode were not written to the database", pending)
+		}
+		if err = fallback.Close(); err != nil {
+			log.Errorf("error closing database: %v", err)
+		}
+	}
+
+	if dbConn != nil {
+		if err = dbConn.Close(); err != nil {
+			log.Errorf("error closing database: %v", err)
+		}
+	}
+
 	log.Info("server stopped gracefully")
 }
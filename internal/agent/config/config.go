@@ -1,44 +1,144 @@
 package config
 
 import (
-	log "github.com/sirupsen/logrus"
-	"github.com/spf13/viper"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Axel791/metricsalert/internal/shared/configloader"
 )
 
-// Config структура для хранения конфигурации
+// DefaultConfigFile - файл конфигурации, который читается, если путь
+// не задан флагом -c/-config или переменной CONFIG.
+const DefaultConfigFile = "agent_config.json"
+
+// Config - конфигурация агента.
 type Config struct {
-	Address   string `mapstructure:"ADDRESS"`
-	Key       string `mapstructure:"KEY"`
-	CryptoKey string `mapstructure:"CRYPTO_KEY"`
+	Address         string        `mapstructure:"address"`
+	ShutdownTimeout time.Duration `mapstructure:"shutdown_timeout"`
 
-	ReportInterval int64 `mapstructure:"REPORT_INTERVAL"`
-	PollInterval   int64 `mapstructure:"POLL_INTERVAL"`
-	RateLimit      int   `mapstructure:"RATE_LIMIT"`
+	Log        LogConfig        `mapstructure:"log"`
+	Security   SecurityConfig   `mapstructure:"security"`
+	Collectors CollectorsConfig `mapstructure:"collectors"`
+	Sender     SenderConfig     `mapstructure:"sender"`
 }
 
-// AgentLoadConfig загружает конфигурацию из .env, переменных окружения и задает значения по умолчанию
-func AgentLoadConfig() (*Config, error) {
-	viper.SetConfigName(".env")
-	viper.SetConfigType("env")
-	viper.AddConfigPath(".")
+// LogConfig - настройки логирования.
+type LogConfig struct {
+	Level  string `mapstructure:"level"`
+	Format string `mapstructure:"format"`
+}
+
+// SecurityConfig - ключи подписи и шифрования.
+type SecurityConfig struct {
+	Key       string `mapstructure:"key"`
+	CryptoKey string `mapstructure:"crypto_key"`
+}
 
-	viper.SetDefault("ADDRESS", "localhost:8080")
-	viper.SetDefault("REPORT_INTERVAL", 10)
-	viper.SetDefault("POLL_INTERVAL", 2)
+// CollectorsConfig - какие метрики собирать и как часто.
+type CollectorsConfig struct {
+	PollInterval time.Duration `mapstructure:"poll_interval"`
+	Runtime      bool          `mapstructure:"runtime"`
+	System       bool          `mapstructure:"system"`
+}
 
-	_ = viper.BindEnv("KEY", "KEY")
-	_ = viper.BindEnv("CRYPTO_KEY", "CRYPTO_KEY")
-	_ = viper.BindEnv("RATE_LIMIT", "RATE_LIMIT")
+// SenderConfig - настройки отправки метрик на сервер.
+type SenderConfig struct {
+	ReportInterval time.Duration `mapstructure:"report_interval"`
+	RateLimit      int           `mapstructure:"rate_limit"`
+	SpoolPath      string        `mapstructure:"spool_path"`
+	// AgentID - идентификатор агента в заголовке X-Agent-ID. По умолчанию -
+	// имя хоста.
+	AgentID string `mapstructure:"agent_id"`
+}
 
-	viper.AutomaticEnv()
+// Options возвращает описание всех настроек агента.
+func Options() []configloader.Option {
+	return []configloader.Option{
+		{Key: "address", Env: "ADDRESS", Flag: "a", Usage: "HTTP server address", Default: "localhost:8080"},
+		{
+			Key: "shutdown_timeout", Env: "SHUTDOWN_TIMEOUT", Flag: "shutdown-timeout",
+			Usage: "deadline for sending the final batch on shutdown (seconds or duration)", Default: 5 * time.Second,
+		},
+		{Key: "log.level", Env: "LOG_LEVEL", Flag: "log-level", Usage: "log level", Default: "info"},
+		{Key: "log.format", Env: "LOG_FORMAT", Flag: "log-format", Usage: "log format: json or text", Default: "json"},
+		{Key: "security.key", Env: "KEY", Flag: "k", Usage: "secret key", Default: "", Secret: true},
+		{
+			Key: "security.crypto_key", Env: "CRYPTO_KEY", Flag: "crypto-key",
+			Usage: "path to PEM public key for RSA encryption", Default: "",
+		},
+		{
+			Key: "collectors.poll_interval", Env: "POLL_INTERVAL", Flag: "p",
+			Usage: "frequency of collecting metrics (seconds or duration)", Default: 2 * time.Second,
+		},
+		{
+			Key: "collectors.runtime", Env: "COLLECT_RUNTIME",
+			Usage: "collect Go runtime metrics", Default: true,
+		},
+		{
+			Key: "collectors.system", Env: "COLLECT_SYSTEM",
+			Usage: "collect memory and CPU metrics of the host", Default: true,
+		},
+		{
+			Key: "sender.report_interval", Env: "REPORT_INTERVAL", Flag: "r",
+			Usage: "frequency of sending metrics to the server (seconds or duration)", Default: 10 * time.Second,
+		},
+		{Key: "sender.rate_limit", Env: "RATE_LIMIT", Flag: "l", Usage: "rate limit", Default: 1},
+		{
+			Key: "sender.spool_path", Env: "SPOOL_PATH", Flag: "spool",
+			Usage:   "file for batches that could not be sent on shutdown (empty disables)",
+			Default: "./agent_spool.json",
+		},
+		{
+			Key: "sender.agent_id", Env: "AGENT_ID", Flag: "agent-id",
+			Usage: "agent identity sent to the server for auditing (default: host name)", Default: "",
+		},
+	}
+}
 
-	if err := viper.ReadInConfig(); err != nil {
-		log.Infof("filed to find conf file, set default value: %v.", err)
+// AgentLoadConfig собирает конфигурацию из флагов args, переменных окружения,
+// файла .env, файла конфигурации и значений по умолчанию.
+func AgentLoadConfig(args []string) (*Config, *configloader.Loader, error) {
+	loader := configloader.New(Options(), DefaultConfigFile)
+	if err := loader.Load("agent", args); err != nil {
+		return nil, nil, err
 	}
+
 	var cfg Config
-	if err := viper.Unmarshal(&cfg); err != nil {
-		return nil, err
+	if err := loader.Decode(&cfg); err != nil {
+		return nil, nil, fmt.Errorf("decode config: %w", err)
 	}
+	cfg.Address = NormalizeAddress(cfg.Address)
+	if cfg.Sender.AgentID == "" {
+		// Без имени хоста агент просто не представляется серверу.
+		cfg.Sender.AgentID, _ = os.Hostname()
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, nil, err
+	}
+	return &cfg, loader, nil
+}
+
+// Validate проверяет значения, при которых агент не сможет работать.
+func (c *Config) Validate() error {
+	if c.Collectors.PollInterval <= 0 {
+		return fmt.Errorf("poll interval must be positive, got %s", c.Collectors.PollInterval)
+	}
+	if c.Sender.ReportInterval <= 0 {
+		return fmt.Errorf("report interval must be positive, got %s", c.Sender.ReportInterval)
+	}
+	if c.Sender.RateLimit <= 0 {
+		return fmt.Errorf("rate limit must be positive, got %d", c.Sender.RateLimit)
+	}
+	return nil
+}
 
-	return &cfg, nil
+// NormalizeAddress добавляет схему http://, если адрес задан без неё.
+func NormalizeAddress(addr string) string {
+	if !strings.HasPrefix(addr, "http://") && !strings.HasPrefix(addr, "https://") {
+		return "http://" + addr
+	}
+	return addr
 }
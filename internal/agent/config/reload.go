@@ -0,0 +1,34 @@
+package config
+
+import (
+	"github.com/Axel791/metricsalert/internal/shared"
+)
+
+// Diff сравнивает две конфигурации. Интервалы, число воркеров, уровень
+// логирования и таймаут остановки применяются на лету, остальное требует перезапуска.
+func Diff(oldCfg, newCfg *Config) []shared.Change {
+	var changes []shared.Change
+
+	changes = shared.CompareSetting(changes, "log.level", oldCfg.Log.Level, newCfg.Log.Level, true)
+	changes = shared.CompareSetting(changes, "log.format", oldCfg.Log.Format, newCfg.Log.Format, true)
+	changes = shared.CompareSetting(
+		changes, "collectors.poll_interval", oldCfg.Collectors.PollInterval, newCfg.Collectors.PollInterval, true,
+	)
+	changes = shared.CompareSetting(
+		changes, "sender.report_interval", oldCfg.Sender.ReportInterval, newCfg.Sender.ReportInterval, true,
+	)
+	changes = shared.CompareSetting(changes, "sender.rate_limit", oldCfg.Sender.RateLimit, newCfg.Sender.RateLimit, true)
+	changes = shared.CompareSetting(changes, "shutdown_timeout", oldCfg.ShutdownTimeout, newCfg.ShutdownTimeout, true)
+
+	changes = shared.CompareSetting(changes, "address", oldCfg.Address, newCfg.Address, false)
+	changes = shared.CompareSetting(changes, "collectors.runtime", oldCfg.Collectors.Runtime, newCfg.Collectors.Runtime, false)
+	changes = shared.CompareSetting(changes, "collectors.system", oldCfg.Collectors.System, newCfg.Collectors.System, false)
+	changes = shared.CompareSetting(changes, "sender.spool_path", oldCfg.Sender.SpoolPath, newCfg.Sender.SpoolPath, false)
+	changes = shared.CompareSetting(changes, "sender.agent_id", oldCfg.Sender.AgentID, newCfg.Sender.AgentID, false)
+	changes = shared.CompareSecret(changes, "security.key", oldCfg.Security.Key, newCfg.Security.Key, false)
+	changes = shared.CompareSetting(
+		changes, "security.crypto_key", oldCfg.Security.CryptoKey, newCfg.Security.CryptoKey, false,
+	)
+
+	return changes
+}
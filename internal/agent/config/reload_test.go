@@ -0,0 +1,77 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Axel791/metricsalert/internal/shared"
+)
+
+func TestDiff(t *testing.T) {
+	tests := []struct {
+		name     string
+		change   func(cfg *Config)
+		expected []shared.Change
+	}{
+		{
+			name:     "no changes",
+			change:   func(*Config) {},
+			expected: nil,
+		},
+		{
+			name:   "poll interval is applied on the fly",
+			change: func(cfg *Config) { cfg.Collectors.PollInterval = time.Second },
+			expected: []shared.Change{
+				{Name: "collectors.poll_interval", Old: 2 * time.Second, New: time.Second, Hot: true},
+			},
+		},
+		{
+			name:   "rate limit is applied on the fly",
+			change: func(cfg *Config) { cfg.Sender.RateLimit = 4 },
+			expected: []shared.Change{
+				{Name: "sender.rate_limit", Old: 1, New: 4, Hot: true},
+			},
+		},
+		{
+			name:   "collectors require restart",
+			change: func(cfg *Config) { cfg.Collectors.System = false },
+			expected: []shared.Change{
+				{Name: "collectors.system", Old: true, New: false, Hot: false},
+			},
+		},
+		{
+			name:   "signing key is masked",
+			change: func(cfg *Config) { cfg.Security.Key = "secret" },
+			expected: []shared.Change{
+				{Name: "security.key", Old: "***", New: "***", Hot: false},
+			},
+		},
+		{
+			name: "hot and restart-only changes together",
+			change: func(cfg *Config) {
+				cfg.Sender.ReportInterval = 5 * time.Second
+				cfg.Address = "localhost:9090"
+			},
+			expected: []shared.Change{
+				{Name: "sender.report_interval", Old: 10 * time.Second, New: 5 * time.Second, Hot: true},
+				{Name: "address", Old: "localhost:8080", New: "localhost:9090", Hot: false},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			oldCfg := &Config{
+				Address:    "localhost:8080",
+				Collectors: CollectorsConfig{PollInterval: 2 * time.Second, Runtime: true, System: true},
+				Sender:     SenderConfig{ReportInterval: 10 * time.Second, RateLimit: 1},
+			}
+			newCfg := *oldCfg
+			tt.change(&newCfg)
+
+			assert.Equal(t, tt.expected, Diff(oldCfg, &newCfg))
+		})
+	}
+}
@@ -42,3 +42,25 @@ type MetricPost struct {
 	Delta *int64   `json:"delta,omitempty"`
 	Value *float64 `json:"value,omitempty"`
 }
+
+// BatchResponse - ответ сервера на пачку /updates.
+type BatchResponse struct {
+	Accepted []BatchItem      `json:"accepted"`
+	Rejected []RejectedMetric `json:"rejected"`
+}
+
+// BatchItem - метрика пачки, принятая сервером.
+type BatchItem struct {
+	Index int    `json:"index"`
+	ID    string `json:"id"`
+	MType string `json:"type"`
+}
+
+// RejectedMetric - метрика пачки, отклонённая сервером, с кодом причины.
+type RejectedMetric struct {
+	Index int    `json:"index"`
+	ID    string `json:"id"`
+	MType string `json:"type"`
+	Code  string `json:"code"`
+	Error string `json:"error"`
+}
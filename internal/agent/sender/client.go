@@ -3,6 +3,7 @@ package sender
 import (
 	"bytes"
 	"compress/gzip"
+	"context"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/sha256"
@@ -10,6 +11,7 @@ import (
 	"fmt"
 	"net/http"
 	"net/url"
+	"strings"
 	"time"
 
 	"github.com/Axel791/metricsalert/internal/agent/services"
@@ -18,6 +20,8 @@ import (
 	log "github.com/sirupsen/logrus"
 
 	"github.com/Axel791/metricsalert/internal/agent/model/api"
+	"github.com/Axel791/metricsalert/internal/shared"
+	"github.com/Axel791/metricsalert/internal/shared/logging"
 )
 
 const (
@@ -26,19 +30,36 @@ const (
 	maxInterval = 5 * time.Second
 )
 
+// Collectors - включённые сборщики метрик. В пачку попадают только метрики
+// включённых сборщиков, чтобы выключенный сборщик не присылал нули.
+type Collectors struct {
+	// Runtime - метрики runtime.MemStats, PollCount и RandomValue.
+	Runtime bool
+	// System - TotalMemory и FreeMemory.
+	System bool
+}
+
+// AllCollectors включает все сборщики.
+var AllCollectors = Collectors{Runtime: true, System: true}
+
 type MetricClient struct {
 	httpClient  *httpclient.Client
 	logger      *log.Logger
 	authService services.AuthService
 	baseURL     string
 	pubKey      *rsa.PublicKey
+	agentID     string
+	collectors  Collectors
 }
 
+// NewMetricClient создаёт клиента сервера метрик. Непустой agentID
+// передаётся в заголовке X-Agent-ID каждой пачки.
 func NewMetricClient(
 	baseURL string,
 	logger *log.Logger,
 	authService services.AuthService,
 	pubKey *rsa.PublicKey,
+	agentID string,
 ) *MetricClient {
 	client := httpclient.NewClient()
 	return &MetricClient{
@@ -47,55 +68,94 @@ func NewMetricClient(
 		baseURL:     baseURL,
 		logger:      logger,
 		pubKey:      pubKey,
+		agentID:     agentID,
+		collectors:  AllCollectors,
 	}
 }
 
+// SetCollectors задаёт сборщики, метрики которых отправляет SendMetrics.
+// По умолчанию включены все. Вызывается до начала отправки.
+func (client *MetricClient) SetCollectors(collectors Collectors) {
+	client.collectors = collectors
+}
+
+// SendMetrics отправляет снимок метрик на сервер.
 func (client *MetricClient) SendMetrics(metrics api.Metrics) error {
-	metricsList := []api.MetricPost{
-		{ID: "Alloc", MType: "gauge", Value: &metrics.Alloc},
-		{ID: "BuckHashSys", MType: "gauge", Value: &metrics.BuckHashSys},
-		{ID: "Frees", MType: "gauge", Value: &metrics.Frees},
-		{ID: "GCCPUFraction", MType: "gauge", Value: &metrics.GCCPUFraction},
-		{ID: "GCSys", MType: "gauge", Value: &metrics.GCSys},
-		{ID: "HeapAlloc", MType: "gauge", Value: &metrics.HeapAlloc},
-		{ID: "HeapIdle", MType: "gauge", Value: &metrics.HeapIdle},
-		{ID: "HeapInuse", MType: "gauge", Value: &metrics.HeapInuse},
-		{ID: "HeapObjects", MType: "gauge", Value: &metrics.HeapObjects},
-		{ID: "HeapReleased", MType: "gauge", Value: &metrics.HeapReleased},
-		{ID: "HeapSys", MType: "gauge", Value: &metrics.HeapSys},
-		{ID: "LastGC", MType: "gauge", Value: &metrics.LastGC},
-		{ID: "Lookups", MType: "gauge", Value: &metrics.Lookups},
-		{ID: "MCacheInuse", MType: "gauge", Value: &metrics.MCacheInuse},
-		{ID: "MSpanInuse", MType: "gauge", Value: &metrics.MSpanInuse},
-		{ID: "MSpanSys", MType: "gauge", Value: &metrics.MSpanSys},
-		{ID: "Mallocs", MType: "gauge", Value: &metrics.Mallocs},
-		{ID: "NextGC", MType: "gauge", Value: &metrics.NextGC},
-		{ID: "NumGC", MType: "gauge", Value: &metrics.NumGC},
-		{ID: "NumForcedGC", MType: "gauge", Value: &metrics.NumForcedGC},
-		{ID: "OtherSys", MType: "gauge", Value: &metrics.OtherSys},
-		{ID: "PauseTotalNs", MType: "gauge", Value: &metrics.PauseTotalNs},
-		{ID: "StackInuse", MType: "gauge", Value: &metrics.StackInuse},
-		{ID: "Sys", MType: "gauge", Value: &metrics.Sys},
-		{ID: "MCacheSys", MType: "gauge", Value: &metrics.MCacheSys},
-		{ID: "StackSys", MType: "gauge", Value: &metrics.StackSys},
-		{ID: "TotalAlloc", MType: "gauge", Value: &metrics.TotalAlloc},
-		{ID: "PollCount", MType: "counter", Delta: &metrics.PollCount},
-		{ID: "RandomValue", MType: "gauge", Value: &metrics.RandomValue},
-		{ID: "TotalMemory", MType: "gauge", Value: &metrics.TotalMemory},
-		{ID: "FreeMemory", MType: "gauge", Value: &metrics.FreeMemory},
-	}
-
-	if err := client.healthCheck(); err != nil {
-		return fmt.Errorf("health check failed: %w", err)
+	return client.SendMetricsContext(context.Background(), metrics)
+}
+
+// SendMetricsContext отправляет снимок метрик, прерываясь при отмене ctx.
+func (client *MetricClient) SendMetricsContext(ctx context.Context, metrics api.Metrics) error {
+	return client.SendBatch(ctx, BuildMetricsList(metrics, client.collectors))
+}
+
+// SendBatch отправляет готовую пачку метрик, прерываясь при отмене ctx.
+// Каждой пачке присваивается свой идентификатор запроса: он уходит на сервер
+// в заголовке X-Request-ID и попадает во все записи лога об этой отправке.
+// Пустая пачка не отправляется.
+func (client *MetricClient) SendBatch(ctx context.Context, metricsList []api.MetricPost) error {
+	if len(metricsList) == 0 {
+		return nil
 	}
+	requestID := logging.NewRequestID()
+	ctx = logging.WithRequestID(ctx, requestID)
+	ctx = logging.WithLogger(ctx, client.logger.WithField(logging.RequestIDField, requestID))
 
-	if err := client.healthCheck(); err != nil {
+	if err := client.healthCheck(ctx); err != nil {
 		return fmt.Errorf("health check failed: %w", err)
 	}
-	return client.sendMetricsBatch(metricsList)
+	return client.sendMetricsBatch(ctx, metricsList)
+}
+
+// BuildMetricsList раскладывает снимок метрик в пачку для /updates. В пачку
+// попадают только метрики включённых сборщиков collectors. PollCount в
+// снимке - приращение с прошлого отчёта (см. PollCountTracker), сервер
+// прибавляет его к своему значению.
+func BuildMetricsList(metrics api.Metrics, collectors Collectors) []api.MetricPost {
+	var list []api.MetricPost
+	if collectors.Runtime {
+		list = append(list,
+			api.MetricPost{ID: "Alloc", MType: "gauge", Value: &metrics.Alloc},
+			api.MetricPost{ID: "BuckHashSys", MType: "gauge", Value: &metrics.BuckHashSys},
+			api.MetricPost{ID: "Frees", MType: "gauge", Value: &metrics.Frees},
+			api.MetricPost{ID: "GCCPUFraction", MType: "gauge", Value: &metrics.GCCPUFraction},
+			api.MetricPost{ID: "GCSys", MType: "gauge", Value: &metrics.GCSys},
+			api.MetricPost{ID: "HeapAlloc", MType: "gauge", Value: &metrics.HeapAlloc},
+			api.MetricPost{ID: "HeapIdle", MType: "gauge", Value: &metrics.HeapIdle},
+			api.MetricPost{ID: "HeapInuse", MType: "gauge", Value: &metrics.HeapInuse},
+			api.MetricPost{ID: "HeapObjects", MType: "gauge", Value: &metrics.HeapObjects},
+			api.MetricPost{ID: "HeapReleased", MType: "gauge", Value: &metrics.HeapReleased},
+			api.MetricPost{ID: "HeapSys", MType: "gauge", Value: &metrics.HeapSys},
+			api.MetricPost{ID: "LastGC", MType: "gauge", Value: &metrics.LastGC},
+			api.MetricPost{ID: "Lookups", MType: "gauge", Value: &metrics.Lookups},
+			api.MetricPost{ID: "MCacheInuse", MType: "gauge", Value: &metrics.MCacheInuse},
+			api.MetricPost{ID: "MSpanInuse", MType: "gauge", Value: &metrics.MSpanInuse},
+			api.MetricPost{ID: "MSpanSys", MType: "gauge", Value: &metrics.MSpanSys},
+			api.MetricPost{ID: "Mallocs", MType: "gauge", Value: &metrics.Mallocs},
+			api.MetricPost{ID: "NextGC", MType: "gauge", Value: &metrics.NextGC},
+			api.MetricPost{ID: "NumGC", MType: "gauge", Value: &metrics.NumGC},
+			api.MetricPost{ID: "NumForcedGC", MType: "gauge", Value: &metrics.NumForcedGC},
+			api.MetricPost{ID: "OtherSys", MType: "gauge", Value: &metrics.OtherSys},
+			api.MetricPost{ID: "PauseTotalNs", MType: "gauge", Value: &metrics.PauseTotalNs},
+			api.MetricPost{ID: "StackInuse", MType: "gauge", Value: &metrics.StackInuse},
+			api.MetricPost{ID: "Sys", MType: "gauge", Value: &metrics.Sys},
+			api.MetricPost{ID: "MCacheSys", MType: "gauge", Value: &metrics.MCacheSys},
+			api.MetricPost{ID: "StackSys", MType: "gauge", Value: &metrics.StackSys},
+			api.MetricPost{ID: "TotalAlloc", MType: "gauge", Value: &metrics.TotalAlloc},
+			api.MetricPost{ID: "PollCount", MType: "counter", Delta: &metrics.PollCount},
+			api.MetricPost{ID: "RandomValue", MType: "gauge", Value: &metrics.RandomValue},
+		)
+	}
+	if collectors.System {
+		list = append(list,
+			api.MetricPost{ID: "TotalMemory", MType: "gauge", Value: &metrics.TotalMemory},
+			api.MetricPost{ID: "FreeMemory", MType: "gauge", Value: &metrics.FreeMemory},
+		)
+	}
+	return list
 }
 
-func (client *MetricClient) sendMetricsBatch(metricsList []api.MetricPost) error {
+func (client *MetricClient) sendMetricsBatch(ctx context.Context, metricsList []api.MetricPost) error {
 	body, err := json.Marshal(metricsList)
 	if err != nil {
 		return fmt.Errorf("failed to marshal metrics batch: %w", err)
@@ -108,6 +168,12 @@ func (client *MetricClient) sendMetricsBatch(metricsList []api.MetricPost) error
 	headers := http.Header{}
 	headers.Set("Content-Type", "application/json")
 	headers.Set("Content-Encoding", "gzip")
+	if requestID := logging.RequestIDFromContext(ctx); requestID != "" {
+		headers.Set(logging.RequestIDHeader, requestID)
+	}
+	if client.agentID != "" {
+		headers.Set(shared.AgentIDHeader, client.agentID)
+	}
 
 	payload := compressedBody
 
@@ -131,7 +197,13 @@ func (client *MetricClient) sendMetricsBatch(metricsList []api.MetricPost) error
 		return fmt.Errorf("failed to parse URL: %w", err)
 	}
 
-	rsp, err := client.httpClient.Post(u.String(), bytes.NewBuffer(payload), headers)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u.String(), bytes.NewBuffer(payload))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header = headers
+
+	rsp, err := client.httpClient.Do(req)
 	if err != nil {
 		return fmt.Errorf("failed to send metrics batch: %w", err)
 	}
@@ -141,34 +213,68 @@ func (client *MetricClient) sendMetricsBatch(metricsList []api.MetricPost) error
 		return fmt.Errorf("unexpected status code: %d", rsp.StatusCode)
 	}
 
-	client.logger.Infof("Successfully sent metrics batch: %d metrics", len(metricsList))
+	rejected := client.logRejected(ctx, rsp)
+	logging.Entry(ctx, client.logger).Infof(
+		"Successfully sent metrics batch: %d metrics, %d rejected", len(metricsList)-rejected, rejected,
+	)
 	return nil
 }
-func (client *MetricClient) healthCheck() error {
+
+// logRejected разбирает ответ сервера на пачку и логирует отклонённые метрики.
+// Такие метрики некорректны и не отправляются повторно: остальная пачка уже
+// сохранена. Возвращает число отклонённых метрик.
+func (client *MetricClient) logRejected(ctx context.Context, rsp *http.Response) int {
+	if !strings.HasPrefix(rsp.Header.Get("Content-Type"), "application/json") {
+		// Сервер без поддержки частичного приёма отвечает пустым телом.
+		return 0
+	}
+
+	logger := logging.Entry(ctx, client.logger)
+	var result api.BatchResponse
+	if err := json.NewDecoder(rsp.Body).Decode(&result); err != nil {
+		logger.Warnf("failed to decode metrics batch response: %v", err)
+		return 0
+	}
+	for _, item := range result.Rejected {
+		logger.WithFields(log.Fields{
+			"metric": item.ID,
+			"type":   item.MType,
+			"index":  item.Index,
+			"code":   item.Code,
+		}).Warnf("metric rejected by server, dropped: %s", item.Error)
+	}
+	return len(result.Rejected)
+}
+
+func (client *MetricClient) healthCheck(ctx context.Context) error {
 	u, err := url.Parse(fmt.Sprintf("%s/healthcheck", client.baseURL))
 	if err != nil {
 		return fmt.Errorf("failed to parse URL: %w", err)
 	}
 
-	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
 	if err != nil {
 		return fmt.Errorf("failed to create request: %w", err)
 	}
+	if requestID := logging.RequestIDFromContext(ctx); requestID != "" {
+		req.Header.Set(logging.RequestIDHeader, requestID)
+	}
 
+	logger := logging.Entry(ctx, client.logger)
 	retries := 0
 	interval := minInterval
 
 	for retries < maxRetries {
 		rsp, err := client.httpClient.Do(req)
 		if err != nil {
-			log.Infof("failed to send healthcheck request (attempt %d/%d): %v", retries+1, maxRetries, err)
+			logger.Warnf("failed to send healthcheck request (attempt %d/%d): %v", retries+1, maxRetries, err)
 		} else {
-			defer rsp.Body.Close()
+			rsp.Body.Close()
 
 			if rsp.StatusCode == http.StatusOK {
 				return nil
 			}
-			log.Infof(
+			logger.Warnf(
 				"unexpected status code during health check: %d (attempt %d/%d)",
 				rsp.StatusCode,
 				retries+1,
@@ -185,7 +291,11 @@ func (client *MetricClient) healthCheck() error {
 			}
 		}
 
-		time.Sleep(interval)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(interval):
+		}
 	}
 
 	return fmt.Errorf("health check failed after %d attempts", retries)
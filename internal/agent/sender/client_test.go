@@ -1,11 +1,19 @@
 package sender
 
 import (
+	"context"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 
 	"github.com/Axel791/metricsalert/internal/agent/model/api"
 	"github.com/Axel791/metricsalert/internal/agent/sender/mocks"
+	"github.com/Axel791/metricsalert/internal/agent/services"
+	"github.com/Axel791/metricsalert/internal/shared"
 
+	log "github.com/sirupsen/logrus"
+	logtest "github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
@@ -24,3 +32,65 @@ func TestSendMetrics(t *testing.T) {
 	require.NoError(t, err)
 	mockClient.AssertExpectations(t)
 }
+
+func TestSendBatch_LogsRejectedMetrics(t *testing.T) {
+	var agentID string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/healthcheck" {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		agentID = r.Header.Get(shared.AgentIDHeader)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"accepted":[{"index":0,"id":"Alloc","type":"gauge"}],` +
+			`"rejected":[{"index":1,"id":"_server.x","type":"gauge","code":"reserved_name","error":"reserved"}]}`))
+	}))
+	defer server.Close()
+
+	logger, hook := logtest.NewNullLogger()
+	client := NewMetricClient(server.URL, logger, services.NewAuthServiceHandler(""), nil, "agent-1")
+
+	value := 1.5
+	err := client.SendBatch(context.Background(), []api.MetricPost{
+		{ID: "Alloc", MType: "gauge", Value: &value},
+		{ID: "_server.x", MType: "gauge", Value: &value},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "agent-1", agentID)
+
+	var rejected []*log.Entry
+	for _, entry := range hook.AllEntries() {
+		if entry.Level == log.WarnLevel {
+			rejected = append(rejected, entry)
+		}
+	}
+	require.Len(t, rejected, 1)
+	assert.Equal(t, "_server.x", rejected[0].Data["metric"])
+	assert.Equal(t, "reserved_name", rejected[0].Data["code"])
+	assert.Contains(t, hook.LastEntry().Message, "1 metrics, 1 rejected")
+}
+
+func TestBuildMetricsList_OnlyEnabledCollectors(t *testing.T) {
+	metrics := api.Metrics{Alloc: 1, PollCount: 2, TotalMemory: 3}
+
+	ids := func(list []api.MetricPost) []string {
+		var out []string
+		for _, metric := range list {
+			out = append(out, metric.ID)
+		}
+		return out
+	}
+
+	all := BuildMetricsList(metrics, AllCollectors)
+	assert.Len(t, all, 31)
+
+	system := ids(BuildMetricsList(metrics, Collectors{System: true}))
+	assert.Equal(t, []string{"TotalMemory", "FreeMemory"}, system)
+
+	runtime := ids(BuildMetricsList(metrics, Collectors{Runtime: true}))
+	assert.Len(t, runtime, 29)
+	assert.Contains(t, runtime, "PollCount")
+	assert.NotContains(t, runtime, "TotalMemory")
+
+	assert.Empty(t, BuildMetricsList(metrics, Collectors{}))
+}
@@ -0,0 +1,32 @@
+package sender
+
+import "sync/atomic"
+
+// PollCountTracker переводит накопленный агентом PollCount в приращения.
+// PollCount - counter: сервер прибавляет присланное значение к своему,
+// поэтому каждая пачка несёт только приращение с прошлого отчёта, а не
+// весь счётчик.
+type PollCountTracker struct {
+	// taken - PollCount, уже разложенный по снимкам отчётов.
+	taken atomic.Int64
+	// delivered - сумма приращений, которые сервер принял.
+	delivered atomic.Int64
+}
+
+// Take возвращает приращение PollCount с прошлого отчёта для снимка с
+// накопленным значением total.
+func (t *PollCountTracker) Take(total int64) int64 {
+	return total - t.taken.Swap(total)
+}
+
+// Delivered отмечает приращение delta принятым сервером.
+func (t *PollCountTracker) Delivered(delta int64) {
+	t.delivered.Add(delta)
+}
+
+// Undelivered возвращает часть накопленного total, которую сервер ещё не
+// принял: приращения неотправленных и неудачно отправленных отчётов и то,
+// что собрано после последнего отчёта.
+func (t *PollCountTracker) Undelivered(total int64) int64 {
+	return total - t.delivered.Load()
+}
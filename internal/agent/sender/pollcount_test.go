@@ -0,0 +1,70 @@
+package sender
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	logtest "github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Axel791/metricsalert/internal/agent/model/api"
+	"github.com/Axel791/metricsalert/internal/agent/services"
+)
+
+func TestPollCountTracker_ServerSumMatchesCollected(t *testing.T) {
+	var (
+		mu  sync.Mutex
+		sum int64
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/healthcheck" {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		reader, err := gzip.NewReader(r.Body)
+		require.NoError(t, err)
+		var batch []api.MetricPost
+		require.NoError(t, json.NewDecoder(reader).Decode(&batch))
+
+		mu.Lock()
+		for _, metric := range batch {
+			if metric.ID == "PollCount" {
+				sum += *metric.Delta
+			}
+		}
+		mu.Unlock()
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	logger, _ := logtest.NewNullLogger()
+	client := NewMetricClient(server.URL, logger, services.NewAuthServiceHandler(""), nil, "")
+	collectors := Collectors{Runtime: true}
+
+	var tracker PollCountTracker
+	report := func(total int64, send bool) {
+		snapshot := api.Metrics{PollCount: tracker.Take(total)}
+		if !send {
+			return
+		}
+		require.NoError(t, client.SendMetrics(snapshot))
+		tracker.Delivered(snapshot.PollCount)
+	}
+
+	report(3, true)
+	report(5, true)
+	// Снимок остался в очереди при остановке агента.
+	report(8, false)
+
+	final := api.Metrics{PollCount: tracker.Undelivered(10)}
+	require.NoError(t, client.SendBatch(context.Background(), BuildMetricsList(final, collectors)))
+
+	assert.Equal(t, int64(5), final.PollCount)
+	assert.Equal(t, int64(10), sum)
+}
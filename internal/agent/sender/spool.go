@@ -0,0 +1,99 @@
+package sender
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/Axel791/metricsalert/internal/agent/model/api"
+	"github.com/Axel791/metricsalert/internal/shared/fileutil"
+)
+
+// Spool хранит на диске пачки метрик, которые не удалось отправить,
+// чтобы агент дослал их при следующем запуске.
+type Spool struct {
+	path  string
+	mutex sync.Mutex
+}
+
+// NewSpool создаёт спул в файле path. Пустой путь отключает спул.
+func NewSpool(path string) *Spool {
+	return &Spool{path: path}
+}
+
+// Enabled сообщает, задан ли файл спула.
+func (s *Spool) Enabled() bool {
+	return s.path != ""
+}
+
+// Save дописывает пачку к уже сохранённым. Файл заменяется атомарно,
+// чтобы падение во время записи не испортило предыдущие пачки.
+func (s *Spool) Save(batch []api.MetricPost) error {
+	if !s.Enabled() {
+		return errors.New("spool is disabled")
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	batches, err := s.read()
+	if err != nil {
+		return err
+	}
+	batches = append(batches, batch)
+
+	data, err := json.Marshal(batches)
+	if err != nil {
+		return fmt.Errorf("marshal spool: %w", err)
+	}
+
+	if err = fileutil.WriteFileAtomic(s.path, data); err != nil {
+		return fmt.Errorf("write spool: %w", err)
+	}
+	return nil
+}
+
+// Load возвращает все сохранённые пачки. Отсутствие файла не ошибка.
+func (s *Spool) Load() ([][]api.MetricPost, error) {
+	if !s.Enabled() {
+		return nil, nil
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.read()
+}
+
+// Clear удаляет файл спула после успешной досылки.
+func (s *Spool) Clear() error {
+	if !s.Enabled() {
+		return nil
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if err := os.Remove(s.path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("remove spool: %w", err)
+	}
+	return nil
+}
+
+func (s *Spool) read() ([][]api.MetricPost, error) {
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("read spool: %w", err)
+	}
+
+	var batches [][]api.MetricPost
+	if err = json.Unmarshal(data, &batches); err != nil {
+		return nil, fmt.Errorf("parse spool: %w", err)
+	}
+	return batches, nil
+}
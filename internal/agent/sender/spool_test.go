@@ -0,0 +1,43 @@
+package sender
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/Axel791/metricsalert/internal/agent/model/api"
+)
+
+func TestSpool(t *testing.T) {
+	spool := NewSpool(filepath.Join(t.TempDir(), "spool.json"))
+
+	batches, err := spool.Load()
+	require.NoError(t, err)
+	require.Empty(t, batches)
+
+	alloc := 1024.0
+	pollCount := int64(5)
+	require.NoError(t, spool.Save([]api.MetricPost{{ID: "Alloc", MType: "gauge", Value: &alloc}}))
+	require.NoError(t, spool.Save([]api.MetricPost{{ID: "PollCount", MType: "counter", Delta: &pollCount}}))
+
+	batches, err = spool.Load()
+	require.NoError(t, err)
+	require.Len(t, batches, 2)
+	require.Equal(t, "Alloc", batches[0][0].ID)
+	require.Equal(t, alloc, *batches[0][0].Value)
+	require.Equal(t, pollCount, *batches[1][0].Delta)
+
+	require.NoError(t, spool.Clear())
+	batches, err = spool.Load()
+	require.NoError(t, err)
+	require.Empty(t, batches)
+}
+
+func TestSpoolDisabled(t *testing.T) {
+	spool := NewSpool("")
+
+	require.False(t, spool.Enabled())
+	require.Error(t, spool.Save(nil))
+	require.NoError(t, spool.Clear())
+}
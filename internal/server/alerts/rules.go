@@ -0,0 +1,58 @@
+// Package alerts описывает правила алертов из конфигурации сервера и
+// проверяет по ним значения метрик, показанные на панели.
+package alerts
+
+import (
+	"fmt"
+
+	"github.com/Axel791/metricsalert/internal/server/model/domain"
+)
+
+// Rule - правило алерта: метрика Metric типа Type срабатывает, когда
+// её значение в отношении Op к Threshold истинно.
+//
+// Пример в YAML-файле конфигурации:
+//
+//	alerts:
+//	  rules:
+//	    - metric: HeapAlloc
+//	      type: gauge
+//	      op: ">"
+//	      threshold: 524288
+type Rule struct {
+	Metric    string  `mapstructure:"metric"`
+	Type      string  `mapstructure:"type"`
+	Op        string  `mapstructure:"op"`
+	Threshold float64 `mapstructure:"threshold"`
+}
+
+// String возвращает правило в читаемом виде для логов.
+func (r Rule) String() string {
+	return fmt.Sprintf("%s(%s) %s %g", r.Metric, r.Type, r.Op, r.Threshold)
+}
+
+// Validate проверяет корректность правила.
+func (r Rule) Validate() error {
+	if r.Metric == "" {
+		return fmt.Errorf("alert rule: metric is required")
+	}
+	if r.Type != domain.Gauge && r.Type != domain.Counter {
+		return fmt.Errorf("alert rule %s: invalid metric type %q", r.Metric, r.Type)
+	}
+	switch r.Op {
+	case ">", ">=", "<", "<=", "==", "!=":
+	default:
+		return fmt.Errorf("alert rule %s: invalid operator %q", r.Metric, r.Op)
+	}
+	return nil
+}
+
+// ValidateRules проверяет набор правил.
+func ValidateRules(rules []Rule) error {
+	for _, rule := range rules {
+		if err := rule.Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,15 @@
+package alerts
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/Axel791/metricsalert/internal/server/model/domain"
+)
+
+func TestRuleValidate(t *testing.T) {
+	require.Error(t, Rule{Type: domain.Gauge, Op: ">"}.Validate())
+	require.Error(t, Rule{Metric: "Alloc", Type: "histogram", Op: ">"}.Validate())
+	require.Error(t, Rule{Metric: "Alloc", Type: domain.Gauge, Op: "=>"}.Validate())
+}
@@ -0,0 +1,95 @@
+package alerts
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/Axel791/metricsalert/internal/server/model/domain"
+	"github.com/Axel791/metricsalert/internal/server/model/dto"
+)
+
+// Alert - сработавшее правило и значение метрики, на котором оно сработало.
+type Alert struct {
+	Rule   Rule
+	Metric dto.Metrics
+}
+
+// RuleSet - текущий набор правил из конфигурации. Правила заменяются при
+// перезагрузке конфигурации; RuleSet безопасен для конкурентного
+// использования.
+type RuleSet struct {
+	mutex sync.RWMutex
+	rules []Rule
+}
+
+// NewRuleSet создаёт RuleSet с начальным набором правил.
+func NewRuleSet(rules []Rule) *RuleSet {
+	return &RuleSet{rules: rules}
+}
+
+// SetRules заменяет набор правил.
+func (s *RuleSet) SetRules(rules []Rule) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.rules = rules
+}
+
+// Rules возвращает текущий набор правил.
+func (s *RuleSet) Rules() []Rule {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	return s.rules
+}
+
+// Evaluate проверяет значения metrics по правилам rules и возвращает
+// сработавшие алерты, упорядоченные по правилу.
+func Evaluate(rules []Rule, metrics []dto.Metrics) []Alert {
+	var firing []Alert
+	for _, rule := range rules {
+		for _, metric := range metrics {
+			if rule.Matches(metric) && rule.Firing(metric) {
+				firing = append(firing, Alert{Rule: rule, Metric: metric})
+			}
+		}
+	}
+	sort.SliceStable(firing, func(i, j int) bool {
+		return firing[i].Rule.String() < firing[j].Rule.String()
+	})
+	return firing
+}
+
+// Matches сообщает, относится ли правило к метрике.
+func (r Rule) Matches(metric dto.Metrics) bool {
+	return r.Metric == metric.ID && r.Type == metric.MType
+}
+
+// Firing сообщает, срабатывает ли правило на значении метрики.
+func (r Rule) Firing(metric dto.Metrics) bool {
+	var value float64
+	switch metric.MType {
+	case domain.Gauge:
+		value = metric.Value.Float64
+	case domain.Counter:
+		value = float64(metric.Delta.Int64)
+	default:
+		return false
+	}
+
+	switch r.Op {
+	case ">":
+		return value > r.Threshold
+	case ">=":
+		return value >= r.Threshold
+	case "<":
+		return value < r.Threshold
+	case "<=":
+		return value <= r.Threshold
+	case "==":
+		return value == r.Threshold
+	case "!=":
+		return value != r.Threshold
+	}
+	return false
+}
@@ -0,0 +1,60 @@
+package alerts
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/guregu/null.v4"
+
+	"github.com/Axel791/metricsalert/internal/server/model/domain"
+	"github.com/Axel791/metricsalert/internal/server/model/dto"
+)
+
+func TestRuleFiring(t *testing.T) {
+	gauge := dto.Metrics{ID: "HeapAlloc", MType: domain.Gauge, Value: null.FloatFrom(10)}
+	counter := dto.Metrics{ID: "PollCount", MType: domain.Counter, Delta: null.IntFrom(3)}
+
+	tests := []struct {
+		name   string
+		rule   Rule
+		metric dto.Metrics
+		firing bool
+	}{
+		{"gauge above", Rule{Metric: "HeapAlloc", Type: domain.Gauge, Op: ">", Threshold: 5}, gauge, true},
+		{"gauge below", Rule{Metric: "HeapAlloc", Type: domain.Gauge, Op: "<", Threshold: 5}, gauge, false},
+		{"counter equal", Rule{Metric: "PollCount", Type: domain.Counter, Op: "==", Threshold: 3}, counter, true},
+		{"counter at most", Rule{Metric: "PollCount", Type: domain.Counter, Op: "<=", Threshold: 2}, counter, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.NoError(t, tt.rule.Validate())
+			require.True(t, tt.rule.Matches(tt.metric))
+			require.Equal(t, tt.firing, tt.rule.Firing(tt.metric))
+		})
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	metrics := []dto.Metrics{
+		{ID: "HeapAlloc", MType: domain.Gauge, Value: null.FloatFrom(10)},
+		{ID: "HeapAlloc", MType: domain.Counter, Delta: null.IntFrom(10)},
+		{ID: "PollCount", MType: domain.Counter, Delta: null.IntFrom(3)},
+	}
+	rules := NewRuleSet([]Rule{
+		{Metric: "PollCount", Type: domain.Counter, Op: ">", Threshold: 1},
+		{Metric: "HeapAlloc", Type: domain.Gauge, Op: ">", Threshold: 5},
+		{Metric: "HeapAlloc", Type: domain.Gauge, Op: "<", Threshold: 5},
+	})
+
+	firing := Evaluate(rules.Rules(), metrics)
+	require.Len(t, firing, 2)
+	assert.Equal(t, "HeapAlloc(gauge) > 5", firing[0].Rule.String())
+	assert.Equal(t, metrics[0], firing[0].Metric)
+	assert.Equal(t, "PollCount(counter) > 1", firing[1].Rule.String())
+
+	rules.SetRules(nil)
+	assert.Empty(t, Evaluate(rules.Rules(), metrics))
+	assert.False(t, Rule{Metric: "Alloc", Type: domain.Counter}.Matches(dto.Metrics{ID: "Alloc", MType: domain.Gauge}))
+}
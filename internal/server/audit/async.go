@@ -0,0 +1,140 @@
+package audit
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/Axel791/metricsalert/internal/server/telemetry"
+)
+
+// asyncBatchSize - сколько событий AsyncRecorder передаёт sink'ам за раз.
+const asyncBatchSize = 256
+
+// AsyncRecorder ставит события в очередь и доставляет их во все sink'и из
+// отдельной горутины, поэтому Record не ждёт диска или сети.
+//
+// Если очередь заполнена (sink'и не успевают), новое событие отбрасывается:
+// приём метрик важнее полноты аудита. Отброшенные и недоставленные события
+// учитываются в телеметрии и в логе.
+type AsyncRecorder struct {
+	sinks   []Sink
+	logger  *log.Logger
+	metrics *telemetry.ServerMetrics
+
+	// mutex защищает закрытие очереди от конкурентных Record.
+	mutex  sync.RWMutex
+	closed bool
+	queue  chan Event
+
+	dropped atomic.Int64
+	ctx     context.Context
+	cancel  context.CancelFunc
+	done    chan struct{}
+}
+
+// NewAsyncRecorder запускает доставку событий в sinks через очередь на
+// queueSize событий. metrics может быть nil.
+func NewAsyncRecorder(
+	sinks []Sink,
+	queueSize int,
+	metrics *telemetry.ServerMetrics,
+	logger *log.Logger,
+) *AsyncRecorder {
+	ctx, cancel := context.WithCancel(context.Background())
+	r := &AsyncRecorder{
+		sinks:   sinks,
+		logger:  logger,
+		metrics: metrics,
+		queue:   make(chan Event, queueSize),
+		ctx:     ctx,
+		cancel:  cancel,
+		done:    make(chan struct{}),
+	}
+	go r.run()
+	return r
+}
+
+// Record ставит событие в очередь, не блокируясь. События после Close
+// отбрасываются.
+func (r *AsyncRecorder) Record(_ context.Context, event Event) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	if r.closed {
+		return
+	}
+	select {
+	case r.queue <- event:
+	default:
+		r.dropped.Add(1)
+		r.metrics.IncAuditDropped()
+	}
+}
+
+// Close перестаёт принимать события, доставляет оставшиеся в очереди и
+// закрывает sink'и. Если ctx отменяется раньше, недоставленные события
+// теряются.
+func (r *AsyncRecorder) Close(ctx context.Context) error {
+	r.mutex.Lock()
+	if !r.closed {
+		r.closed = true
+		close(r.queue)
+	}
+	r.mutex.Unlock()
+
+	var err error
+	select {
+	case <-r.done:
+	case <-ctx.Done():
+		r.cancel()
+		<-r.done
+		err = ctx.Err()
+	}
+	r.cancel()
+
+	for _, sink := range r.sinks {
+		err = errors.Join(err, sink.Close())
+	}
+	return err
+}
+
+// run доставляет события, собирая в пачку всё, что уже есть в очереди.
+func (r *AsyncRecorder) run() {
+	defer close(r.done)
+
+	batch := make([]Event, 0, asyncBatchSize)
+	for event := range r.queue {
+		batch = append(batch[:0], event)
+	fill:
+		for len(batch) < asyncBatchSize {
+			select {
+			case next, ok := <-r.queue:
+				if !ok {
+					break fill
+				}
+				batch = append(batch, next)
+			default:
+				break fill
+			}
+		}
+		r.deliver(batch)
+	}
+}
+
+// deliver передаёт пачку каждому sink. Ошибка одного sink не мешает
+// доставке в остальные.
+func (r *AsyncRecorder) deliver(batch []Event) {
+	if dropped := r.dropped.Swap(0); dropped > 0 {
+		r.logger.Warnf("audit queue is full, %d events dropped", dropped)
+	}
+	for _, sink := range r.sinks {
+		if err := sink.Write(r.ctx, batch); err != nil {
+			r.metrics.AddAuditErrors(sink.Name(), len(batch))
+			r.logger.WithField("sink", sink.Name()).Errorf("error delivering %d audit events: %v", len(batch), err)
+		}
+	}
+}
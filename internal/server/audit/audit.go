@@ -0,0 +1,100 @@
+// Package audit записывает, кто, когда и как менял метрики: принятые
+// обновления от агентов и административные действия (удаление и сброс).
+//
+// События доставляются в sink'и (файл JSONL, HTTP) асинхронно через
+// AsyncRecorder, чтобы запись аудита не замедляла приём метрик.
+package audit
+
+import (
+	"context"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/Axel791/metricsalert/internal/server/model/api"
+	"github.com/Axel791/metricsalert/internal/shared/logging"
+)
+
+// Действия, попадающие в журнал аудита.
+const (
+	ActionUpdateMetrics = "update_metrics"
+	ActionDeleteMetric  = "delete_metric"
+	ActionResetCounter  = "reset_counter"
+)
+
+// Итоги действия.
+const (
+	OutcomeSuccess  = "success"
+	OutcomeNotFound = "not_found"
+	OutcomeError    = "error"
+)
+
+// Event - запись журнала аудита.
+type Event struct {
+	Time   time.Time `json:"time"`
+	Action string    `json:"action"`
+	// Metric - метрика административного действия в виде "type/name".
+	Metric string `json:"metric,omitempty"`
+	// Metrics - принятые метрики обновления с присланными значениями (для
+	// counter - приращение).
+	Metrics []api.Metrics `json:"metrics,omitempty"`
+	// Actor - кто выполнил действие: адрес клиента административного API.
+	Actor string `json:"actor,omitempty"`
+	// SourceIP - IP-адрес, с которого пришёл запрос.
+	SourceIP string `json:"source_ip,omitempty"`
+	// Agent - идентификатор агента из заголовка X-Agent-ID. Заголовок не
+	// подписывается, поэтому это заявленный, а не проверенный идентификатор.
+	Agent     string `json:"agent,omitempty"`
+	RequestID string `json:"request_id,omitempty"`
+	Outcome   string `json:"outcome"`
+	Error     string `json:"error,omitempty"`
+}
+
+// Recorder сохраняет события аудита. Record не возвращает ошибку: сбой
+// записи аудита не отменяет уже выполненное действие.
+type Recorder interface {
+	Record(ctx context.Context, event Event)
+}
+
+// Discard - Recorder, который ничего не записывает. Используется, когда
+// аудит выключен.
+var Discard Recorder = discard{}
+
+type discard struct{}
+
+func (discard) Record(context.Context, Event) {}
+
+// MultiRecorder передаёт каждое событие всем своим Recorder по порядку.
+type MultiRecorder []Recorder
+
+func (m MultiRecorder) Record(ctx context.Context, event Event) {
+	for _, r := range m {
+		r.Record(ctx, event)
+	}
+}
+
+// LogRecorder пишет события аудита в лог сервера на уровне info с полем
+// audit=true, по которому их можно отфильтровать.
+type LogRecorder struct {
+	logger *log.Logger
+}
+
+// NewLogRecorder создаёт Recorder поверх логгера сервера.
+func NewLogRecorder(logger *log.Logger) *LogRecorder {
+	return &LogRecorder{logger: logger}
+}
+
+func (r *LogRecorder) Record(ctx context.Context, event Event) {
+	fields := log.Fields{
+		"audit":      true,
+		"event_time": event.Time.UTC().Format(time.RFC3339Nano),
+		"action":     event.Action,
+		"metric":     event.Metric,
+		"actor":      event.Actor,
+		"outcome":    event.Outcome,
+	}
+	if event.Error != "" {
+		fields["error"] = event.Error
+	}
+	logging.Entry(ctx, r.logger).WithFields(fields).Info("audit event")
+}
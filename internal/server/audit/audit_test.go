@@ -0,0 +1,184 @@
+package audit
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Axel791/metricsalert/internal/server/model/api"
+	"github.com/Axel791/metricsalert/internal/server/telemetry"
+)
+
+func quietLogger() *log.Logger {
+	logger := log.New()
+	logger.SetOutput(io.Discard)
+	return logger
+}
+
+func updateEvent(id string) Event {
+	value := 1.5
+	return Event{
+		Time:     time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC),
+		Action:   ActionUpdateMetrics,
+		Metrics:  []api.Metrics{{ID: id, MType: "gauge", Value: &value}},
+		SourceIP: "10.0.0.1",
+		Agent:    "agent-1",
+		Outcome:  OutcomeSuccess,
+	}
+}
+
+func readJSONL(t *testing.T, path string) []Event {
+	file, err := os.Open(path)
+	require.NoError(t, err)
+	defer file.Close()
+
+	var events []Event
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var event Event
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &event))
+		events = append(events, event)
+	}
+	require.NoError(t, scanner.Err())
+	return events
+}
+
+func TestAsyncRecorderDeliversToFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	sink, err := NewFileSink(path)
+	require.NoError(t, err)
+
+	recorder := NewAsyncRecorder([]Sink{sink}, 16, nil, quietLogger())
+	recorder.Record(context.Background(), updateEvent("Alloc"))
+	recorder.Record(context.Background(), updateEvent("HeapAlloc"))
+	require.NoError(t, recorder.Close(context.Background()))
+
+	events := readJSONL(t, path)
+	require.Equal(t, []Event{updateEvent("Alloc"), updateEvent("HeapAlloc")}, events)
+
+	// После Close события не принимаются.
+	recorder.Record(context.Background(), updateEvent("Late"))
+	assert.Len(t, readJSONL(t, path), 2)
+}
+
+// blockingSink сообщает в writing о начале записи и ждёт release.
+type blockingSink struct {
+	writing chan struct{}
+	release chan struct{}
+	mutex   sync.Mutex
+	events  []Event
+}
+
+func newBlockingSink() *blockingSink {
+	return &blockingSink{writing: make(chan struct{}, 1), release: make(chan struct{})}
+}
+
+func (s *blockingSink) Name() string { return "blocking" }
+
+func (s *blockingSink) Write(ctx context.Context, events []Event) error {
+	select {
+	case s.writing <- struct{}{}:
+	default:
+	}
+	select {
+	case <-s.release:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.events = append(s.events, events...)
+	return nil
+}
+
+func (s *blockingSink) Close() error { return nil }
+
+func TestAsyncRecorderDropsWhenQueueIsFull(t *testing.T) {
+	metrics := telemetry.NewServerMetrics(telemetry.NewRegistry())
+	sink := newBlockingSink()
+	recorder := NewAsyncRecorder([]Sink{sink}, 2, metrics, quietLogger())
+
+	// Первое событие застревает в sink, два ждут в очереди, остальные
+	// отбрасываются без блокировки.
+	recorder.Record(context.Background(), updateEvent("m0"))
+	<-sink.writing
+	for i := 0; i < 5; i++ {
+		recorder.Record(context.Background(), updateEvent("m"))
+	}
+	assert.Equal(t, float64(3), metrics.AuditDropped.Value())
+
+	close(sink.release)
+	require.NoError(t, recorder.Close(context.Background()))
+	assert.Len(t, sink.events, 3)
+}
+
+func TestAsyncRecorderCloseRespectsDeadline(t *testing.T) {
+	sink := newBlockingSink()
+	recorder := NewAsyncRecorder([]Sink{sink}, 2, nil, quietLogger())
+	recorder.Record(context.Background(), updateEvent("Alloc"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, recorder.Close(ctx), context.DeadlineExceeded)
+	assert.Empty(t, sink.events)
+}
+
+func TestHTTPSinkRetriesServerErrors(t *testing.T) {
+	var attempts atomic.Int32
+	var received []Event
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if attempts.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&received))
+	}))
+	defer server.Close()
+
+	sink := NewHTTPSink(server.URL, time.Second)
+	require.NoError(t, sink.Write(context.Background(), []Event{updateEvent("Alloc")}))
+	assert.Equal(t, int32(2), attempts.Load())
+	assert.Equal(t, []Event{updateEvent("Alloc")}, received)
+}
+
+func TestHTTPSinkDoesNotRetryClientErrors(t *testing.T) {
+	var attempts atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		attempts.Add(1)
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	err := NewHTTPSink(server.URL, time.Second).Write(context.Background(), []Event{updateEvent("Alloc")})
+	require.Error(t, err)
+	assert.Equal(t, int32(1), attempts.Load())
+}
+
+func TestMultiRecorder(t *testing.T) {
+	first, second := &memoryRecorder{}, &memoryRecorder{}
+	MultiRecorder{first, Discard, second}.Record(context.Background(), updateEvent("Alloc"))
+	assert.Len(t, first.events, 1)
+	assert.Len(t, second.events, 1)
+}
+
+type memoryRecorder struct {
+	events []Event
+}
+
+func (m *memoryRecorder) Record(_ context.Context, event Event) {
+	m.events = append(m.events, event)
+}
@@ -0,0 +1,146 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// Sink - место доставки событий аудита. Write получает события пачкой в
+// порядке записи и вызывается из одной горутины AsyncRecorder.
+type Sink interface {
+	// Name - имя sink для логов и телеметрии.
+	Name() string
+	Write(ctx context.Context, events []Event) error
+	Close() error
+}
+
+// FileSink дописывает события в файл по одному JSON-объекту на строку
+// (JSONL). Пачка пишется одним вызовом write и фиксируется fsync.
+type FileSink struct {
+	mutex sync.Mutex
+	file  *os.File
+}
+
+// NewFileSink открывает (или создаёт) файл журнала аудита path.
+func NewFileSink(path string) (*FileSink, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("open audit file %q: %w", path, err)
+	}
+	return &FileSink{file: file}, nil
+}
+
+func (s *FileSink) Name() string {
+	return "file"
+}
+
+func (s *FileSink) Write(_ context.Context, events []Event) error {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, event := range events {
+		if err := enc.Encode(event); err != nil {
+			return fmt.Errorf("encode audit event: %w", err)
+		}
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, err := s.file.Write(buf.Bytes()); err != nil {
+		return fmt.Errorf("write audit file: %w", err)
+	}
+	if err := s.file.Sync(); err != nil {
+		return fmt.Errorf("sync audit file: %w", err)
+	}
+	return nil
+}
+
+func (s *FileSink) Close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.file.Close()
+}
+
+// httpSinkAttempts и httpSinkBaseDelay - сколько раз HTTPSink отправляет
+// пачку и пауза перед первым повтором (удваивается с каждой попыткой).
+const (
+	httpSinkAttempts  = 3
+	httpSinkBaseDelay = 200 * time.Millisecond
+)
+
+// HTTPSink отправляет пачку событий POST-запросом с JSON-массивом в теле.
+// Ошибки соединения и ответы 5xx повторяются, ответы 4xx - нет.
+type HTTPSink struct {
+	url    string
+	client *http.Client
+}
+
+// NewHTTPSink создаёт sink, отправляющий события на url. timeout
+// ограничивает одну попытку отправки.
+func NewHTTPSink(url string, timeout time.Duration) *HTTPSink {
+	return &HTTPSink{url: url, client: &http.Client{Timeout: timeout}}
+}
+
+func (s *HTTPSink) Name() string {
+	return "http"
+}
+
+func (s *HTTPSink) Write(ctx context.Context, events []Event) error {
+	body, err := json.Marshal(events)
+	if err != nil {
+		return fmt.Errorf("encode audit events: %w", err)
+	}
+
+	delay := httpSinkBaseDelay
+	for attempt := 1; ; attempt++ {
+		retry, err := s.post(ctx, body)
+		if err == nil {
+			return nil
+		}
+		if !retry || attempt == httpSinkAttempts {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%w (last error: %w)", ctx.Err(), err)
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+
+// post выполняет одну попытку отправки и сообщает, стоит ли её повторить.
+func (s *HTTPSink) post(ctx context.Context, body []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return false, fmt.Errorf("create audit request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	rsp, err := s.client.Do(req)
+	if err != nil {
+		return ctx.Err() == nil, fmt.Errorf("send audit events: %w", err)
+	}
+	defer rsp.Body.Close()
+	_, _ = io.Copy(io.Discard, rsp.Body)
+
+	if rsp.StatusCode >= http.StatusMultipleChoices {
+		return rsp.StatusCode >= http.StatusInternalServerError,
+			fmt.Errorf("send audit events: unexpected status %d", rsp.StatusCode)
+	}
+	return false, nil
+}
+
+func (s *HTTPSink) Close() error {
+	s.client.CloseIdleConnections()
+	return nil
+}
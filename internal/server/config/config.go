@@ -1,56 +1,353 @@
 package config
 
 import (
-	log "github.com/sirupsen/logrus"
-	"github.com/spf13/viper"
+	"fmt"
+	"time"
+
+	"github.com/Axel791/metricsalert/internal/server/alerts"
+	"github.com/Axel791/metricsalert/internal/server/retention"
+	"github.com/Axel791/metricsalert/internal/server/staleness"
+	"github.com/Axel791/metricsalert/internal/shared/configloader"
 )
 
-// Config - структура для хранения конфигурации
+// DefaultConfigFile - файл конфигурации, который читается, если путь
+// не задан флагом -c/-config или переменной CONFIG.
+const DefaultConfigFile = "server_config.json"
+
+// Config - конфигурация сервера.
 type Config struct {
-	Address         string `mapstructure:"ADDRESS"`
-	FileStoragePath string `mapstructure:"FILE_STORAGE_PATH"`
-	DatabaseDSN     string `mapstructure:"DATABASE_DSN"`
-	MigrationsPath  string `mapstructure:"MIGRATIONS_PATH"`
-	Key             string `mapstructure:"KEY"`
-	CryptoKey       string `mapstructure:"CRYPTO_KEY"`
-
-	StoreInterval  int64 `mapstructure:"STORE_INTERVAL"`
-	Restore        bool  `mapstructure:"RESTORE"`
-	UseFileStorage bool  `mapstructure:"USE_FILE_STORAGE"`
-}
-
-// ServerLoadConfig - загружает конфигурацию из .env, переменных окружения и задает значения по умолчанию
-func ServerLoadConfig() (*Config, error) {
-	viper.SetConfigName(".env")
-	viper.SetConfigType("env")
-	viper.AddConfigPath(".")
-
-	viper.SetDefault("ADDRESS", "localhost:8080")
-	viper.SetDefault("STORE_INTERVAL", 300)
-	viper.SetDefault("FILE_STORAGE_PATH", "./data.txt")
-	viper.SetDefault("RESTORE", true)
-	viper.SetDefault("USE_FILE_STORAGE", true)
-	viper.SetDefault("MIGRATIONS_PATH", "./migrations")
-
-	viper.AutomaticEnv()
-
-	_ = viper.BindEnv("ADDRESS", "ADDRESS")
-	_ = viper.BindEnv("STORE_INTERVAL", "STORE_INTERVAL")
-	_ = viper.BindEnv("FILE_STORAGE_PATH", "FILE_STORAGE_PATH")
-	_ = viper.BindEnv("RESTORE", "RESTORE")
-	_ = viper.BindEnv("USE_FILE_STORAGE", "USE_FILE_STORAGE")
-	_ = viper.BindEnv("DATABASE_DSN", "DATABASE_DSN")
-	_ = viper.BindEnv("KEY", "KEY")
-	_ = viper.BindEnv("CRYPTO_KEY", "CRYPTO_KEY")
-
-	if err := viper.ReadInConfig(); err != nil {
-		log.Infof("filed find file config set defoult value: %v", err)
+	Address         string        `mapstructure:"address"`
+	ShutdownTimeout time.Duration `mapstructure:"shutdown_timeout"`
+
+	Log       LogConfig       `mapstructure:"log"`
+	Storage   StorageConfig   `mapstructure:"storage"`
+	Security  SecurityConfig  `mapstructure:"security"`
+	Alerts    AlertsConfig    `mapstructure:"alerts"`
+	Telemetry TelemetryConfig `mapstructure:"telemetry"`
+	Retention RetentionConfig `mapstructure:"retention"`
+	Staleness StalenessConfig `mapstructure:"staleness"`
+	Audit     AuditConfig     `mapstructure:"audit"`
+	Stream    StreamConfig    `mapstructure:"stream"`
+}
+
+// LogConfig - настройки логирования.
+type LogConfig struct {
+	Level  string `mapstructure:"level"`
+	Format string `mapstructure:"format"`
+}
+
+// StorageConfig - настройки хранилища метрик.
+type StorageConfig struct {
+	FilePath       string        `mapstructure:"file_path"`
+	StoreInterval  time.Duration `mapstructure:"store_interval"`
+	Restore        bool          `mapstructure:"restore"`
+	UseFile        bool          `mapstructure:"use_file"`
+	DatabaseDSN    string        `mapstructure:"database_dsn"`
+	MigrationsPath string        `mapstructure:"migrations_path"`
+	BoltPath       string        `mapstructure:"bolt_path"`
+
+	MaxOpenConns    int           `mapstructure:"max_open_conns"`
+	MaxIdleConns    int           `mapstructure:"max_idle_conns"`
+	ConnMaxLifetime time.Duration `mapstructure:"conn_max_lifetime"`
+	ConnMaxIdleTime time.Duration `mapstructure:"conn_max_idle_time"`
+	PingTimeout     time.Duration `mapstructure:"ping_timeout"`
+
+	RetryMaxAttempts   int           `mapstructure:"retry_max_attempts"`
+	RetryBaseDelay     time.Duration `mapstructure:"retry_base_delay"`
+	RetryMaxDelay      time.Duration `mapstructure:"retry_max_delay"`
+	BreakerThreshold   int           `mapstructure:"breaker_threshold"`
+	BreakerOpenTimeout time.Duration `mapstructure:"breaker_open_timeout"`
+
+	Fallback          bool          `mapstructure:"fallback"`
+	ReconnectInterval time.Duration `mapstructure:"reconnect_interval"`
+}
+
+// SecurityConfig - ключи подписи и шифрования.
+type SecurityConfig struct {
+	Key       string `mapstructure:"key"`
+	CryptoKey string `mapstructure:"crypto_key"`
+	// AdminToken - токен административного API (удаление и сброс метрик).
+	// Пустое значение выключает административные маршруты.
+	AdminToken string `mapstructure:"admin_token"`
+}
+
+// AlertsConfig - правила алертов.
+type AlertsConfig struct {
+	Rules []alerts.Rule `mapstructure:"rules"`
+}
+
+// TelemetryConfig - внутренний адрес с pprof и метриками самого сервера.
+type TelemetryConfig struct {
+	Address        string        `mapstructure:"address"`
+	ReportInterval time.Duration `mapstructure:"report_interval"`
+}
+
+// RetentionConfig - история метрик и сроки её хранения. Raw, Minute и Hour
+// задают политику по умолчанию, Policies - политики для шаблонов имён.
+type RetentionConfig struct {
+	Enabled  bool               `mapstructure:"enabled"`
+	Interval time.Duration      `mapstructure:"interval"`
+	Raw      time.Duration      `mapstructure:"raw"`
+	Minute   time.Duration      `mapstructure:"minute"`
+	Hour     time.Duration      `mapstructure:"hour"`
+	Policies []retention.Policy `mapstructure:"policies"`
+}
+
+// RetentionPolicies собирает политики хранения истории.
+func (c RetentionConfig) RetentionPolicies() retention.Policies {
+	return retention.Policies{
+		Default: retention.Policy{Pattern: "*", Raw: c.Raw, Minute: c.Minute, Hour: c.Hour},
+		Rules:   c.Policies,
+	}
+}
+
+// StalenessConfig - устаревание метрик. TTL и Action задают правило по
+// умолчанию, Rules - правила для префиксов имён. Interval - период удаления
+// метрик, устаревших по правилам с действием evict.
+type StalenessConfig struct {
+	TTL      time.Duration    `mapstructure:"ttl"`
+	Action   string           `mapstructure:"action"`
+	Interval time.Duration    `mapstructure:"interval"`
+	Rules    []staleness.Rule `mapstructure:"rules"`
+}
+
+// StalenessPolicy собирает политику устаревания метрик.
+func (c StalenessConfig) StalenessPolicy() staleness.Policy {
+	return staleness.Policy{
+		Default: staleness.Rule{TTL: c.TTL, Action: c.Action},
+		Rules:   c.Rules,
+	}
+}
+
+// AuditConfig - журнал аудита принятых обновлений метрик. File и URL задают
+// приёмники событий; пустые значения выключают соответствующий приёмник.
+type AuditConfig struct {
+	File        string        `mapstructure:"file"`
+	URL         string        `mapstructure:"url"`
+	QueueSize   int           `mapstructure:"queue_size"`
+	HTTPTimeout time.Duration `mapstructure:"http_timeout"`
+}
+
+// StreamConfig - поток изменений метрик GET /api/v1/metrics/stream.
+// BufferSize - сколько событий ждут отправки одному подписчику; отстающий
+// подписчик отключается. Heartbeat - период пустых сообщений, по которым
+// клиент и прокси видят, что соединение живо.
+type StreamConfig struct {
+	BufferSize int           `mapstructure:"buffer_size"`
+	Heartbeat  time.Duration `mapstructure:"heartbeat"`
+}
+
+// Options возвращает описание всех настроек сервера.
+func Options() []configloader.Option {
+	return []configloader.Option{
+		{Key: "address", Env: "ADDRESS", Flag: "a", Usage: "HTTP server address", Default: "localhost:8080"},
+		{
+			Key: "shutdown_timeout", Env: "SHUTDOWN_TIMEOUT", Flag: "shutdown-timeout",
+			Usage: "graceful shutdown deadline (seconds or duration)", Default: 10 * time.Second,
+		},
+		{Key: "log.level", Env: "LOG_LEVEL", Flag: "log-level", Usage: "log level", Default: "info"},
+		{Key: "log.format", Env: "LOG_FORMAT", Flag: "log-format", Usage: "log format: json or text", Default: "json"},
+		{
+			Key: "storage.file_path", Env: "FILE_STORAGE_PATH", Flag: "f",
+			Usage: "path to file for storing metrics", Default: "./data.txt",
+		},
+		{
+			Key: "storage.store_interval", Env: "STORE_INTERVAL", Flag: "i",
+			Usage: "interval for metrics file snapshots (seconds or duration, 0 snapshots only when the WAL grows)", Default: 300 * time.Second,
+		},
+		{
+			Key: "storage.restore", Env: "RESTORE", Flag: "r",
+			Usage: "restore metrics from file on start (true/false)", Default: true,
+		},
+		{
+			Key: "storage.use_file", Env: "USE_FILE_STORAGE",
+			Usage: "keep metrics in file storage", Default: true,
+		},
+		{
+			Key: "storage.database_dsn", Env: "DATABASE_DSN", Flag: "d",
+			Usage: "database DSN", Default: "", Secret: true,
+		},
+		{
+			Key: "storage.migrations_path", Env: "MIGRATIONS_PATH",
+			Usage: "path to goose migrations", Default: "./migrations",
+		},
+		{
+			Key: "storage.bolt_path", Env: "BOLT_PATH", Flag: "bolt-path",
+			Usage: "embedded BoltDB file used when no database DSN is set (empty disables)", Default: "",
+		},
+		{
+			Key: "storage.max_open_conns", Env: "DB_MAX_OPEN_CONNS",
+			Usage: "maximum number of open database connections", Default: 10,
+		},
+		{
+			Key: "storage.max_idle_conns", Env: "DB_MAX_IDLE_CONNS",
+			Usage: "maximum number of idle database connections", Default: 5,
+		},
+		{
+			Key: "storage.conn_max_lifetime", Env: "DB_CONN_MAX_LIFETIME",
+			Usage: "maximum lifetime of a database connection", Default: 30 * time.Minute,
+		},
+		{
+			Key: "storage.conn_max_idle_time", Env: "DB_CONN_MAX_IDLE_TIME",
+			Usage: "maximum idle time of a database connection", Default: 5 * time.Minute,
+		},
+		{
+			Key: "storage.ping_timeout", Env: "DB_PING_TIMEOUT",
+			Usage: "timeout of database checks in /ping and /health", Default: 2 * time.Second,
+		},
+		{
+			Key: "storage.retry_max_attempts", Env: "DB_RETRY_MAX_ATTEMPTS",
+			Usage: "attempts of a database operation on connection errors, including the first", Default: 3,
+		},
+		{
+			Key: "storage.retry_base_delay", Env: "DB_RETRY_BASE_DELAY",
+			Usage: "delay before the first database retry, doubled for each next one", Default: 200 * time.Millisecond,
+		},
+		{
+			Key: "storage.retry_max_delay", Env: "DB_RETRY_MAX_DELAY",
+			Usage: "maximum delay between database retries", Default: 2 * time.Second,
+		},
+		{
+			Key: "storage.breaker_threshold", Env: "DB_BREAKER_THRESHOLD",
+			Usage: "consecutive database connection errors that open the circuit breaker (0 disables)", Default: 5,
+		},
+		{
+			Key: "storage.breaker_open_timeout", Env: "DB_BREAKER_OPEN_TIMEOUT",
+			Usage: "time the database circuit breaker stays open before a probe request", Default: 10 * time.Second,
+		},
+		{
+			Key: "storage.fallback", Env: "DB_FALLBACK",
+			Usage: "start with the in-memory store if the database is unreachable at startup", Default: true,
+		},
+		{
+			Key: "storage.reconnect_interval", Env: "DB_RECONNECT_INTERVAL",
+			Usage: "interval between database connection attempts in fallback mode", Default: 5 * time.Second,
+		},
+		{Key: "security.key", Env: "KEY", Flag: "k", Usage: "secret key", Default: "", Secret: true},
+		{
+			Key: "security.crypto_key", Env: "CRYPTO_KEY", Flag: "crypto-key",
+			Usage: "path to PEM private key for RSA decryption", Default: "",
+		},
+		{
+			Key: "security.admin_token", Env: "ADMIN_TOKEN",
+			Usage: "bearer token for the admin API (empty disables it)", Default: "", Secret: true,
+		},
+		{Key: "alerts.rules", Usage: "alert rules (config file only)", Default: []alerts.Rule(nil)},
+		{
+			Key: "telemetry.address", Env: "TELEMETRY_ADDRESS", Flag: "telemetry-address",
+			Usage: "internal address for pprof and /metrics (empty disables)", Default: "localhost:6060",
+		},
+		{
+			Key: "telemetry.report_interval", Env: "TELEMETRY_REPORT_INTERVAL",
+			Usage: "interval for writing server telemetry into the metric store (0 disables)", Default: time.Duration(0),
+		},
+		{
+			Key: "retention.enabled", Env: "RETENTION_ENABLED",
+			Usage: "record metrics history with rollups and retention", Default: false,
+		},
+		{
+			Key: "retention.interval", Env: "RETENTION_INTERVAL",
+			Usage: "interval between history compaction passes", Default: time.Minute,
+		},
+		{
+			Key: "retention.raw", Env: "RETENTION_RAW",
+			Usage: "default retention of raw history values", Default: 24 * time.Hour,
+		},
+		{
+			Key: "retention.minute", Env: "RETENTION_MINUTE",
+			Usage: "default retention of 1m history rollups", Default: 7 * 24 * time.Hour,
+		},
+		{
+			Key: "retention.hour", Env: "RETENTION_HOUR",
+			Usage: "default retention of 1h history rollups", Default: 90 * 24 * time.Hour,
+		},
+		{
+			Key: "retention.policies", Usage: "per-pattern retention policies (config file only)",
+			Default: []retention.Policy(nil),
+		},
+		{
+			Key: "staleness.ttl", Env: "STALENESS_TTL",
+			Usage:   "default time after the last update when a metric becomes stale (0 disables)",
+			Default: time.Duration(0),
+		},
+		{
+			Key: "staleness.action", Env: "STALENESS_ACTION",
+			Usage: "default action for stale metrics: mark or evict", Default: staleness.ActionMark,
+		},
+		{
+			Key: "staleness.interval", Env: "STALENESS_INTERVAL",
+			Usage: "interval between stale metrics eviction passes (0 disables eviction)", Default: 30 * time.Second,
+		},
+		{
+			Key: "staleness.rules", Usage: "per-prefix staleness rules (config file only)",
+			Default: []staleness.Rule(nil),
+		},
+		{
+			Key: "audit.file", Env: "AUDIT_FILE",
+			Usage: "JSONL file for the audit log of metric updates", Default: "",
+		},
+		{
+			Key: "audit.url", Env: "AUDIT_URL",
+			Usage: "HTTP endpoint for the audit log of metric updates", Default: "",
+		},
+		{
+			Key: "audit.queue_size", Env: "AUDIT_QUEUE_SIZE",
+			Usage: "audit events queue size; events are dropped when it is full", Default: 1024,
+		},
+		{
+			Key: "audit.http_timeout", Env: "AUDIT_HTTP_TIMEOUT",
+			Usage: "timeout of one audit HTTP request", Default: 5 * time.Second,
+		},
+		{
+			Key: "stream.buffer_size", Env: "STREAM_BUFFER_SIZE",
+			Usage: "events buffered per metrics stream subscriber; lagging subscribers are disconnected", Default: 256,
+		},
+		{
+			Key: "stream.heartbeat", Env: "STREAM_HEARTBEAT",
+			Usage: "heartbeat interval of the metrics stream", Default: 15 * time.Second,
+		},
+	}
+}
+
+// ServerLoadConfig собирает конфигурацию из флагов args, переменных окружения,
+// файла .env, файла конфигурации и значений по умолчанию.
+func ServerLoadConfig(args []string) (*Config, *configloader.Loader, error) {
+	loader := configloader.New(Options(), DefaultConfigFile)
+	if err := loader.Load("server", args); err != nil {
+		return nil, nil, err
 	}
 
 	var cfg Config
-	if err := viper.Unmarshal(&cfg); err != nil {
-		return nil, err
+	if err := loader.Decode(&cfg); err != nil {
+		return nil, nil, fmt.Errorf("decode config: %w", err)
+	}
+	if err := alerts.ValidateRules(cfg.Alerts.Rules); err != nil {
+		return nil, nil, err
+	}
+	if cfg.Retention.Enabled && cfg.Retention.Interval <= 0 {
+		return nil, nil, fmt.Errorf("retention.interval must be positive, got %s", cfg.Retention.Interval)
+	}
+	if err := cfg.Retention.RetentionPolicies().Validate(); err != nil {
+		return nil, nil, err
+	}
+	if cfg.Staleness.Interval < 0 {
+		return nil, nil, fmt.Errorf("staleness.interval must not be negative, got %s", cfg.Staleness.Interval)
+	}
+	if err := cfg.Staleness.StalenessPolicy().Validate(); err != nil {
+		return nil, nil, err
+	}
+	if cfg.Audit.QueueSize <= 0 {
+		return nil, nil, fmt.Errorf("audit.queue_size must be positive, got %d", cfg.Audit.QueueSize)
+	}
+	if cfg.Audit.HTTPTimeout <= 0 {
+		return nil, nil, fmt.Errorf("audit.http_timeout must be positive, got %s", cfg.Audit.HTTPTimeout)
+	}
+	if cfg.Stream.BufferSize <= 0 {
+		return nil, nil, fmt.Errorf("stream.buffer_size must be positive, got %d", cfg.Stream.BufferSize)
+	}
+	if cfg.Stream.Heartbeat <= 0 {
+		return nil, nil, fmt.Errorf("stream.heartbeat must be positive, got %s", cfg.Stream.Heartbeat)
 	}
 
-	return &cfg, nil
+	return &cfg, loader, nil
 }
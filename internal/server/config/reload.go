@@ -0,0 +1,115 @@
+package config
+
+import (
+	"fmt"
+
+	"github.com/Axel791/metricsalert/internal/shared"
+)
+
+// Diff сравнивает две конфигурации. Уровень логирования, интервал
+// сохранения, правила алертов, сроки хранения истории и правила устаревания
+// метрик применяются на лету, остальное требует перезапуска.
+func Diff(oldCfg, newCfg *Config) []shared.Change {
+	var changes []shared.Change
+
+	changes = shared.CompareSetting(changes, "log.level", oldCfg.Log.Level, newCfg.Log.Level, true)
+	changes = shared.CompareSetting(changes, "log.format", oldCfg.Log.Format, newCfg.Log.Format, true)
+	changes = shared.CompareSetting(
+		changes, "storage.store_interval", oldCfg.Storage.StoreInterval, newCfg.Storage.StoreInterval, true,
+	)
+	changes = shared.CompareSetting(
+		changes, "alerts.rules", fmt.Sprint(oldCfg.Alerts.Rules), fmt.Sprint(newCfg.Alerts.Rules), true,
+	)
+	changes = shared.CompareSetting(changes, "retention.raw", oldCfg.Retention.Raw, newCfg.Retention.Raw, true)
+	changes = shared.CompareSetting(changes, "retention.minute", oldCfg.Retention.Minute, newCfg.Retention.Minute, true)
+	changes = shared.CompareSetting(changes, "retention.hour", oldCfg.Retention.Hour, newCfg.Retention.Hour, true)
+	changes = shared.CompareSetting(
+		changes, "retention.policies",
+		fmt.Sprint(oldCfg.Retention.Policies), fmt.Sprint(newCfg.Retention.Policies), true,
+	)
+	changes = shared.CompareSetting(changes, "staleness.ttl", oldCfg.Staleness.TTL, newCfg.Staleness.TTL, true)
+	changes = shared.CompareSetting(changes, "staleness.action", oldCfg.Staleness.Action, newCfg.Staleness.Action, true)
+	changes = shared.CompareSetting(
+		changes, "staleness.rules", fmt.Sprint(oldCfg.Staleness.Rules), fmt.Sprint(newCfg.Staleness.Rules), true,
+	)
+
+	changes = shared.CompareSetting(changes, "address", oldCfg.Address, newCfg.Address, false)
+	changes = shared.CompareSetting(changes, "shutdown_timeout", oldCfg.ShutdownTimeout, newCfg.ShutdownTimeout, false)
+	changes = shared.CompareSetting(changes, "storage.file_path", oldCfg.Storage.FilePath, newCfg.Storage.FilePath, false)
+	changes = shared.CompareSetting(changes, "storage.restore", oldCfg.Storage.Restore, newCfg.Storage.Restore, false)
+	changes = shared.CompareSetting(changes, "storage.use_file", oldCfg.Storage.UseFile, newCfg.Storage.UseFile, false)
+	changes = shared.CompareSecret(
+		changes, "storage.database_dsn", oldCfg.Storage.DatabaseDSN, newCfg.Storage.DatabaseDSN, false,
+	)
+	changes = shared.CompareSetting(
+		changes, "storage.migrations_path", oldCfg.Storage.MigrationsPath, newCfg.Storage.MigrationsPath, false,
+	)
+	changes = shared.CompareSetting(changes, "storage.bolt_path", oldCfg.Storage.BoltPath, newCfg.Storage.BoltPath, false)
+	changes = shared.CompareSetting(
+		changes, "storage.max_open_conns", oldCfg.Storage.MaxOpenConns, newCfg.Storage.MaxOpenConns, false,
+	)
+	changes = shared.CompareSetting(
+		changes, "storage.max_idle_conns", oldCfg.Storage.MaxIdleConns, newCfg.Storage.MaxIdleConns, false,
+	)
+	changes = shared.CompareSetting(
+		changes, "storage.conn_max_lifetime", oldCfg.Storage.ConnMaxLifetime, newCfg.Storage.ConnMaxLifetime, false,
+	)
+	changes = shared.CompareSetting(
+		changes, "storage.conn_max_idle_time", oldCfg.Storage.ConnMaxIdleTime, newCfg.Storage.ConnMaxIdleTime, false,
+	)
+	changes = shared.CompareSetting(
+		changes, "storage.ping_timeout", oldCfg.Storage.PingTimeout, newCfg.Storage.PingTimeout, false,
+	)
+	changes = shared.CompareSetting(
+		changes, "storage.retry_max_attempts", oldCfg.Storage.RetryMaxAttempts, newCfg.Storage.RetryMaxAttempts, false,
+	)
+	changes = shared.CompareSetting(
+		changes, "storage.retry_base_delay", oldCfg.Storage.RetryBaseDelay, newCfg.Storage.RetryBaseDelay, false,
+	)
+	changes = shared.CompareSetting(
+		changes, "storage.retry_max_delay", oldCfg.Storage.RetryMaxDelay, newCfg.Storage.RetryMaxDelay, false,
+	)
+	changes = shared.CompareSetting(
+		changes, "storage.breaker_threshold", oldCfg.Storage.BreakerThreshold, newCfg.Storage.BreakerThreshold, false,
+	)
+	changes = shared.CompareSetting(
+		changes, "storage.breaker_open_timeout",
+		oldCfg.Storage.BreakerOpenTimeout, newCfg.Storage.BreakerOpenTimeout, false,
+	)
+	changes = shared.CompareSetting(changes, "storage.fallback", oldCfg.Storage.Fallback, newCfg.Storage.Fallback, false)
+	changes = shared.CompareSetting(
+		changes, "storage.reconnect_interval", oldCfg.Storage.ReconnectInterval, newCfg.Storage.ReconnectInterval, false,
+	)
+	changes = shared.CompareSecret(changes, "security.key", oldCfg.Security.Key, newCfg.Security.Key, false)
+	changes = shared.CompareSetting(
+		changes, "security.crypto_key", oldCfg.Security.CryptoKey, newCfg.Security.CryptoKey, false,
+	)
+	changes = shared.CompareSecret(
+		changes, "security.admin_token", oldCfg.Security.AdminToken, newCfg.Security.AdminToken, false,
+	)
+	changes = shared.CompareSetting(
+		changes, "telemetry.address", oldCfg.Telemetry.Address, newCfg.Telemetry.Address, false,
+	)
+	changes = shared.CompareSetting(
+		changes, "telemetry.report_interval", oldCfg.Telemetry.ReportInterval, newCfg.Telemetry.ReportInterval, false,
+	)
+	changes = shared.CompareSetting(changes, "retention.enabled", oldCfg.Retention.Enabled, newCfg.Retention.Enabled, false)
+	changes = shared.CompareSetting(
+		changes, "retention.interval", oldCfg.Retention.Interval, newCfg.Retention.Interval, false,
+	)
+	changes = shared.CompareSetting(
+		changes, "staleness.interval", oldCfg.Staleness.Interval, newCfg.Staleness.Interval, false,
+	)
+	changes = shared.CompareSetting(changes, "audit.file", oldCfg.Audit.File, newCfg.Audit.File, false)
+	changes = shared.CompareSetting(changes, "audit.url", oldCfg.Audit.URL, newCfg.Audit.URL, false)
+	changes = shared.CompareSetting(changes, "audit.queue_size", oldCfg.Audit.QueueSize, newCfg.Audit.QueueSize, false)
+	changes = shared.CompareSetting(
+		changes, "audit.http_timeout", oldCfg.Audit.HTTPTimeout, newCfg.Audit.HTTPTimeout, false,
+	)
+	changes = shared.CompareSetting(
+		changes, "stream.buffer_size", oldCfg.Stream.BufferSize, newCfg.Stream.BufferSize, false,
+	)
+	changes = shared.CompareSetting(changes, "stream.heartbeat", oldCfg.Stream.Heartbeat, newCfg.Stream.Heartbeat, false)
+
+	return changes
+}
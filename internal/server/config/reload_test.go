@@ -0,0 +1,81 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Axel791/metricsalert/internal/server/alerts"
+	"github.com/Axel791/metricsalert/internal/shared"
+)
+
+func TestDiff(t *testing.T) {
+	tests := []struct {
+		name     string
+		change   func(cfg *Config)
+		expected []shared.Change
+	}{
+		{
+			name:     "no changes",
+			change:   func(*Config) {},
+			expected: nil,
+		},
+		{
+			name:   "store interval is applied on the fly",
+			change: func(cfg *Config) { cfg.Storage.StoreInterval = time.Minute },
+			expected: []shared.Change{
+				{Name: "storage.store_interval", Old: 300 * time.Second, New: time.Minute, Hot: true},
+			},
+		},
+		{
+			name: "alert rules are applied on the fly",
+			change: func(cfg *Config) {
+				cfg.Alerts.Rules = []alerts.Rule{{Metric: "Alloc", Type: "gauge", Op: ">", Threshold: 1}}
+			},
+			expected: []shared.Change{
+				{Name: "alerts.rules", Old: "[]", New: "[Alloc(gauge) > 1]", Hot: true},
+			},
+		},
+		{
+			name:   "address requires restart",
+			change: func(cfg *Config) { cfg.Address = "localhost:9090" },
+			expected: []shared.Change{
+				{Name: "address", Old: "localhost:8080", New: "localhost:9090", Hot: false},
+			},
+		},
+		{
+			name:   "database dsn is masked",
+			change: func(cfg *Config) { cfg.Storage.DatabaseDSN = "postgres://user:secret@db/metrics" },
+			expected: []shared.Change{
+				{Name: "storage.database_dsn", Old: "***", New: "***", Hot: false},
+			},
+		},
+		{
+			name: "hot and restart-only changes together",
+			change: func(cfg *Config) {
+				cfg.Log.Level = "debug"
+				cfg.Stream.BufferSize = 64
+			},
+			expected: []shared.Change{
+				{Name: "log.level", Old: "info", New: "debug", Hot: true},
+				{Name: "stream.buffer_size", Old: 16, New: 64, Hot: false},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			oldCfg := &Config{
+				Address: "localhost:8080",
+				Log:     LogConfig{Level: "info"},
+				Storage: StorageConfig{StoreInterval: 300 * time.Second},
+				Stream:  StreamConfig{BufferSize: 16},
+			}
+			newCfg := *oldCfg
+			tt.change(&newCfg)
+
+			assert.Equal(t, tt.expected, Diff(oldCfg, &newCfg))
+		})
+	}
+}
@@ -0,0 +1,140 @@
+package db
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen возвращается без обращения к базе, пока автомат защиты разомкнут.
+var ErrCircuitOpen = errors.New("database circuit breaker is open")
+
+// BreakerState - состояние автомата защиты.
+type BreakerState int
+
+// Состояния автомата защиты.
+const (
+	BreakerClosed BreakerState = iota
+	BreakerHalfOpen
+	BreakerOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerHalfOpen:
+		return "half_open"
+	case BreakerOpen:
+		return "open"
+	default:
+		return "closed"
+	}
+}
+
+// CircuitBreaker - автомат защиты от недоступной базы. После threshold ошибок
+// соединения подряд он размыкается, и запросы сразу получают ErrCircuitOpen.
+// Через openTimeout пропускается один пробный запрос: при успехе автомат
+// замыкается, при ошибке снова размыкается.
+type CircuitBreaker struct {
+	threshold   int
+	openTimeout time.Duration
+	now         func() time.Time
+
+	mu       sync.Mutex
+	state    BreakerState
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+// NewCircuitBreaker создаёт замкнутый автомат. threshold <= 0 отключает его.
+func NewCircuitBreaker(threshold int, openTimeout time.Duration) *CircuitBreaker {
+	return &CircuitBreaker{threshold: threshold, openTimeout: openTimeout, now: time.Now}
+}
+
+// State возвращает текущее состояние автомата.
+func (b *CircuitBreaker) State() BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+// Allow разрешает запрос к базе или возвращает ErrCircuitOpen.
+func (b *CircuitBreaker) Allow() error {
+	if b.threshold <= 0 {
+		return nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case BreakerOpen:
+		if b.now().Sub(b.openedAt) < b.openTimeout {
+			return ErrCircuitOpen
+		}
+		b.setState(BreakerHalfOpen)
+		b.probing = true
+		return nil
+	case BreakerHalfOpen:
+		if b.probing {
+			return ErrCircuitOpen
+		}
+		b.probing = true
+		return nil
+	default:
+		return nil
+	}
+}
+
+// Success отмечает, что база ответила на запрос.
+func (b *CircuitBreaker) Success() {
+	if b.threshold <= 0 {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures = 0
+	b.probing = false
+	b.setState(BreakerClosed)
+}
+
+// Failure отмечает ошибку соединения с базой.
+func (b *CircuitBreaker) Failure() {
+	if b.threshold <= 0 {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+	b.failures++
+	if b.state == BreakerHalfOpen || b.failures >= b.threshold {
+		b.openedAt = b.now()
+		b.setState(BreakerOpen)
+	}
+}
+
+// Release завершает запрос, исход которого ничего не говорит о базе
+// (например, отменённый клиентом), и освобождает место пробного запроса.
+func (b *CircuitBreaker) Release() {
+	if b.threshold <= 0 {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+}
+
+// setState меняет состояние и сообщает его в телеметрию. Вызывается под mu.
+func (b *CircuitBreaker) setState(state BreakerState) {
+	if b.state == state {
+		return
+	}
+	b.state = state
+	retryMetrics.Load().SetDBBreakerState(float64(state))
+}
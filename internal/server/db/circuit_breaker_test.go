@@ -0,0 +1,60 @@
+package db
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCircuitBreaker_Transitions(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	breaker := NewCircuitBreaker(2, 10*time.Second)
+	breaker.now = func() time.Time { return now }
+
+	require.NoError(t, breaker.Allow())
+	breaker.Failure()
+	assert.Equal(t, BreakerClosed, breaker.State())
+
+	require.NoError(t, breaker.Allow())
+	breaker.Failure()
+	assert.Equal(t, BreakerOpen, breaker.State())
+	assert.ErrorIs(t, breaker.Allow(), ErrCircuitOpen)
+
+	now = now.Add(10 * time.Second)
+	require.NoError(t, breaker.Allow(), "probe request after open timeout")
+	assert.Equal(t, BreakerHalfOpen, breaker.State())
+	assert.ErrorIs(t, breaker.Allow(), ErrCircuitOpen, "only one probe at a time")
+
+	breaker.Failure()
+	assert.Equal(t, BreakerOpen, breaker.State(), "failed probe opens the breaker again")
+
+	now = now.Add(10 * time.Second)
+	require.NoError(t, breaker.Allow())
+	breaker.Success()
+	assert.Equal(t, BreakerClosed, breaker.State())
+	assert.NoError(t, breaker.Allow())
+}
+
+func TestCircuitBreaker_ReleaseFreesProbe(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	breaker := NewCircuitBreaker(1, time.Second)
+	breaker.now = func() time.Time { return now }
+
+	breaker.Failure()
+	now = now.Add(time.Second)
+	require.NoError(t, breaker.Allow())
+
+	breaker.Release()
+	assert.NoError(t, breaker.Allow())
+}
+
+func TestCircuitBreaker_Disabled(t *testing.T) {
+	breaker := NewCircuitBreaker(0, time.Second)
+	for range 10 {
+		breaker.Failure()
+	}
+	assert.NoError(t, breaker.Allow())
+	assert.Equal(t, BreakerClosed, breaker.State())
+}
@@ -2,22 +2,62 @@ package db
 
 import (
 	"context"
+	"time"
 
 	"github.com/jmoiron/sqlx"
 	"github.com/pressly/goose/v3"
-
-	"github.com/Axel791/metricsalert/internal/server/config"
 )
 
-// ConnectDB - подключение к базе данных, применение миграций
-func ConnectDB(databaseDSN string, cfg *config.Config) (*sqlx.DB, error) {
+// PoolConfig - настройки пула соединений с базой данных. Нулевое значение
+// поля оставляет значение database/sql по умолчанию.
+type PoolConfig struct {
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	ConnMaxIdleTime time.Duration
+}
+
+// apply применяет настройки к пулу соединений db.
+func (p PoolConfig) apply(db *sqlx.DB) {
+	if p.MaxOpenConns > 0 {
+		db.SetMaxOpenConns(p.MaxOpenConns)
+	}
+	if p.MaxIdleConns > 0 {
+		db.SetMaxIdleConns(p.MaxIdleConns)
+	}
+	if p.ConnMaxLifetime > 0 {
+		db.SetConnMaxLifetime(p.ConnMaxLifetime)
+	}
+	if p.ConnMaxIdleTime > 0 {
+		db.SetConnMaxIdleTime(p.ConnMaxIdleTime)
+	}
+}
+
+// Source возвращает текущее подключение к базе или nil, если его нет.
+type Source interface {
+	DB() *sqlx.DB
+}
+
+// StaticSource - Source с подключением, открытым при старте сервера.
+type StaticSource struct {
+	Conn *sqlx.DB
+}
+
+// DB возвращает подключение, переданное при создании.
+func (s StaticSource) DB() *sqlx.DB {
+	return s.Conn
+}
+
+// ConnectDB - подключение к базе данных, настройка пула соединений и применение миграций
+func ConnectDB(databaseDSN, migrationsPath string, pool PoolConfig) (*sqlx.DB, error) {
 	if databaseDSN != "" {
 		db, err := sqlx.Connect("postgres", databaseDSN)
 		if err != nil {
 			return nil, err
 		}
+		pool.apply(db)
 
-		err = appleMigration(db, cfg)
+		err = appleMigration(db, migrationsPath)
 		if err != nil {
 			_ = db.Close()
 			return nil, err
@@ -29,6 +69,6 @@ func ConnectDB(databaseDSN string, cfg *config.Config) (*sqlx.DB, error) {
 }
 
 // appleMigration - Применение миграций
-func appleMigration(dbConn *sqlx.DB, cfg *config.Config) error {
-	return goose.RunContext(context.Background(), "up", dbConn.DB, cfg.MigrationsPath)
+func appleMigration(dbConn *sqlx.DB, migrationsPath string) error {
+	return goose.RunContext(context.Background(), "up", dbConn.DB, migrationsPath)
 }
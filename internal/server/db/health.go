@@ -0,0 +1,79 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/pressly/goose/v3"
+)
+
+// Состояния базы данных в отчёте о здоровье.
+const (
+	StatusOK          = "ok"
+	StatusUnavailable = "unavailable"
+)
+
+// PoolStats - статистика пула соединений.
+type PoolStats struct {
+	MaxOpen           int     `json:"max_open"`
+	Open              int     `json:"open"`
+	InUse             int     `json:"in_use"`
+	Idle              int     `json:"idle"`
+	WaitCount         int64   `json:"wait_count"`
+	WaitDurationMS    float64 `json:"wait_duration_ms"`
+	MaxIdleClosed     int64   `json:"max_idle_closed"`
+	MaxIdleTimeClosed int64   `json:"max_idle_time_closed"`
+	MaxLifetimeClosed int64   `json:"max_lifetime_closed"`
+}
+
+// Health - состояние базы данных: доступность, время ответа, версия
+// применённых миграций и статистика пула.
+type Health struct {
+	Status           string     `json:"status"`
+	Error            string     `json:"error,omitempty"`
+	LatencyMS        float64    `json:"latency_ms,omitempty"`
+	MigrationVersion int64      `json:"migration_version,omitempty"`
+	Pool             *PoolStats `json:"pool,omitempty"`
+}
+
+// CheckHealth проверяет соединение из общего пула db и собирает его
+// состояние. Ошибка проверки не возвращается, а попадает в Health.Error.
+func CheckHealth(ctx context.Context, db *sqlx.DB) Health {
+	health := Health{Status: StatusOK, Pool: poolStats(db)}
+
+	start := time.Now()
+	err := db.PingContext(ctx)
+	health.LatencyMS = float64(time.Since(start)) / float64(time.Millisecond)
+	if err != nil {
+		health.Status = StatusUnavailable
+		health.Error = fmt.Sprintf("ping: %v", err)
+		return health
+	}
+
+	version, err := goose.GetDBVersionContext(ctx, db.DB)
+	if err != nil {
+		health.Status = StatusUnavailable
+		health.Error = fmt.Sprintf("migration version: %v", err)
+		return health
+	}
+	health.MigrationVersion = version
+
+	return health
+}
+
+func poolStats(db *sqlx.DB) *PoolStats {
+	stats := db.Stats()
+	return &PoolStats{
+		MaxOpen:           stats.MaxOpenConnections,
+		Open:              stats.OpenConnections,
+		InUse:             stats.InUse,
+		Idle:              stats.Idle,
+		WaitCount:         stats.WaitCount,
+		WaitDurationMS:    float64(stats.WaitDuration) / float64(time.Millisecond),
+		MaxIdleClosed:     stats.MaxIdleClosed,
+		MaxIdleTimeClosed: stats.MaxIdleTimeClosed,
+		MaxLifetimeClosed: stats.MaxLifetimeClosed,
+	}
+}
@@ -1,41 +1,264 @@
 package db
 
 import (
+	"context"
+	"database/sql/driver"
 	"errors"
-	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/jackc/pgconn"
+	"github.com/lib/pq"
+
+	"github.com/Axel791/metricsalert/internal/server/telemetry"
 )
 
-// RetryOperation - выполняет операцию с повторными попытками при ошибке транспорта.
-func RetryOperation(operation func() error) error {
-	retries := []time.Duration{1 * time.Second, 3 * time.Second, 5 * time.Second}
+// retryMetrics - метрики сервера, в которые Retrier пишет число повторов и
+// состояние автомата защиты.
+var retryMetrics atomic.Pointer[telemetry.ServerMetrics]
+
+// SetTelemetry включает подсчёт повторов запросов к БД.
+func SetTelemetry(metrics *telemetry.ServerMetrics) {
+	retryMetrics.Store(metrics)
+}
+
+// RetryConfig - настройки повторов запросов к БД и автомата защиты.
+type RetryConfig struct {
+	// MaxAttempts - число попыток выполнить операцию, включая первую.
+	MaxAttempts int
+	// BaseDelay - пауза перед вторым вызовом, далее она удваивается.
+	BaseDelay time.Duration
+	// MaxDelay - верхняя граница паузы между попытками.
+	MaxDelay time.Duration
+	// BreakerThreshold - число ошибок соединения подряд, после которого
+	// автомат размыкается. 0 отключает автомат.
+	BreakerThreshold int
+	// BreakerOpenTimeout - сколько автомат остаётся разомкнутым до пробного
+	// запроса.
+	BreakerOpenTimeout time.Duration
+}
+
+// DefaultRetryConfig возвращает настройки повторов по умолчанию.
+func DefaultRetryConfig() RetryConfig {
+	return RetryConfig{
+		MaxAttempts:        3,
+		BaseDelay:          200 * time.Millisecond,
+		MaxDelay:           2 * time.Second,
+		BreakerThreshold:   5,
+		BreakerOpenTimeout: 10 * time.Second,
+	}
+}
+
+// Retrier выполняет операции с БД с повторами при ошибках соединения.
+// Паузы между попытками растут экспоненциально со случайной добавкой и
+// прерываются при отмене контекста. Пока автомат защиты разомкнут, операции
+// сразу завершаются ошибкой ErrCircuitOpen.
+type Retrier struct {
+	cfg     RetryConfig
+	breaker *CircuitBreaker
+	// random возвращает число из [0, 1) для случайной добавки к паузе.
+	random func() float64
+}
+
+// NewRetrier создаёт Retrier с настройками cfg.
+func NewRetrier(cfg RetryConfig) *Retrier {
+	if cfg.MaxAttempts < 1 {
+		cfg.MaxAttempts = 1
+	}
+	return &Retrier{
+		cfg:     cfg,
+		breaker: NewCircuitBreaker(cfg.BreakerThreshold, cfg.BreakerOpenTimeout),
+		random:  rand.Float64,
+	}
+}
+
+// Breaker возвращает автомат защиты Retrier.
+func (r *Retrier) Breaker() *CircuitBreaker {
+	return r.breaker
+}
+
+// Do выполняет operation, повторяя её при ошибках соединения. Остальные
+// ошибки возвращаются сразу: база ответила, повтор ничего не изменит.
+//
+// Do подходит для чтения и идемпотентных записей: при обрыве соединения
+// неизвестно, выполнила ли база запрос, и повтор может применить его
+// второй раз. Неидемпотентные записи выполняются через DoWrite.
+func (r *Retrier) Do(ctx context.Context, operation func(ctx context.Context) error) error {
+	return r.do(ctx, operation, IsConnectionError)
+}
+
+// DoWrite выполняет неидемпотентную запись (приращение counter, фиксацию
+// транзакции). Операция повторяется, только если запрос заведомо не изменил
+// данные (IsNotAppliedError); при прочих ошибках соединения ошибка
+// возвращается без повтора.
+func (r *Retrier) DoWrite(ctx context.Context, operation func(ctx context.Context) error) error {
+	return r.do(ctx, operation, IsNotAppliedError)
+}
+
+// do выполняет operation и повторяет её при ошибках соединения, для
+// которых retryable возвращает true. Автомат защиты учитывает все ошибки
+// соединения независимо от retryable.
+func (r *Retrier) do(
+	ctx context.Context,
+	operation func(ctx context.Context) error,
+	retryable func(err error) bool,
+) error {
+	for attempt := 1; ; attempt++ {
+		if err := r.breaker.Allow(); err != nil {
+			return err
+		}
 
-	for i, delay := range retries {
-		err := operation()
-		if err == nil {
+		err := operation(ctx)
+		switch {
+		case err == nil:
+			r.breaker.Success()
 			return nil
+		case ctx.Err() != nil:
+			// Запрос отменён клиентом - о состоянии базы это ничего не говорит.
+			r.breaker.Release()
+			return err
+		case !IsConnectionError(err):
+			r.breaker.Success()
+			return err
 		}
 
-		if isConnectionException(err) {
-			if i < len(retries)-1 {
-				time.Sleep(delay)
-				continue
-			}
+		r.breaker.Failure()
+		if attempt >= r.cfg.MaxAttempts || !retryable(err) {
+			return err
 		}
 
-		return err
+		retryMetrics.Load().IncDBRetry()
+		if sleepErr := sleepContext(ctx, r.backoff(attempt)); sleepErr != nil {
+			return errors.Join(err, sleepErr)
+		}
 	}
+}
 
-	return fmt.Errorf("operation failed after retries")
+// backoff возвращает паузу после попытки attempt: половина - экспоненциальная,
+// вторая половина - случайная, чтобы клиенты не повторяли запросы хором.
+func (r *Retrier) backoff(attempt int) time.Duration {
+	delay := r.cfg.BaseDelay << (attempt - 1)
+	if delay > r.cfg.MaxDelay || delay <= 0 {
+		delay = r.cfg.MaxDelay
+	}
+	half := delay / 2
+	return half + time.Duration(r.random()*float64(half))
 }
 
-func isConnectionException(err error) bool {
+func sleepContext(ctx context.Context, delay time.Duration) error {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// IsConnectionError сообщает, что операция не выполнена из-за недоступности
+// базы: ошибка сети, разорванное соединение или код PostgreSQL класса 08,
+// остановки сервера или нехватки соединений. Распознаются ошибки lib/pq и
+// pgconn.
+func IsConnectionError(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return isConnectionCode(string(pqErr.Code))
+	}
 	var pgErr *pgconn.PgError
 	if errors.As(err, &pgErr) {
-		return strings.HasPrefix(pgErr.Code, "08")
+		return isConnectionCode(pgErr.Code)
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// notAppliedError помечает ошибку операции, которая заведомо не изменила
+// данные.
+type notAppliedError struct {
+	err error
+}
+
+func (e *notAppliedError) Error() string {
+	return e.err.Error()
+}
+
+func (e *notAppliedError) Unwrap() error {
+	return e.err
+}
+
+// NotApplied помечает err как ошибку шага, после которого данные в базе
+// заведомо не изменились: подготовки выражения, начала транзакции или
+// запроса внутри незафиксированной транзакции. DoWrite повторяет такие
+// операции при ошибках соединения.
+func NotApplied(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &notAppliedError{err: err}
+}
+
+// IsNotAppliedError сообщает, что операция не выполнена из-за ошибки
+// соединения и запрос заведомо не изменил данные: соединение отброшено до
+// отправки запроса (driver.ErrBadConn), не удалось подключиться к базе или
+// ошибка помечена NotApplied. Обрыв соединения после отправки запроса
+// (io.ErrUnexpectedEOF, ошибки чтения и записи в сеть) сюда не относится:
+// база могла успеть выполнить запрос.
+func IsNotAppliedError(err error) bool {
+	if !IsConnectionError(err) {
+		return false
+	}
+	var marked *notAppliedError
+	if errors.Is(err, driver.ErrBadConn) || errors.As(err, &marked) {
+		return true
+	}
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return isConnectCode(string(pqErr.Code))
+	}
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return isConnectCode(pgErr.Code)
+	}
+
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+// isConnectCode сообщает, что код PostgreSQL означает отказ в подключении:
+// запрос на таком соединении не выполнялся.
+func isConnectCode(code string) bool {
+	switch code {
+	case "08001", // sqlclient_unable_to_establish_sqlconnection
+		"08004", // sqlserver_rejected_establishment_of_sqlconnection
+		"53300", // too_many_connections
+		"57P03": // cannot_connect_now
+		return true
 	}
 	return false
 }
+
+func isConnectionCode(code string) bool {
+	switch code {
+	case "53300", // too_many_connections
+		"57P01", // admin_shutdown
+		"57P02", // crash_shutdown
+		"57P03": // cannot_connect_now
+		return true
+	}
+	return strings.HasPrefix(code, "08")
+}
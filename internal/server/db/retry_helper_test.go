@@ -0,0 +1,228 @@
+package db
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgconn"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsConnectionError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "nil", err: nil, want: false},
+		{name: "pq connection failure", err: &pq.Error{Code: "08006"}, want: true},
+		{name: "pq cannot connect now", err: &pq.Error{Code: "57P03"}, want: true},
+		{name: "pq too many connections", err: &pq.Error{Code: "53300"}, want: true},
+		{name: "pq unique violation", err: &pq.Error{Code: "23505"}, want: false},
+		{name: "pgconn connection failure", err: &pgconn.PgError{Code: "08001"}, want: true},
+		{name: "wrapped pq error", err: fmt.Errorf("UpdateGauge: %w", &pq.Error{Code: "57P01"}), want: true},
+		{name: "network error", err: &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}, want: true},
+		{name: "bad connection", err: fmt.Errorf("query: %w", driver.ErrBadConn), want: true},
+		{name: "context canceled", err: context.Canceled, want: false},
+		{name: "deadline exceeded", err: context.DeadlineExceeded, want: false},
+		{name: "other error", err: errors.New("syntax error"), want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, IsConnectionError(tt.err))
+		})
+	}
+}
+
+func testRetryConfig() RetryConfig {
+	return RetryConfig{
+		MaxAttempts:        3,
+		BaseDelay:          time.Millisecond,
+		MaxDelay:           5 * time.Millisecond,
+		BreakerThreshold:   5,
+		BreakerOpenTimeout: time.Minute,
+	}
+}
+
+var errConnection = &pq.Error{Code: "08006"}
+
+func TestRetrier_RetriesConnectionErrors(t *testing.T) {
+	retrier := NewRetrier(testRetryConfig())
+
+	calls := 0
+	err := retrier.Do(context.Background(), func(context.Context) error {
+		calls++
+		if calls < 3 {
+			return errConnection
+		}
+		return nil
+	})
+
+	require.NoError(t, err)
+	assert.Equal(t, 3, calls)
+	assert.Equal(t, BreakerClosed, retrier.Breaker().State())
+}
+
+func TestRetrier_GivesUpAfterMaxAttempts(t *testing.T) {
+	retrier := NewRetrier(testRetryConfig())
+
+	calls := 0
+	err := retrier.Do(context.Background(), func(context.Context) error {
+		calls++
+		return errConnection
+	})
+
+	assert.ErrorIs(t, err, errConnection)
+	assert.Equal(t, 3, calls)
+}
+
+func TestRetrier_DoesNotRetryOtherErrors(t *testing.T) {
+	retrier := NewRetrier(testRetryConfig())
+	queryErr := &pq.Error{Code: "23505"}
+
+	calls := 0
+	err := retrier.Do(context.Background(), func(context.Context) error {
+		calls++
+		return queryErr
+	})
+
+	assert.ErrorIs(t, err, queryErr)
+	assert.Equal(t, 1, calls)
+}
+
+func TestRetrier_StopsOnContextCancel(t *testing.T) {
+	cfg := testRetryConfig()
+	cfg.BaseDelay = time.Hour
+	cfg.MaxDelay = time.Hour
+	retrier := NewRetrier(cfg)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	err := retrier.Do(ctx, func(context.Context) error {
+		return errConnection
+	})
+
+	assert.ErrorIs(t, err, errConnection)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), time.Second)
+}
+
+func TestRetrier_FailsFastWhenBreakerIsOpen(t *testing.T) {
+	cfg := testRetryConfig()
+	cfg.MaxAttempts = 1
+	cfg.BreakerThreshold = 2
+	retrier := NewRetrier(cfg)
+
+	calls := 0
+	operation := func(context.Context) error {
+		calls++
+		return errConnection
+	}
+
+	for range 2 {
+		assert.ErrorIs(t, retrier.Do(context.Background(), operation), errConnection)
+	}
+	assert.ErrorIs(t, retrier.Do(context.Background(), operation), ErrCircuitOpen)
+	assert.Equal(t, 2, calls)
+}
+
+func TestRetrier_BackoffHasJitter(t *testing.T) {
+	retrier := NewRetrier(RetryConfig{MaxAttempts: 5, BaseDelay: 100 * time.Millisecond, MaxDelay: 300 * time.Millisecond})
+
+	retrier.random = func() float64 { return 0 }
+	assert.Equal(t, 50*time.Millisecond, retrier.backoff(1))
+	assert.Equal(t, 100*time.Millisecond, retrier.backoff(2))
+	assert.Equal(t, 150*time.Millisecond, retrier.backoff(3), "delay is capped by MaxDelay")
+
+	retrier.random = func() float64 { return 0.5 }
+	assert.Equal(t, 75*time.Millisecond, retrier.backoff(1))
+}
+
+func TestIsNotAppliedError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "bad connection", err: fmt.Errorf("query: %w", driver.ErrBadConn), want: true},
+		{name: "dial error", err: &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}, want: true},
+		{name: "pq cannot connect now", err: &pq.Error{Code: "57P03"}, want: true},
+		{name: "pgconn unable to connect", err: &pgconn.PgError{Code: "08001"}, want: true},
+		{name: "marked not applied", err: NotApplied(fmt.Errorf("begin: %w", io.ErrUnexpectedEOF)), want: true},
+		{name: "unexpected EOF", err: io.ErrUnexpectedEOF, want: false},
+		{name: "read error", err: &net.OpError{Op: "read", Net: "tcp", Err: errors.New("connection reset")}, want: false},
+		{name: "pq connection failure", err: &pq.Error{Code: "08006"}, want: false},
+		{name: "marked query error", err: NotApplied(&pq.Error{Code: "23505"}), want: false},
+		{name: "nil", err: NotApplied(nil), want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, IsNotAppliedError(tt.err))
+		})
+	}
+}
+
+func TestRetrier_DoWriteDoesNotRetryAmbiguousErrors(t *testing.T) {
+	for _, connErr := range []error{
+		io.ErrUnexpectedEOF,
+		&net.OpError{Op: "read", Net: "tcp", Err: errors.New("connection reset")},
+		errConnection,
+	} {
+		t.Run(connErr.Error(), func(t *testing.T) {
+			retrier := NewRetrier(testRetryConfig())
+
+			calls := 0
+			err := retrier.DoWrite(context.Background(), func(context.Context) error {
+				calls++
+				return connErr
+			})
+
+			assert.ErrorIs(t, err, connErr)
+			assert.Equal(t, 1, calls, "the write may have been applied")
+		})
+	}
+}
+
+func TestRetrier_DoWriteRetriesNotAppliedErrors(t *testing.T) {
+	retrier := NewRetrier(testRetryConfig())
+
+	calls := 0
+	err := retrier.DoWrite(context.Background(), func(context.Context) error {
+		calls++
+		switch calls {
+		case 1:
+			return driver.ErrBadConn
+		case 2:
+			return NotApplied(errConnection)
+		}
+		return nil
+	})
+
+	require.NoError(t, err)
+	assert.Equal(t, 3, calls)
+}
+
+func TestRetrier_DoWriteCountsBreakerFailures(t *testing.T) {
+	cfg := testRetryConfig()
+	cfg.BreakerThreshold = 2
+	retrier := NewRetrier(cfg)
+
+	for range 2 {
+		assert.ErrorIs(t, retrier.DoWrite(context.Background(), func(context.Context) error {
+			return io.ErrUnexpectedEOF
+		}), io.ErrUnexpectedEOF)
+	}
+	assert.Equal(t, BreakerOpen, retrier.Breaker().State())
+}
@@ -0,0 +1,151 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/Axel791/metricsalert/internal/server/audit"
+	"github.com/Axel791/metricsalert/internal/server/model/api"
+	"github.com/Axel791/metricsalert/internal/server/model/domain"
+	"github.com/Axel791/metricsalert/internal/server/repositories"
+	"github.com/Axel791/metricsalert/internal/server/services"
+	"github.com/Axel791/metricsalert/internal/shared/logging"
+)
+
+// DeleteMetricHandler удаляет метрику. Маршрут административный и должен
+// быть закрыт middleware.AdminAuth; каждый вызов записывается в журнал аудита.
+//
+// # Request example
+//
+//	DELETE /api/v1/metrics/gauge/Aloc HTTP/1.1
+//	Authorization: Bearer <admin token>
+//
+// # Ответы
+// | Код | Когда возвращается                     |
+// |-----|----------------------------------------|
+// | 204 | Метрика удалена                        |
+// | 400 | Некорректный тип или имя метрики       |
+// | 404 | Метрики нет                            |
+// | 503 | Хранилище временно недоступно          |
+// | 500 | Ошибка хранилища                       |
+//
+// Ошибки возвращаются в формате api.ErrorResponse.
+type DeleteMetricHandler struct {
+	metricService services.Metric
+	auditor       audit.Recorder
+	logger        *log.Logger
+}
+
+// NewDeleteMetricHandler создаёт DeleteMetricHandler.
+func NewDeleteMetricHandler(
+	metricService services.Metric,
+	auditor audit.Recorder,
+	logger *log.Logger,
+) *DeleteMetricHandler {
+	return &DeleteMetricHandler{metricService: metricService, auditor: auditor, logger: logger}
+}
+
+func (h *DeleteMetricHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	key := domain.MetricKey{Name: chi.URLParam(r, "name"), MType: chi.URLParam(r, "metricType")}
+
+	err := h.metricService.DeleteMetric(r.Context(), key.MType, key.Name)
+	recordAdminAction(r, h.auditor, audit.ActionDeleteMetric, key, err)
+	if err != nil {
+		logging.Entry(r.Context(), h.logger).Warnf("error deleting metric %s: %v", key, err)
+		writeServiceError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ResetCounterHandler обнуляет counter и возвращает его в формате api.Metrics.
+// Маршрут административный, как и у DeleteMetricHandler.
+//
+// # Request example
+//
+//	POST /api/v1/metrics/counter/PollCount/reset HTTP/1.1
+//	Authorization: Bearer <admin token>
+//
+// # Successful response example
+//
+//	HTTP/1.1 200 OK
+//	Content-Type: application/json
+//
+//	{"id": "PollCount", "type": "counter", "delta": 0}
+//
+// # Ответы
+// | Код | Когда возвращается                     |
+// |-----|----------------------------------------|
+// | 200 | Counter обнулён                        |
+// | 400 | Тип не counter или пустое имя          |
+// | 404 | Counter нет                            |
+// | 503 | Хранилище временно недоступно          |
+// | 500 | Ошибка хранилища                       |
+//
+// Ошибки возвращаются в формате api.ErrorResponse.
+type ResetCounterHandler struct {
+	metricService services.Metric
+	auditor       audit.Recorder
+	logger        *log.Logger
+}
+
+// NewResetCounterHandler создаёт ResetCounterHandler.
+func NewResetCounterHandler(
+	metricService services.Metric,
+	auditor audit.Recorder,
+	logger *log.Logger,
+) *ResetCounterHandler {
+	return &ResetCounterHandler{metricService: metricService, auditor: auditor, logger: logger}
+}
+
+func (h *ResetCounterHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	key := domain.MetricKey{Name: chi.URLParam(r, "name"), MType: chi.URLParam(r, "metricType")}
+	if key.MType != domain.Counter {
+		writeError(w, http.StatusBadRequest, api.ErrCodeInvalidMetric, "only counter metrics can be reset")
+		return
+	}
+
+	metric, err := h.metricService.ResetCounter(r.Context(), key.Name)
+	recordAdminAction(r, h.auditor, audit.ActionResetCounter, key, err)
+	if err != nil {
+		logging.Entry(r.Context(), h.logger).Warnf("error resetting counter %s: %v", key, err)
+		writeServiceError(w, err)
+		return
+	}
+
+	delta := metric.Delta.Int64
+	response := api.Metrics{ID: metric.ID, MType: metric.MType, Delta: &delta}
+	setMetadata(&response, metric)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err = json.NewEncoder(w).Encode(response); err != nil {
+		logging.Entry(r.Context(), h.logger).Errorf("error encoding response: %v", err)
+	}
+}
+
+// recordAdminAction записывает административное действие в журнал аудита.
+func recordAdminAction(r *http.Request, auditor audit.Recorder, action string, key domain.MetricKey, err error) {
+	event := audit.Event{
+		Time:      time.Now(),
+		Action:    action,
+		Metric:    key.String(),
+		Actor:     r.RemoteAddr,
+		SourceIP:  sourceIP(r),
+		RequestID: logging.RequestIDFromContext(r.Context()),
+		Outcome:   audit.OutcomeSuccess,
+	}
+	switch {
+	case errors.Is(err, repositories.ErrNotFound):
+		event.Outcome = audit.OutcomeNotFound
+	case err != nil:
+		event.Outcome = audit.OutcomeError
+		event.Error = err.Error()
+	}
+	auditor.Record(r.Context(), event)
+}
@@ -0,0 +1,144 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Axel791/metricsalert/internal/server/audit"
+	"github.com/Axel791/metricsalert/internal/server/middleware"
+	"github.com/Axel791/metricsalert/internal/server/model/api"
+	"github.com/Axel791/metricsalert/internal/server/model/domain"
+	"github.com/Axel791/metricsalert/internal/server/repositories"
+	"github.com/Axel791/metricsalert/internal/server/services"
+)
+
+// auditLog запоминает события аудита.
+type auditLog struct {
+	events []audit.Event
+}
+
+func (a *auditLog) Record(_ context.Context, event audit.Event) {
+	a.events = append(a.events, event)
+}
+
+func newAdminRouter(t *testing.T, token string) (http.Handler, repositories.Store, *auditLog) {
+	t.Helper()
+
+	store := repositories.NewMetricMapRepository()
+	_, err := store.UpdateGauge(context.Background(), "Aloc", 1.5)
+	require.NoError(t, err)
+	_, err = store.UpdateCounter(context.Background(), "PollCount", 7)
+	require.NoError(t, err)
+
+	service := services.NewMetricsService(store)
+	auditor := &auditLog{}
+
+	router := chi.NewRouter()
+	router.Group(func(admin chi.Router) {
+		admin.Use(middleware.AdminAuth(token))
+		admin.Method(http.MethodDelete, "/api/v1/metrics/{metricType}/{name}",
+			NewDeleteMetricHandler(service, auditor, log.New()))
+		admin.Method(http.MethodPost, "/api/v1/metrics/{metricType}/{name}/reset",
+			NewResetCounterHandler(service, auditor, log.New()))
+	})
+	return router, store, auditor
+}
+
+func adminRequest(method, target, token string) *http.Request {
+	req := httptest.NewRequest(method, target, nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return req
+}
+
+func TestAdminAuth(t *testing.T) {
+	tests := []struct {
+		name       string
+		configured string
+		presented  string
+		wantStatus int
+		wantCode   string
+	}{
+		{"no token", "secret", "", http.StatusUnauthorized, api.ErrCodeUnauthorized},
+		{"wrong token", "secret", "guess", http.StatusUnauthorized, api.ErrCodeUnauthorized},
+		{"admin API disabled", "", "secret", http.StatusForbidden, api.ErrCodeForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router, store, auditor := newAdminRouter(t, tt.configured)
+
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, adminRequest(http.MethodDelete, "/api/v1/metrics/gauge/Aloc", tt.presented))
+
+			assert.Equal(t, tt.wantStatus, rr.Code)
+			assert.Equal(t, tt.wantCode, decodeAPIError(t, rr).Code)
+			assert.Empty(t, auditor.events)
+			_, err := store.GetMetric(context.Background(), domain.Metrics{Name: "Aloc", MType: domain.Gauge})
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestDeleteMetricHandler(t *testing.T) {
+	router, store, auditor := newAdminRouter(t, "secret")
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, adminRequest(http.MethodDelete, "/api/v1/metrics/gauge/Aloc", "secret"))
+	assert.Equal(t, http.StatusNoContent, rr.Code)
+
+	_, err := store.GetMetric(context.Background(), domain.Metrics{Name: "Aloc", MType: domain.Gauge})
+	assert.ErrorIs(t, err, repositories.ErrNotFound)
+
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, adminRequest(http.MethodDelete, "/api/v1/metrics/gauge/Aloc", "secret"))
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, adminRequest(http.MethodDelete, "/api/v1/metrics/histogram/Aloc", "secret"))
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+	require.Len(t, auditor.events, 3)
+	assert.Equal(t, audit.ActionDeleteMetric, auditor.events[0].Action)
+	assert.Equal(t, "gauge/Aloc", auditor.events[0].Metric)
+	assert.Equal(t, audit.OutcomeSuccess, auditor.events[0].Outcome)
+	assert.NotEmpty(t, auditor.events[0].Actor)
+	assert.Equal(t, audit.OutcomeNotFound, auditor.events[1].Outcome)
+	assert.Equal(t, audit.OutcomeError, auditor.events[2].Outcome)
+}
+
+func TestResetCounterHandler(t *testing.T) {
+	router, store, auditor := newAdminRouter(t, "secret")
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, adminRequest(http.MethodPost, "/api/v1/metrics/counter/PollCount/reset", "secret"))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	counter, err := store.GetMetric(context.Background(), domain.Metrics{Name: "PollCount", MType: domain.Counter})
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), counter.Delta.Int64)
+	assert.JSONEq(t, fmt.Sprintf(`{"id":"PollCount","type":"counter","delta":0,"updated_at":%q}`,
+		counter.UpdatedAt.UTC().Format(time.RFC3339Nano)), rr.Body.String())
+
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, adminRequest(http.MethodPost, "/api/v1/metrics/gauge/Aloc/reset", "secret"))
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, adminRequest(http.MethodPost, "/api/v1/metrics/counter/Missing/reset", "secret"))
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+
+	require.Len(t, auditor.events, 2)
+	assert.Equal(t, audit.ActionResetCounter, auditor.events[0].Action)
+	assert.Equal(t, audit.OutcomeSuccess, auditor.events[0].Outcome)
+	assert.Equal(t, audit.OutcomeNotFound, auditor.events[1].Outcome)
+}
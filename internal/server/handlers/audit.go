@@ -0,0 +1,39 @@
+package handlers
+
+import (
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/Axel791/metricsalert/internal/server/audit"
+	"github.com/Axel791/metricsalert/internal/server/model/api"
+	"github.com/Axel791/metricsalert/internal/shared"
+	"github.com/Axel791/metricsalert/internal/shared/logging"
+)
+
+// RecordUpdate записывает в журнал аудита принятые метрики обновления.
+// Используется и устаревшими хэндлерами пакета deprecated.
+func RecordUpdate(r *http.Request, auditor audit.Recorder, metrics []api.Metrics) {
+	if len(metrics) == 0 {
+		return
+	}
+	auditor.Record(r.Context(), audit.Event{
+		Time:      time.Now(),
+		Action:    audit.ActionUpdateMetrics,
+		Metrics:   metrics,
+		SourceIP:  sourceIP(r),
+		Agent:     r.Header.Get(shared.AgentIDHeader),
+		RequestID: logging.RequestIDFromContext(r.Context()),
+		Outcome:   audit.OutcomeSuccess,
+	})
+}
+
+// sourceIP возвращает IP-адрес клиента из RemoteAddr. X-Forwarded-For не
+// учитывается: клиент может подставить в него что угодно.
+func sourceIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
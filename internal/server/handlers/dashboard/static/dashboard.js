@@ -0,0 +1,107 @@
+// Панель метрик: мгновенный поиск по имени и автообновление таблицы без
+// перезагрузки страницы. Без JavaScript те же возможности дают параметры
+// запроса q, sort, group и refresh.
+(function () {
+    'use strict';
+
+    var search = document.getElementById('search');
+    var grouped = document.getElementById('grouped');
+    var refresh = document.getElementById('refresh');
+    var timer = null;
+    var pending = null;
+
+    // pageURL возвращает адрес страницы с текущими значениями элементов
+    // управления.
+    function pageURL() {
+        var url = new URL(window.location.href);
+        var query = search.value.trim();
+        if (query === '') {
+            url.searchParams.delete('q');
+        } else {
+            url.searchParams.set('q', query);
+        }
+        if (grouped.checked) {
+            url.searchParams.delete('group');
+        } else {
+            url.searchParams.set('group', 'none');
+        }
+        url.searchParams.set('refresh', refresh.value);
+        return url;
+    }
+
+    // filterRows скрывает строки, имя которых не содержит строку поиска, и
+    // группы без видимых строк.
+    function filterRows() {
+        var needle = search.value.trim().toLowerCase();
+        document.querySelectorAll('#metrics tbody').forEach(function (group) {
+            var visible = 0;
+            group.querySelectorAll('tr:not(.group)').forEach(function (row) {
+                var match = row.cells[0].textContent.toLowerCase().indexOf(needle) !== -1;
+                row.hidden = !match;
+                if (match) {
+                    visible++;
+                }
+            });
+            group.hidden = visible === 0;
+        });
+    }
+
+    // reload загружает страницу заново и заменяет сводку, алерты и таблицу.
+    function reload() {
+        if (document.hidden) {
+            return;
+        }
+        fetch(pageURL(), {headers: {Accept: 'text/html'}})
+            .then(function (response) {
+                if (!response.ok) {
+                    throw new Error('HTTP ' + response.status);
+                }
+                return response.text();
+            })
+            .then(function (html) {
+                var next = new DOMParser().parseFromString(html, 'text/html');
+                ['summary', 'alerts', 'metrics'].forEach(function (id) {
+                    var current = document.getElementById(id);
+                    var fresh = next.getElementById(id);
+                    if (current && fresh) {
+                        current.replaceWith(fresh);
+                    }
+                });
+                filterRows();
+            })
+            .catch(function (err) {
+                document.getElementById('summary').textContent = 'Не удалось обновить: ' + err.message;
+            });
+    }
+
+    // schedule перезапускает таймер автообновления.
+    function schedule() {
+        if (timer !== null) {
+            clearInterval(timer);
+            timer = null;
+        }
+        var seconds = parseInt(refresh.value, 10);
+        if (seconds > 0) {
+            timer = setInterval(reload, seconds * 1000);
+        }
+    }
+
+    // Строки, отброшенные сервером по прежней строке поиска, появятся
+    // после перезагрузки таблицы.
+    search.addEventListener('input', function () {
+        filterRows();
+        window.history.replaceState(null, '', pageURL());
+        clearTimeout(pending);
+        pending = setTimeout(reload, 300);
+    });
+    grouped.addEventListener('change', function () {
+        window.location.assign(pageURL());
+    });
+    refresh.addEventListener('change', function () {
+        window.history.replaceState(null, '', pageURL());
+        schedule();
+    });
+
+    filterRows();
+    schedule();
+}());
@@ -1,28 +1,39 @@
 package handlers
 
 import (
+	"context"
 	"net/http"
+	"time"
 
-	"github.com/jmoiron/sqlx"
+	"github.com/Axel791/metricsalert/internal/server/db"
 )
 
-// DatabaseHealthCheckHandler - структура хэндлера проверки состояния базы данных
+// DatabaseHealthCheckHandler - структура хэндлера проверки состояния базы данных.
+// Проверка идёт через общий пул соединений сервера и ограничена таймаутом.
 type DatabaseHealthCheckHandler struct {
-	databaseDSN string
+	database db.Source
+	timeout  time.Duration
 }
 
 // NewDatabaseHealthCheckHandler - конструктор хэндлера проверки состояния базы данных
-func NewDatabaseHealthCheckHandler(databaseDSN string) *DatabaseHealthCheckHandler {
-	return &DatabaseHealthCheckHandler{databaseDSN: databaseDSN}
+func NewDatabaseHealthCheckHandler(database db.Source, timeout time.Duration) *DatabaseHealthCheckHandler {
+	return &DatabaseHealthCheckHandler{database: database, timeout: timeout}
 }
 
 // ServeHTTP - обработчик запроса
-func (dh *DatabaseHealthCheckHandler) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
-	db, err := sqlx.Connect("postgres", dh.databaseDSN)
-	if err != nil {
+func (dh *DatabaseHealthCheckHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	conn := dh.database.DB()
+	if conn == nil {
+		http.Error(w, "database is not connected", http.StatusInternalServerError)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), dh.timeout)
+	defer cancel()
+
+	if err := conn.PingContext(ctx); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	defer db.Close()
 	w.WriteHeader(http.StatusOK)
 }
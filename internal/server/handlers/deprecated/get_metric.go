@@ -1,8 +1,8 @@
 package deprecated
 
 import (
+	"errors"
 	"fmt"
-	"log"
 	"net/http"
 	"strconv"
 
@@ -10,6 +10,7 @@ import (
 
 	"github.com/Axel791/metricsalert/internal/server/model/domain"
 	"github.com/Axel791/metricsalert/internal/server/repositories"
+	"github.com/Axel791/metricsalert/internal/shared/logging"
 )
 
 // GetMetricHandler - структура хэндлера получения метрик [устаревший]
@@ -43,14 +44,17 @@ func (h *GetMetricHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 
 	value, err := h.storage.GetMetric(r.Context(), metric)
-	if err != nil {
-		http.Error(w, fmt.Sprintf("error get metric: %v", err), http.StatusInternalServerError)
+	if errors.Is(err, repositories.ErrNotFound) {
+		logging.FromContext(r.Context()).Infof("GetMetricHandler: metric not found: %s (type: %s)", name, metricType)
+		http.Error(w, "metric not found", http.StatusNotFound)
 		return
 	}
-
-	if value.Name == "" {
-		log.Printf("GetMetricHandler: metric not found: %s (type: %s)", name, metricType)
-		http.Error(w, "metric not found", http.StatusNotFound)
+	if errors.Is(err, repositories.ErrUnavailable) {
+		http.Error(w, "metrics store is temporarily unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("error get metric: %v", err), http.StatusInternalServerError)
 		return
 	}
 
@@ -69,7 +73,7 @@ func (h *GetMetricHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			valueStr = "null"
 		}
 	default:
-		log.Printf("unknown metric type: %s", value.MType)
+		logging.FromContext(r.Context()).Warnf("unknown metric type: %s", value.MType)
 		valueStr = "unknown"
 	}
 
@@ -79,7 +83,7 @@ func (h *GetMetricHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 	_, err = w.Write([]byte(valueStr))
 	if err != nil {
-		log.Printf(
+		logging.FromContext(r.Context()).Errorf(
 			"GetMetricHandler: invalid metric %s (type: %s): %v", name, metricType, err,
 		)
 		http.Error(w, "invalid metric", http.StatusInternalServerError)
@@ -1,12 +1,19 @@
 package deprecated
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
 
 	"github.com/go-chi/chi/v5"
+	log "github.com/sirupsen/logrus"
 
+	"github.com/Axel791/metricsalert/internal/server/audit"
+	"github.com/Axel791/metricsalert/internal/server/handlers"
+	"github.com/Axel791/metricsalert/internal/server/model/api"
 	"github.com/Axel791/metricsalert/internal/server/repositories"
+	"github.com/Axel791/metricsalert/internal/server/services"
+	"github.com/Axel791/metricsalert/internal/shared/logging"
 )
 
 const (
@@ -16,12 +23,24 @@ const (
 
 // UpdateMetricHandler - структура хэндлера обновления метрик [устаревший]
 type UpdateMetricHandler struct {
-	storage repositories.Store
+	metricService services.Metric
+	auditor       audit.Recorder
+	logger        *log.Logger
 }
 
-// NewUpdateMetricHandler - конструктор хэндлера обновления метрик [устаревший]
-func NewUpdateMetricHandler(storage repositories.Store) *UpdateMetricHandler {
-	return &UpdateMetricHandler{storage}
+// NewUpdateMetricHandler - конструктор хэндлера обновления метрик [устаревший].
+// Метрика записывается через MetricService и попадает в журнал аудита, как
+// и при обновлении через JSON API.
+func NewUpdateMetricHandler(
+	metricService services.Metric,
+	auditor audit.Recorder,
+	logger *log.Logger,
+) *UpdateMetricHandler {
+	return &UpdateMetricHandler{
+		metricService: metricService,
+		auditor:       auditor,
+		logger:        logger,
+	}
 }
 
 // ServeHTTP - обработчик запроса
@@ -35,8 +54,7 @@ func (h *UpdateMetricHandler) ServeHTTP(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	ctx := r.Context()
-
+	input := api.Metrics{ID: name, MType: metricType}
 	switch metricType {
 	case Gauge:
 		v, err := strconv.ParseFloat(value, 64)
@@ -44,10 +62,7 @@ func (h *UpdateMetricHandler) ServeHTTP(w http.ResponseWriter, r *http.Request)
 			http.Error(w, "invalid gauge value", http.StatusBadRequest)
 			return
 		}
-		_, err = h.storage.UpdateGauge(ctx, name, v)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-		}
+		input.Value = &v
 
 	case Counter:
 		v, err := strconv.ParseInt(value, 10, 64)
@@ -55,15 +70,26 @@ func (h *UpdateMetricHandler) ServeHTTP(w http.ResponseWriter, r *http.Request)
 			http.Error(w, "Invalid counter value", http.StatusBadRequest)
 			return
 		}
-		_, err = h.storage.UpdateCounter(ctx, name, v)
-		if err != nil {
-			http.Error(w, "Invalid counter value", http.StatusBadRequest)
-		}
+		input.Delta = &v
 	default:
 		http.Error(w, "invalid metric type", http.StatusBadRequest)
 		return
 	}
 
+	if _, err := h.metricService.CreateOrUpdateMetric(r.Context(), input); err != nil {
+		logging.Entry(r.Context(), h.logger).Errorf("UpdateMetricHandler [deprecated]: failed to update metric: %v", err)
+		switch {
+		case errors.Is(err, repositories.ErrUnavailable):
+			http.Error(w, "metrics store is temporarily unavailable", http.StatusServiceUnavailable)
+		case errors.Is(err, services.ErrInvalidMetric):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		default:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+	handlers.RecordUpdate(r, h.auditor, []api.Metrics{input})
+
 	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
 	w.Header().Set("Content-Length:", value)
 	w.WriteHeader(http.StatusOK)
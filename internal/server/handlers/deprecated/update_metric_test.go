@@ -1,6 +1,7 @@
 package deprecated
 
 import (
+	"context"
 	"flag"
 	"net/http"
 	"net/http/httptest"
@@ -8,14 +9,29 @@ import (
 
 	"gopkg.in/guregu/null.v4"
 
+	"github.com/Axel791/metricsalert/internal/server/audit"
+	"github.com/Axel791/metricsalert/internal/server/model/api"
 	"github.com/Axel791/metricsalert/internal/server/model/domain"
+	"github.com/Axel791/metricsalert/internal/server/repositories"
 	"github.com/Axel791/metricsalert/internal/server/repositories/mocks"
+	"github.com/Axel791/metricsalert/internal/server/services"
 
 	"github.com/go-chi/chi/v5"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
 )
 
+// auditLog запоминает события аудита.
+type auditLog struct {
+	events []audit.Event
+}
+
+func (a *auditLog) Record(_ context.Context, event audit.Event) {
+	a.events = append(a.events, event)
+}
+
 func TestUpdateMetricHandler(t *testing.T) {
 	originalFlagSet := flag.CommandLine
 	defer func() {
@@ -27,7 +43,7 @@ func TestUpdateMetricHandler(t *testing.T) {
 
 	mockStore := new(mocks.MockStore)
 
-	handler := NewUpdateMetricHandler(mockStore)
+	handler := NewUpdateMetricHandler(services.NewMetricsService(mockStore), audit.Discard, log.New())
 
 	router := chi.NewRouter()
 	router.Post("/update/{metricType}/{name}/{value}", handler.ServeHTTP)
@@ -78,6 +94,25 @@ func TestUpdateMetricHandler(t *testing.T) {
 			expectedStatus: http.StatusBadRequest,
 			mockBehavior:   func() {},
 		},
+		{
+			name:           "Invalid Counter Value",
+			urlPath:        "/update/counter/testMetric/1.5",
+			method:         http.MethodPost,
+			expectedStatus: http.StatusBadRequest,
+			mockBehavior:   func() {},
+		},
+		{
+			name:           "Store Unavailable",
+			urlPath:        "/update/counter/testMetric/1",
+			method:         http.MethodPost,
+			expectedStatus: http.StatusServiceUnavailable,
+			mockBehavior: func() {
+				mockStore.
+					On("UpdateCounter", mock.Anything, "testMetric", int64(1)).
+					Return(domain.Metrics{}, repositories.ErrUnavailable).
+					Once()
+			},
+		},
 		{
 			name:           "Invalid HTTP Method",
 			urlPath:        "/update/gauge/testMetric/123.45",
@@ -102,3 +137,31 @@ func TestUpdateMetricHandler(t *testing.T) {
 		})
 	}
 }
+
+func TestUpdateMetricHandlerRecordsAudit(t *testing.T) {
+	mockStore := new(mocks.MockStore)
+	mockStore.
+		On("UpdateCounter", mock.Anything, "PollCount", int64(3)).
+		Return(domain.Metrics{Name: "PollCount", MType: Counter, Delta: null.NewInt(10, true)}, nil).
+		Once()
+
+	auditor := &auditLog{}
+	router := chi.NewRouter()
+	router.Method(http.MethodPost, "/update/{metricType}/{name}/{value}",
+		NewUpdateMetricHandler(services.NewMetricsService(mockStore), auditor, log.New()))
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/update/counter/PollCount/3", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	delta := int64(3)
+	require.Len(t, auditor.events, 1)
+	assert.Equal(t, audit.ActionUpdateMetrics, auditor.events[0].Action)
+	assert.Equal(t, []api.Metrics{{ID: "PollCount", MType: Counter, Delta: &delta}}, auditor.events[0].Metrics)
+	mockStore.AssertExpectations(t)
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/update/counter/PollCount/x", nil))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Len(t, auditor.events, 1, "rejected updates are not audited")
+}
@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/Axel791/metricsalert/internal/server/model/api"
+	"github.com/Axel791/metricsalert/internal/server/repositories"
+	"github.com/Axel791/metricsalert/internal/server/services"
+)
+
+// writeUnavailable отвечает 503, если err означает временную недоступность
+// хранилища, и сообщает, был ли отправлен ответ.
+func writeUnavailable(w http.ResponseWriter, err error) bool {
+	if !errors.Is(err, repositories.ErrUnavailable) {
+		return false
+	}
+	http.Error(w, "metrics store is temporarily unavailable", http.StatusServiceUnavailable)
+	return true
+}
+
+// writeError отвечает ошибкой API /api/v1 в формате api.ErrorResponse.
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	writeErrorResponse(w, status, api.Error{Code: code, Message: message})
+}
+
+func writeErrorResponse(w http.ResponseWriter, status int, apiErr api.Error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(api.ErrorResponse{Error: apiErr})
+}
+
+// writeServiceError отвечает ошибкой API /api/v1, код которой выбирается по
+// ошибке сервиса метрик.
+func writeServiceError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, repositories.ErrUnavailable):
+		writeError(w, http.StatusServiceUnavailable, api.ErrCodeUnavailable, "metrics store is temporarily unavailable")
+	case errors.Is(err, repositories.ErrInvalidQuery):
+		writeError(w, http.StatusBadRequest, api.ErrCodeInvalidRequest, err.Error())
+	case errors.Is(err, services.ErrInvalidMetricKey), errors.Is(err, services.ErrInvalidMetric):
+		writeError(w, http.StatusBadRequest, api.ErrCodeInvalidMetric, err.Error())
+	case errors.Is(err, repositories.ErrNotFound):
+		writeError(w, http.StatusNotFound, api.ErrCodeNotFound, "metric not found")
+	default:
+		writeError(w, http.StatusInternalServerError, api.ErrCodeInternal, http.StatusText(http.StatusInternalServerError))
+	}
+}
+
+// NotFoundJSON отвечает 404 в формате api.ErrorResponse на неизвестные
+// маршруты /api/v1.
+func NotFoundJSON(w http.ResponseWriter, _ *http.Request) {
+	writeError(w, http.StatusNotFound, api.ErrCodeNotFound, "route not found")
+}
+
+// MethodNotAllowedJSON отвечает 405 в формате api.ErrorResponse.
+func MethodNotAllowedJSON(w http.ResponseWriter, _ *http.Request) {
+	writeError(w, http.StatusMethodNotAllowed, api.ErrCodeMethodNotAllowed, "method not allowed")
+}
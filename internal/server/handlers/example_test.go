@@ -11,7 +11,9 @@ import (
 	"github.com/Axel791/metricsalert/internal/server/model/dto"
 	"gopkg.in/guregu/null.v4"
 
+	"github.com/Axel791/metricsalert/internal/server/audit"
 	"github.com/Axel791/metricsalert/internal/server/model/api"
+	"github.com/Axel791/metricsalert/internal/server/services"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -47,14 +49,48 @@ func (s *stubMetricService) GetAllMetric(_ context.Context) ([]dto.Metrics, erro
 	return res, nil
 }
 
+// ListMetrics возвращает все метрики одной страницей без фильтра.
+func (s *stubMetricService) ListMetrics(ctx context.Context, _ services.ListQuery) (services.MetricsPage, error) {
+	metrics, err := s.GetAllMetric(ctx)
+	return services.MetricsPage{Metrics: metrics}, err
+}
+
 // BatchMetricsUpdate сохраняет несколько метрик.
-func (s *stubMetricService) BatchMetricsUpdate(_ context.Context, metrics []api.Metrics) error {
-	for _, m := range metrics {
+func (s *stubMetricService) BatchMetricsUpdate(
+	_ context.Context,
+	metrics []api.Metrics,
+	_ bool,
+) (services.BatchResult, error) {
+	var result services.BatchResult
+	for i, m := range metrics {
 		s.store[m.ID] = m
+		result.Accepted = append(result.Accepted, services.BatchItem{Index: i, ID: m.ID, MType: m.MType})
+	}
+	return result, nil
+}
+
+// DeleteMetric удаляет метрику из памяти.
+func (s *stubMetricService) DeleteMetric(_ context.Context, metricType, name string) error {
+	m, ok := s.store[name]
+	if !ok || m.MType != metricType {
+		return fmt.Errorf("not found")
 	}
+	delete(s.store, name)
 	return nil
 }
 
+// ResetCounter обнуляет counter в памяти.
+func (s *stubMetricService) ResetCounter(_ context.Context, name string) (dto.Metrics, error) {
+	m, ok := s.store[name]
+	if !ok || m.MType != "counter" {
+		return dto.Metrics{}, fmt.Errorf("not found")
+	}
+	zero := int64(0)
+	m.Delta = &zero
+	s.store[name] = m
+	return dtoFromAPI(m), nil
+}
+
 // dtoFromAPI конвертирует api.Metrics → dto.Metrics c использованием null.Int/Float.
 func dtoFromAPI(m api.Metrics) dto.Metrics {
 	var d dto.Metrics
@@ -71,7 +107,7 @@ func dtoFromAPI(m api.Metrics) dto.Metrics {
 
 func ExampleUpdateMetricHandler() {
 	svc := newStubService()
-	h := NewUpdateMetricHandler(svc, log.New())
+	h := NewUpdateMetricHandler(svc, audit.Discard, log.New())
 
 	payload := api.Metrics{ID: "Alloc", MType: "gauge", Value: floatPtr(6.27)}
 	body, _ := json.Marshal(payload)
@@ -103,7 +139,7 @@ func ExampleGetMetricHandler() {
 
 func ExampleUpdatesMetricsHandler() {
 	svc := newStubService()
-	h := NewUpdatesMetricsHandler(svc, log.New())
+	h := NewUpdatesMetricsHandler(svc, audit.Discard, log.New())
 
 	batch := []api.Metrics{
 		{ID: "Alloc", MType: "gauge", Value: floatPtr(7.01)},
@@ -123,9 +159,9 @@ func ExampleUpdatesMetricsHandler() {
 func ExampleGetMetricsHTMLHandler() {
 	svc := newStubService()
 	_, _ = svc.CreateOrUpdateMetric(context.Background(), api.Metrics{ID: "Alloc", MType: "gauge", Value: floatPtr(6.27)})
-	_ = svc.BatchMetricsUpdate(context.Background(), []api.Metrics{{ID: "PollCount", MType: "counter", Delta: intPtr(3)}})
+	_, _ = svc.BatchMetricsUpdate(context.Background(), []api.Metrics{{ID: "PollCount", MType: "counter", Delta: intPtr(3)}}, false)
 
-	h := NewGetMetricsHTMLHandler(svc)
+	h := NewGetMetricsHTMLHandler(svc, nil, nil, log.New())
 	rr := httptest.NewRecorder()
 	req := httptest.NewRequest(http.MethodGet, "/", nil)
 
@@ -6,7 +6,9 @@ import (
 
 	"github.com/Axel791/metricsalert/internal/server/model/api"
 	"github.com/Axel791/metricsalert/internal/server/model/domain"
+	"github.com/Axel791/metricsalert/internal/server/model/dto"
 	"github.com/Axel791/metricsalert/internal/server/services"
+	"github.com/Axel791/metricsalert/internal/shared/logging"
 
 	log "github.com/sirupsen/logrus"
 )
@@ -28,12 +30,16 @@ import (
 //	HTTP/1.1 200 OK
 //	Content-Type: application/json
 //
-//	{"id": "Alloc", "type": "gauge", "value": 6.27}
+//	{"id": "Alloc", "type": "gauge", "value": 6.27, "updated_at": "2026-10-19T12:00:00Z"}
+//
+// Метрика, не обновлявшаяся дольше срока из настроек устаревания,
+// отдаётся с "stale": true.
 //
 // # Possible error responses
 //
 //	400 – malformed JSON request body;
 //	404 – metric not found;
+//	503 – metric store is temporarily unavailable;
 //	500 – failed to encode response.
 //
 // Обработчик делегирует бизнес-логику реализации services.Metric
@@ -63,14 +69,17 @@ func (h *GetMetricHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	var input api.GetMetric
 
 	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
-		h.logger.Infof("failed to decode request body: %v", err)
+		logging.Entry(r.Context(), h.logger).Warnf("failed to decode request body: %v", err)
 		http.Error(w, "invalid request body", http.StatusBadRequest)
 		return
 	}
 
 	metricDTO, err := h.metricService.GetMetric(r.Context(), input.MType, input.ID)
 	if err != nil {
-		h.logger.Infof("error getting metric: %v", err)
+		logging.Entry(r.Context(), h.logger).Warnf("error getting metric: %v", err)
+		if writeUnavailable(w, err) {
+			return
+		}
 		http.Error(w, err.Error(), http.StatusNotFound)
 		return
 	}
@@ -87,12 +96,24 @@ func (h *GetMetricHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	if metricDTO.MType == domain.Gauge {
 		apiResponse.Value = &metricDTO.Value.Float64
 	}
+	setMetadata(&apiResponse, metricDTO)
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	if err := json.NewEncoder(w).Encode(apiResponse); err != nil {
-		h.logger.Infof("error encoding response: %v", err)
+		logging.Entry(r.Context(), h.logger).Errorf("error encoding response: %v", err)
 		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 		return
 	}
 }
+
+// setMetadata дополняет ответ метками, временем обновления метрики и
+// признаком устаревания.
+func setMetadata(response *api.Metrics, metric dto.Metrics) {
+	response.Labels = metric.Labels
+	if !metric.UpdatedAt.IsZero() {
+		updatedAt := metric.UpdatedAt.UTC()
+		response.UpdatedAt = &updatedAt
+	}
+	response.Stale = metric.Stale
+}
@@ -18,6 +18,8 @@ import (
 	"github.com/Axel791/metricsalert/internal/server/services/mock"
 
 	"github.com/golang/mock/gomock"
+	log "github.com/sirupsen/logrus"
+	logtest "github.com/sirupsen/logrus/hooks/test"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -47,7 +49,7 @@ func TestGetMetricHandler_ServeHTTP(t *testing.T) {
 			expectedBody: api.Metrics{
 				ID:    "testCounter",
 				MType: domain.Counter,
-				Delta: int64Ptr(42),
+				Delta: int64Ptr(43),
 			},
 		},
 		{
@@ -59,9 +61,9 @@ func TestGetMetricHandler_ServeHTTP(t *testing.T) {
 			mockSetup: func(m *mock.MockMetric) {
 				m.EXPECT().GetMetric(gomock.Any(), domain.Gauge, "testGauge").
 					Return(dto.Metrics{
-						ID:    "testCounter",
-						MType: domain.Counter,
-						Delta: null.Int{NullInt64: sql.NullInt64{Int64: 52, Valid: true}},
+						ID:    "testGauge",
+						MType: domain.Gauge,
+						Value: null.Float{NullFloat64: sql.NullFloat64{Float64: 3.14, Valid: true}},
 					}, nil)
 			},
 			expectedStatus: http.StatusOK,
@@ -85,11 +87,8 @@ func TestGetMetricHandler_ServeHTTP(t *testing.T) {
 			expectedBody:   "metric not found",
 		},
 		{
-			name: "invalid request body",
-			input: api.GetMetric{
-				MType: "invalidType",
-				ID:    "",
-			},
+			name:           "invalid request body",
+			input:          api.GetMetric{},
 			mockSetup:      func(_ *mock.MockMetric) {},
 			expectedStatus: http.StatusBadRequest,
 			expectedBody:   "invalid request body",
@@ -104,7 +103,7 @@ func TestGetMetricHandler_ServeHTTP(t *testing.T) {
 			mockMetric := mock.NewMockMetric(ctrl)
 			tt.mockSetup(mockMetric)
 
-			handler := NewGetMetricHandler(mockMetric, nil)
+			handler := NewGetMetricHandler(mockMetric, log.New())
 
 			var reqBody []byte
 			var err error
@@ -147,15 +146,22 @@ func TestGetMetricHandler_EncodingError(t *testing.T) {
 			Delta: null.Int{NullInt64: sql.NullInt64{Int64: 43, Valid: true}},
 		}, nil)
 
-	handler := NewGetMetricHandler(mockMetric, nil)
+	logger, hook := logtest.NewNullLogger()
+	handler := NewGetMetricHandler(mockMetric, logger)
 
-	req, err := http.NewRequest(http.MethodPost, "/", bytes.NewBufferString(`{"mtype":"counter","id":"testCounter"}`))
+	req, err := http.NewRequest(http.MethodPost, "/", bytes.NewBufferString(`{"type":"counter","id":"testCounter"}`))
 	assert.NoError(t, err)
 
 	rr := httptest.NewRecorder()
 	w := &errorResponseWriter{ResponseWriter: rr, failAfter: 0}
 	handler.ServeHTTP(w, req)
 
-	assert.Equal(t, http.StatusInternalServerError, rr.Code)
-	assert.Contains(t, rr.Body.String(), http.StatusText(http.StatusInternalServerError))
+	// Статус уже отправлен до ошибки записи тела, поэтому ошибка только
+	// логируется.
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Empty(t, rr.Body.String())
+	if assert.NotNil(t, hook.LastEntry()) {
+		assert.Equal(t, log.ErrorLevel, hook.LastEntry().Level)
+		assert.Contains(t, hook.LastEntry().Message, "error encoding response")
+	}
 }
@@ -1,112 +1,559 @@
 package handlers
 
 import (
+	"bytes"
+	"context"
+	"embed"
+	"errors"
+	"fmt"
 	"html/template"
+	"io/fs"
+	"math"
 	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
+	log "github.com/sirupsen/logrus"
+
+	"github.com/Axel791/metricsalert/internal/server/alerts"
 	"github.com/Axel791/metricsalert/internal/server/model/domain"
+	"github.com/Axel791/metricsalert/internal/server/model/dto"
+	"github.com/Axel791/metricsalert/internal/server/repositories"
+	"github.com/Axel791/metricsalert/internal/server/retention"
 	"github.com/Axel791/metricsalert/internal/server/services"
+	"github.com/Axel791/metricsalert/internal/shared/logging"
+)
+
+const (
+	// dashboardRefresh - период автообновления страницы по умолчанию.
+	dashboardRefresh = 10 * time.Second
+	// sparklineWindow - за какой период строится график значений метрики.
+	sparklineWindow = 30 * time.Minute
+	// sparklinePoints - наибольшее число точек графика.
+	sparklinePoints = 60
+	// sparklineTimeout ограничивает время чтения истории для одной страницы.
+	sparklineTimeout = 2 * time.Second
+	// sparklineQueries - наибольшее число одновременных запросов истории.
+	sparklineQueries = 4
+
+	sparklineWidth  = 120
+	sparklineHeight = 24
 )
 
-// GetMetricsHTMLHandler renders the current set of metrics as a simple HTML page.
+//go:embed dashboard
+var dashboardFS embed.FS
+
+// dashboardTemplates разбираются один раз при запуске; ошибка в шаблоне
+// останавливает сервер сразу, а не при первом запросе.
+var dashboardTemplates = template.Must(template.ParseFS(dashboardFS, "dashboard/*.html"))
+
+// dashboardSortColumns - столбцы, по которым можно сортировать таблицу.
+var dashboardSortColumns = []struct{ Key, Label string }{
+	{"name", "Имя"},
+	{"type", "Тип"},
+	{"value", "Значение"},
+	{"updated", "Обновлено"},
+}
+
+// AlertRules возвращает текущие правила алертов (alerts.RuleSet).
+type AlertRules interface {
+	Rules() []alerts.Rule
+}
+
+// MetricHistory читает историю значений метрики (repositories.History).
+type MetricHistory interface {
+	Query(ctx context.Context, key domain.MetricKey, resolution string, since time.Time) ([]repositories.HistoryPoint, error)
+}
+
+// GetMetricsHTMLHandler отдаёт панель с текущими значениями метрик.
 //
-// The handler responds to **GET /** (или другой настроенный путь) и возвращает
-// страницу‑таблицу, пригодную для быстрого визуального просмотра значений.
+// The handler responds to **GET /** и возвращает страницу, пригодную для
+// быстрого визуального просмотра значений: метрики сгруппированы по типу,
+// таблицу можно сортировать и фильтровать, страница обновляется сама.
 //
 // # Таблица полей
-// | Столбец | Смысл                                   |
-// |---------|-----------------------------------------|
-// | Имя     | ID метрики                              |
-// | Тип     | Go‑тип отображаемого значения (int64/float64) |
-// | Значение| Числовое значение метрики               |
+// | Столбец   | Смысл                                          |
+// |-----------|------------------------------------------------|
+// | Имя       | ID метрики                                     |
+// | Тип       | Тип метрики (counter/gauge)                    |
+// | Значение  | Числовое значение метрики                      |
+// | Обновлено | Время последнего обновления и давность         |
+// | История   | График значений за последние 30 минут          |
+// | Алерты    | Сработавшие правила алертов по метрике         |
 //
-// # Пример запроса
+// Строки устаревших метрик (dto.Metrics.Stale) выводятся серым, метрики со
+// сработавшими алертами - красным. Столбец «История» есть только при
+// включённой истории метрик.
 //
-//	GET / HTTP/1.1
+// # Параметры запроса
+//
+//	q       – подстрока имени метрики (без учёта регистра);
+//	sort    – name, type, value или updated, "-" в начале - по убыванию;
+//	group   – none отключает группировку по типу;
+//	refresh – период автообновления в секундах, 0 отключает.
+//
+// Некорректные значения параметров заменяются значениями по умолчанию.
 //
 // # Пример ответа (фрагмент)
 //
-//	<tr><td>Alloc</td><td>float64</td><td>6.27</td></tr>
+//	<tr><td>Alloc</td><td>gauge</td><td>6.27</td>…</tr>
 //
 // # Возможные коды ошибок
 //
-//	500 – при неуспехе services.Metric.GetAllMetric или ошибке шаблона.
+//	500 – при неуспехе services.Metric.GetAllMetric или ошибке шаблона;
+//	503 – хранилище метрик временно недоступно.
 //
-// GetMetricsHTMLHandler **не кэширует** результат и каждый раз берёт свежие данные
-// из переданной реализации services.Metric.
+// Стили и скрипт панели отдаёт DashboardAssetsHandler. Шаблоны встроены в
+// бинарник и разбираются один раз при запуске.
 //
 // Экземпляр безопасен для конкурентного использования.
 type GetMetricsHTMLHandler struct {
 	metricService services.Metric
+	history       MetricHistory
+	alerts        AlertRules
+	logger        *log.Logger
+}
+
+// dashboardPage - данные шаблона панели.
+type dashboardPage struct {
+	Query       string
+	Sort        string
+	Grouped     bool
+	Refresh     int
+	Columns     []sortColumn
+	Groups      []metricGroup
+	Alerts      []alertRow
+	Total       int
+	Shown       int
+	History     bool
+	GeneratedAt string
+}
+
+// sortColumn - заголовок столбца со ссылкой на сортировку по нему.
+type sortColumn struct {
+	Label string
+	Href  string
+	Arrow string
+}
+
+// metricGroup - метрики одного типа; Type пуст, если группировка отключена.
+type metricGroup struct {
+	Type string
+	Rows []metricRow
+}
+
+// metricRow - строка таблицы метрик.
+type metricRow struct {
+	Name      string
+	Type      string
+	Value     interface{}
+	UpdatedAt string
+	Age       string
+	Stale     bool
+	Alerts    []string
+	Sparkline string
+
+	number  float64
+	updated time.Time
+}
+
+// Class возвращает CSS-класс строки.
+func (r metricRow) Class() string {
+	var classes []string
+	if r.Stale {
+		classes = append(classes, "stale")
+	}
+	if len(r.Alerts) > 0 {
+		classes = append(classes, "alerting")
+	}
+	return strings.Join(classes, " ")
+}
+
+// alertRow - сработавший алерт в сводке над таблицей.
+type alertRow struct {
+	Rule  string
+	Value string
+}
+
+// dashboardError - данные страницы ошибки.
+type dashboardError struct {
+	Status  int
+	Message string
 }
 
 // NewGetMetricsHTMLHandler возвращает инициализированный HTML‑хендлер.
-func NewGetMetricsHTMLHandler(metricService services.Metric) *GetMetricsHTMLHandler {
-	return &GetMetricsHTMLHandler{metricService: metricService}
+// history и alertRules могут быть nil - тогда графики и алерты не выводятся.
+// Алерты вычисляются по правилам alertRules на значениях, показанных на
+// странице.
+func NewGetMetricsHTMLHandler(
+	metricService services.Metric,
+	history MetricHistory,
+	alertRules AlertRules,
+	logger *log.Logger,
+) *GetMetricsHTMLHandler {
+	return &GetMetricsHTMLHandler{
+		metricService: metricService,
+		history:       history,
+		alerts:        alertRules,
+		logger:        logger,
+	}
 }
 
 // ServeHTTP реализует интерфейс http.Handler.
 //
 // Алгоритм:
 //  1. Получает все метрики через MetricService.
-//  2. Преобразует их в map[string]interface{} для удобной передачи в шаблон.
-//  3. Парсит встроенный html/template и рендерит его в ответ.
+//  2. Отбирает метрики по q, сортирует и группирует их по типу.
+//  3. Дополняет строки алертами и графиками по истории.
+//  4. Рендерит разобранный при запуске шаблон в ответ.
 func (h *GetMetricsHTMLHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	metrics, err := h.metricService.GetAllMetric(r.Context())
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		status := http.StatusInternalServerError
+		if errors.Is(err, repositories.ErrUnavailable) {
+			status = http.StatusServiceUnavailable
+		}
+		h.renderError(w, r, status, err.Error())
 		return
 	}
 
-	metricsMap := make(map[string]interface{})
+	params := r.URL.Query()
+	page := dashboardPage{
+		Query:       strings.TrimSpace(params.Get("q")),
+		Sort:        dashboardSort(params.Get("sort")),
+		Grouped:     params.Get("group") != "none",
+		Refresh:     dashboardRefreshSeconds(params.Get("refresh")),
+		Total:       len(metrics),
+		History:     h.history != nil,
+		GeneratedAt: time.Now().Format(time.DateTime),
+	}
+	page.Columns = dashboardColumns(page)
+
+	firing := h.firingAlerts(&page, metrics)
+
+	now := time.Now()
+	needle := strings.ToLower(page.Query)
+	rows := make([]metricRow, 0, len(metrics))
 	for _, metric := range metrics {
-		var value interface{}
-		switch metric.MType {
-		case domain.Counter:
-			value = metric.Delta.Int64
-		case domain.Gauge:
-			value = metric.Value.Float64
-		default:
-			value = "unknown"
-		}
-		metricsMap[metric.ID] = value
-	}
-
-	const tpl = `
-<!DOCTYPE html>
-<html>
-<head>
-    <title>Метрики</title>
-</head>
-<body>
-    <h1>Список метрик</h1>
-    <table border="1">
-        <tr>
-            <th>Имя:</th>
-            <th>Тип:</th>
-            <th>Значение:</th>
-        </tr>
-        {{ range $name, $value := . }}
-        <tr>
-            <td>{{ $name }}</td>
-            <td>{{ printf "%T" $value }}</td>
-            <td>{{ $value }}</td>
-        </tr>
-        {{ end }}
-    </table>
-</body>
-</html>`
-
-	tmpl, err := template.New("metrics").Parse(tpl)
-	if err != nil {
-		http.Error(w, "Ошибка при генерации страницы", http.StatusInternalServerError)
+		if needle != "" && !strings.Contains(strings.ToLower(metric.ID), needle) {
+			continue
+		}
+		row := newMetricRow(metric, now)
+		row.Alerts = firing[domain.MetricKey{Name: metric.ID, MType: metric.MType}]
+		rows = append(rows, row)
+	}
+	page.Shown = len(rows)
+
+	if h.history != nil {
+		h.addSparklines(r.Context(), rows, now)
+	}
+	sortMetricRows(rows, page.Sort)
+	page.Groups = groupMetricRows(rows, page.Grouped)
+
+	var buf bytes.Buffer
+	if err := dashboardTemplates.ExecuteTemplate(&buf, "index.html", page); err != nil {
+		logging.Entry(r.Context(), h.logger).Errorf("error rendering dashboard: %v", err)
+		h.renderError(w, r, http.StatusInternalServerError, "Ошибка при генерации страницы")
 		return
 	}
 
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
 	w.WriteHeader(http.StatusOK)
-	if err := tmpl.Execute(w, metricsMap); err != nil {
-		http.Error(w, "Ошибка при генерации страницы", http.StatusInternalServerError)
+	_, _ = buf.WriteTo(w)
+}
+
+// renderError отвечает HTML-страницей с текстом ошибки.
+func (h *GetMetricsHTMLHandler) renderError(w http.ResponseWriter, r *http.Request, status int, message string) {
+	var buf bytes.Buffer
+	if err := dashboardTemplates.ExecuteTemplate(&buf, "error.html", dashboardError{Status: status, Message: message}); err != nil {
+		logging.Entry(r.Context(), h.logger).Errorf("error rendering dashboard error page: %v", err)
+		http.Error(w, message, status)
 		return
 	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	_, _ = buf.WriteTo(w)
+}
+
+// firingAlerts проверяет metrics по правилам алертов, заполняет сводку
+// алертов страницы и возвращает описания сработавших правил по метрикам.
+func (h *GetMetricsHTMLHandler) firingAlerts(page *dashboardPage, metrics []dto.Metrics) map[domain.MetricKey][]string {
+	if h.alerts == nil {
+		return nil
+	}
+
+	firing := alerts.Evaluate(h.alerts.Rules(), metrics)
+	byMetric := make(map[domain.MetricKey][]string, len(firing))
+	for _, alert := range firing {
+		key := domain.MetricKey{Name: alert.Metric.ID, MType: alert.Metric.MType}
+		byMetric[key] = append(byMetric[key], alert.Rule.String())
+		page.Alerts = append(page.Alerts, alertRow{
+			Rule:  alert.Rule.String(),
+			Value: fmt.Sprint(metricValue(alert.Metric)),
+		})
+	}
+	return byMetric
+}
+
+// addSparklines строит графики значений метрик по минутной истории. История
+// читается параллельно, не больше sparklineQueries запросов сразу. Ошибки
+// чтения истории не мешают показу страницы: строка остаётся без графика.
+func (h *GetMetricsHTMLHandler) addSparklines(ctx context.Context, rows []metricRow, now time.Time) {
+	ctx, cancel := context.WithTimeout(ctx, sparklineTimeout)
+	defer cancel()
+
+	since := now.Add(-sparklineWindow)
+	sem := make(chan struct{}, sparklineQueries)
+	var wg sync.WaitGroup
+	for i := range rows {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			wg.Wait()
+			return
+		}
+		wg.Add(1)
+		go func(row *metricRow) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			key := domain.MetricKey{Name: row.Name, MType: row.Type}
+			points, err := h.history.Query(ctx, key, retention.ResolutionRaw, since)
+			if err == nil && len(points) < 2 {
+				// Сырые значения могли быть уже свёрнуты в минутные агрегаты.
+				points, err = h.history.Query(ctx, key, retention.ResolutionMinute, since)
+			}
+			if err != nil {
+				logging.Entry(ctx, h.logger).Warnf("error reading history of %s: %v", key, err)
+				return
+			}
+			row.Sparkline = sparkline(points)
+		}(&rows[i])
+	}
+	wg.Wait()
+}
+
+// newMetricRow преобразует метрику в строку таблицы.
+func newMetricRow(metric dto.Metrics, now time.Time) metricRow {
+	row := metricRow{
+		Name:    metric.ID,
+		Type:    metric.MType,
+		Value:   metricValue(metric),
+		Stale:   metric.Stale,
+		updated: metric.UpdatedAt,
+	}
+	switch value := row.Value.(type) {
+	case int64:
+		row.number = float64(value)
+	case float64:
+		row.number = value
+	}
+	if !metric.UpdatedAt.IsZero() {
+		row.UpdatedAt = metric.UpdatedAt.Format(time.DateTime)
+		row.Age = now.Sub(metric.UpdatedAt).Truncate(time.Second).String()
+	}
+	return row
+}
+
+// metricValue возвращает значение метрики для вывода.
+func metricValue(metric dto.Metrics) interface{} {
+	switch metric.MType {
+	case domain.Counter:
+		return metric.Delta.Int64
+	case domain.Gauge:
+		return metric.Value.Float64
+	default:
+		return "unknown"
+	}
+}
+
+// dashboardSort возвращает порядок сортировки из параметра sort или
+// сортировку по имени, если параметр пуст или некорректен.
+func dashboardSort(value string) string {
+	key := strings.TrimPrefix(value, "-")
+	for _, column := range dashboardSortColumns {
+		if column.Key == key {
+			return value
+		}
+	}
+	return "name"
+}
+
+// dashboardRefreshSeconds возвращает период автообновления в секундах.
+func dashboardRefreshSeconds(value string) int {
+	seconds, err := strconv.Atoi(value)
+	if err != nil || seconds < 0 {
+		return int(dashboardRefresh / time.Second)
+	}
+	return seconds
+}
+
+// dashboardColumns возвращает заголовки столбцов: повторный выбор текущего
+// столбца меняет направление сортировки.
+func dashboardColumns(page dashboardPage) []sortColumn {
+	desc := strings.HasPrefix(page.Sort, "-")
+	current := strings.TrimPrefix(page.Sort, "-")
+
+	columns := make([]sortColumn, 0, len(dashboardSortColumns))
+	for _, column := range dashboardSortColumns {
+		next := column.Key
+		var arrow string
+		if column.Key == current {
+			if desc {
+				arrow = "▼"
+			} else {
+				next = "-" + column.Key
+				arrow = "▲"
+			}
+		}
+
+		params := url.Values{"sort": {next}}
+		if page.Query != "" {
+			params.Set("q", page.Query)
+		}
+		if !page.Grouped {
+			params.Set("group", "none")
+		}
+		if page.Refresh != int(dashboardRefresh/time.Second) {
+			params.Set("refresh", strconv.Itoa(page.Refresh))
+		}
+		columns = append(columns, sortColumn{Label: column.Label, Href: "?" + params.Encode(), Arrow: arrow})
+	}
+	return columns
+}
+
+// sortMetricRows сортирует строки по order; равные строки упорядочены по
+// имени и типу.
+func sortMetricRows(rows []metricRow, order string) {
+	desc := strings.HasPrefix(order, "-")
+	key := strings.TrimPrefix(order, "-")
+
+	byName := func(a, b metricRow) int {
+		if c := strings.Compare(a.Name, b.Name); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Type, b.Type)
+	}
+	compare := byName
+	switch key {
+	case "type":
+		compare = func(a, b metricRow) int {
+			if c := strings.Compare(a.Type, b.Type); c != 0 {
+				return c
+			}
+			return byName(a, b)
+		}
+	case "value":
+		compare = func(a, b metricRow) int {
+			if a.number != b.number {
+				if a.number < b.number {
+					return -1
+				}
+				return 1
+			}
+			return byName(a, b)
+		}
+	case "updated":
+		compare = func(a, b metricRow) int {
+			if c := a.updated.Compare(b.updated); c != 0 {
+				return c
+			}
+			return byName(a, b)
+		}
+	}
+
+	sort.SliceStable(rows, func(i, j int) bool {
+		if desc {
+			return compare(rows[j], rows[i]) < 0
+		}
+		return compare(rows[i], rows[j]) < 0
+	})
+}
+
+// groupMetricRows раскладывает отсортированные строки по типам: сначала
+// counter, затем gauge, затем прочие типы по алфавиту.
+func groupMetricRows(rows []metricRow, grouped bool) []metricGroup {
+	if !grouped {
+		return []metricGroup{{Rows: rows}}
+	}
+
+	byType := make(map[string][]metricRow)
+	types := []string{domain.Counter, domain.Gauge}
+	for _, row := range rows {
+		if _, ok := byType[row.Type]; !ok && row.Type != domain.Counter && row.Type != domain.Gauge {
+			types = append(types, row.Type)
+		}
+		byType[row.Type] = append(byType[row.Type], row)
+	}
+	sort.Strings(types[2:])
+
+	groups := make([]metricGroup, 0, len(types))
+	for _, metricType := range types {
+		if len(byType[metricType]) > 0 {
+			groups = append(groups, metricGroup{Type: metricType, Rows: byType[metricType]})
+		}
+	}
+	return groups
+}
+
+// sparkline возвращает координаты ломаной SVG по последним значениям точек
+// истории или пустую строку, если точек меньше двух.
+func sparkline(points []repositories.HistoryPoint) string {
+	if len(points) < 2 {
+		return ""
+	}
+	if len(points) > sparklinePoints {
+		sampled := make([]repositories.HistoryPoint, 0, sparklinePoints)
+		for i := 0; i < sparklinePoints; i++ {
+			sampled = append(sampled, points[i*(len(points)-1)/(sparklinePoints-1)])
+		}
+		points = sampled
+	}
+
+	low, high := math.Inf(1), math.Inf(-1)
+	for _, point := range points {
+		low = math.Min(low, point.Last)
+		high = math.Max(high, point.Last)
+	}
+	span := high - low
+
+	var b strings.Builder
+	step := float64(sparklineWidth) / float64(len(points)-1)
+	for i, point := range points {
+		y := float64(sparklineHeight) / 2
+		if span > 0 {
+			y = sparklineHeight - 1 - (point.Last-low)/span*(sparklineHeight-2)
+		}
+		if i > 0 {
+			b.WriteByte(' ')
+		}
+		fmt.Fprintf(&b, "%.1f,%.1f", float64(i)*step, y)
+	}
+	return b.String()
+}
+
+// DashboardAssetsHandler отдаёт стили и скрипт панели метрик, встроенные в
+// бинарник. Хендлер нужно подключить с префиксом prefix, например
+// "/dashboard/". Список файлов не отдаётся.
+func DashboardAssetsHandler(prefix string) http.Handler {
+	static, err := fs.Sub(dashboardFS, "dashboard/static")
+	if err != nil {
+		panic(err)
+	}
+	files := http.StripPrefix(prefix, http.FileServer(http.FS(static)))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/") {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Cache-Control", "public, max-age=300")
+		files.ServeHTTP(w, r)
+	})
 }
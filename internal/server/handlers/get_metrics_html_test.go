@@ -1,18 +1,25 @@
 package handlers
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/golang/mock/gomock"
+	log "github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"gopkg.in/guregu/null.v4"
 
+	"github.com/Axel791/metricsalert/internal/server/alerts"
 	"github.com/Axel791/metricsalert/internal/server/model/domain"
 	"github.com/Axel791/metricsalert/internal/server/model/dto"
+	"github.com/Axel791/metricsalert/internal/server/repositories"
 	"github.com/Axel791/metricsalert/internal/server/services/mock"
 )
 
@@ -40,7 +47,7 @@ func TestGetMetricsHTMLHandler_ServeHTTP(t *testing.T) {
 				}, nil)
 			},
 			expectedStatus: http.StatusOK,
-			expectedBody:   `<td>testCounter</td>.*<td>int64</td>.*<td>42</td>.*<td>testGauge</td>.*<td>float64</td>.*<td>3.14</td>`,
+			expectedBody:   `(?s)<td>testCounter</td>\s*<td>counter</td>\s*<td>42</td>.*<td>testGauge</td>\s*<td>gauge</td>\s*<td>3.14</td>`,
 		},
 		{
 			name: "successful with empty metrics",
@@ -69,7 +76,7 @@ func TestGetMetricsHTMLHandler_ServeHTTP(t *testing.T) {
 				}, nil)
 			},
 			expectedStatus: http.StatusOK,
-			expectedBody:   `<td>unknown</td>.*<td>string</td>.*<td>unknown</td>`,
+			expectedBody:   `(?s)<td>unknown</td>\s*<td>unknownType</td>\s*<td>unknown</td>`,
 		},
 	}
 
@@ -81,7 +88,7 @@ func TestGetMetricsHTMLHandler_ServeHTTP(t *testing.T) {
 			mockMetric := mock.NewMockMetric(ctrl)
 			tt.mockSetup(mockMetric)
 
-			handler := NewGetMetricsHTMLHandler(mockMetric)
+			handler := NewGetMetricsHTMLHandler(mockMetric, nil, nil, log.New())
 
 			req, err := http.NewRequest(http.MethodGet, "/", nil)
 			assert.NoError(t, err)
@@ -100,3 +107,200 @@ func TestGetMetricsHTMLHandler_ServeHTTP(t *testing.T) {
 		})
 	}
 }
+
+func TestGetMetricsHTMLHandler_MarksStale(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockMetric := mock.NewMockMetric(ctrl)
+	mockMetric.EXPECT().GetAllMetric(gomock.Any()).Return([]dto.Metrics{
+		{ID: "Fresh", MType: domain.Gauge, Value: null.FloatFrom(1), UpdatedAt: time.Now()},
+		{ID: "Dead", MType: domain.Gauge, Value: null.FloatFrom(2), UpdatedAt: time.Now().Add(-time.Hour), Stale: true},
+	}, nil)
+
+	rr := httptest.NewRecorder()
+	NewGetMetricsHTMLHandler(mockMetric, nil, nil, log.New()).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	body := rr.Body.String()
+	assert.Regexp(t, `(?s)<tr class="stale"[^>]*>\s*<td>Dead</td>.*\(1h0m\ds назад\)`, body)
+	assert.Regexp(t, `(?s)<tr>\s*<td>Fresh</td>`, body)
+}
+
+func dashboardMetrics() []dto.Metrics {
+	now := time.Now()
+	return []dto.Metrics{
+		{ID: "Alloc", MType: domain.Gauge, Value: null.FloatFrom(30), UpdatedAt: now.Add(-time.Minute)},
+		{ID: "PollCount", MType: domain.Counter, Delta: null.IntFrom(5), UpdatedAt: now},
+		{ID: "HeapAlloc", MType: domain.Gauge, Value: null.FloatFrom(10), UpdatedAt: now},
+		{ID: "Requests", MType: domain.Counter, Delta: null.IntFrom(7), UpdatedAt: now.Add(-time.Hour)},
+	}
+}
+
+func serveDashboard(t *testing.T, handler http.Handler, target string) string {
+	t.Helper()
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, target, nil))
+	require.Equal(t, http.StatusOK, rr.Code)
+	return rr.Body.String()
+}
+
+func TestGetMetricsHTMLHandler_SortSearchGroup(t *testing.T) {
+	tests := []struct {
+		name     string
+		target   string
+		expected string
+		absent   string
+	}{
+		{
+			name:     "grouped by type and sorted by name",
+			target:   "/",
+			expected: `(?s)<tbody data-type="counter">.*<td>PollCount</td>.*<td>Requests</td>.*<tbody data-type="gauge">.*<td>Alloc</td>.*<td>HeapAlloc</td>`,
+		},
+		{
+			name:     "sorted by value descending without groups",
+			target:   "/?sort=-value&group=none",
+			expected: `(?s)<td>Alloc</td>.*<td>HeapAlloc</td>.*<td>Requests</td>.*<td>PollCount</td>`,
+			absent:   `data-type=`,
+		},
+		{
+			name:     "sorted by update time",
+			target:   "/?sort=updated&group=none",
+			expected: `(?s)<td>Requests</td>.*<td>Alloc</td>.*<td>HeapAlloc</td>.*<td>PollCount</td>`,
+		},
+		{
+			name:     "search is case insensitive",
+			target:   "/?q=alloc",
+			expected: `(?s)Показано 2 из 4.*<td>Alloc</td>.*<td>HeapAlloc</td>`,
+			absent:   `<td>PollCount</td>`,
+		},
+		{
+			name:     "invalid sort falls back to name",
+			target:   "/?sort=label&group=none",
+			expected: `(?s)<td>Alloc</td>.*<td>HeapAlloc</td>.*<td>PollCount</td>.*<td>Requests</td>`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			mockMetric := mock.NewMockMetric(ctrl)
+			mockMetric.EXPECT().GetAllMetric(gomock.Any()).Return(dashboardMetrics(), nil)
+
+			body := serveDashboard(t, NewGetMetricsHTMLHandler(mockMetric, nil, nil, log.New()), tt.target)
+			assert.Regexp(t, tt.expected, body)
+			if tt.absent != "" {
+				assert.NotRegexp(t, tt.absent, body)
+			}
+		})
+	}
+}
+
+func TestGetMetricsHTMLHandler_SortLinksToggleDirection(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	mockMetric := mock.NewMockMetric(ctrl)
+	mockMetric.EXPECT().GetAllMetric(gomock.Any()).Return(dashboardMetrics(), nil)
+
+	body := serveDashboard(t, NewGetMetricsHTMLHandler(mockMetric, nil, nil, log.New()), "/?q=a&refresh=0")
+	assert.Contains(t, body, `href="?q=a&amp;refresh=0&amp;sort=-name"`)
+	assert.Contains(t, body, `href="?q=a&amp;refresh=0&amp;sort=value"`)
+	assert.Contains(t, body, `<input id="refresh" type="number" name="refresh" min="0" value="0">`)
+}
+
+func TestGetMetricsHTMLHandler_AlertsAndSparklines(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	mockMetric := mock.NewMockMetric(ctrl)
+	mockMetric.EXPECT().GetAllMetric(gomock.Any()).Return(dashboardMetrics(), nil)
+
+	history := repositories.NewMemoryHistory()
+	now := time.Now()
+	for i, value := range []float64{10, 20, 15} {
+		require.NoError(t, history.Record(context.Background(), now.Add(time.Duration(i-3)*time.Minute), []domain.Metrics{
+			{Name: "Alloc", MType: domain.Gauge, Value: null.FloatFrom(value)},
+		}))
+	}
+
+	rules := alerts.NewRuleSet([]alerts.Rule{
+		{Metric: "Alloc", Type: domain.Gauge, Op: ">", Threshold: 25},
+		{Metric: "HeapAlloc", Type: domain.Gauge, Op: ">", Threshold: 25},
+	})
+
+	body := serveDashboard(t, NewGetMetricsHTMLHandler(mockMetric, history, rules, log.New()), "/")
+	assert.Contains(t, body, "Сработавшие алерты (1)")
+	assert.Contains(t, body, "Alloc(gauge) &gt; 25: значение 30")
+	assert.Regexp(t, `(?s)<tr class="alerting">\s*<td>Alloc</td>.*<span class="alert">Alloc\(gauge\) &gt; 25</span>`, body)
+	assert.Contains(t, body, `<polyline points="0.0,23.0 60.0,1.0 120.0,12.0"/>`)
+	assert.Equal(t, 1, strings.Count(body, "<polyline"), "graphs only for metrics with history")
+}
+
+// failingHistory - история, запросы которой по метрике failing завершаются
+// ошибкой.
+type failingHistory struct {
+	*repositories.MemoryHistory
+	failing string
+}
+
+func (h failingHistory) Query(
+	ctx context.Context,
+	key domain.MetricKey,
+	resolution string,
+	since time.Time,
+) ([]repositories.HistoryPoint, error) {
+	if key.Name == h.failing {
+		return nil, errors.New("history unavailable")
+	}
+	return h.MemoryHistory.Query(ctx, key, resolution, since)
+}
+
+func TestGetMetricsHTMLHandler_SparklinesSkipFailedRows(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	mockMetric := mock.NewMockMetric(ctrl)
+	mockMetric.EXPECT().GetAllMetric(gomock.Any()).Return(dashboardMetrics(), nil)
+
+	history := repositories.NewMemoryHistory()
+	now := time.Now()
+	for i, value := range []float64{10, 20} {
+		require.NoError(t, history.Record(context.Background(), now.Add(time.Duration(i-2)*time.Minute), []domain.Metrics{
+			{Name: "Alloc", MType: domain.Gauge, Value: null.FloatFrom(value)},
+			{Name: "HeapAlloc", MType: domain.Gauge, Value: null.FloatFrom(value)},
+		}))
+	}
+
+	handler := NewGetMetricsHTMLHandler(mockMetric, failingHistory{MemoryHistory: history, failing: "Alloc"}, nil, log.New())
+	body := serveDashboard(t, handler, "/")
+	assert.Regexp(t, `(?s)<td>HeapAlloc</td>.*<polyline`, body)
+	assert.Equal(t, 1, strings.Count(body, "<polyline"), "no graph for the metric whose history failed")
+}
+
+func TestSparkline(t *testing.T) {
+	assert.Empty(t, sparkline(nil))
+	assert.Empty(t, sparkline([]repositories.HistoryPoint{{Last: 1}}))
+	assert.Equal(t, "0.0,12.0 120.0,12.0", sparkline([]repositories.HistoryPoint{{Last: 5}, {Last: 5}}))
+
+	points := make([]repositories.HistoryPoint, 200)
+	for i := range points {
+		points[i].Last = float64(i)
+	}
+	assert.Len(t, strings.Fields(sparkline(points)), sparklinePoints)
+}
+
+func TestDashboardAssetsHandler(t *testing.T) {
+	handler := DashboardAssetsHandler("/dashboard/")
+
+	for path, contentType := range map[string]string{
+		"/dashboard/dashboard.css": "text/css; charset=utf-8",
+		"/dashboard/dashboard.js":  "text/javascript; charset=utf-8",
+	} {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, path, nil))
+		assert.Equal(t, http.StatusOK, rr.Code, path)
+		assert.Equal(t, contentType, rr.Header().Get("Content-Type"), path)
+	}
+
+	for _, path := range []string{"/dashboard/error.html", "/dashboard/"} {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, path, nil))
+		assert.Equal(t, http.StatusNotFound, rr.Code, path)
+	}
+}
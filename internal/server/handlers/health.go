@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/Axel791/metricsalert/internal/server/db"
+	"github.com/Axel791/metricsalert/internal/server/repositories"
+	"github.com/Axel791/metricsalert/internal/shared/logging"
+)
+
+// LastWriteReporter сообщает время последней успешной записи в хранилище.
+type LastWriteReporter interface {
+	LastWrite() time.Time
+}
+
+// ModeReporter реализуется хранилищем с резервным режимом в памяти
+// (repositories.FallbackStore).
+type ModeReporter interface {
+	Mode() string
+	PendingWrites() int
+}
+
+// statusDegraded - сервер принимает метрики, но база недоступна и они
+// хранятся в памяти.
+const statusDegraded = "degraded"
+
+// HealthHandler отдаёт подробное состояние сервера для проверок готовности:
+// бэкенд хранилища, время последней успешной записи и, если используется
+// PostgreSQL, доступность базы, версию миграций и статистику пула. Если
+// хранилище работает в резервном режиме, в ответе есть режим (`mode`) и число
+// метрик, ожидающих переноса в базу (`pending_writes`), а статус - `degraded`.
+//
+// # Пример ответа
+//
+//	{
+//	  "status": "ok",
+//	  "backend": "postgres",
+//	  "last_write": "2024-05-01T12:00:00Z",
+//	  "database": {
+//	    "status": "ok",
+//	    "latency_ms": 0.8,
+//	    "migration_version": 3,
+//	    "pool": {"max_open": 10, "open": 2, "in_use": 0, "idle": 2, ...}
+//	  }
+//	}
+//
+// # Ответы
+// | Код | Когда возвращается                                             |
+// |-----|----------------------------------------------------------------|
+// | 200 | Сервер готов принимать метрики, в том числе в резервном режиме |
+// | 503 | База данных недоступна                                         |
+type HealthHandler struct {
+	database  db.Source
+	backend   string
+	lastWrite LastWriteReporter
+	timeout   time.Duration
+	logger    *log.Logger
+}
+
+// NewHealthHandler создаёт HealthHandler. database возвращает nil, если сервер
+// работает без PostgreSQL или ещё не подключился к нему.
+func NewHealthHandler(
+	database db.Source,
+	backend string,
+	lastWrite LastWriteReporter,
+	timeout time.Duration,
+	logger *log.Logger,
+) *HealthHandler {
+	return &HealthHandler{
+		database:  database,
+		backend:   backend,
+		lastWrite: lastWrite,
+		timeout:   timeout,
+		logger:    logger,
+	}
+}
+
+// healthResponse - тело ответа HealthHandler.
+type healthResponse struct {
+	Status        string     `json:"status"`
+	Backend       string     `json:"backend"`
+	Mode          string     `json:"mode,omitempty"`
+	PendingWrites *int       `json:"pending_writes,omitempty"`
+	LastWrite     *time.Time `json:"last_write"`
+	Database      *db.Health `json:"database,omitempty"`
+}
+
+// ServeHTTP реализует http.Handler.
+func (h *HealthHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	response := healthResponse{Status: db.StatusOK, Backend: h.backend}
+
+	if at := h.lastWrite.LastWrite(); !at.IsZero() {
+		at = at.UTC()
+		response.LastWrite = &at
+	}
+
+	if reporter, ok := h.database.(ModeReporter); ok {
+		pending := reporter.PendingWrites()
+		response.Mode = reporter.Mode()
+		response.PendingWrites = &pending
+	}
+
+	if conn := h.database.DB(); conn != nil {
+		ctx, cancel := context.WithTimeout(r.Context(), h.timeout)
+		defer cancel()
+
+		health := db.CheckHealth(ctx, conn)
+		response.Database = &health
+		response.Status = health.Status
+	} else if response.Mode == repositories.ModeDegraded {
+		response.Database = &db.Health{Status: db.StatusUnavailable, Error: "not connected"}
+		response.Status = statusDegraded
+	}
+
+	status := http.StatusOK
+	if response.Status == db.StatusUnavailable {
+		logging.Entry(r.Context(), h.logger).Warnf("HealthHandler: database is unavailable: %s", response.Database.Error)
+		status = http.StatusServiceUnavailable
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		logging.Entry(r.Context(), h.logger).Errorf("HealthHandler: failed to encode response: %v", err)
+	}
+}
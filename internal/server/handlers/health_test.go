@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	_ "github.com/lib/pq"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Axel791/metricsalert/internal/server/db"
+	"github.com/Axel791/metricsalert/internal/server/repositories"
+)
+
+type fixedLastWrite time.Time
+
+func (f fixedLastWrite) LastWrite() time.Time {
+	return time.Time(f)
+}
+
+// unreachableDB возвращает пул, соединения которого никогда не устанавливаются.
+func unreachableDB(t *testing.T) *sqlx.DB {
+	t.Helper()
+	conn, err := sqlx.Open("postgres", "host=127.0.0.1 port=1 user=test dbname=test sslmode=disable connect_timeout=1")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = conn.Close() })
+	return conn
+}
+
+func TestHealthHandler_WithoutDatabase(t *testing.T) {
+	lastWrite := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	handler := NewHealthHandler(db.StaticSource{}, "memory", fixedLastWrite(lastWrite), time.Second, log.New())
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/health", nil))
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+
+	var response healthResponse
+	require.NoError(t, json.NewDecoder(rr.Body).Decode(&response))
+	assert.Equal(t, db.StatusOK, response.Status)
+	assert.Equal(t, "memory", response.Backend)
+	require.NotNil(t, response.LastWrite)
+	assert.True(t, lastWrite.Equal(*response.LastWrite))
+	assert.Nil(t, response.Database)
+}
+
+func TestHealthHandler_NoWritesYet(t *testing.T) {
+	handler := NewHealthHandler(db.StaticSource{}, "file", fixedLastWrite(time.Time{}), time.Second, log.New())
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/health", nil))
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), `"last_write":null`)
+}
+
+func TestHealthHandler_DatabaseUnavailable(t *testing.T) {
+	handler := NewHealthHandler(
+		db.StaticSource{Conn: unreachableDB(t)}, "postgres", fixedLastWrite(time.Time{}), 500*time.Millisecond, log.New(),
+	)
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/health", nil))
+
+	assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+
+	var response healthResponse
+	require.NoError(t, json.NewDecoder(rr.Body).Decode(&response))
+	assert.Equal(t, db.StatusUnavailable, response.Status)
+	require.NotNil(t, response.Database)
+	assert.Equal(t, db.StatusUnavailable, response.Database.Status)
+	assert.NotEmpty(t, response.Database.Error)
+}
+
+func TestDatabaseHealthCheckHandler_ServeHTTP(t *testing.T) {
+	tests := []struct {
+		name string
+		db   *sqlx.DB
+	}{
+		{name: "database is not connected"},
+		{name: "database is unavailable", db: unreachableDB(t)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := NewDatabaseHealthCheckHandler(db.StaticSource{Conn: tt.db}, 500*time.Millisecond)
+
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/ping", nil))
+
+			assert.Equal(t, http.StatusInternalServerError, rr.Code)
+		})
+	}
+}
+
+type fallbackSource struct {
+	db.StaticSource
+	mode    string
+	pending int
+}
+
+func (f fallbackSource) Mode() string {
+	return f.mode
+}
+
+func (f fallbackSource) PendingWrites() int {
+	return f.pending
+}
+
+func TestHealthHandler_FallbackMode(t *testing.T) {
+	source := fallbackSource{mode: repositories.ModeDegraded, pending: 3}
+	handler := NewHealthHandler(source, "postgres", fixedLastWrite(time.Time{}), time.Second, log.New())
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/health", nil))
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	var response healthResponse
+	require.NoError(t, json.NewDecoder(rr.Body).Decode(&response))
+	assert.Equal(t, statusDegraded, response.Status)
+	assert.Equal(t, repositories.ModeDegraded, response.Mode)
+	require.NotNil(t, response.PendingWrites)
+	assert.Equal(t, 3, *response.PendingWrites)
+	require.NotNil(t, response.Database)
+	assert.Equal(t, db.StatusUnavailable, response.Database.Status)
+}
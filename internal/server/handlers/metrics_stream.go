@@ -0,0 +1,211 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/Axel791/metricsalert/internal/server/model/api"
+	"github.com/Axel791/metricsalert/internal/server/model/dto"
+	"github.com/Axel791/metricsalert/internal/server/services"
+	"github.com/Axel791/metricsalert/internal/server/stream"
+	"github.com/Axel791/metricsalert/internal/shared/logging"
+)
+
+// Имена событий потока метрик помимо stream.Action*.
+const (
+	// streamEventSnapshot - текущее значение метрики при подключении.
+	streamEventSnapshot = "snapshot"
+	// streamEventLagged - последнее событие перед отключением отстающего
+	// подписчика.
+	streamEventLagged = "lagged"
+	// streamRetry - через сколько миллисекунд EventSource переподключается.
+	streamRetry = 1000
+)
+
+// MetricsStreamHandler передаёт изменения метрик по Server-Sent Events.
+//
+// # Параметры запроса
+//
+//	name     – шаблон имени (* – любые символы, ? – один символ), можно
+//	           указать несколько раз;
+//	type     – gauge или counter, можно указать несколько раз;
+//	snapshot – false отключает отправку текущих значений при подключении.
+//
+// # Request example
+//
+//	GET /api/v1/metrics/stream?name=Heap*&type=gauge HTTP/1.1
+//	Accept: text/event-stream
+//
+// # Successful response example
+//
+//	HTTP/1.1 200 OK
+//	Content-Type: text/event-stream
+//
+//	event: snapshot
+//	data: {"action":"snapshot","metric":{"id":"HeapAlloc","type":"gauge","value":5},"time":"..."}
+//
+//	id: 17
+//	event: update
+//	data: {"action":"update","metric":{"id":"HeapAlloc","type":"gauge","value":6},"time":"..."}
+//
+// Имя события SSE совпадает с полем action (snapshot, update, reset,
+// delete). Пропущенные события не пересылаются: после переподключения
+// клиент снова получает текущие значения. Отстающий клиент получает событие
+// lagged и отключается. Ошибки до начала потока возвращаются в формате
+// api.ErrorResponse.
+type MetricsStreamHandler struct {
+	broker        *stream.Broker
+	metricService services.Metric
+	heartbeat     time.Duration
+	logger        *log.Logger
+}
+
+// NewMetricsStreamHandler создаёт обработчик потока метрик. Раз в heartbeat
+// в поток пишется комментарий, чтобы прокси не закрывали соединение.
+func NewMetricsStreamHandler(
+	broker *stream.Broker,
+	metricService services.Metric,
+	heartbeat time.Duration,
+	logger *log.Logger,
+) *MetricsStreamHandler {
+	return &MetricsStreamHandler{
+		broker:        broker,
+		metricService: metricService,
+		heartbeat:     heartbeat,
+		logger:        logger,
+	}
+}
+
+func (h *MetricsStreamHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	filter := stream.Filter{Names: params["name"], Types: params["type"]}
+	if err := filter.Validate(); err != nil {
+		writeError(w, http.StatusBadRequest, api.ErrCodeInvalidRequest, err.Error())
+		return
+	}
+	snapshot := true
+	if value := params.Get("snapshot"); value != "" {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, api.ErrCodeInvalidRequest, "snapshot must be a boolean")
+			return
+		}
+		snapshot = parsed
+	}
+
+	// Подписка оформляется до чтения текущих значений, чтобы изменения между
+	// ними не потерялись; метрика может прийти дважды.
+	sub, err := h.broker.Subscribe(filter)
+	if err != nil {
+		writeError(w, http.StatusServiceUnavailable, api.ErrCodeUnavailable, err.Error())
+		return
+	}
+	defer sub.Close()
+
+	var current []dto.Metrics
+	if snapshot {
+		metrics, err := h.metricService.GetAllMetric(r.Context())
+		if err != nil {
+			logging.Entry(r.Context(), h.logger).Warnf("error reading metrics for the stream: %v", err)
+			writeServiceError(w, err)
+			return
+		}
+		for _, metric := range metrics {
+			if filter.Matches(metric) {
+				current = append(current, metric)
+			}
+		}
+		sort.Slice(current, func(i, j int) bool {
+			if current[i].ID != current[j].ID {
+				return current[i].ID < current[j].ID
+			}
+			return current[i].MType < current[j].MType
+		})
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	controller := http.NewResponseController(w)
+	logger := logging.Entry(r.Context(), h.logger)
+
+	if _, err := fmt.Fprintf(w, "retry: %d\n\n", streamRetry); err != nil {
+		return
+	}
+	now := time.Now()
+	for _, metric := range current {
+		event := api.MetricEvent{Action: streamEventSnapshot, Metric: toAPIMetric(metric), Time: now}
+		if err := writeStreamEvent(w, 0, streamEventSnapshot, event); err != nil {
+			return
+		}
+	}
+	if err := controller.Flush(); err != nil {
+		logger.Errorf("metrics stream is not supported by the response writer: %v", err)
+		return
+	}
+
+	heartbeat := time.NewTicker(h.heartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			if _, err := io.WriteString(w, ": ping\n\n"); err != nil {
+				return
+			}
+		case event, ok := <-sub.Events():
+			if !ok {
+				if sub.Lagged() {
+					logger.Warn("metrics stream subscriber is lagging, disconnecting")
+					_ = writeStreamEvent(w, 0, streamEventLagged, api.ErrorResponse{Error: api.Error{
+						Code:    api.ErrCodeLagging,
+						Message: "client is too slow to receive metric events",
+					}})
+					_ = controller.Flush()
+				}
+				return
+			}
+			if err := writeStreamEvent(w, event.ID, event.Action, toAPIEvent(event)); err != nil {
+				return
+			}
+		}
+		if err := controller.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// toAPIEvent переводит событие брокера в формат API.
+func toAPIEvent(event stream.Event) api.MetricEvent {
+	metric := api.Metrics{ID: event.Metric.ID, MType: event.Metric.MType}
+	if event.Action != stream.ActionDelete {
+		metric = toAPIMetric(event.Metric)
+	}
+	return api.MetricEvent{Action: event.Action, Metric: metric, Time: event.Time}
+}
+
+// writeStreamEvent пишет одно событие SSE; нулевой id не передаётся.
+func writeStreamEvent(w io.Writer, id uint64, name string, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if id != 0 {
+		if _, err := fmt.Fprintf(w, "id: %d\n", id); err != nil {
+			return err
+		}
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", name, data)
+	return err
+}
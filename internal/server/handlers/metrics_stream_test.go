@@ -0,0 +1,180 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Axel791/metricsalert/internal/server/model/api"
+	"github.com/Axel791/metricsalert/internal/server/model/domain"
+	"github.com/Axel791/metricsalert/internal/server/repositories"
+	"github.com/Axel791/metricsalert/internal/server/services"
+	"github.com/Axel791/metricsalert/internal/server/stream"
+)
+
+// sseEvent - событие, прочитанное из потока SSE.
+type sseEvent struct {
+	ID    string
+	Name  string
+	Event api.MetricEvent
+}
+
+func newStreamServer(t *testing.T) (*httptest.Server, *services.MetricsService, *stream.Broker) {
+	t.Helper()
+
+	store := repositories.NewMetricMapRepository()
+	_, err := store.UpdateGauge(context.Background(), "HeapAlloc", 5)
+	require.NoError(t, err)
+	_, err = store.UpdateGauge(context.Background(), "Alloc", 1)
+	require.NoError(t, err)
+	_, err = store.UpdateCounter(context.Background(), "PollCount", 7)
+	require.NoError(t, err)
+
+	broker := stream.NewBroker(16, nil)
+	service := services.NewMetricsService(repositories.NewPublishingStore(store, broker))
+
+	server := httptest.NewServer(NewMetricsStreamHandler(broker, service, time.Hour, log.New()))
+	t.Cleanup(server.Close)
+	return server, service, broker
+}
+
+// openStream подключается к потоку и ждёт, пока придут count событий snapshot.
+func openStream(t *testing.T, target string, snapshots int) (*bufio.Reader, []sseEvent) {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	require.NoError(t, err)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = resp.Body.Close() })
+
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+	assert.Equal(t, "no-cache", resp.Header.Get("Cache-Control"))
+
+	reader := bufio.NewReader(resp.Body)
+	events := make([]sseEvent, 0, snapshots)
+	for len(events) < snapshots {
+		events = append(events, readEvent(t, reader))
+	}
+	return reader, events
+}
+
+// readEvent читает следующее событие, пропуская retry и комментарии.
+func readEvent(t *testing.T, reader *bufio.Reader) sseEvent {
+	t.Helper()
+
+	var event sseEvent
+	for {
+		line, err := reader.ReadString('\n')
+		require.NoError(t, err)
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case line == "":
+			if event.Name != "" {
+				return event
+			}
+		case strings.HasPrefix(line, "id: "):
+			event.ID = strings.TrimPrefix(line, "id: ")
+		case strings.HasPrefix(line, "event: "):
+			event.Name = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			require.NoError(t, json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &event.Event))
+		}
+	}
+}
+
+func TestMetricsStreamHandler(t *testing.T) {
+	server, service, _ := newStreamServer(t)
+
+	reader, snapshot := openStream(t, server.URL+"?name=*Alloc&type=gauge", 2)
+	assert.Equal(t, "snapshot", snapshot[0].Name)
+	assert.Empty(t, snapshot[0].ID)
+	assert.Equal(t, "Alloc", snapshot[0].Event.Metric.ID)
+	assert.Equal(t, "HeapAlloc", snapshot[1].Event.Metric.ID)
+	assert.Equal(t, 5.0, *snapshot[1].Event.Metric.Value)
+
+	value := 6.0
+	delta := int64(1)
+	_, err := service.CreateOrUpdateMetric(context.Background(), api.Metrics{ID: "PollCount", MType: domain.Counter, Delta: &delta})
+	require.NoError(t, err)
+	_, err = service.CreateOrUpdateMetric(context.Background(), api.Metrics{ID: "Sys", MType: domain.Gauge, Value: &value})
+	require.NoError(t, err)
+	_, err = service.CreateOrUpdateMetric(context.Background(), api.Metrics{ID: "HeapAlloc", MType: domain.Gauge, Value: &value})
+	require.NoError(t, err)
+	require.NoError(t, service.DeleteMetric(context.Background(), domain.Gauge, "Alloc"))
+
+	update := readEvent(t, reader)
+	assert.Equal(t, "update", update.Name)
+	assert.Equal(t, "3", update.ID, "events of other metrics are filtered out")
+	assert.Equal(t, "update", update.Event.Action)
+	assert.Equal(t, "HeapAlloc", update.Event.Metric.ID)
+	assert.Equal(t, 6.0, *update.Event.Metric.Value)
+	assert.False(t, update.Event.Time.IsZero())
+
+	deleted := readEvent(t, reader)
+	assert.Equal(t, "delete", deleted.Name)
+	assert.Equal(t, api.Metrics{ID: "Alloc", MType: domain.Gauge}, deleted.Event.Metric)
+}
+
+func TestMetricsStreamHandlerWithoutSnapshot(t *testing.T) {
+	server, service, _ := newStreamServer(t)
+
+	reader, _ := openStream(t, server.URL+"?snapshot=false&type=counter", 0)
+	_, err := service.ResetCounter(context.Background(), "PollCount")
+	require.NoError(t, err)
+
+	event := readEvent(t, reader)
+	assert.Equal(t, "reset", event.Name)
+	assert.Equal(t, "PollCount", event.Event.Metric.ID)
+	assert.Equal(t, int64(0), *event.Event.Metric.Delta)
+}
+
+func TestMetricsStreamHandlerEndsOnBrokerClose(t *testing.T) {
+	server, _, broker := newStreamServer(t)
+
+	reader, _ := openStream(t, server.URL, 3)
+	broker.Close()
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := reader.ReadString('\n')
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		assert.Error(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("stream is not closed")
+	}
+
+	resp, err := http.Get(server.URL)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+}
+
+func TestMetricsStreamHandlerInvalidQuery(t *testing.T) {
+	server, _, _ := newStreamServer(t)
+	handler := server.Config.Handler
+
+	for _, target := range []string{"/?type=histogram", "/?name=%5B", "/?snapshot=maybe"} {
+		t.Run(target, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, target, nil))
+			assert.Equal(t, http.StatusBadRequest, rr.Code)
+			assert.Equal(t, api.ErrCodeInvalidRequest, decodeAPIError(t, rr).Code)
+		})
+	}
+}
@@ -0,0 +1,344 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/Axel791/metricsalert/internal/server/audit"
+	"github.com/Axel791/metricsalert/internal/server/model/api"
+	"github.com/Axel791/metricsalert/internal/server/model/domain"
+	"github.com/Axel791/metricsalert/internal/server/model/dto"
+	"github.com/Axel791/metricsalert/internal/server/services"
+	"github.com/Axel791/metricsalert/internal/shared/logging"
+)
+
+// ListMetricsHandler отдаёт страницу метрик с фильтром и сортировкой.
+//
+// # Параметры запроса
+//
+//	type    – gauge или counter;
+//	prefix  – начало имени;
+//	glob    – шаблон имени целиком (* – любые символы, ? – один символ);
+//	regex   – регулярное выражение для имени;
+//	label   – метка name=value, которая должна быть у метрики; параметр
+//	          можно повторить, тогда нужны все метки;
+//	sort    – name, type (по умолчанию) или updated_at, с "-" – по убыванию;
+//	limit   – размер страницы (по умолчанию 100, не больше 1000);
+//	cursor  – next_cursor предыдущей страницы.
+//
+// # Request example
+//
+//	GET /api/v1/metrics?type=gauge&prefix=cpu&sort=-updated_at&limit=2 HTTP/1.1
+//
+// # Successful response example
+//
+//	HTTP/1.1 200 OK
+//	Content-Type: application/json
+//
+//	{"metrics": [{"id": "cpu0", "type": "gauge", "value": 5}], "next_cursor": "eyJzb3J0Ij..."}
+//
+// Ошибки возвращаются в формате api.ErrorResponse.
+type ListMetricsHandler struct {
+	metricService services.Metric
+	logger        *log.Logger
+}
+
+// NewListMetricsHandler создаёт ListMetricsHandler.
+func NewListMetricsHandler(metricService services.Metric, logger *log.Logger) *ListMetricsHandler {
+	return &ListMetricsHandler{metricService: metricService, logger: logger}
+}
+
+func (h *ListMetricsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	labels, err := parseLabelFilter(params["label"])
+	if err != nil {
+		writeError(w, http.StatusBadRequest, api.ErrCodeInvalidRequest, err.Error())
+		return
+	}
+	query := services.ListQuery{
+		MType:  params.Get("type"),
+		Prefix: params.Get("prefix"),
+		Glob:   params.Get("glob"),
+		Regex:  params.Get("regex"),
+		Labels: labels,
+		Sort:   params.Get("sort"),
+		Cursor: params.Get("cursor"),
+	}
+	if raw := params.Get("limit"); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit <= 0 {
+			writeError(w, http.StatusBadRequest, api.ErrCodeInvalidRequest, "limit must be a positive integer")
+			return
+		}
+		query.Limit = limit
+	}
+
+	page, err := h.metricService.ListMetrics(r.Context(), query)
+	if err != nil {
+		logging.Entry(r.Context(), h.logger).Warnf("error listing metrics: %v", err)
+		writeServiceError(w, err)
+		return
+	}
+
+	response := api.MetricsList{
+		Metrics:    make([]api.Metrics, 0, len(page.Metrics)),
+		NextCursor: page.NextCursor,
+	}
+	for _, metric := range page.Metrics {
+		response.Metrics = append(response.Metrics, toAPIMetric(metric))
+	}
+	writeJSON(w, r, h.logger, http.StatusOK, response)
+}
+
+// parseLabelFilter разбирает значения параметра label вида name=value.
+func parseLabelFilter(raw []string) (map[string]string, error) {
+	if len(raw) == 0 {
+		return nil, nil
+	}
+	labels := make(map[string]string, len(raw))
+	for _, pair := range raw {
+		name, value, ok := strings.Cut(pair, "=")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("label filter %q must be name=value", pair)
+		}
+		if existing, dup := labels[name]; dup && existing != value {
+			return nil, fmt.Errorf("label %q is given with different values", name)
+		}
+		labels[name] = value
+	}
+	return labels, nil
+}
+
+// ReadMetricHandler отдаёт одну метрику в формате api.Metrics.
+//
+// # Request example
+//
+//	GET /api/v1/metrics/gauge/Alloc HTTP/1.1
+//
+// # Ответы
+// | Код | Когда возвращается                     |
+// |-----|----------------------------------------|
+// | 200 | Метрика найдена                        |
+// | 400 | Некорректный тип или имя метрики       |
+// | 404 | Метрики нет                            |
+// | 503 | Хранилище временно недоступно          |
+// | 500 | Ошибка хранилища                       |
+type ReadMetricHandler struct {
+	metricService services.Metric
+	logger        *log.Logger
+}
+
+// NewReadMetricHandler создаёт ReadMetricHandler.
+func NewReadMetricHandler(metricService services.Metric, logger *log.Logger) *ReadMetricHandler {
+	return &ReadMetricHandler{metricService: metricService, logger: logger}
+}
+
+func (h *ReadMetricHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	key := domain.MetricKey{Name: chi.URLParam(r, "name"), MType: chi.URLParam(r, "metricType")}
+
+	metric, err := h.metricService.GetMetric(r.Context(), key.MType, key.Name)
+	if err != nil {
+		logging.Entry(r.Context(), h.logger).Warnf("error getting metric %s: %v", key, err)
+		writeServiceError(w, err)
+		return
+	}
+	writeJSON(w, r, h.logger, http.StatusOK, toAPIMetric(metric))
+}
+
+// PutMetricHandler записывает значение метрики, заданной путём. Тело -
+// api.Metrics, в котором достаточно поля value (gauge) или delta (counter);
+// id и type, если заданы, должны совпадать с путём. Для counter delta
+// прибавляется к текущему значению, как и в POST /update. Принятая метрика
+// записывается в журнал аудита обновлений.
+//
+// # Request example
+//
+//	PUT /api/v1/metrics/gauge/Alloc HTTP/1.1
+//	Content-Type: application/json
+//
+//	{"value": 6.27}
+//
+// # Ответы
+// | Код | Когда возвращается                     |
+// |-----|----------------------------------------|
+// | 200 | Метрика записана, в ответе её значение |
+// | 400 | Некорректное тело или метрика          |
+// | 503 | Хранилище временно недоступно          |
+// | 500 | Ошибка хранилища                       |
+type PutMetricHandler struct {
+	metricService services.Metric
+	auditor       audit.Recorder
+	logger        *log.Logger
+}
+
+// NewPutMetricHandler создаёт PutMetricHandler.
+func NewPutMetricHandler(
+	metricService services.Metric,
+	auditor audit.Recorder,
+	logger *log.Logger,
+) *PutMetricHandler {
+	return &PutMetricHandler{metricService: metricService, auditor: auditor, logger: logger}
+}
+
+func (h *PutMetricHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	key := domain.MetricKey{Name: chi.URLParam(r, "name"), MType: chi.URLParam(r, "metricType")}
+
+	var input api.Metrics
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		logging.Entry(r.Context(), h.logger).Warnf("PutMetricHandler: failed to decode request body: %v", err)
+		writeError(w, http.StatusBadRequest, api.ErrCodeInvalidRequest, "invalid request body")
+		return
+	}
+	if (input.ID != "" && input.ID != key.Name) || (input.MType != "" && input.MType != key.MType) {
+		writeError(w, http.StatusBadRequest, api.ErrCodeInvalidMetric,
+			fmt.Sprintf("metric in body does not match %s from path", key))
+		return
+	}
+	input.ID, input.MType = key.Name, key.MType
+	input.UpdatedAt, input.Stale = nil, false
+
+	metric, err := h.metricService.CreateOrUpdateMetric(r.Context(), input)
+	if err != nil {
+		logging.Entry(r.Context(), h.logger).Warnf("PutMetricHandler: failed to update metric %s: %v", key, err)
+		writeServiceError(w, err)
+		return
+	}
+	RecordUpdate(r, h.auditor, []api.Metrics{input})
+	writeJSON(w, r, h.logger, http.StatusOK, toAPIMetric(metric))
+}
+
+// BatchMetricsHandler принимает пачку метрик, как POST /updates. Корректные
+// метрики сохраняются, некорректные перечисляются в ответе; с ?strict=true
+// при хотя бы одной некорректной метрике пачка отклоняется целиком с кодом
+// 400 и ошибкой invalid_batch. Принятые метрики записываются в журнал аудита
+// обновлений.
+//
+// # Request example
+//
+//	POST /api/v1/metrics HTTP/1.1
+//	Content-Type: application/json
+//
+//	[{"id": "Alloc", "type": "gauge", "value": 6.27}]
+//
+// # Successful response example
+//
+//	HTTP/1.1 200 OK
+//	Content-Type: application/json
+//
+//	{"accepted": [{"index": 0, "id": "Alloc", "type": "gauge"}], "rejected": []}
+type BatchMetricsHandler struct {
+	metricService services.Metric
+	auditor       audit.Recorder
+	logger        *log.Logger
+}
+
+// NewBatchMetricsHandler создаёт BatchMetricsHandler.
+func NewBatchMetricsHandler(
+	metricService services.Metric,
+	auditor audit.Recorder,
+	logger *log.Logger,
+) *BatchMetricsHandler {
+	return &BatchMetricsHandler{metricService: metricService, auditor: auditor, logger: logger}
+}
+
+func (h *BatchMetricsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	strict := false
+	if raw := r.URL.Query().Get("strict"); raw != "" {
+		var err error
+		if strict, err = strconv.ParseBool(raw); err != nil {
+			writeError(w, http.StatusBadRequest, api.ErrCodeInvalidRequest, "invalid strict parameter")
+			return
+		}
+	}
+
+	var input []api.Metrics
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		logging.Entry(r.Context(), h.logger).Warnf("BatchMetricsHandler: failed to decode request body: %v", err)
+		writeError(w, http.StatusBadRequest, api.ErrCodeInvalidRequest, "invalid request body")
+		return
+	}
+
+	result, err := h.metricService.BatchMetricsUpdate(r.Context(), input, strict)
+	var validationErr *services.BatchValidationError
+	if errors.As(err, &validationErr) {
+		logging.Entry(r.Context(), h.logger).Warnf("BatchMetricsHandler: rejected batch: %v", err)
+		writeErrorResponse(w, http.StatusBadRequest, api.Error{
+			Code:     api.ErrCodeInvalidBatch,
+			Message:  "invalid metrics in batch",
+			Rejected: toAPIRejected(result.Rejected),
+		})
+		return
+	}
+	if err != nil {
+		logging.Entry(r.Context(), h.logger).Errorf("BatchMetricsHandler: failed to update metrics: %v", err)
+		writeServiceError(w, err)
+		return
+	}
+
+	accepted := make([]api.Metrics, 0, len(result.Accepted))
+	for _, item := range result.Accepted {
+		if item.Index >= 0 && item.Index < len(input) {
+			accepted = append(accepted, input[item.Index])
+		}
+	}
+	RecordUpdate(r, h.auditor, accepted)
+	writeJSON(w, r, h.logger, http.StatusOK, toAPIBatchResult(result))
+}
+
+// toAPIMetric переводит метрику в формат ответа API /api/v1. В отличие от
+// POST /value, значение отдаётся всегда, в том числе нулевой delta.
+func toAPIMetric(metric dto.Metrics) api.Metrics {
+	response := api.Metrics{ID: metric.ID, MType: metric.MType}
+	switch metric.MType {
+	case domain.Counter:
+		delta := metric.Delta.Int64
+		response.Delta = &delta
+	case domain.Gauge:
+		value := metric.Value.Float64
+		response.Value = &value
+	}
+	setMetadata(&response, metric)
+	return response
+}
+
+// toAPIBatchResult переводит итог пакетного обновления в формат ответа.
+func toAPIBatchResult(result services.BatchResult) api.BatchResult {
+	response := api.BatchResult{
+		Accepted: make([]api.BatchItem, 0, len(result.Accepted)),
+		Rejected: toAPIRejected(result.Rejected),
+	}
+	for _, item := range result.Accepted {
+		response.Accepted = append(response.Accepted, api.BatchItem{Index: item.Index, ID: item.ID, MType: item.MType})
+	}
+	return response
+}
+
+func toAPIRejected(rejected []services.MetricError) []api.RejectedMetric {
+	result := make([]api.RejectedMetric, 0, len(rejected))
+	for _, metricErr := range rejected {
+		result = append(result, api.RejectedMetric{
+			Index: metricErr.Index,
+			ID:    metricErr.ID,
+			MType: metricErr.MType,
+			Code:  metricErr.Code,
+			Error: metricErr.Err.Error(),
+		})
+	}
+	return result
+}
+
+// writeJSON отвечает телом v в формате JSON.
+func writeJSON(w http.ResponseWriter, r *http.Request, logger *log.Logger, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		logging.Entry(r.Context(), logger).Errorf("error encoding response: %v", err)
+	}
+}
@@ -0,0 +1,270 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Axel791/metricsalert/internal/server/model/api"
+	"github.com/Axel791/metricsalert/internal/server/model/domain"
+	"github.com/Axel791/metricsalert/internal/server/repositories"
+	"github.com/Axel791/metricsalert/internal/server/services"
+)
+
+func newV1Router(t *testing.T) (http.Handler, repositories.Store, *auditLog) {
+	t.Helper()
+
+	store := repositories.NewMetricMapRepository()
+	_, err := store.UpdateGauge(context.Background(), "Alloc", 1.5)
+	require.NoError(t, err)
+	_, err = store.UpdateCounter(context.Background(), "PollCount", 7)
+	require.NoError(t, err)
+
+	service := services.NewMetricsService(store)
+	auditor := &auditLog{}
+
+	router := chi.NewRouter()
+	router.Route("/api/v1", func(v1 chi.Router) {
+		v1.NotFound(NotFoundJSON)
+		v1.MethodNotAllowed(MethodNotAllowedJSON)
+		v1.Method(http.MethodGet, "/metrics", NewListMetricsHandler(service, log.New()))
+		v1.Method(http.MethodPost, "/metrics", NewBatchMetricsHandler(service, auditor, log.New()))
+		v1.Method(http.MethodGet, "/metrics/{metricType}/{name}", NewReadMetricHandler(service, log.New()))
+		v1.Method(http.MethodPut, "/metrics/{metricType}/{name}", NewPutMetricHandler(service, auditor, log.New()))
+	})
+	return router, store, auditor
+}
+
+func serveV1(router http.Handler, method, target, body string) *httptest.ResponseRecorder {
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest(method, target, bytes.NewBufferString(body)))
+	return rr
+}
+
+func decodeAPIError(t *testing.T, rr *httptest.ResponseRecorder) api.Error {
+	t.Helper()
+
+	assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+	var response api.ErrorResponse
+	require.NoError(t, json.NewDecoder(rr.Body).Decode(&response))
+	return response.Error
+}
+
+func TestListMetricsHandler(t *testing.T) {
+	router, _, _ := newV1Router(t)
+
+	rr := serveV1(router, http.MethodGet, "/api/v1/metrics", "")
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	var response api.MetricsList
+	require.NoError(t, json.NewDecoder(rr.Body).Decode(&response))
+	require.Len(t, response.Metrics, 2)
+	assert.Equal(t, "PollCount", response.Metrics[0].ID)
+	assert.Equal(t, int64(7), *response.Metrics[0].Delta)
+	assert.Equal(t, "Alloc", response.Metrics[1].ID)
+	assert.Equal(t, 1.5, *response.Metrics[1].Value)
+}
+
+func TestListMetricsHandlerFiltersAndPages(t *testing.T) {
+	router, store, _ := newV1Router(t)
+	_, err := store.UpdateGauge(context.Background(), "Alloc2", 2)
+	require.NoError(t, err)
+
+	var ids []string
+	target := "/api/v1/metrics?type=gauge&glob=Alloc*&sort=-name&limit=1"
+	for pages := 0; ; pages++ {
+		require.Less(t, pages, 3)
+		rr := serveV1(router, http.MethodGet, target, "")
+		require.Equal(t, http.StatusOK, rr.Code)
+
+		var response api.MetricsList
+		require.NoError(t, json.NewDecoder(rr.Body).Decode(&response))
+		for _, metric := range response.Metrics {
+			ids = append(ids, metric.ID)
+		}
+		if response.NextCursor == "" {
+			break
+		}
+		target = "/api/v1/metrics?type=gauge&glob=Alloc*&sort=-name&limit=1&cursor=" + response.NextCursor
+	}
+	assert.Equal(t, []string{"Alloc2", "Alloc"}, ids)
+}
+
+func TestListMetricsHandlerFiltersByLabels(t *testing.T) {
+	router, _, _ := newV1Router(t)
+
+	rr := serveV1(router, http.MethodPost, "/api/v1/metrics", `[
+		{"id": "cpu", "type": "gauge", "value": 1, "labels": {"host": "a", "env": "prod"}},
+		{"id": "mem", "type": "gauge", "value": 2, "labels": {"host": "b", "env": "prod"}}
+	]`)
+	require.Equal(t, http.StatusOK, rr.Code)
+	rr = serveV1(router, http.MethodPut, "/api/v1/metrics/counter/requests", `{"delta": 1, "labels": {"host": "a"}}`)
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	list := func(target string) []api.Metrics {
+		rr := serveV1(router, http.MethodGet, target, "")
+		require.Equal(t, http.StatusOK, rr.Code, target)
+		var response api.MetricsList
+		require.NoError(t, json.NewDecoder(rr.Body).Decode(&response))
+		return response.Metrics
+	}
+
+	metrics := list("/api/v1/metrics?label=host=a")
+	require.Len(t, metrics, 2)
+	assert.Equal(t, "requests", metrics[0].ID)
+	assert.Equal(t, map[string]string{"host": "a"}, metrics[0].Labels)
+	assert.Equal(t, "cpu", metrics[1].ID)
+	assert.Equal(t, map[string]string{"host": "a", "env": "prod"}, metrics[1].Labels)
+
+	metrics = list("/api/v1/metrics?label=env=prod&label=host=b")
+	require.Len(t, metrics, 1)
+	assert.Equal(t, "mem", metrics[0].ID)
+
+	assert.Empty(t, list("/api/v1/metrics?label=host=c"))
+}
+
+func TestListMetricsHandlerInvalidQuery(t *testing.T) {
+	router, _, _ := newV1Router(t)
+
+	for _, target := range []string{
+		"/api/v1/metrics?label=env:prod",
+		"/api/v1/metrics?label==prod",
+		"/api/v1/metrics?label=env=prod&label=env=dev",
+		"/api/v1/metrics?limit=0",
+		"/api/v1/metrics?sort=value",
+		"/api/v1/metrics?regex=(",
+		"/api/v1/metrics?cursor=garbage!",
+	} {
+		rr := serveV1(router, http.MethodGet, target, "")
+		assert.Equal(t, http.StatusBadRequest, rr.Code, target)
+		assert.Equal(t, api.ErrCodeInvalidRequest, decodeAPIError(t, rr).Code, target)
+	}
+}
+
+func TestReadMetricHandler(t *testing.T) {
+	router, _, _ := newV1Router(t)
+
+	rr := serveV1(router, http.MethodGet, "/api/v1/metrics/gauge/Alloc", "")
+	require.Equal(t, http.StatusOK, rr.Code)
+	var metric api.Metrics
+	require.NoError(t, json.NewDecoder(rr.Body).Decode(&metric))
+	assert.Equal(t, 1.5, *metric.Value)
+	assert.NotNil(t, metric.UpdatedAt)
+
+	rr = serveV1(router, http.MethodGet, "/api/v1/metrics/gauge/Missing", "")
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+	assert.Equal(t, api.ErrCodeNotFound, decodeAPIError(t, rr).Code)
+
+	rr = serveV1(router, http.MethodGet, "/api/v1/metrics/histogram/Alloc", "")
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Equal(t, api.ErrCodeInvalidMetric, decodeAPIError(t, rr).Code)
+}
+
+func TestPutMetricHandler(t *testing.T) {
+	tests := []struct {
+		name       string
+		target     string
+		body       string
+		wantStatus int
+		wantCode   string
+	}{
+		{"invalid body", "/api/v1/metrics/gauge/Alloc", "{", http.StatusBadRequest, api.ErrCodeInvalidRequest},
+		{"missing value", "/api/v1/metrics/gauge/Alloc", `{}`, http.StatusBadRequest, api.ErrCodeInvalidMetric},
+		{
+			"id does not match path", "/api/v1/metrics/gauge/Alloc", `{"id":"Other","value":1}`,
+			http.StatusBadRequest, api.ErrCodeInvalidMetric,
+		},
+		{"reserved name", "/api/v1/metrics/gauge/_server.x", `{"value":1}`, http.StatusBadRequest, api.ErrCodeInvalidMetric},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router, _, auditor := newV1Router(t)
+
+			rr := serveV1(router, http.MethodPut, tt.target, tt.body)
+
+			assert.Equal(t, tt.wantStatus, rr.Code)
+			assert.Equal(t, tt.wantCode, decodeAPIError(t, rr).Code)
+			assert.Empty(t, auditor.events)
+		})
+	}
+
+	t.Run("counter delta is added", func(t *testing.T) {
+		router, store, auditor := newV1Router(t)
+
+		rr := serveV1(router, http.MethodPut, "/api/v1/metrics/counter/PollCount", `{"delta":3}`)
+		require.Equal(t, http.StatusOK, rr.Code)
+
+		var metric api.Metrics
+		require.NoError(t, json.NewDecoder(rr.Body).Decode(&metric))
+		assert.Equal(t, "PollCount", metric.ID)
+		assert.Equal(t, int64(10), *metric.Delta)
+
+		stored, err := store.GetMetric(context.Background(), domain.Metrics{Name: "PollCount", MType: domain.Counter})
+		require.NoError(t, err)
+		assert.Equal(t, int64(10), stored.Delta.Int64)
+
+		require.Len(t, auditor.events, 1)
+		assert.Equal(t, []api.Metrics{{ID: "PollCount", MType: domain.Counter, Delta: int64Ptr(3)}},
+			auditor.events[0].Metrics)
+	})
+}
+
+func TestBatchMetricsHandler(t *testing.T) {
+	body := `[{"id":"Alloc","type":"gauge","value":2},{"id":"PollCount","type":"counter"}]`
+
+	t.Run("partial success", func(t *testing.T) {
+		router, _, auditor := newV1Router(t)
+
+		rr := serveV1(router, http.MethodPost, "/api/v1/metrics", body)
+		require.Equal(t, http.StatusOK, rr.Code)
+
+		var result api.BatchResult
+		require.NoError(t, json.NewDecoder(rr.Body).Decode(&result))
+		assert.Equal(t, []api.BatchItem{{Index: 0, ID: "Alloc", MType: domain.Gauge}}, result.Accepted)
+		require.Len(t, result.Rejected, 1)
+		assert.Equal(t, services.ReasonMissingDelta, result.Rejected[0].Code)
+		require.Len(t, auditor.events, 1)
+	})
+
+	t.Run("strict mode", func(t *testing.T) {
+		router, _, auditor := newV1Router(t)
+
+		rr := serveV1(router, http.MethodPost, "/api/v1/metrics?strict=true", body)
+		require.Equal(t, http.StatusBadRequest, rr.Code)
+
+		apiErr := decodeAPIError(t, rr)
+		assert.Equal(t, api.ErrCodeInvalidBatch, apiErr.Code)
+		require.Len(t, apiErr.Rejected, 1)
+		assert.Equal(t, 1, apiErr.Rejected[0].Index)
+		assert.Empty(t, auditor.events)
+	})
+
+	t.Run("invalid strict", func(t *testing.T) {
+		router, _, _ := newV1Router(t)
+
+		rr := serveV1(router, http.MethodPost, "/api/v1/metrics?strict=maybe", body)
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		assert.Equal(t, api.ErrCodeInvalidRequest, decodeAPIError(t, rr).Code)
+	})
+}
+
+func TestAPIV1UnknownRoute(t *testing.T) {
+	router, _, _ := newV1Router(t)
+
+	rr := serveV1(router, http.MethodGet, "/api/v1/unknown", "")
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+	assert.Equal(t, api.ErrCodeNotFound, decodeAPIError(t, rr).Code)
+
+	rr = serveV1(router, http.MethodPatch, "/api/v1/metrics", "")
+	assert.Equal(t, http.StatusMethodNotAllowed, rr.Code)
+	assert.Equal(t, api.ErrCodeMethodNotAllowed, decodeAPIError(t, rr).Code)
+}
@@ -6,8 +6,10 @@ import (
 
 	log "github.com/sirupsen/logrus"
 
+	"github.com/Axel791/metricsalert/internal/server/audit"
 	"github.com/Axel791/metricsalert/internal/server/model/api"
 	"github.com/Axel791/metricsalert/internal/server/services"
+	"github.com/Axel791/metricsalert/internal/shared/logging"
 )
 
 // UpdateMetricHandler принимает HTTP‑запрос с JSON‑описанием метрики
@@ -41,20 +43,28 @@ import (
 // # Коды ошибок
 //
 //	400 – некорректный JSON или нарушены бизнес‑правила (например, пустые value/delta);
+//	503 – хранилище временно недоступно;
 //	500 – ошибка кодирования ответа.
 //
+// Принятая метрика записывается в журнал аудита обновлений.
 // Все диагностические сообщения пишет в переданный *log.Logger.
 // Экземпляр хэндлера потокобезопасен.
 type UpdateMetricHandler struct {
 	metricService services.Metric
+	auditor       audit.Recorder
 	logger        *log.Logger
 }
 
 // NewUpdateMetricHandler конструирует UpdateMetricHandler с внедрённым
-// сервисом метрик и логгером.
-func NewUpdateMetricHandler(metricService services.Metric, logger *log.Logger) *UpdateMetricHandler {
+// сервисом метрик, журналом аудита и логгером.
+func NewUpdateMetricHandler(
+	metricService services.Metric,
+	auditor audit.Recorder,
+	logger *log.Logger,
+) *UpdateMetricHandler {
 	return &UpdateMetricHandler{
 		metricService: metricService,
+		auditor:       auditor,
 		logger:        logger,
 	}
 }
@@ -64,26 +74,31 @@ func NewUpdateMetricHandler(metricService services.Metric, logger *log.Logger) *
 // Шаги выполнения:
 //  1. Декодирует тело запроса в api.Metrics.
 //  2. Передаёт DTO в MetricService.CreateOrUpdateMetric.
-//  3. Возвращает обновлённый объект в JSON.
+//  3. Записывает принятую метрику в журнал аудита.
+//  4. Возвращает обновлённый объект в JSON.
 func (h *UpdateMetricHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	var input api.Metrics
 	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
-		h.logger.Printf("UpdateMetricHandler: failed to decode request body: %v", err)
+		logging.Entry(r.Context(), h.logger).Warnf("UpdateMetricHandler: failed to decode request body: %v", err)
 		http.Error(w, "invalid request body", http.StatusBadRequest)
 		return
 	}
 
 	metricDTO, err := h.metricService.CreateOrUpdateMetric(r.Context(), input)
 	if err != nil {
-		h.logger.Printf("UpdateMetricHandler: failed to update metric: %v", err)
+		logging.Entry(r.Context(), h.logger).Errorf("UpdateMetricHandler: failed to update metric: %v", err)
+		if writeUnavailable(w, err) {
+			return
+		}
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	RecordUpdate(r, h.auditor, []api.Metrics{input})
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	if err := json.NewEncoder(w).Encode(metricDTO); err != nil {
-		h.logger.Printf("UpdateMetricHandler: failed to encode response: %v", err)
+		logging.Entry(r.Context(), h.logger).Errorf("UpdateMetricHandler: failed to encode response: %v", err)
 		http.Error(w, "failed to encode response", http.StatusInternalServerError)
 		return
 	}
@@ -5,17 +5,22 @@ import (
 	"database/sql"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"testing"
 
 	"github.com/golang/mock/gomock"
+	log "github.com/sirupsen/logrus"
+	logtest "github.com/sirupsen/logrus/hooks/test"
 	"github.com/stretchr/testify/assert"
 	"gopkg.in/guregu/null.v4"
 
+	"github.com/Axel791/metricsalert/internal/server/audit"
 	"github.com/Axel791/metricsalert/internal/server/model/api"
 	"github.com/Axel791/metricsalert/internal/server/model/domain"
 	"github.com/Axel791/metricsalert/internal/server/model/dto"
+	"github.com/Axel791/metricsalert/internal/server/services"
 	"github.com/Axel791/metricsalert/internal/server/services/mock"
 )
 
@@ -23,6 +28,7 @@ func TestUpdateMetricHandler_ServeHTTP(t *testing.T) {
 	tests := []struct {
 		name           string
 		input          api.Metrics
+		body           string
 		mockSetup      func(*mock.MockMetric)
 		expectedStatus int
 		expectedBody   interface{}
@@ -83,9 +89,12 @@ func TestUpdateMetricHandler_ServeHTTP(t *testing.T) {
 				ID:    "invalid",
 				MType: "invalidType",
 			},
-			mockSetup:      func(_ *mock.MockMetric) {},
+			mockSetup: func(m *mock.MockMetric) {
+				m.EXPECT().CreateOrUpdateMetric(gomock.Any(), api.Metrics{ID: "invalid", MType: "invalidType"}).
+					Return(dto.Metrics{}, fmt.Errorf("%w: invalid metric type: invalidType", services.ErrInvalidMetric))
+			},
 			expectedStatus: http.StatusBadRequest,
-			expectedBody:   "invalid request body",
+			expectedBody:   "invalid metric type",
 		},
 		{
 			name: "missing required fields",
@@ -93,6 +102,17 @@ func TestUpdateMetricHandler_ServeHTTP(t *testing.T) {
 				ID:    "",
 				MType: domain.Gauge,
 			},
+			mockSetup: func(m *mock.MockMetric) {
+				m.EXPECT().CreateOrUpdateMetric(gomock.Any(), api.Metrics{MType: domain.Gauge}).
+					Return(dto.Metrics{}, fmt.Errorf("%w: metric name (ID) is required", services.ErrInvalidMetric))
+			},
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   "metric name (ID) is required",
+		},
+		{
+			name:           "invalid request body",
+			input:          api.Metrics{},
+			body:           "invalid json",
 			mockSetup:      func(_ *mock.MockMetric) {},
 			expectedStatus: http.StatusBadRequest,
 			expectedBody:   "invalid request body",
@@ -124,10 +144,13 @@ func TestUpdateMetricHandler_ServeHTTP(t *testing.T) {
 			mockMetric := mock.NewMockMetric(ctrl)
 			tt.mockSetup(mockMetric)
 
-			handler := NewUpdateMetricHandler(mockMetric, nil)
+			handler := NewUpdateMetricHandler(mockMetric, audit.Discard, log.New())
 
 			reqBody, err := json.Marshal(tt.input)
 			assert.NoError(t, err)
+			if tt.body != "" {
+				reqBody = []byte(tt.body)
+			}
 
 			req, err := http.NewRequest(http.MethodPost, "/", bytes.NewBuffer(reqBody))
 			assert.NoError(t, err)
@@ -161,7 +184,8 @@ func TestUpdateMetricHandler_EncodingError(t *testing.T) {
 			Delta: null.Int{NullInt64: sql.NullInt64{Int64: 42, Valid: true}},
 		}, nil)
 
-	handler := NewUpdateMetricHandler(mockMetric, nil)
+	logger, hook := logtest.NewNullLogger()
+	handler := NewUpdateMetricHandler(mockMetric, audit.Discard, logger)
 
 	req, err := http.NewRequest(http.MethodPost, "/", bytes.NewBufferString(`{"id":"testCounter","type":"counter","delta":42}`))
 	assert.NoError(t, err)
@@ -170,6 +194,12 @@ func TestUpdateMetricHandler_EncodingError(t *testing.T) {
 	w := &errorResponseWriter{ResponseWriter: rr, failAfter: 0}
 	handler.ServeHTTP(w, req)
 
-	assert.Equal(t, http.StatusInternalServerError, rr.Code)
-	assert.Contains(t, rr.Body.String(), "failed to encode response")
+	// Статус уже отправлен до ошибки записи тела, поэтому ошибка только
+	// логируется.
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Empty(t, rr.Body.String())
+	if assert.NotNil(t, hook.LastEntry()) {
+		assert.Equal(t, log.ErrorLevel, hook.LastEntry().Level)
+		assert.Contains(t, hook.LastEntry().Message, "failed to encode response")
+	}
 }
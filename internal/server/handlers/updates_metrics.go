@@ -2,51 +2,80 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
+	"strconv"
 
 	log "github.com/sirupsen/logrus"
 
+	"github.com/Axel791/metricsalert/internal/server/audit"
 	"github.com/Axel791/metricsalert/internal/server/model/api"
 	"github.com/Axel791/metricsalert/internal/server/services"
+	"github.com/Axel791/metricsalert/internal/shared/logging"
 )
 
 // UpdatesMetricsHandler обрабатывает пакетное (batch) обновление метрик.
 //
 // Клиент отправляет массив JSON‑объектов в формате `api.Metrics`; каждый элемент
-// описывает одну метрику (counter или gauge). Хендлер валидирует входные данные
-// и делегирует их обработку `MetricService.BatchMetricsUpdate`, позволяя
-// применить несколько изменений атомарно.
+// описывает одну метрику (counter или gauge). Хендлер делегирует обработку
+// `MetricService.BatchMetricsUpdate`: корректные метрики пачки сохраняются
+// атомарно, некорректные отклоняются, а в ответе перечисляются принятые и
+// отклонённые метрики с кодом причины.
+//
+// С параметром `?strict=true` пачка обрабатывается по принципу «всё или
+// ничего»: если хотя бы одна метрика некорректна, не сохраняется ни одна и
+// возвращается 400 с тем же телом ответа.
 //
 // # Пример запроса
 //
-// POST /api/metrics HTTP/1.1
+// POST /updates/ HTTP/1.1
 // Content-Type: application/json
 //
 // [
 //
 //	{"id":"Alloc","type":"gauge","value":6.27},
-//	{"id":"PollCount","type":"counter","delta":5}
+//	{"id":"PollCount","type":"counter"}
 //
 // ]
 //
+// # Пример ответа
+//
+//	{
+//	  "accepted": [{"index": 0, "id": "Alloc", "type": "gauge"}],
+//	  "rejected": [
+//	    {"index": 1, "id": "PollCount", "type": "counter", "code": "missing_delta",
+//	     "error": "delta is required for counter"}
+//	  ]
+//	}
+//
+// Коды причин: missing_id, invalid_type, reserved_name, missing_delta, missing_value,
+// invalid_labels.
+//
 // # Ответы
 // | Код | Когда возвращается                                        |
 // |-----|-----------------------------------------------------------|
-// | 200 | Метрики успешно сохранены                                 |
-// | 400 | Невалидный JSON или бизнес‑ошибка сервиса                 |
-// | 500 | Неожиданная внутренняя ошибка при сериализации/логике      |
+// | 200 | Пачка обработана, тело перечисляет принятые и отклонённые |
+// | 400 | Невалидный JSON, неверный strict или (strict) некорректные метрики |
+// | 500 | Ошибка хранилища                                          |
+// | 503 | Хранилище временно недоступно (база не отвечает)          |
 //
 // Логи записываются через переданный `*log.Logger`. Экземпляр
 // `UpdatesMetricsHandler` потокобезопасен.
 type UpdatesMetricsHandler struct {
 	metricService services.Metric
+	auditor       audit.Recorder
 	logger        *log.Logger
 }
 
 // NewUpdatesMetricsHandler создаёт и инициализирует UpdatesMetricsHandler.
-func NewUpdatesMetricsHandler(metricService services.Metric, logger *log.Logger) *UpdatesMetricsHandler {
+func NewUpdatesMetricsHandler(
+	metricService services.Metric,
+	auditor audit.Recorder,
+	logger *log.Logger,
+) *UpdatesMetricsHandler {
 	return &UpdatesMetricsHandler{
 		metricService: metricService,
+		auditor:       auditor,
 		logger:        logger,
 	}
 }
@@ -54,20 +83,55 @@ func NewUpdatesMetricsHandler(metricService services.Metric, logger *log.Logger)
 // ServeHTTP реализует http.Handler. Последовательность действий:
 //  1. Декодирует входной JSON‑массив в `[]api.Metrics`.
 //  2. Передаёт данные в `MetricService.BatchMetricsUpdate`.
-//  3. Возвращает HTTP 200 при успехе либо соответствующий код ошибки.
+//  3. Записывает принятые метрики в журнал аудита.
+//  4. Возвращает итог обработки пачки либо соответствующий код ошибки.
 func (h *UpdatesMetricsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	strict := false
+	if raw := r.URL.Query().Get("strict"); raw != "" {
+		var err error
+		if strict, err = strconv.ParseBool(raw); err != nil {
+			http.Error(w, "invalid strict parameter", http.StatusBadRequest)
+			return
+		}
+	}
+
 	var input []api.Metrics
 	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
-		h.logger.Printf("UpdatesMetricsHandler: failed to decode request body: %v", err)
+		logging.Entry(r.Context(), h.logger).Warnf("UpdatesMetricsHandler: failed to decode request body: %v", err)
 		http.Error(w, "invalid request body", http.StatusBadRequest)
 		return
 	}
 
-	if err := h.metricService.BatchMetricsUpdate(r.Context(), input); err != nil {
-		h.logger.Printf("UpdatesMetricsHandler: failed to update metrics: %v", err)
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	result, err := h.metricService.BatchMetricsUpdate(r.Context(), input, strict)
+	var validationErr *services.BatchValidationError
+	if errors.As(err, &validationErr) {
+		logging.Entry(r.Context(), h.logger).Warnf("UpdatesMetricsHandler: rejected batch: %v", err)
+		response := toAPIBatchResult(result)
+		response.Error = "invalid metrics in batch"
+		writeJSON(w, r, h.logger, http.StatusBadRequest, response)
+		return
+	}
+	if err != nil {
+		logging.Entry(r.Context(), h.logger).Errorf("UpdatesMetricsHandler: failed to update metrics: %v", err)
+		if writeUnavailable(w, err) {
+			return
+		}
+		http.Error(w, "failed to update metrics", http.StatusInternalServerError)
 		return
 	}
 
-	w.WriteHeader(http.StatusOK)
+	accepted := make([]api.Metrics, 0, len(result.Accepted))
+	for _, item := range result.Accepted {
+		if item.Index >= 0 && item.Index < len(input) {
+			accepted = append(accepted, input[item.Index])
+		}
+	}
+	RecordUpdate(r, h.auditor, accepted)
+
+	if len(result.Rejected) > 0 {
+		logging.Entry(r.Context(), h.logger).Warnf(
+			"UpdatesMetricsHandler: rejected %d of %d metrics", len(result.Rejected), len(input),
+		)
+	}
+	writeJSON(w, r, h.logger, http.StatusOK, toAPIBatchResult(result))
 }
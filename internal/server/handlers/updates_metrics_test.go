@@ -0,0 +1,201 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Axel791/metricsalert/internal/server/audit"
+	"github.com/Axel791/metricsalert/internal/server/model/api"
+	"github.com/Axel791/metricsalert/internal/server/model/domain"
+	"github.com/Axel791/metricsalert/internal/server/repositories"
+	"github.com/Axel791/metricsalert/internal/server/services"
+	"github.com/Axel791/metricsalert/internal/server/services/mock"
+	"github.com/Axel791/metricsalert/internal/shared"
+)
+
+func TestUpdatesMetricsHandler_ServeHTTP(t *testing.T) {
+	input := []api.Metrics{
+		{ID: "Alloc", MType: domain.Gauge, Value: float64Ptr(1.5)},
+		{ID: "PollCount", MType: domain.Counter},
+		{ID: "", MType: domain.Gauge, Value: float64Ptr(2)},
+	}
+	rejected := []services.MetricError{
+		{
+			Index: 1, ID: "PollCount", MType: domain.Counter,
+			Code: services.ReasonMissingDelta, Err: errors.New("delta is required for counter"),
+		},
+		{
+			Index: 2, ID: "", MType: domain.Gauge,
+			Code: services.ReasonMissingID, Err: errors.New("metric id is required"),
+		},
+	}
+	rejectedResponse := []api.RejectedMetric{
+		{Index: 1, ID: "PollCount", MType: domain.Counter, Code: "missing_delta", Error: "delta is required for counter"},
+		{Index: 2, ID: "", MType: domain.Gauge, Code: "missing_id", Error: "metric id is required"},
+	}
+
+	tests := []struct {
+		name           string
+		query          string
+		strict         bool
+		result         services.BatchResult
+		serviceErr     error
+		expectedStatus int
+		expectedBody   *api.BatchResult
+	}{
+		{
+			name: "partial success",
+			result: services.BatchResult{
+				Accepted: []services.BatchItem{{Index: 0, ID: "Alloc", MType: domain.Gauge}},
+				Rejected: rejected,
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody: &api.BatchResult{
+				Accepted: []api.BatchItem{{Index: 0, ID: "Alloc", MType: domain.Gauge}},
+				Rejected: rejectedResponse,
+			},
+		},
+		{
+			name:           "strict mode rejects whole batch",
+			query:          "?strict=true",
+			strict:         true,
+			result:         services.BatchResult{Rejected: rejected},
+			serviceErr:     &services.BatchValidationError{Errors: rejected},
+			expectedStatus: http.StatusBadRequest,
+			expectedBody: &api.BatchResult{
+				Error:    "invalid metrics in batch",
+				Accepted: []api.BatchItem{},
+				Rejected: rejectedResponse,
+			},
+		},
+		{
+			name:           "store error",
+			serviceErr:     errors.New("database is unavailable"),
+			expectedStatus: http.StatusInternalServerError,
+		},
+		{
+			name:           "store temporarily unavailable",
+			serviceErr:     fmt.Errorf("BatchMetricsUpdate: %w", repositories.ErrUnavailable),
+			expectedStatus: http.StatusServiceUnavailable,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			mockMetric := mock.NewMockMetric(ctrl)
+			mockMetric.EXPECT().BatchMetricsUpdate(gomock.Any(), input, tt.strict).Return(tt.result, tt.serviceErr)
+
+			handler := NewUpdatesMetricsHandler(mockMetric, audit.Discard, log.New())
+
+			reqBody, err := json.Marshal(input)
+			require.NoError(t, err)
+
+			rr := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPost, "/updates/"+tt.query, bytes.NewReader(reqBody))
+			handler.ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+			if tt.expectedBody != nil {
+				assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+
+				var response api.BatchResult
+				require.NoError(t, json.NewDecoder(rr.Body).Decode(&response))
+				assert.Equal(t, *tt.expectedBody, response)
+			}
+		})
+	}
+}
+
+func TestUpdatesMetricsHandler_InvalidStrict(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	handler := NewUpdatesMetricsHandler(mock.NewMockMetric(ctrl), audit.Discard, log.New())
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/updates/?strict=maybe", bytes.NewBufferString("[]")))
+
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+}
+
+func TestUpdatesMetricsHandler_InvalidJSON(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	handler := NewUpdatesMetricsHandler(mock.NewMockMetric(ctrl), audit.Discard, log.New())
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/updates/", bytes.NewBufferString("{")))
+
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+}
+
+func TestUpdatesMetricsHandler_RecordsAudit(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	input := []api.Metrics{
+		{ID: "Alloc", MType: domain.Gauge, Value: float64Ptr(1.5)},
+		{ID: "PollCount", MType: domain.Counter},
+	}
+	result := services.BatchResult{
+		Accepted: []services.BatchItem{{Index: 0, ID: "Alloc", MType: domain.Gauge}},
+		Rejected: []services.MetricError{{
+			Index: 1, ID: "PollCount", MType: domain.Counter,
+			Code: services.ReasonMissingDelta, Err: errors.New("delta is required for counter"),
+		}},
+	}
+	mockMetric := mock.NewMockMetric(ctrl)
+	mockMetric.EXPECT().BatchMetricsUpdate(gomock.Any(), input, false).Return(result, nil)
+
+	auditor := &auditLog{}
+	handler := NewUpdatesMetricsHandler(mockMetric, auditor, log.New())
+
+	reqBody, err := json.Marshal(input)
+	require.NoError(t, err)
+	req := httptest.NewRequest(http.MethodPost, "/updates/", bytes.NewReader(reqBody))
+	req.RemoteAddr = "10.0.0.7:51234"
+	req.Header.Set(shared.AgentIDHeader, "agent-1")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	require.Equal(t, http.StatusOK, rr.Code)
+	require.Len(t, auditor.events, 1)
+	event := auditor.events[0]
+	assert.Equal(t, audit.ActionUpdateMetrics, event.Action)
+	assert.Equal(t, "10.0.0.7", event.SourceIP)
+	assert.Equal(t, "agent-1", event.Agent)
+	assert.Equal(t, audit.OutcomeSuccess, event.Outcome)
+	assert.Equal(t, input[:1], event.Metrics)
+}
+
+func TestUpdatesMetricsHandler_NoAuditWithoutAccepted(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockMetric := mock.NewMockMetric(ctrl)
+	mockMetric.EXPECT().BatchMetricsUpdate(gomock.Any(), gomock.Any(), false).
+		Return(services.BatchResult{}, errors.New("database is unavailable"))
+
+	auditor := &auditLog{}
+	handler := NewUpdatesMetricsHandler(mockMetric, auditor, log.New())
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/updates/", bytes.NewBufferString("[]")))
+
+	assert.Equal(t, http.StatusInternalServerError, rr.Code)
+	assert.Empty(t, auditor.events)
+}
@@ -0,0 +1,41 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/Axel791/metricsalert/internal/server/model/api"
+)
+
+// AdminAuth пропускает запросы с заголовком "Authorization: Bearer <token>".
+// Без заголовка или с неверным токеном отвечает 401. Если token пуст,
+// административные маршруты выключены и отвечают 403. Ошибки возвращаются
+// в формате api.ErrorResponse, как и у остальных маршрутов /api/v1.
+func AdminAuth(token string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if token == "" {
+				writeAPIError(w, http.StatusForbidden, api.ErrCodeForbidden, "admin API is disabled")
+				return
+			}
+
+			presented, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !ok || subtle.ConstantTimeCompare([]byte(presented), []byte(token)) != 1 {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+				writeAPIError(w, http.StatusUnauthorized, api.ErrCodeUnauthorized, "invalid admin token")
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func writeAPIError(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(api.ErrorResponse{Error: api.Error{Code: code, Message: message}})
+}
@@ -0,0 +1,19 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// Deprecated помечает ответы устаревшего маршрута заголовками Deprecation и
+// Link со ссылкой на маршрут /api/v1, который его заменяет.
+func Deprecated(successor string) func(http.Handler) http.Handler {
+	link := fmt.Sprintf(`<%s>; rel="successor-version"`, successor)
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Deprecation", "true")
+			w.Header().Add("Link", link)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
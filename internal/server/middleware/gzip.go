@@ -79,6 +79,12 @@ func (g *gzipResponseWriter) Write(b []byte) (int, error) {
 	return g.ResponseWriter.Write(b)
 }
 
+// Unwrap возвращает исходный writer для http.ResponseController: потоковые
+// ответы (text/event-stream) не сжимаются и сбрасываются клиенту напрямую.
+func (g *gzipResponseWriter) Unwrap() http.ResponseWriter {
+	return g.ResponseWriter
+}
+
 func (g *gzipResponseWriter) closeAsync() {
 	if g.gz != nil {
 		g.gz.Close()
@@ -5,6 +5,8 @@ import (
 	"time"
 
 	log "github.com/sirupsen/logrus"
+
+	"github.com/Axel791/metricsalert/internal/shared/logging"
 )
 
 // ResponseWriter структура ответа
@@ -27,7 +29,14 @@ func (rw *ResponseWriter) Write(data []byte) (int, error) {
 	return size, err
 }
 
-// WithLogging middleware для получения информации о запросе
+// Unwrap возвращает исходный writer для http.ResponseController.
+func (rw *ResponseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
+// WithLogging пишет одну структурированную запись о каждом запросе:
+// метод, путь, статус, длительность и размер ответа. Идентификатор запроса
+// добавляется из контекста, поэтому middleware ставится после RequestID.
 func WithLogging(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
@@ -37,14 +46,15 @@ func WithLogging(next http.Handler) http.Handler {
 			StatusCode:     http.StatusOK,
 		}
 
-		log.Infof("Started %s %s", r.Method, r.RequestURI)
-
 		next.ServeHTTP(rw, r)
 
-		duration := time.Since(start)
-		log.Infof(
-			"Completed %d %s in %v (%d bytes)",
-			rw.StatusCode, http.StatusText(rw.StatusCode), duration, rw.Size,
-		)
+		logging.FromContext(r.Context()).WithFields(log.Fields{
+			"method":      r.Method,
+			"uri":         r.RequestURI,
+			"status":      rw.StatusCode,
+			"duration_ms": float64(time.Since(start).Microseconds()) / 1000,
+			"size":        rw.Size,
+			"remote_addr": r.RemoteAddr,
+		}).Info("request completed")
 	})
 }
@@ -0,0 +1,44 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/Axel791/metricsalert/internal/server/telemetry"
+)
+
+// unmatchedRoute - метка маршрута для запросов, не попавших ни в один маршрут.
+const unmatchedRoute = "unmatched"
+
+// Metrics считает запросы и их длительность по маршруту, методу и статусу.
+// В метку попадает шаблон маршрута chi ("/update/{metricType}/{name}/{value}"),
+// а не сам путь, чтобы число серий не росло с числом метрик.
+func Metrics(metrics *telemetry.ServerMetrics) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if metrics == nil {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+
+			rw := &ResponseWriter{
+				ResponseWriter: w,
+				StatusCode:     http.StatusOK,
+			}
+
+			next.ServeHTTP(rw, r)
+
+			route := unmatchedRoute
+			if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+				route = rctx.RoutePattern()
+			}
+			status := strconv.Itoa(rw.StatusCode)
+
+			metrics.HTTPRequests.Inc(route, r.Method, status)
+			metrics.HTTPDuration.Observe(time.Since(start).Seconds(), route, r.Method, status)
+		})
+	}
+}
@@ -0,0 +1,29 @@
+package middleware
+
+import (
+	"net/http"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/Axel791/metricsalert/internal/shared/logging"
+)
+
+// RequestID берёт идентификатор запроса из заголовка X-Request-ID или
+// генерирует новый, возвращает его в ответе и кладёт в контекст запроса
+// вместе с записью лога, к которой он уже привязан.
+func RequestID(logger *log.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id := r.Header.Get(logging.RequestIDHeader)
+			if !logging.ValidRequestID(id) {
+				id = logging.NewRequestID()
+			}
+			w.Header().Set(logging.RequestIDHeader, id)
+
+			ctx := logging.WithRequestID(r.Context(), id)
+			ctx = logging.WithLogger(ctx, logger.WithField(logging.RequestIDField, id))
+
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
@@ -0,0 +1,52 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Axel791/metricsalert/internal/shared/logging"
+)
+
+func TestRequestID(t *testing.T) {
+	tests := []struct {
+		name     string
+		incoming string
+		keep     bool
+	}{
+		{name: "propagates valid header", incoming: "abc-123", keep: true},
+		{name: "generates when missing", incoming: ""},
+		{name: "replaces invalid header", incoming: "bad\nid"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var ctxID string
+			var entryID any
+			handler := RequestID(log.New())(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+				ctxID = logging.RequestIDFromContext(r.Context())
+				entryID = logging.FromContext(r.Context()).Data[logging.RequestIDField]
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.incoming != "" {
+				req.Header.Set(logging.RequestIDHeader, tt.incoming)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			id := rec.Header().Get(logging.RequestIDHeader)
+			assert.NotEmpty(t, id)
+			if tt.keep {
+				assert.Equal(t, tt.incoming, id)
+			} else {
+				assert.NotEqual(t, tt.incoming, id)
+			}
+			assert.Equal(t, id, ctxID)
+			assert.Equal(t, id, entryID)
+		})
+	}
+}
@@ -13,10 +13,15 @@ import (
 
 // responseCapture перехватывает запись ответа и буферизует тело,
 // а также использует оригинальный заголовочный набор.
+//
+// Flush переводит ответ в потоковый режим: накопленное тело и всё
+// дальнейшее пишется в оригинальный writer сразу, без подписи, потому что
+// тело потока (например, text/event-stream) заранее неизвестно.
 type responseCapture struct {
 	rw         http.ResponseWriter // оригинальный writer
 	body       bytes.Buffer
 	statusCode int
+	streaming  bool
 }
 
 // newResponseCapture создаёт новый перехватчик, устанавливая начальный код статуса.
@@ -32,8 +37,12 @@ func (rc *responseCapture) Header() http.Header {
 	return rc.rw.Header()
 }
 
-// Write записывает данные в буфер (не отправляя их сразу).
+// Write записывает данные в буфер (не отправляя их сразу), а в потоковом
+// режиме - в оригинальный writer.
 func (rc *responseCapture) Write(b []byte) (int, error) {
+	if rc.streaming {
+		return rc.rw.Write(b)
+	}
 	return rc.body.Write(b)
 }
 
@@ -42,11 +51,17 @@ func (rc *responseCapture) WriteHeader(statusCode int) {
 	rc.statusCode = statusCode
 }
 
-// Flush делегирует вызов оригинальному ResponseWriter, если он поддерживает http.Flusher.
+// Flush включает потоковый режим, отправляет накопленное тело и делегирует
+// вызов оригинальному ResponseWriter.
 func (rc *responseCapture) Flush() {
-	if flusher, ok := rc.rw.(http.Flusher); ok {
-		flusher.Flush()
+	if !rc.streaming {
+		rc.streaming = true
+		rc.rw.Header().Del("Content-Length")
+		rc.rw.WriteHeader(rc.statusCode)
+		_, _ = rc.rw.Write(rc.body.Bytes())
+		rc.body.Reset()
 	}
+	_ = http.NewResponseController(rc.rw).Flush()
 }
 
 // Hijack делегирует вызов оригинальному ResponseWriter, если он поддерживает http.Hijacker.
@@ -76,6 +91,9 @@ func SignatureMiddleware(signService services.SignService) func(next http.Handle
 			}
 			rc := newResponseCapture(w)
 			next.ServeHTTP(rc, r)
+			if rc.streaming {
+				return
+			}
 
 			newToken := signService.ComputedHash(rc.body.Bytes())
 
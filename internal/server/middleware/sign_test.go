@@ -0,0 +1,57 @@
+package middleware
+
+import (
+	"bufio"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Axel791/metricsalert/internal/server/services"
+)
+
+func TestSignatureMiddlewareStreaming(t *testing.T) {
+	release := make(chan struct{})
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/plain" {
+			_, _ = io.WriteString(w, "plain body")
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = io.WriteString(w, "first\n")
+		assert.NoError(t, http.NewResponseController(w).Flush())
+		<-release
+		_, _ = io.WriteString(w, "second\n")
+	})
+
+	chain := WithLogging(SignatureMiddleware(services.NewSignService("key"))(GzipMiddleware(handler)))
+	server := httptest.NewServer(chain)
+	defer server.Close()
+	defer close(release)
+
+	resp, err := http.Get(server.URL + "/plain")
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+	assert.NotEmpty(t, resp.Header.Get("HashSHA256"), "buffered responses are still signed")
+
+	resp, err = http.Get(server.URL + "/stream")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Empty(t, resp.Header.Get("HashSHA256"))
+
+	lines := make(chan string, 1)
+	go func() {
+		line, _ := bufio.NewReader(resp.Body).ReadString('\n')
+		lines <- line
+	}()
+	select {
+	case line := <-lines:
+		assert.Equal(t, "first\n", line)
+	case <-time.After(time.Second):
+		t.Fatal("flushed data is not delivered before the handler returns")
+	}
+}
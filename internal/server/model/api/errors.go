@@ -0,0 +1,49 @@
+package api
+
+// Коды ошибок API /api/v1.
+const (
+	ErrCodeInvalidRequest   = "invalid_request"
+	ErrCodeInvalidMetric    = "invalid_metric"
+	ErrCodeInvalidBatch     = "invalid_batch"
+	ErrCodeNotFound         = "not_found"
+	ErrCodeMethodNotAllowed = "method_not_allowed"
+	ErrCodeUnauthorized     = "unauthorized"
+	ErrCodeForbidden        = "forbidden"
+	ErrCodeUnavailable      = "unavailable"
+	ErrCodeInternal         = "internal"
+	// ErrCodeLagging - подписчик потока метрик не успевал забирать события
+	// и был отключён.
+	ErrCodeLagging = "lagging"
+)
+
+// ErrorResponse - тело любого ответа API /api/v1 с ошибкой.
+//
+// Пример:
+//
+//	{
+//	  "error": {
+//	    "code":    "not_found",
+//	    "message": "metric not found"
+//	  }
+//	}
+type ErrorResponse struct {
+	Error Error `json:"error"`
+}
+
+// Error описывает ошибку: машиночитаемый код (одна из констант ErrCode*) и
+// сообщение для человека. Rejected заполняется только для отклонённой пачки
+// метрик и перечисляет ошибки по каждой метрике.
+type Error struct {
+	Code     string           `json:"code"`
+	Message  string           `json:"message"`
+	Rejected []RejectedMetric `json:"rejected,omitempty"`
+}
+
+// RejectedMetric - метрика из пачки, отклонённая при проверке.
+type RejectedMetric struct {
+	Index int    `json:"index"`
+	ID    string `json:"id"`
+	MType string `json:"type"`
+	Code  string `json:"code"`
+	Error string `json:"error"`
+}
@@ -1,5 +1,7 @@
 package api
 
+import "time"
+
 // Metrics описывает универсальный JSON‑контейнер для передачи значения одной
 // метрики (gauge или counter) между клиентом и сервером.
 //
@@ -10,6 +12,12 @@ package api
 //     или null в запросах/ответах gauge‑метрик.
 //   - Value  — при MType=="gauge" содержит само числовое значение (Float64).
 //     Отсутствует или null в запросах/ответах counter‑метрик.
+//   - UpdatedAt — только в ответах: время последнего обновления метрики
+//     (RFC 3339). Отсутствует, если время неизвестно.
+//   - Labels — метки метрики (пары строк). В запросе непустые метки заменяют
+//     сохранённые, без меток сохранённые метки не меняются.
+//   - Stale — только в ответах: true, если метрика не обновлялась дольше
+//     срока из настроек устаревания (staleness).
 //
 // В каждом экземпляре одновременно задано **только одно** из полей Delta/Value.
 // Сервер обязан валидировать согласованность: переданное поле должно
@@ -31,10 +39,13 @@ package api
 //	  "delta": 3
 //	}
 type Metrics struct {
-	ID    string   `json:"id"`
-	MType string   `json:"type"`
-	Delta *int64   `json:"delta,omitempty"`
-	Value *float64 `json:"value,omitempty"`
+	ID        string            `json:"id"`
+	MType     string            `json:"type"`
+	Delta     *int64            `json:"delta,omitempty"`
+	Value     *float64          `json:"value,omitempty"`
+	UpdatedAt *time.Time        `json:"updated_at,omitempty"`
+	Labels    map[string]string `json:"labels,omitempty"`
+	Stale     bool              `json:"stale,omitempty"`
 }
 
 // GetMetric описывает запрос клиента на получение значения конкретной метрики.
@@ -54,3 +65,44 @@ type GetMetric struct {
 	ID    string `json:"id"`
 	MType string `json:"type"`
 }
+
+// MetricsList - страница ответа GET /api/v1/metrics. NextCursor передаётся
+// в параметре cursor, чтобы получить следующую страницу; на последней
+// странице его нет.
+type MetricsList struct {
+	Metrics    []Metrics `json:"metrics"`
+	NextCursor string    `json:"next_cursor,omitempty"`
+}
+
+// BatchItem - метрика из пачки, принятая сервером.
+type BatchItem struct {
+	Index int    `json:"index"`
+	ID    string `json:"id"`
+	MType string `json:"type"`
+}
+
+// BatchResult - ответ POST /api/v1/metrics и POST /updates: какие метрики
+// пачки сохранены, а какие отклонены и почему. Error заполняется только в
+// ответе POST /updates на отклонённую строгую пачку.
+type BatchResult struct {
+	Error    string           `json:"error,omitempty"`
+	Accepted []BatchItem      `json:"accepted"`
+	Rejected []RejectedMetric `json:"rejected"`
+}
+
+// MetricEvent - событие потока GET /api/v1/metrics/stream: действие
+// (snapshot, update, reset или delete) и метрика после него. У удалённой
+// метрики заданы только id и type.
+//
+// Пример:
+//
+//	{
+//	  "action": "update",
+//	  "metric": {"id": "PollCount", "type": "counter", "delta": 42},
+//	  "time":   "2026-10-19T12:00:00Z"
+//	}
+type MetricEvent struct {
+	Action string    `json:"action"`
+	Metric Metrics   `json:"metric"`
+	Time   time.Time `json:"time"`
+}
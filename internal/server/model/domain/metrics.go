@@ -1,7 +1,13 @@
 package domain
 
 import (
+	"database/sql/driver"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"maps"
+	"strings"
+	"time"
 
 	"gopkg.in/guregu/null.v4"
 )
@@ -11,12 +17,107 @@ const (
 	Counter = "counter"
 )
 
+// ReservedPrefix - префикс имён метрик, которые сервер пишет о себе сам.
+// Клиенты не могут обновлять метрики с таким префиксом.
+const ReservedPrefix = "_server."
+
+// ErrReservedName - имя метрики занято внутренними метриками сервера.
+var ErrReservedName = errors.New("metric name uses reserved prefix " + ReservedPrefix)
+
 type Metrics struct {
 	ID    int64      `db:"id"`
 	Name  string     `db:"name"`
 	MType string     `db:"metric_type"`
 	Delta null.Int   `db:"delta"`
 	Value null.Float `db:"value"`
+	// UpdatedAt - время последнего обновления метрики. Нулевое значение -
+	// время неизвестно (метрика сохранена до появления этого поля).
+	UpdatedAt time.Time `db:"updated_at"`
+	// Labels - метки метрики. Запись без меток сохраняет метки, заданные
+	// раньше, запись с метками заменяет их целиком.
+	Labels Labels `db:"labels" json:",omitempty"`
+}
+
+// Labels - метки метрики: пары «ключ - значение». В PostgreSQL хранятся в
+// столбце jsonb.
+type Labels map[string]string
+
+// Clone возвращает копию меток; для пустых меток - nil.
+func (l Labels) Clone() Labels {
+	if len(l) == 0 {
+		return nil
+	}
+	return maps.Clone(l)
+}
+
+// Contains сообщает, есть ли в метках все пары из subset.
+func (l Labels) Contains(subset Labels) bool {
+	for k, v := range subset {
+		if got, ok := l[k]; !ok || got != v {
+			return false
+		}
+	}
+	return true
+}
+
+// Merge возвращает метки после записи метрики с метками update: непустые
+// update заменяют текущие метки, пустые оставляют их как есть.
+func (l Labels) Merge(update Labels) Labels {
+	if len(update) == 0 {
+		return l.Clone()
+	}
+	return update.Clone()
+}
+
+// Value сохраняет метки в jsonb; пустые метки - пустой объект.
+func (l Labels) Value() (driver.Value, error) {
+	if len(l) == 0 {
+		return "{}", nil
+	}
+	data, err := json.Marshal(map[string]string(l))
+	if err != nil {
+		return nil, fmt.Errorf("encode labels: %w", err)
+	}
+	return string(data), nil
+}
+
+// Scan читает метки из jsonb.
+func (l *Labels) Scan(src interface{}) error {
+	var data []byte
+	switch v := src.(type) {
+	case nil:
+		*l = nil
+		return nil
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return fmt.Errorf("scan labels: unsupported type %T", src)
+	}
+	var labels map[string]string
+	if err := json.Unmarshal(data, &labels); err != nil {
+		return fmt.Errorf("decode labels: %w", err)
+	}
+	*l = Labels(labels).Clone()
+	return nil
+}
+
+// MetricKey - ключ метрики в хранилище. Метрики с одинаковым именем, но
+// разными типами (gauge и counter) - разные метрики.
+type MetricKey struct {
+	Name  string
+	MType string
+}
+
+// String возвращает ключ в виде "type/name".
+func (k MetricKey) String() string {
+	return k.MType + "/" + k.Name
+}
+
+// Key возвращает ключ метрики.
+func (m *Metrics) Key() MetricKey {
+	return MetricKey{Name: m.Name, MType: m.MType}
 }
 
 func (m *Metrics) ValidateMetricsType() error {
@@ -33,6 +134,24 @@ func (m *Metrics) ValidateMetricID() error {
 	return nil
 }
 
+// ValidateWritable проверяет, что клиент может обновлять метрику с таким именем.
+func (m *Metrics) ValidateWritable() error {
+	if strings.HasPrefix(m.Name, ReservedPrefix) {
+		return ErrReservedName
+	}
+	return nil
+}
+
+// ValidateLabels проверяет, что у всех меток метрики есть имя.
+func (m *Metrics) ValidateLabels() error {
+	for key := range m.Labels {
+		if key == "" {
+			return errors.New("label name is required")
+		}
+	}
+	return nil
+}
+
 func (m *Metrics) SetMetricValue(value interface{}) error {
 	switch m.MType {
 	case Counter:
@@ -1,10 +1,20 @@
 package dto
 
-import "gopkg.in/guregu/null.v4"
+import (
+	"time"
+
+	"gopkg.in/guregu/null.v4"
+)
 
 type Metrics struct {
 	ID    string
 	MType string
 	Delta null.Int
 	Value null.Float
+	// UpdatedAt - время последнего обновления; нулевое, если неизвестно.
+	UpdatedAt time.Time
+	// Labels - метки метрики.
+	Labels map[string]string
+	// Stale - метрика не обновлялась дольше срока из политики устаревания.
+	Stale bool
 }
@@ -0,0 +1,26 @@
+// Package openapi хранит описание API /api/v1 в формате OpenAPI 3.
+//
+// Документ openapi.json поддерживается вручную и встраивается в бинарник
+// сервера; при изменении маршрутов /api/v1 его нужно обновить вместе с ними.
+package openapi
+
+import (
+	_ "embed"
+	"net/http"
+)
+
+//go:embed openapi.json
+var spec []byte
+
+// Spec возвращает документ OpenAPI в формате JSON.
+func Spec() []byte {
+	return spec
+}
+
+// Handler отдаёт документ OpenAPI.
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(spec)
+	})
+}
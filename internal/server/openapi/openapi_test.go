@@ -0,0 +1,91 @@
+package openapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type document struct {
+	OpenAPI    string                                `json:"openapi"`
+	Paths      map[string]map[string]json.RawMessage `json:"paths"`
+	Components struct {
+		Schemas   map[string]json.RawMessage `json:"schemas"`
+		Responses map[string]json.RawMessage `json:"responses"`
+	} `json:"components"`
+}
+
+func TestSpecDescribesAPIV1(t *testing.T) {
+	var doc document
+	require.NoError(t, json.Unmarshal(Spec(), &doc))
+	assert.True(t, strings.HasPrefix(doc.OpenAPI, "3."))
+
+	var operations []string
+	for path, item := range doc.Paths {
+		for method := range item {
+			if method != "parameters" {
+				operations = append(operations, strings.ToUpper(method)+" "+path)
+			}
+		}
+	}
+	sort.Strings(operations)
+	// Список должен совпадать с маршрутами /api/v1 в cmd/server/main.go.
+	assert.Equal(t, []string{
+		"DELETE /metrics/{type}/{name}",
+		"GET /metrics",
+		"GET /metrics/stream",
+		"GET /metrics/{type}/{name}",
+		"GET /openapi.json",
+		"POST /metrics",
+		"POST /metrics/{type}/{name}/reset",
+		"PUT /metrics/{type}/{name}",
+	}, operations)
+}
+
+func TestSpecReferencesResolve(t *testing.T) {
+	var doc document
+	require.NoError(t, json.Unmarshal(Spec(), &doc))
+
+	var raw any
+	require.NoError(t, json.Unmarshal(Spec(), &raw))
+
+	var walk func(v any)
+	walk = func(v any) {
+		switch node := v.(type) {
+		case map[string]any:
+			if ref, ok := node["$ref"].(string); ok {
+				switch {
+				case strings.HasPrefix(ref, "#/components/schemas/"):
+					assert.Contains(t, doc.Components.Schemas, strings.TrimPrefix(ref, "#/components/schemas/"))
+				case strings.HasPrefix(ref, "#/components/responses/"):
+					assert.Contains(t, doc.Components.Responses, strings.TrimPrefix(ref, "#/components/responses/"))
+				default:
+					t.Errorf("unexpected $ref %q", ref)
+				}
+			}
+			for _, child := range node {
+				walk(child)
+			}
+		case []any:
+			for _, child := range node {
+				walk(child)
+			}
+		}
+	}
+	walk(raw)
+}
+
+func TestHandler(t *testing.T) {
+	rr := httptest.NewRecorder()
+	Handler().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/v1/openapi.json", nil))
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+	assert.Equal(t, Spec(), rr.Body.Bytes())
+}
@@ -0,0 +1,263 @@
+package repositories
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+	"gopkg.in/guregu/null.v4"
+
+	"github.com/Axel791/metricsalert/internal/server/model/domain"
+)
+
+// metricsBucket - бакет BoltDB с метриками. Внутри него по вложенному бакету
+// на каждый тип метрики, ключ во вложенном бакете - имя метрики.
+var metricsBucket = []byte("metrics")
+
+// metricTypes - типы метрик, для которых создаются вложенные бакеты.
+var metricTypes = []string{domain.Gauge, domain.Counter}
+
+// boltOpenTimeout - сколько ждать блокировку файла, занятого другим процессом.
+const boltOpenTimeout = time.Second
+
+// BoltMetricsHandler хранит метрики во встроенной базе BoltDB в одном файле.
+// Каждая транзакция записи фиксируется на диске (fsync) до возврата из метода,
+// поэтому отдельный журнал и снимки не нужны.
+type BoltMetricsHandler struct {
+	db *bolt.DB
+}
+
+// NewBoltStore открывает (или создаёт) файл базы path.
+func NewBoltStore(path string) (*BoltMetricsHandler, error) {
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: boltOpenTimeout})
+	if err != nil {
+		return nil, fmt.Errorf("open bolt database %q: %w", path, err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		root, err := tx.CreateBucketIfNotExists(metricsBucket)
+		if err != nil {
+			return err
+		}
+		for _, mType := range metricTypes {
+			if _, err = root.CreateBucketIfNotExists([]byte(mType)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("prepare bolt database: %w", err)
+	}
+
+	return &BoltMetricsHandler{db: db}, nil
+}
+
+// UpdateGauge - обновление Gauge.
+func (r *BoltMetricsHandler) UpdateGauge(_ context.Context, name string, value float64) (domain.Metrics, error) {
+	var result domain.Metrics
+	err := r.db.Update(func(tx *bolt.Tx) error {
+		var err error
+		result, err = updateBoltMetric(tx.Bucket(metricsBucket), domain.Metrics{
+			Name:  name,
+			MType: domain.Gauge,
+			Value: null.FloatFrom(value),
+		})
+		return err
+	})
+	if err != nil {
+		return domain.Metrics{}, fmt.Errorf("UpdateGauge: %w", err)
+	}
+	return result, nil
+}
+
+// UpdateCounter - обновление Counter.
+func (r *BoltMetricsHandler) UpdateCounter(_ context.Context, name string, value int64) (domain.Metrics, error) {
+	var result domain.Metrics
+	err := r.db.Update(func(tx *bolt.Tx) error {
+		var err error
+		result, err = updateBoltMetric(tx.Bucket(metricsBucket), domain.Metrics{
+			Name:  name,
+			MType: domain.Counter,
+			Delta: null.IntFrom(value),
+		})
+		return err
+	})
+	if err != nil {
+		return domain.Metrics{}, fmt.Errorf("UpdateCounter: %w", err)
+	}
+	return result, nil
+}
+
+// GetMetric - получение метрики по имени и типу. Если метрики нет или у неё
+// другой тип, возвращается ErrNotFound.
+func (r *BoltMetricsHandler) GetMetric(_ context.Context, metric domain.Metrics) (domain.Metrics, error) {
+	var result domain.Metrics
+	err := r.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(metricsBucket).Bucket([]byte(metric.MType))
+		if bucket == nil {
+			return ErrNotFound
+		}
+		stored, ok, err := getBoltMetric(bucket, metric.Name)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return ErrNotFound
+		}
+		result = stored
+		return nil
+	})
+	if err != nil {
+		return domain.Metrics{}, fmt.Errorf("GetMetric: %w", err)
+	}
+	return result, nil
+}
+
+// GetAllMetrics - получение всех метрик.
+func (r *BoltMetricsHandler) GetAllMetrics(_ context.Context) (map[domain.MetricKey]domain.Metrics, error) {
+	result := make(map[domain.MetricKey]domain.Metrics)
+	err := r.db.View(func(tx *bolt.Tx) error {
+		root := tx.Bucket(metricsBucket)
+		for _, mType := range metricTypes {
+			err := root.Bucket([]byte(mType)).ForEach(func(k, v []byte) error {
+				var metric domain.Metrics
+				if err := json.Unmarshal(v, &metric); err != nil {
+					return fmt.Errorf("decode metric %s/%s: %w", mType, k, err)
+				}
+				result[metric.Key()] = metric
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("GetAllMetrics: %w", err)
+	}
+	return result, nil
+}
+
+// BatchUpdateMetrics применяет всю пачку в одной транзакции: при ошибке
+// на любой метрике не сохраняется ни одна.
+func (r *BoltMetricsHandler) BatchUpdateMetrics(_ context.Context, metrics []domain.Metrics) error {
+	if err := validateBatch(metrics); err != nil {
+		return fmt.Errorf("BatchUpdateMetrics: %w", err)
+	}
+	err := r.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(metricsBucket)
+		for _, metric := range metrics {
+			if _, err := updateBoltMetric(bucket, metric); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("BatchUpdateMetrics: %w", err)
+	}
+	return nil
+}
+
+// DeleteMetric - удаление метрики.
+func (r *BoltMetricsHandler) DeleteMetric(_ context.Context, key domain.MetricKey) error {
+	err := r.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(metricsBucket).Bucket([]byte(key.MType))
+		if bucket == nil || bucket.Get([]byte(key.Name)) == nil {
+			return ErrNotFound
+		}
+		return bucket.Delete([]byte(key.Name))
+	})
+	if err != nil {
+		return fmt.Errorf("DeleteMetric: %w", err)
+	}
+	return nil
+}
+
+// ResetCounter - обнуление Counter. Метки counter сохраняются.
+func (r *BoltMetricsHandler) ResetCounter(_ context.Context, name string) (domain.Metrics, error) {
+	var result domain.Metrics
+	err := r.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(metricsBucket).Bucket([]byte(domain.Counter))
+		stored, ok, err := getBoltMetric(bucket, name)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return ErrNotFound
+		}
+		result = domain.Metrics{
+			Name: name, MType: domain.Counter, Delta: null.IntFrom(0), UpdatedAt: time.Now(), Labels: stored.Labels,
+		}
+		data, err := json.Marshal(result)
+		if err != nil {
+			return fmt.Errorf("encode metric %q: %w", name, err)
+		}
+		return bucket.Put([]byte(name), data)
+	})
+	if err != nil {
+		return domain.Metrics{}, fmt.Errorf("ResetCounter: %w", err)
+	}
+	return result, nil
+}
+
+// QueryMetrics - выборка метрик по запросу.
+func (r *BoltMetricsHandler) QueryMetrics(ctx context.Context, query MetricsQuery) ([]domain.Metrics, error) {
+	return queryAll(ctx, r, query)
+}
+
+// Close закрывает файл базы.
+func (r *BoltMetricsHandler) Close() error {
+	return r.db.Close()
+}
+
+// updateBoltMetric записывает gauge или прибавляет counter в рамках транзакции.
+func updateBoltMetric(root *bolt.Bucket, metric domain.Metrics) (domain.Metrics, error) {
+	bucket := root.Bucket([]byte(metric.MType))
+	if bucket == nil {
+		return domain.Metrics{}, fmt.Errorf("unknown metric type %s for metric %s", metric.MType, metric.Name)
+	}
+	stored, exists, err := getBoltMetric(bucket, metric.Name)
+	if err != nil {
+		return domain.Metrics{}, err
+	}
+
+	result := domain.Metrics{
+		Name: metric.Name, MType: metric.MType, UpdatedAt: updatedAt(metric), Labels: stored.Labels.Merge(metric.Labels),
+	}
+	if metric.MType == domain.Gauge {
+		result.Value = null.FloatFrom(metric.Value.Float64)
+	} else {
+		delta := metric.Delta.Int64
+		if exists {
+			delta += stored.Delta.Int64
+		}
+		result.Delta = null.IntFrom(delta)
+	}
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		return domain.Metrics{}, fmt.Errorf("encode metric %q: %w", metric.Name, err)
+	}
+	if err = bucket.Put([]byte(metric.Name), data); err != nil {
+		return domain.Metrics{}, fmt.Errorf("put metric %q: %w", metric.Name, err)
+	}
+	return result, nil
+}
+
+func getBoltMetric(bucket *bolt.Bucket, name string) (domain.Metrics, bool, error) {
+	data := bucket.Get([]byte(name))
+	if data == nil {
+		return domain.Metrics{}, false, nil
+	}
+	var metric domain.Metrics
+	if err := json.Unmarshal(data, &metric); err != nil {
+		return domain.Metrics{}, false, fmt.Errorf("decode metric %q: %w", name, err)
+	}
+	return metric, true, nil
+}
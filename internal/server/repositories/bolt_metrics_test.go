@@ -0,0 +1,73 @@
+package repositories
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/guregu/null.v4"
+
+	"github.com/Axel791/metricsalert/internal/server/model/domain"
+)
+
+func openBoltStore(t *testing.T, path string) *BoltMetricsHandler {
+	t.Helper()
+
+	store, err := NewBoltStore(path)
+	require.NoError(t, err)
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+func TestBoltStore_PersistsAcrossReopen(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "metrics.db")
+
+	store := openBoltStore(t, path)
+	_, err := store.UpdateCounter(ctx, "PollCount", 2)
+	require.NoError(t, err)
+	counter, err := store.UpdateCounter(ctx, "PollCount", 3)
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), counter.Delta.Int64)
+	_, err = store.UpdateGauge(ctx, "Alloc", 1.5)
+	require.NoError(t, err)
+	require.NoError(t, store.Close())
+
+	reopened := openBoltStore(t, path)
+	all, err := reopened.GetAllMetrics(ctx)
+	require.NoError(t, err)
+	assert.Len(t, all, 2)
+	assert.Equal(t, int64(5), all[domain.MetricKey{Name: "PollCount", MType: domain.Counter}].Delta.Int64)
+	assert.Equal(t, 1.5, all[domain.MetricKey{Name: "Alloc", MType: domain.Gauge}].Value.Float64)
+
+	gauge, err := reopened.GetMetric(ctx, domain.Metrics{Name: "Alloc", MType: domain.Gauge})
+	require.NoError(t, err)
+	assert.Equal(t, 1.5, gauge.Value.Float64)
+
+	_, err = reopened.GetMetric(ctx, domain.Metrics{Name: "Alloc", MType: domain.Counter})
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestBoltStore_BatchIsAtomic(t *testing.T) {
+	ctx := context.Background()
+	store := openBoltStore(t, filepath.Join(t.TempDir(), "metrics.db"))
+
+	require.NoError(t, store.BatchUpdateMetrics(ctx, []domain.Metrics{
+		{Name: "PollCount", MType: domain.Counter, Delta: null.IntFrom(1)},
+		{Name: "PollCount", MType: domain.Counter, Delta: null.IntFrom(2)},
+		{Name: "Alloc", MType: domain.Gauge, Value: null.FloatFrom(3)},
+	}))
+
+	err := store.BatchUpdateMetrics(ctx, []domain.Metrics{
+		{Name: "PollCount", MType: domain.Counter, Delta: null.IntFrom(10)},
+		{Name: "Broken", MType: "histogram"},
+	})
+	require.Error(t, err)
+
+	all, err := store.GetAllMetrics(ctx)
+	require.NoError(t, err)
+	assert.Len(t, all, 2)
+	assert.Equal(t, int64(3), all[domain.MetricKey{Name: "PollCount", MType: domain.Counter}].Delta.Int64, "failed batch must not be applied partially")
+}
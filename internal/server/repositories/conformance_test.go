@@ -0,0 +1,142 @@
+package repositories_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/Axel791/metricsalert/internal/server/db"
+	"github.com/Axel791/metricsalert/internal/server/repositories"
+	"github.com/Axel791/metricsalert/internal/server/repositories/storetest"
+	"github.com/Axel791/metricsalert/internal/server/telemetry"
+)
+
+// testDatabaseDSNEnv - переменная с DSN тестовой базы PostgreSQL. Таблица
+// metrics в ней очищается перед каждым тестом.
+const testDatabaseDSNEnv = "TEST_DATABASE_DSN"
+
+func TestMapStoreConformance(t *testing.T) {
+	storetest.Run(t, func(_ *testing.T) storetest.Backend {
+		return storetest.Backend{Store: repositories.NewMetricMapRepository()}
+	})
+}
+
+func TestInstrumentedStoreConformance(t *testing.T) {
+	metrics := telemetry.NewServerMetrics(telemetry.NewRegistry())
+	storetest.Run(t, func(_ *testing.T) storetest.Backend {
+		store := repositories.NewMetricMapRepository()
+		return storetest.Backend{Store: repositories.NewInstrumentedStore(store, repositories.BackendMemory, metrics)}
+	})
+}
+
+func TestHistoryRecorderConformance(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) storetest.Backend {
+		recorder := repositories.NewHistoryRecorder(repositories.NewMetricMapRepository(), repositories.NewMemoryHistory())
+		t.Cleanup(func() { recorder.Close() })
+		return storetest.Backend{Store: recorder}
+	})
+}
+
+func TestFallbackStoreConformance(t *testing.T) {
+	unavailable := func(context.Context) (repositories.Store, error) {
+		return nil, errors.New("connection refused")
+	}
+
+	t.Run("Degraded", func(t *testing.T) {
+		storetest.Run(t, func(_ *testing.T) storetest.Backend {
+			return storetest.Backend{Store: repositories.NewFallbackStore(unavailable, time.Hour)}
+		})
+	})
+
+	t.Run("Primary", func(t *testing.T) {
+		storetest.Run(t, func(t *testing.T) storetest.Backend {
+			ctx, cancel := context.WithCancel(context.Background())
+			t.Cleanup(cancel)
+
+			store := repositories.NewFallbackStore(func(context.Context) (repositories.Store, error) {
+				return repositories.NewMetricMapRepository(), nil
+			}, time.Millisecond)
+			store.Run(ctx)
+			require.Equal(t, repositories.ModePrimary, store.Mode())
+			return storetest.Backend{Store: store}
+		})
+	})
+}
+
+func TestFileStoreConformance(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) storetest.Backend {
+		path := filepath.Join(t.TempDir(), "metrics.json")
+		open := func(t *testing.T) *repositories.FileStoreHandler {
+			ctx, cancel := context.WithCancel(context.Background())
+			t.Cleanup(cancel)
+
+			store, err := repositories.NewFileStore(ctx, repositories.NewMetricMapRepository(), path, true, 0, nil)
+			require.NoError(t, err)
+			t.Cleanup(func() { store.Close() })
+			return store
+		}
+
+		store := open(t)
+		return storetest.Backend{
+			Store: store,
+			// Без Flush: данные должны восстановиться из журнала, как после сбоя.
+			Reopen: func(t *testing.T) repositories.Store {
+				require.NoError(t, store.Close())
+				return open(t)
+			},
+		}
+	})
+}
+
+func TestBoltStoreConformance(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) storetest.Backend {
+		path := filepath.Join(t.TempDir(), "metrics.db")
+		open := func(t *testing.T) *repositories.BoltMetricsHandler {
+			store, err := repositories.NewBoltStore(path)
+			require.NoError(t, err)
+			t.Cleanup(func() { store.Close() })
+			return store
+		}
+
+		store := open(t)
+		return storetest.Backend{
+			Store: store,
+			Reopen: func(t *testing.T) repositories.Store {
+				require.NoError(t, store.Close())
+				return open(t)
+			},
+		}
+	})
+}
+
+func TestPostgresStoreConformance(t *testing.T) {
+	dsn := os.Getenv(testDatabaseDSNEnv)
+	if dsn == "" {
+		t.Skipf("%s is not set", testDatabaseDSNEnv)
+	}
+
+	conn, err := db.ConnectDB(dsn, filepath.Join("..", "..", "..", "migrations"), db.PoolConfig{})
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	storetest.Run(t, func(t *testing.T) storetest.Backend {
+		_, err := conn.Exec("TRUNCATE TABLE metrics")
+		require.NoError(t, err)
+
+		open := func(t *testing.T) repositories.Store {
+			store := repositories.NewMetricRepository(conn, db.NewRetrier(db.DefaultRetryConfig()))
+			t.Cleanup(func() { store.Close() })
+			return store
+		}
+
+		return storetest.Backend{
+			Store:  open(t),
+			Reopen: open,
+		}
+	})
+}
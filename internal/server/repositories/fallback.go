@@ -0,0 +1,349 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"gopkg.in/guregu/null.v4"
+
+	"github.com/Axel791/metricsalert/internal/server/db"
+	"github.com/Axel791/metricsalert/internal/server/model/domain"
+	"github.com/Axel791/metricsalert/internal/shared/logging"
+)
+
+// Режимы работы FallbackStore.
+const (
+	// ModePrimary - запросы обслуживает основное хранилище.
+	ModePrimary = "primary"
+	// ModeDegraded - основное хранилище недоступно, метрики хранятся в
+	// памяти и копятся для переноса.
+	ModeDegraded = "degraded"
+)
+
+// Connector подключается к основному хранилищу.
+type Connector func(ctx context.Context) (Store, error)
+
+// FallbackStore обслуживает запросы из памяти, пока основное хранилище
+// (PostgreSQL) недоступно при старте сервера, и переключается на него после
+// подключения.
+//
+// В резервном режиме записи применяются к хранилищу в памяти и копятся в
+// буфере: для counter - сумма приращений, для gauge - последнее значение.
+// Удаление и сброс метрики запоминаются в буфере и при переносе удаляют
+// метрику из основного хранилища перед записью новых значений.
+// Run периодически пытается подключиться; после подключения буфер одной
+// пачкой переносится в основное хранилище, и дальше все запросы идут в него.
+// Пока перенос не выполнен, чтения, удаление и сброс видят только метрики,
+// записанные в резервном режиме.
+type FallbackStore struct {
+	connect  Connector
+	interval time.Duration
+
+	mutex   sync.RWMutex
+	primary Store
+	memory  *MetricMapRepositoryHandler
+	pending map[domain.MetricKey]pendingWrite
+	closed  bool
+}
+
+// pendingWrite - запись буфера переноса. Если replace, метрика удаляется из
+// основного хранилища перед записью metric; если deleted, только удаляется.
+type pendingWrite struct {
+	metric  domain.Metrics
+	replace bool
+	deleted bool
+}
+
+// NewFallbackStore создаёт хранилище в резервном режиме. connect вызывается
+// из Run раз в interval до успешного подключения.
+func NewFallbackStore(connect Connector, interval time.Duration) *FallbackStore {
+	return &FallbackStore{
+		connect:  connect,
+		interval: interval,
+		memory:   NewMetricMapRepository(),
+		pending:  make(map[domain.MetricKey]pendingWrite),
+	}
+}
+
+// Run подключается к основному хранилищу и переносит в него накопленные
+// метрики. Завершается после успешного переноса или отмены ctx.
+func (s *FallbackStore) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		replayed, err := s.reconnect(ctx)
+		if err != nil {
+			logging.FromContext(ctx).Warnf("primary store is still unavailable: %v", err)
+			continue
+		}
+		logging.FromContext(ctx).Infof("connected to primary store, replayed %d buffered metrics", replayed)
+		return
+	}
+}
+
+// Mode возвращает текущий режим работы: ModePrimary или ModeDegraded.
+func (s *FallbackStore) Mode() string {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	if s.primary != nil {
+		return ModePrimary
+	}
+	return ModeDegraded
+}
+
+// PendingWrites возвращает число метрик, ожидающих переноса в основное хранилище.
+func (s *FallbackStore) PendingWrites() int {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	return len(s.pending)
+}
+
+// DB возвращает подключение к базе основного хранилища или nil, пока
+// хранилище работает в резервном режиме.
+func (s *FallbackStore) DB() *sqlx.DB {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	if source, ok := s.primary.(db.Source); ok {
+		return source.DB()
+	}
+	return nil
+}
+
+// reconnect подключается к основному хранилищу и переносит в него буфер.
+// Возвращает число перенесённых метрик.
+func (s *FallbackStore) reconnect(ctx context.Context) (int, error) {
+	if s.Mode() == ModePrimary {
+		return 0, nil
+	}
+
+	primary, err := s.connect(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.closed {
+		return 0, errors.Join(errors.New("store is closed"), closeStore(primary))
+	}
+	if err = replayPending(ctx, primary, s.pending); err != nil {
+		return 0, errors.Join(fmt.Errorf("replay buffered metrics: %w", err), closeStore(primary))
+	}
+
+	replayed := len(s.pending)
+	s.primary = primary
+	s.memory = nil
+	s.pending = nil
+	return replayed, nil
+}
+
+// replayPending переносит буфер в primary: сначала удаляет метрики, которые
+// в резервном режиме удалялись или сбрасывались, затем записывает значения
+// одной пачкой. Повтор после ошибки безопасен: удаление уже удалённой
+// метрики пропускается.
+func replayPending(ctx context.Context, primary Store, pending map[domain.MetricKey]pendingWrite) error {
+	metrics := make([]domain.Metrics, 0, len(pending))
+	for key, write := range pending {
+		if write.replace || write.deleted {
+			if err := primary.DeleteMetric(ctx, key); err != nil && !errors.Is(err, ErrNotFound) {
+				return fmt.Errorf("delete metric %s: %w", key, err)
+			}
+		}
+		if !write.deleted {
+			metrics = append(metrics, write.metric)
+		}
+	}
+	return primary.BatchUpdateMetrics(ctx, mergeBatch(metrics))
+}
+
+// buffer добавляет успешно записанную в память метрику в буфер переноса.
+// Время обновления и метки переносятся вместе с метрикой. Вызывается под mutex.
+func (s *FallbackStore) buffer(metric domain.Metrics) {
+	metric.UpdatedAt = updatedAt(metric)
+	key := metric.Key()
+	existing, ok := s.pending[key]
+	if ok && !existing.deleted {
+		if metric.MType == domain.Counter {
+			metric.Delta.Int64 += existing.metric.Delta.Int64
+		}
+		metric.Labels = existing.metric.Labels.Merge(metric.Labels)
+	}
+	s.pending[key] = pendingWrite{metric: metric, replace: ok && (existing.replace || existing.deleted)}
+}
+
+// current возвращает основное хранилище или nil в резервном режиме.
+func (s *FallbackStore) current() Store {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	return s.primary
+}
+
+func (s *FallbackStore) UpdateGauge(ctx context.Context, name string, value float64) (domain.Metrics, error) {
+	if primary := s.current(); primary != nil {
+		return primary.UpdateGauge(ctx, name, value)
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.primary != nil {
+		return s.primary.UpdateGauge(ctx, name, value)
+	}
+	metric, err := s.memory.UpdateGauge(ctx, name, value)
+	if err != nil {
+		return metric, err
+	}
+	s.buffer(domain.Metrics{Name: name, MType: domain.Gauge, Value: null.FloatFrom(value), UpdatedAt: metric.UpdatedAt})
+	return metric, nil
+}
+
+func (s *FallbackStore) UpdateCounter(ctx context.Context, name string, value int64) (domain.Metrics, error) {
+	if primary := s.current(); primary != nil {
+		return primary.UpdateCounter(ctx, name, value)
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.primary != nil {
+		return s.primary.UpdateCounter(ctx, name, value)
+	}
+	metric, err := s.memory.UpdateCounter(ctx, name, value)
+	if err != nil {
+		return metric, err
+	}
+	s.buffer(domain.Metrics{Name: name, MType: domain.Counter, Delta: null.IntFrom(value), UpdatedAt: metric.UpdatedAt})
+	return metric, nil
+}
+
+func (s *FallbackStore) GetMetric(ctx context.Context, metric domain.Metrics) (domain.Metrics, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	if s.primary != nil {
+		return s.primary.GetMetric(ctx, metric)
+	}
+	return s.memory.GetMetric(ctx, metric)
+}
+
+func (s *FallbackStore) GetAllMetrics(ctx context.Context) (map[domain.MetricKey]domain.Metrics, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	if s.primary != nil {
+		return s.primary.GetAllMetrics(ctx)
+	}
+	return s.memory.GetAllMetrics(ctx)
+}
+
+func (s *FallbackStore) BatchUpdateMetrics(ctx context.Context, metrics []domain.Metrics) error {
+	if primary := s.current(); primary != nil {
+		return primary.BatchUpdateMetrics(ctx, metrics)
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.primary != nil {
+		return s.primary.BatchUpdateMetrics(ctx, metrics)
+	}
+	if err := s.memory.BatchUpdateMetrics(ctx, metrics); err != nil {
+		return err
+	}
+	for _, metric := range metrics {
+		s.buffer(metric)
+	}
+	return nil
+}
+
+func (s *FallbackStore) DeleteMetric(ctx context.Context, key domain.MetricKey) error {
+	if primary := s.current(); primary != nil {
+		return primary.DeleteMetric(ctx, key)
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.primary != nil {
+		return s.primary.DeleteMetric(ctx, key)
+	}
+	if err := s.memory.DeleteMetric(ctx, key); err != nil {
+		return err
+	}
+	s.pending[key] = pendingWrite{deleted: true}
+	return nil
+}
+
+func (s *FallbackStore) ResetCounter(ctx context.Context, name string) (domain.Metrics, error) {
+	if primary := s.current(); primary != nil {
+		return primary.ResetCounter(ctx, name)
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.primary != nil {
+		return s.primary.ResetCounter(ctx, name)
+	}
+	metric, err := s.memory.ResetCounter(ctx, name)
+	if err != nil {
+		return metric, err
+	}
+	s.pending[metric.Key()] = pendingWrite{metric: metric, replace: true}
+	return metric, nil
+}
+
+func (s *FallbackStore) QueryMetrics(ctx context.Context, query MetricsQuery) ([]domain.Metrics, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	if s.primary != nil {
+		return s.primary.QueryMetrics(ctx, query)
+	}
+	return s.memory.QueryMetrics(ctx, query)
+}
+
+// Close закрывает основное хранилище и его подключение к базе, если они
+// были открыты. Метрики, не перенесённые из резервного режима, теряются.
+func (s *FallbackStore) Close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	if s.primary == nil {
+		return nil
+	}
+	return closeStore(s.primary)
+}
+
+// closeStore закрывает store и его подключение к базе, открытое Connector.
+func closeStore(store Store) error {
+	var errs []error
+	if closer, ok := store.(io.Closer); ok {
+		errs = append(errs, closer.Close())
+	}
+	if source, ok := store.(db.Source); ok && source.DB() != nil {
+		errs = append(errs, source.DB().Close())
+	}
+	return errors.Join(errs...)
+}
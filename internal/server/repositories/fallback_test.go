@@ -0,0 +1,165 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/guregu/null.v4"
+
+	"github.com/Axel791/metricsalert/internal/server/model/domain"
+)
+
+// closeRecorder запоминает, что основное хранилище было закрыто.
+type closeRecorder struct {
+	Store
+	closed bool
+}
+
+func (c *closeRecorder) Close() error {
+	c.closed = true
+	return nil
+}
+
+func TestFallbackStore_ReplaysBufferedMetrics(t *testing.T) {
+	ctx := context.Background()
+
+	primary := NewMetricMapRepository()
+	_, err := primary.UpdateCounter(ctx, "PollCount", 10)
+	require.NoError(t, err)
+	_, err = primary.UpdateGauge(ctx, "Alloc", 1)
+	require.NoError(t, err)
+
+	attempts := 0
+	fallback := NewFallbackStore(func(context.Context) (Store, error) {
+		attempts++
+		if attempts < 3 {
+			return nil, errors.New("connection refused")
+		}
+		return primary, nil
+	}, time.Millisecond)
+	assert.Equal(t, ModeDegraded, fallback.Mode())
+
+	_, err = fallback.UpdateCounter(ctx, "PollCount", 2)
+	require.NoError(t, err)
+	require.NoError(t, fallback.BatchUpdateMetrics(ctx, []domain.Metrics{
+		{Name: "PollCount", MType: domain.Counter, Delta: null.IntFrom(3)},
+		{Name: "Alloc", MType: domain.Gauge, Value: null.FloatFrom(4), Labels: domain.Labels{"host": "a"}},
+	}))
+	_, err = fallback.UpdateGauge(ctx, "Alloc", 5)
+	require.NoError(t, err)
+	_, err = fallback.UpdateGauge(ctx, "HeapInuse", 7)
+	require.NoError(t, err)
+	assert.Equal(t, 3, fallback.PendingWrites())
+
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	done := make(chan struct{})
+	go func() {
+		fallback.Run(runCtx)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("fallback store did not reconnect")
+	}
+	assert.Equal(t, 3, attempts)
+	assert.Equal(t, ModePrimary, fallback.Mode())
+	assert.Zero(t, fallback.PendingWrites())
+
+	counter, err := fallback.GetMetric(ctx, domain.Metrics{Name: "PollCount", MType: domain.Counter})
+	require.NoError(t, err)
+	assert.Equal(t, int64(15), counter.Delta.Int64)
+
+	all, err := primary.GetAllMetrics(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 5.0, all[domain.MetricKey{Name: "Alloc", MType: domain.Gauge}].Value.Float64)
+	assert.Equal(t, domain.Labels{"host": "a"}, all[domain.MetricKey{Name: "Alloc", MType: domain.Gauge}].Labels)
+	assert.Equal(t, 7.0, all[domain.MetricKey{Name: "HeapInuse", MType: domain.Gauge}].Value.Float64)
+}
+
+func TestFallbackStore_ReplaysDeletesAndResets(t *testing.T) {
+	ctx := context.Background()
+
+	primary := NewMetricMapRepository()
+	require.NoError(t, primary.BatchUpdateMetrics(ctx, []domain.Metrics{
+		{Name: "PollCount", MType: domain.Counter, Delta: null.IntFrom(10)},
+		{Name: "Alloc", MType: domain.Gauge, Value: null.FloatFrom(1)},
+		{Name: "Typo", MType: domain.Gauge, Value: null.FloatFrom(1)},
+	}))
+	fallback := NewFallbackStore(func(context.Context) (Store, error) {
+		return primary, nil
+	}, time.Millisecond)
+
+	// В резервном режиме удалить и сбросить можно только метрики из памяти.
+	_, err := fallback.ResetCounter(ctx, "PollCount")
+	require.ErrorIs(t, err, ErrNotFound)
+
+	_, err = fallback.UpdateCounter(ctx, "PollCount", 2)
+	require.NoError(t, err)
+	_, err = fallback.ResetCounter(ctx, "PollCount")
+	require.NoError(t, err)
+	_, err = fallback.UpdateCounter(ctx, "PollCount", 3)
+	require.NoError(t, err)
+
+	_, err = fallback.UpdateGauge(ctx, "Typo", 2)
+	require.NoError(t, err)
+	require.NoError(t, fallback.DeleteMetric(ctx, domain.MetricKey{Name: "Typo", MType: domain.Gauge}))
+
+	_, err = fallback.UpdateGauge(ctx, "Alloc", 4)
+	require.NoError(t, err)
+	require.NoError(t, fallback.DeleteMetric(ctx, domain.MetricKey{Name: "Alloc", MType: domain.Gauge}))
+	_, err = fallback.UpdateGauge(ctx, "Alloc", 5)
+	require.NoError(t, err)
+
+	_, err = fallback.reconnect(ctx)
+	require.NoError(t, err)
+
+	all, err := primary.GetAllMetrics(ctx)
+	require.NoError(t, err)
+	assert.Len(t, all, 2)
+	assert.Equal(t, int64(3), all[domain.MetricKey{Name: "PollCount", MType: domain.Counter}].Delta.Int64)
+	assert.Equal(t, 5.0, all[domain.MetricKey{Name: "Alloc", MType: domain.Gauge}].Value.Float64)
+}
+
+func TestFallbackStore_FailedReplayKeepsBuffer(t *testing.T) {
+	ctx := context.Background()
+
+	primary := &closeRecorder{Store: failingStore{NewMetricMapRepository()}}
+	fallback := NewFallbackStore(func(context.Context) (Store, error) {
+		return primary, nil
+	}, time.Millisecond)
+
+	_, err := fallback.UpdateCounter(ctx, "PollCount", 2)
+	require.NoError(t, err)
+
+	_, err = fallback.reconnect(ctx)
+	require.Error(t, err)
+	assert.True(t, primary.closed, "primary store is closed after a failed replay")
+	assert.Equal(t, ModeDegraded, fallback.Mode())
+	assert.Equal(t, 1, fallback.PendingWrites())
+
+	counter, err := fallback.GetMetric(ctx, domain.Metrics{Name: "PollCount", MType: domain.Counter})
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), counter.Delta.Int64)
+}
+
+func TestFallbackStore_ClosePrimary(t *testing.T) {
+	ctx := context.Background()
+
+	primary := &closeRecorder{Store: NewMetricMapRepository()}
+	fallback := NewFallbackStore(func(context.Context) (Store, error) {
+		return primary, nil
+	}, time.Millisecond)
+
+	_, err := fallback.reconnect(ctx)
+	require.NoError(t, err)
+	require.NoError(t, fallback.Close())
+	assert.True(t, primary.closed)
+	assert.Nil(t, fallback.DB())
+}
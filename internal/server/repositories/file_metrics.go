@@ -2,21 +2,39 @@ package repositories
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
-	"os"
 	"sync"
 	"time"
 
 	log "github.com/sirupsen/logrus"
+	"gopkg.in/guregu/null.v4"
 
 	"github.com/Axel791/metricsalert/internal/server/model/domain"
+	"github.com/Axel791/metricsalert/internal/server/telemetry"
+	"github.com/Axel791/metricsalert/internal/shared/logging"
 )
 
+// walSnapshotThreshold - число записей журнала, после которого снимок
+// делается вне расписания, чтобы журнал не рос без ограничений (в том
+// числе при storeInterval = 0, когда периодических снимков нет).
+const walSnapshotThreshold = 10000
+
+// FileStoreHandler хранит метрики в памяти и делает их постоянными с
+// помощью журнала предзаписи (WAL) и периодических снимков.
+//
+// Каждое обновление сначала дописывается в журнал filePath+".wal" с fsync,
+// затем применяется в памяти. Снимок всех метрик записывается в filePath
+// атомарно (временный файл, fsync, rename), после чего журнал очищается.
+// При восстановлении читается снимок и поверх него применяются записи
+// журнала с номерами больше сохранённого в снимке.
 type FileStoreHandler struct {
 	memoryStore Store
 	filePath    string
 	mutex       *sync.Mutex
+	wal         *writeAheadLog
+	intervalCh  chan time.Duration
+	metrics     *telemetry.ServerMetrics
 }
 
 // NewFileStore создает новый экземпляр FileStoreHandler.
@@ -26,17 +44,32 @@ func NewFileStore(
 	filePath string,
 	restoreFlag bool,
 	storeInterval time.Duration,
+	metrics *telemetry.ServerMetrics,
 ) (*FileStoreHandler, error) {
+	wal, err := openWAL(filePath + walSuffix)
+	if err != nil {
+		return nil, err
+	}
+
 	fs := &FileStoreHandler{
 		memoryStore: memoryStore,
 		filePath:    filePath,
 		mutex:       &sync.Mutex{},
+		wal:         wal,
+		intervalCh:  make(chan time.Duration, 1),
+		metrics:     metrics,
 	}
 	if restoreFlag {
-		if err := fs.load(ctx); err != nil {
+		if err = fs.load(ctx); err != nil {
+			wal.Close()
 			log.Warnf("failed to load metrics from file %q: %v", filePath, err)
 			return nil, fmt.Errorf("failed to load metrics from file %q: %w", filePath, err)
 		}
+	} else if err = fs.snapshot(ctx); err != nil {
+		// Без восстановления старые снимок и журнал заменяются текущим
+		// состоянием, чтобы не примешаться к новым данным.
+		wal.Close()
+		return nil, fmt.Errorf("failed to reset metrics file %q: %w", filePath, err)
 	}
 
 	fs.startAutoSave(ctx, storeInterval)
@@ -49,12 +82,19 @@ func (fs *FileStoreHandler) UpdateGauge(ctx context.Context, name string, value
 	fs.mutex.Lock()
 	defer fs.mutex.Unlock()
 
+	pos := fs.wal.Position()
+	record := domain.Metrics{Name: name, MType: domain.Gauge, Value: null.FloatFrom(value)}
+	if err := fs.wal.Append(record); err != nil {
+		return domain.Metrics{}, fmt.Errorf("failed to log gauge %q: %w", name, err)
+	}
+
 	metric, err := fs.memoryStore.UpdateGauge(ctx, name, value)
 	if err != nil {
-		return domain.Metrics{}, fmt.Errorf("failed to update counter %q: %w", name, err)
+		err = errors.Join(err, fs.wal.Rollback(pos))
+		return domain.Metrics{}, fmt.Errorf("failed to update gauge %q: %w", name, err)
 	}
 
-	_ = fs.saveToFile(ctx)
+	fs.snapshotIfNeeded(ctx)
 	return metric, nil
 }
 
@@ -63,11 +103,19 @@ func (fs *FileStoreHandler) UpdateCounter(ctx context.Context, name string, valu
 	fs.mutex.Lock()
 	defer fs.mutex.Unlock()
 
+	pos := fs.wal.Position()
+	record := domain.Metrics{Name: name, MType: domain.Counter, Delta: null.IntFrom(value)}
+	if err := fs.wal.Append(record); err != nil {
+		return domain.Metrics{}, fmt.Errorf("failed to log counter %q: %w", name, err)
+	}
+
 	metric, err := fs.memoryStore.UpdateCounter(ctx, name, value)
 	if err != nil {
+		err = errors.Join(err, fs.wal.Rollback(pos))
 		return domain.Metrics{}, fmt.Errorf("failed to update counter %q: %w", name, err)
 	}
-	_ = fs.saveToFile(ctx)
+
+	fs.snapshotIfNeeded(ctx)
 	return metric, nil
 }
 
@@ -81,76 +129,201 @@ func (fs *FileStoreHandler) GetMetric(ctx context.Context, metricsDomain domain.
 }
 
 // GetAllMetrics возвращает все метрики из памяти
-func (fs *FileStoreHandler) GetAllMetrics(ctx context.Context) (map[string]domain.Metrics, error) {
+func (fs *FileStoreHandler) GetAllMetrics(ctx context.Context) (map[domain.MetricKey]domain.Metrics, error) {
 	metric, err := fs.memoryStore.GetAllMetrics(ctx)
 	if err != nil {
-		log.Warnf("failed to get all metrics: %v", err)
+		logging.FromContext(ctx).Warnf("failed to get all metrics: %v", err)
 		return nil, err
 	}
 	return metric, nil
 }
 
+// BatchUpdateMetrics записывает пачку в журнал одной операцией и применяет её в памяти.
+// Если хранилище в памяти отвергло пачку, записи удаляются из журнала, чтобы
+// не примениться при восстановлении.
 func (fs *FileStoreHandler) BatchUpdateMetrics(ctx context.Context, m []domain.Metrics) error {
-	return fs.memoryStore.BatchUpdateMetrics(ctx, m)
+	if len(m) == 0 {
+		return nil
+	}
+	if err := validateBatch(m); err != nil {
+		return fmt.Errorf("failed to update metrics batch: %w", err)
+	}
+
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+
+	pos := fs.wal.Position()
+	if err := fs.wal.Append(m...); err != nil {
+		return fmt.Errorf("failed to log metrics batch: %w", err)
+	}
+	if err := fs.memoryStore.BatchUpdateMetrics(ctx, m); err != nil {
+		err = errors.Join(err, fs.wal.Rollback(pos))
+		return fmt.Errorf("failed to update metrics batch: %w", err)
+	}
+
+	fs.snapshotIfNeeded(ctx)
+	return nil
+}
+
+// DeleteMetric записывает удаление в журнал и удаляет метрику из памяти.
+func (fs *FileStoreHandler) DeleteMetric(ctx context.Context, key domain.MetricKey) error {
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+
+	pos := fs.wal.Position()
+	if err := fs.wal.AppendOp(walOpDelete, key); err != nil {
+		return fmt.Errorf("failed to log deletion of %s: %w", key, err)
+	}
+	if err := fs.memoryStore.DeleteMetric(ctx, key); err != nil {
+		err = errors.Join(err, fs.wal.Rollback(pos))
+		return fmt.Errorf("failed to delete metric %s: %w", key, err)
+	}
+
+	fs.snapshotIfNeeded(ctx)
+	return nil
 }
 
-// Load загружает метрики из файла в память
+// ResetCounter записывает сброс в журнал и обнуляет Counter в памяти.
+func (fs *FileStoreHandler) ResetCounter(ctx context.Context, name string) (domain.Metrics, error) {
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+
+	pos := fs.wal.Position()
+	if err := fs.wal.AppendOp(walOpReset, domain.MetricKey{Name: name, MType: domain.Counter}); err != nil {
+		return domain.Metrics{}, fmt.Errorf("failed to log reset of counter %q: %w", name, err)
+	}
+	metric, err := fs.memoryStore.ResetCounter(ctx, name)
+	if err != nil {
+		err = errors.Join(err, fs.wal.Rollback(pos))
+		return domain.Metrics{}, fmt.Errorf("failed to reset counter %q: %w", name, err)
+	}
+
+	fs.snapshotIfNeeded(ctx)
+	return metric, nil
+}
+
+// QueryMetrics выбирает метрики из памяти.
+func (fs *FileStoreHandler) QueryMetrics(ctx context.Context, query MetricsQuery) ([]domain.Metrics, error) {
+	return fs.memoryStore.QueryMetrics(ctx, query)
+}
+
+// load восстанавливает метрики из снимка и журнала, после чего делает
+// новый снимок, чтобы начать с пустого журнала.
 func (fs *FileStoreHandler) load(ctx context.Context) error {
 	fs.mutex.Lock()
 	defer fs.mutex.Unlock()
 
-	file, err := os.Open(fs.filePath)
+	snap, err := readSnapshot(fs.filePath)
 	if err != nil {
-		if os.IsNotExist(err) {
-			log.Infof("File %s does not exist, skipping load", fs.filePath)
-			return nil
-		}
 		return err
 	}
-	defer file.Close()
+	if snap == nil {
+		log.Infof("File %s does not exist, skipping load", fs.filePath)
+		snap = &snapshot{}
+	}
+
+	for _, metric := range snap.Metrics {
+		if err = fs.apply(ctx, metric); err != nil {
+			return err
+		}
+	}
 
-	var data map[string]domain.Metrics
-	if err := json.NewDecoder(file).Decode(&data); err != nil {
+	lastSeq, torn, err := replayWAL(fs.wal.path, snap.Seq, func(record walRecord) error {
+		if record.Op != "" {
+			return fs.applyOp(ctx, record)
+		}
+		return fs.apply(ctx, domain.Metrics{
+			Name:      record.Name,
+			MType:     record.MType,
+			Delta:     record.Delta,
+			Value:     record.Value,
+			UpdatedAt: record.At,
+			Labels:    record.Labels,
+		})
+	})
+	if err != nil {
 		return err
 	}
+	if torn {
+		log.Warnf("WAL %s ends with an incomplete record, it was discarded", fs.wal.path)
+	}
+	if replayed := lastSeq - snap.Seq; replayed > 0 {
+		log.Infof("Replayed %d WAL records from %s", replayed, fs.wal.path)
+	}
 
-	for name, metric := range data {
-		switch metric.MType {
-		case domain.Counter:
-			_, err := fs.memoryStore.UpdateCounter(ctx, name, metric.Delta.Int64)
-			if err != nil {
-				return fmt.Errorf("failed to update metric %q: %w", name, err)
-			}
-		case domain.Gauge:
+	fs.wal.seq = lastSeq
+	return fs.snapshot(ctx)
+}
 
-			_, err := fs.memoryStore.UpdateGauge(ctx, name, metric.Value.Float64)
-			if err != nil {
-				return fmt.Errorf("failed to update metric %q: %w", name, err)
-			}
-		}
+// apply применяет метрику из снимка или журнала к хранилищу в памяти.
+// Метрика записывается пачкой из одного элемента, чтобы сохранилось время
+// её последнего обновления.
+func (fs *FileStoreHandler) apply(ctx context.Context, metric domain.Metrics) error {
+	if metric.MType != domain.Counter && metric.MType != domain.Gauge {
+		return nil
+	}
+	if err := fs.memoryStore.BatchUpdateMetrics(ctx, []domain.Metrics{metric}); err != nil {
+		return fmt.Errorf("failed to update metric %q: %w", metric.Name, err)
 	}
 	return nil
 }
 
-// StartAutoSave запускает периодическое сохранение.
-func (fs *FileStoreHandler) startAutoSave(ctx context.Context, storeInterval time.Duration) {
-	if storeInterval <= 0 {
-		log.Infof("Auto-save disabled (storeInterval=%v)", storeInterval)
-		return
+// applyOp применяет удаление или сброс из журнала к хранилищу в памяти.
+// Запись журнала фиксируется только после успешной операции, поэтому
+// отсутствие метрики при восстановлении не считается ошибкой.
+func (fs *FileStoreHandler) applyOp(ctx context.Context, record walRecord) error {
+	var err error
+	switch record.Op {
+	case walOpDelete:
+		err = fs.memoryStore.DeleteMetric(ctx, domain.MetricKey{Name: record.Name, MType: record.MType})
+	case walOpReset:
+		_, err = fs.memoryStore.ResetCounter(ctx, record.Name)
+	default:
+		return fmt.Errorf("unknown wal operation %q", record.Op)
 	}
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return fmt.Errorf("failed to %s metric %q: %w", record.Op, record.Name, err)
+	}
+	return nil
+}
 
-	ticker := time.NewTicker(storeInterval)
-	log.Infof("Starting auto-save every %s seconds", storeInterval)
-
+// StartAutoSave запускает периодическое сохранение.
+// Интервал можно сменить на лету через SetStoreInterval.
+func (fs *FileStoreHandler) startAutoSave(ctx context.Context, storeInterval time.Duration) {
 	go func() {
-		defer ticker.Stop()
+		var (
+			ticker *time.Ticker
+			tick   <-chan time.Time
+		)
+		reset := func(interval time.Duration) {
+			if ticker != nil {
+				ticker.Stop()
+				ticker, tick = nil, nil
+			}
+			if interval <= 0 {
+				log.Infof("Auto-save disabled (storeInterval=%v)", interval)
+				return
+			}
+			ticker = time.NewTicker(interval)
+			tick = ticker.C
+			log.Infof("Starting auto-save every %s", interval)
+		}
+		defer func() {
+			if ticker != nil {
+				ticker.Stop()
+			}
+		}()
+
+		reset(storeInterval)
 		for {
 			select {
 			case <-ctx.Done():
 				log.Info("Auto-save context canceled, stopping...")
 				return
-			case <-ticker.C:
-				if err := fs.saveToFile(ctx); err != nil {
+			case interval := <-fs.intervalCh:
+				reset(interval)
+			case <-tick:
+				if err := fs.Flush(ctx); err != nil {
 					log.Errorf("failed to auto-save metrics: %v", err)
 				}
 			}
@@ -158,17 +331,56 @@ func (fs *FileStoreHandler) startAutoSave(ctx context.Context, storeInterval tim
 	}()
 }
 
-// SaveToFile сохраняет все метрики в файл
-func (fs *FileStoreHandler) saveToFile(ctx context.Context) error {
-	file, err := os.Create(fs.filePath)
-	if err != nil {
-		return err
+// SetStoreInterval меняет интервал автосохранения без перезапуска.
+func (fs *FileStoreHandler) SetStoreInterval(storeInterval time.Duration) {
+	select {
+	case <-fs.intervalCh:
+	default:
 	}
-	defer file.Close()
+	fs.intervalCh <- storeInterval
+}
+
+// Flush синхронно записывает снимок метрик и очищает журнал.
+// Вызывается при автосохранении и при остановке сервера.
+func (fs *FileStoreHandler) Flush(ctx context.Context) error {
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+
+	return fs.snapshot(ctx)
+}
+
+// Close закрывает журнал. Перед ним следует вызвать Flush.
+func (fs *FileStoreHandler) Close() error {
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+
+	return fs.wal.Close()
+}
+
+// snapshotIfNeeded делает снимок, если журнал вырос сверх порога.
+// Ошибка только логируется: обновление уже надёжно записано в журнал.
+func (fs *FileStoreHandler) snapshotIfNeeded(ctx context.Context) {
+	if fs.wal.records < walSnapshotThreshold {
+		return
+	}
+	if err := fs.snapshot(ctx); err != nil {
+		logging.FromContext(ctx).Errorf("failed to save metrics snapshot %q: %v", fs.filePath, err)
+	}
+}
+
+// snapshot атомарно записывает все метрики в файл и очищает журнал.
+// Вызывается под fs.mutex.
+func (fs *FileStoreHandler) snapshot(ctx context.Context) error {
+	defer fs.metrics.ObserveFileSave(time.Now())
 
 	data, err := fs.memoryStore.GetAllMetrics(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to get all metrics: %w", err)
 	}
-	return json.NewEncoder(file).Encode(data)
+	if err = writeSnapshot(fs.filePath, snapshotFromMap(fs.wal.seq, data)); err != nil {
+		return err
+	}
+	// Если процесс упадёт до очистки, записи журнала с номерами не больше
+	// snapshot.Seq будут пропущены при восстановлении.
+	return fs.wal.Reset()
 }
@@ -0,0 +1,239 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/guregu/null.v4"
+
+	"github.com/Axel791/metricsalert/internal/server/model/domain"
+)
+
+func openFileStore(t *testing.T, path string, restore bool) *FileStoreHandler {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	fs, err := NewFileStore(ctx, NewMetricMapRepository(), path, restore, 0, nil)
+	require.NoError(t, err)
+	t.Cleanup(func() { fs.Close() })
+	return fs
+}
+
+func getMetric(t *testing.T, store Store, name, mType string) domain.Metrics {
+	t.Helper()
+
+	metric, err := store.GetMetric(context.Background(), domain.Metrics{Name: name, MType: mType})
+	require.NoError(t, err)
+	return metric
+}
+
+func TestFileStore_RecoversFromWALWithoutSnapshot(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "metrics.json")
+
+	fs := openFileStore(t, path, true)
+	_, err := fs.UpdateCounter(ctx, "PollCount", 2)
+	require.NoError(t, err)
+	_, err = fs.UpdateGauge(ctx, "Alloc", 1.5)
+	require.NoError(t, err)
+	require.NoError(t, fs.BatchUpdateMetrics(ctx, []domain.Metrics{
+		{Name: "PollCount", MType: domain.Counter, Delta: null.IntFrom(3)},
+		{Name: "Alloc", MType: domain.Gauge, Value: null.FloatFrom(2.5)},
+	}))
+
+	// Процесс "падает" без Flush: всё восстанавливается из журнала.
+	restored := openFileStore(t, path, true)
+	assert.Equal(t, int64(5), getMetric(t, restored, "PollCount", domain.Counter).Delta.Int64)
+	assert.Equal(t, 2.5, getMetric(t, restored, "Alloc", domain.Gauge).Value.Float64)
+}
+
+func TestFileStore_SnapshotThenWAL(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "metrics.json")
+
+	fs := openFileStore(t, path, true)
+	_, err := fs.UpdateCounter(ctx, "PollCount", 2)
+	require.NoError(t, err)
+	require.NoError(t, fs.Flush(ctx))
+
+	info, err := os.Stat(path + walSuffix)
+	require.NoError(t, err)
+	assert.Zero(t, info.Size(), "WAL must be truncated after snapshot")
+
+	_, err = fs.UpdateCounter(ctx, "PollCount", 3)
+	require.NoError(t, err)
+
+	restored := openFileStore(t, path, true)
+	assert.Equal(t, int64(5), getMetric(t, restored, "PollCount", domain.Counter).Delta.Int64)
+}
+
+func TestFileStore_SkipsWALRecordsCoveredBySnapshot(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "metrics.json")
+
+	fs := openFileStore(t, path, true)
+	_, err := fs.UpdateCounter(ctx, "PollCount", 2)
+	require.NoError(t, err)
+
+	// Сбой между записью снимка и очисткой журнала.
+	all, err := fs.memoryStore.GetAllMetrics(ctx)
+	require.NoError(t, err)
+	require.NoError(t, writeSnapshot(path, snapshotFromMap(fs.wal.seq, all)))
+
+	restored := openFileStore(t, path, true)
+	assert.Equal(t, int64(2), getMetric(t, restored, "PollCount", domain.Counter).Delta.Int64)
+}
+
+func TestFileStore_DiscardsTornWALRecord(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "metrics.json")
+
+	fs := openFileStore(t, path, true)
+	_, err := fs.UpdateCounter(ctx, "PollCount", 2)
+	require.NoError(t, err)
+
+	wal, err := os.OpenFile(path+walSuffix, os.O_WRONLY|os.O_APPEND, 0o644)
+	require.NoError(t, err)
+	_, err = wal.WriteString(`{"seq":2,"name":"PollCount","type":"coun`)
+	require.NoError(t, err)
+	require.NoError(t, wal.Close())
+
+	restored := openFileStore(t, path, true)
+	assert.Equal(t, int64(2), getMetric(t, restored, "PollCount", domain.Counter).Delta.Int64)
+
+	// После восстановления журнал начинается заново и пригоден для записи.
+	_, err = restored.UpdateCounter(ctx, "PollCount", 1)
+	require.NoError(t, err)
+	again := openFileStore(t, path, true)
+	assert.Equal(t, int64(3), getMetric(t, again, "PollCount", domain.Counter).Delta.Int64)
+}
+
+func TestFileStore_RejectsCorruptWALRecordInTheMiddle(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "metrics.json")
+
+	fs := openFileStore(t, path, true)
+	_, err := fs.UpdateCounter(ctx, "PollCount", 2)
+	require.NoError(t, err)
+	require.NoError(t, fs.Close())
+
+	wal, err := os.OpenFile(path+walSuffix, os.O_WRONLY|os.O_APPEND, 0o644)
+	require.NoError(t, err)
+	_, err = wal.WriteString("{\"seq\":2,\"name\":\"PollCount\",\"type\":\"coun\n" +
+		`{"seq":3,"name":"PollCount","type":"counter","delta":5,"value":null}` + "\n")
+	require.NoError(t, err)
+	require.NoError(t, wal.Close())
+	walBefore, err := os.ReadFile(path + walSuffix)
+	require.NoError(t, err)
+	snapshotBefore, err := os.ReadFile(path)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	_, err = NewFileStore(ctx, NewMetricMapRepository(), path, true, 0, nil)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "corrupted")
+
+	// Журнал и снимок остаются как есть, чтобы записи после повреждения
+	// можно было восстановить вручную.
+	walAfter, err := os.ReadFile(path + walSuffix)
+	require.NoError(t, err)
+	assert.Equal(t, walBefore, walAfter)
+	snapshotAfter, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, snapshotBefore, snapshotAfter)
+}
+
+func TestFileStore_ReadsLegacyFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metrics.json")
+	legacy := `{"PollCount":{"ID":0,"Name":"PollCount","MType":"counter","Delta":7,"Value":null},` +
+		`"version":{"ID":0,"Name":"version","MType":"gauge","Delta":null,"Value":1.25}}`
+	require.NoError(t, os.WriteFile(path, []byte(legacy), 0o644))
+
+	fs := openFileStore(t, path, true)
+	assert.Equal(t, int64(7), getMetric(t, fs, "PollCount", domain.Counter).Delta.Int64)
+	assert.Equal(t, 1.25, getMetric(t, fs, "version", domain.Gauge).Value.Float64)
+
+	snap, err := readSnapshot(path)
+	require.NoError(t, err)
+	assert.Equal(t, snapshotVersion, snap.Version)
+}
+
+func TestFileStore_MigratesVersion1Snapshot(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "metrics.json")
+	v1 := `{"version":1,"seq":0,"metrics":{"Requests":{"Name":"Requests","MType":"counter","Delta":4,"Value":null}}}`
+	require.NoError(t, os.WriteFile(path, []byte(v1), 0o644))
+
+	fs := openFileStore(t, path, true)
+	_, err := fs.UpdateGauge(ctx, "Requests", 0.5)
+	require.NoError(t, err)
+	require.NoError(t, fs.Flush(ctx))
+
+	snap, err := readSnapshot(path)
+	require.NoError(t, err)
+	assert.Equal(t, snapshotVersion, snap.Version)
+	assert.Len(t, snap.Metrics, 2)
+
+	restored := openFileStore(t, path, true)
+	assert.Equal(t, int64(4), getMetric(t, restored, "Requests", domain.Counter).Delta.Int64)
+	assert.Equal(t, 0.5, getMetric(t, restored, "Requests", domain.Gauge).Value.Float64)
+}
+
+func TestFileStore_WithoutRestoreIgnoresOldWAL(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "metrics.json")
+
+	fs := openFileStore(t, path, true)
+	_, err := fs.UpdateCounter(ctx, "PollCount", 2)
+	require.NoError(t, err)
+	_, err = fs.UpdateCounter(ctx, "PollCount", 2)
+	require.NoError(t, err)
+	require.NoError(t, fs.Flush(ctx))
+
+	fresh := openFileStore(t, path, false)
+	_, err = fresh.GetMetric(ctx, domain.Metrics{Name: "PollCount", MType: domain.Counter})
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	_, err = fresh.UpdateCounter(ctx, "PollCount", 1)
+	require.NoError(t, err)
+	restored := openFileStore(t, path, true)
+	assert.Equal(t, int64(1), getMetric(t, restored, "PollCount", domain.Counter).Delta.Int64)
+}
+
+// failingStore отвергает пачки, как недоступная база под файловым хранилищем.
+type failingStore struct {
+	Store
+}
+
+func (failingStore) BatchUpdateMetrics(context.Context, []domain.Metrics) error {
+	return errors.New("database is unavailable")
+}
+
+func TestFileStore_RollsBackWALOnFailedBatch(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "metrics.json")
+
+	fs, err := NewFileStore(ctx, failingStore{NewMetricMapRepository()}, path, true, 0, nil)
+	require.NoError(t, err)
+	_, err = fs.UpdateCounter(ctx, "PollCount", 2)
+	require.NoError(t, err)
+
+	err = fs.BatchUpdateMetrics(ctx, []domain.Metrics{
+		{Name: "PollCount", MType: domain.Counter, Delta: null.IntFrom(10)},
+	})
+	require.Error(t, err)
+	_, err = fs.UpdateCounter(ctx, "PollCount", 3)
+	require.NoError(t, err)
+	require.NoError(t, fs.Close())
+
+	restored := openFileStore(t, path, true)
+	assert.Equal(t, int64(5), getMetric(t, restored, "PollCount", domain.Counter).Delta.Int64)
+}
@@ -0,0 +1,231 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/guregu/null.v4"
+
+	"github.com/Axel791/metricsalert/internal/server/model/domain"
+	"github.com/Axel791/metricsalert/internal/server/retention"
+	"github.com/Axel791/metricsalert/internal/shared/logging"
+)
+
+// HistoryPoint - точка истории метрики: сырое значение (Count = 1) или
+// агрегат за минуту или час, начинающийся в Time. Для gauge значением
+// считается value, для counter - приращение delta.
+type HistoryPoint struct {
+	Time  time.Time
+	Count int64
+	Sum   float64
+	Min   float64
+	Max   float64
+	Last  float64
+}
+
+// rawPoint создаёт точку истории из одного значения.
+func rawPoint(at time.Time, value float64) HistoryPoint {
+	return HistoryPoint{Time: at, Count: 1, Sum: value, Min: value, Max: value, Last: value}
+}
+
+// merge добавляет к агрегату p более поздний агрегат того же интервала.
+func (p HistoryPoint) merge(later HistoryPoint) HistoryPoint {
+	p.Count += later.Count
+	p.Sum += later.Sum
+	p.Min = min(p.Min, later.Min)
+	p.Max = max(p.Max, later.Max)
+	p.Last = later.Last
+	return p
+}
+
+// rollup сворачивает точки points, упорядоченные по времени, в агрегаты по
+// интервалам длины size.
+func rollup(points []HistoryPoint, size time.Duration) []HistoryPoint {
+	var out []HistoryPoint
+	for _, point := range points {
+		bucket := point.Time.Truncate(size)
+		if n := len(out); n > 0 && out[n-1].Time.Equal(bucket) {
+			out[n-1] = out[n-1].merge(point)
+			continue
+		}
+		point.Time = bucket
+		out = append(out, point)
+	}
+	return out
+}
+
+// sampleValue возвращает значение метрики для истории.
+func sampleValue(metric domain.Metrics) float64 {
+	if metric.MType == domain.Counter {
+		return float64(metric.Delta.Int64)
+	}
+	return metric.Value.Float64
+}
+
+// History - история значений метрик с агрегатами по минутам и часам.
+// Сроки хранения задаются политиками retention и применяются в Compact.
+type History interface {
+	retention.Target
+
+	// Record сохраняет значения metrics, записанные в момент at.
+	Record(ctx context.Context, at time.Time, metrics []domain.Metrics) error
+	// Query возвращает точки истории метрики key с разрешением resolution
+	// (retention.ResolutionRaw, ResolutionMinute или ResolutionHour) начиная
+	// с since, по возрастанию времени.
+	Query(ctx context.Context, key domain.MetricKey, resolution string, since time.Time) ([]HistoryPoint, error)
+}
+
+// validateResolution проверяет разрешение запроса истории.
+func validateResolution(resolution string) error {
+	switch resolution {
+	case retention.ResolutionRaw, retention.ResolutionMinute, retention.ResolutionHour:
+		return nil
+	default:
+		return fmt.Errorf("unknown history resolution %q", resolution)
+	}
+}
+
+// historyQueueSize - сколько записей истории HistoryRecorder держит в
+// очереди, пока история их не сохранила.
+const historyQueueSize = 1024
+
+// historyEntry - значения, записанные в хранилище в момент at. logger -
+// запись лога запроса, в котором они записаны.
+type historyEntry struct {
+	at      time.Time
+	metrics []domain.Metrics
+	logger  *log.Entry
+}
+
+// HistoryRecorder оборачивает Store и после каждой успешной записи
+// сохраняет записанные значения в History. История пишется из отдельной
+// горутины через очередь, поэтому запись метрики не ждёт базу.
+//
+// Ошибка записи истории только логируется: метрика уже сохранена. Если
+// очередь заполнена, значения в историю не попадают, а число отброшенных
+// записей попадает в лог.
+type HistoryRecorder struct {
+	storeDelegate
+	history History
+	now     func() time.Time
+
+	// mutex защищает закрытие очереди от конкурентных record.
+	mutex   sync.RWMutex
+	closed  bool
+	queue   chan historyEntry
+	dropped atomic.Int64
+	done    chan struct{}
+}
+
+// NewHistoryRecorder создаёт обёртку над store, пишущую историю в history.
+// Close дописывает историю из очереди.
+func NewHistoryRecorder(store Store, history History) *HistoryRecorder {
+	s := &HistoryRecorder{
+		storeDelegate: storeDelegate{store: store},
+		history:       history,
+		now:           time.Now,
+		queue:         make(chan historyEntry, historyQueueSize),
+		done:          make(chan struct{}),
+	}
+	go s.run()
+	return s
+}
+
+// History возвращает историю, в которую пишет обёртка.
+func (s *HistoryRecorder) History() History {
+	return s.history
+}
+
+func (s *HistoryRecorder) UpdateGauge(ctx context.Context, name string, value float64) (domain.Metrics, error) {
+	metric, err := s.store.UpdateGauge(ctx, name, value)
+	if err == nil {
+		s.record(ctx, []domain.Metrics{{Name: name, MType: domain.Gauge, Value: null.FloatFrom(value)}})
+	}
+	return metric, err
+}
+
+func (s *HistoryRecorder) UpdateCounter(ctx context.Context, name string, value int64) (domain.Metrics, error) {
+	metric, err := s.store.UpdateCounter(ctx, name, value)
+	if err == nil {
+		s.record(ctx, []domain.Metrics{{Name: name, MType: domain.Counter, Delta: null.IntFrom(value)}})
+	}
+	return metric, err
+}
+
+func (s *HistoryRecorder) GetMetric(ctx context.Context, metric domain.Metrics) (domain.Metrics, error) {
+	return s.store.GetMetric(ctx, metric)
+}
+
+func (s *HistoryRecorder) GetAllMetrics(ctx context.Context) (map[domain.MetricKey]domain.Metrics, error) {
+	return s.store.GetAllMetrics(ctx)
+}
+
+func (s *HistoryRecorder) BatchUpdateMetrics(ctx context.Context, metrics []domain.Metrics) error {
+	err := s.store.BatchUpdateMetrics(ctx, metrics)
+	if err == nil && len(metrics) > 0 {
+		s.record(ctx, metrics)
+	}
+	return err
+}
+
+func (s *HistoryRecorder) DeleteMetric(ctx context.Context, key domain.MetricKey) error {
+	return s.store.DeleteMetric(ctx, key)
+}
+
+func (s *HistoryRecorder) ResetCounter(ctx context.Context, name string) (domain.Metrics, error) {
+	return s.store.ResetCounter(ctx, name)
+}
+
+func (s *HistoryRecorder) QueryMetrics(ctx context.Context, query MetricsQuery) ([]domain.Metrics, error) {
+	return s.store.QueryMetrics(ctx, query)
+}
+
+// record ставит значения в очередь истории, не блокируясь. После Close
+// значения отбрасываются.
+func (s *HistoryRecorder) record(ctx context.Context, metrics []domain.Metrics) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	if s.closed {
+		return
+	}
+	select {
+	case s.queue <- historyEntry{at: s.now(), metrics: metrics, logger: logging.FromContext(ctx)}:
+	default:
+		s.dropped.Add(1)
+	}
+}
+
+// run сохраняет значения из очереди в историю, пока очередь не закрыта.
+// Контекст запроса к этому моменту может быть уже отменён, поэтому запись
+// идёт со своим.
+func (s *HistoryRecorder) run() {
+	defer close(s.done)
+
+	for entry := range s.queue {
+		if dropped := s.dropped.Swap(0); dropped > 0 {
+			entry.logger.Warnf("history queue is full, %d writes dropped", dropped)
+		}
+		if err := s.history.Record(context.Background(), entry.at, entry.metrics); err != nil {
+			entry.logger.Warnf("failed to record metrics history: %v", err)
+		}
+	}
+}
+
+// Close дописывает историю из очереди и закрывает обёрнутое хранилище,
+// если ему это нужно.
+func (s *HistoryRecorder) Close() error {
+	s.mutex.Lock()
+	if !s.closed {
+		s.closed = true
+		close(s.queue)
+	}
+	s.mutex.Unlock()
+	<-s.done
+
+	return s.storeDelegate.Close()
+}
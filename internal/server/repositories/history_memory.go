@@ -0,0 +1,182 @@
+package repositories
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Axel791/metricsalert/internal/server/model/domain"
+	"github.com/Axel791/metricsalert/internal/server/retention"
+)
+
+// memorySeries - история одной метрики на трёх разрешениях, по
+// возрастанию времени.
+type memorySeries struct {
+	raw    []HistoryPoint
+	minute []HistoryPoint
+	hour   []HistoryPoint
+}
+
+// MemoryHistory хранит историю метрик в памяти и применяет те же политики
+// хранения, что и история в PostgreSQL. История не переживает перезапуск
+// сервера.
+type MemoryHistory struct {
+	mutex  sync.RWMutex
+	series map[domain.MetricKey]*memorySeries
+	// minuteUntil и hourUntil - до какого момента сырые значения свёрнуты в
+	// минутные агрегаты и минутные агрегаты - в часовые.
+	minuteUntil time.Time
+	hourUntil   time.Time
+}
+
+// NewMemoryHistory создаёт пустую историю в памяти.
+func NewMemoryHistory() *MemoryHistory {
+	return &MemoryHistory{series: make(map[domain.MetricKey]*memorySeries)}
+}
+
+func (h *MemoryHistory) Record(_ context.Context, at time.Time, metrics []domain.Metrics) error {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	for _, metric := range metrics {
+		key := metric.Key()
+		series, ok := h.series[key]
+		if !ok {
+			series = &memorySeries{}
+			h.series[key] = series
+		}
+		series.raw = insertPoint(series.raw, rawPoint(at, sampleValue(metric)))
+	}
+	return nil
+}
+
+// insertPoint добавляет точку, сохраняя порядок по времени. Обычно точка
+// самая поздняя и просто дописывается в конец.
+func insertPoint(points []HistoryPoint, point HistoryPoint) []HistoryPoint {
+	i := sort.Search(len(points), func(i int) bool { return points[i].Time.After(point.Time) })
+	if i == len(points) {
+		return append(points, point)
+	}
+	points = append(points, HistoryPoint{})
+	copy(points[i+1:], points[i:])
+	points[i] = point
+	return points
+}
+
+func (h *MemoryHistory) Query(
+	_ context.Context,
+	key domain.MetricKey,
+	resolution string,
+	since time.Time,
+) ([]HistoryPoint, error) {
+	if err := validateResolution(resolution); err != nil {
+		return nil, err
+	}
+
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+
+	series, ok := h.series[key]
+	if !ok {
+		return nil, nil
+	}
+	points := series.raw
+	switch resolution {
+	case retention.ResolutionMinute:
+		points = series.minute
+	case retention.ResolutionHour:
+		points = series.hour
+	}
+
+	start := sort.Search(len(points), func(i int) bool { return !points[i].Time.Before(since) })
+	return append([]HistoryPoint(nil), points[start:]...), nil
+}
+
+// Compact сворачивает и удаляет историю по тем же правилам, что и
+// PostgresHistory: сырые значения удаляются только после свёртки в минутные
+// агрегаты, минутные агрегаты - после свёртки в часовые.
+func (h *MemoryHistory) Compact(_ context.Context, now time.Time, policies retention.Policies) (retention.Stats, error) {
+	minuteEnd, hourEnd := retention.RollupBounds(now)
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	var stats retention.Stats
+	for key, series := range h.series {
+		if minuteEnd.After(h.minuteUntil) {
+			rolled := rollup(between(series.raw, h.minuteUntil, minuteEnd), time.Minute)
+			series.minute = mergeRollups(series.minute, rolled)
+			stats.MinuteRollups += int64(len(rolled))
+		}
+		if hourEnd.After(h.hourUntil) {
+			rolled := rollup(between(series.minute, h.hourUntil, hourEnd), time.Hour)
+			series.hour = mergeRollups(series.hour, rolled)
+			stats.HourRollups += int64(len(rolled))
+		}
+
+		cutoffs := policies.For(key.Name).Cutoffs(now)
+		var deleted int
+		series.raw, deleted = deleteBefore(series.raw, earliest(cutoffs.Raw, minuteEnd))
+		stats.DeletedRaw += int64(deleted)
+		series.minute, deleted = deleteBefore(series.minute, earliest(cutoffs.Minute, hourEnd))
+		stats.DeletedMinute += int64(deleted)
+		series.hour, deleted = deleteBefore(series.hour, cutoffs.Hour)
+		stats.DeletedHour += int64(deleted)
+
+		if len(series.raw) == 0 && len(series.minute) == 0 && len(series.hour) == 0 {
+			delete(h.series, key)
+		}
+	}
+	h.minuteUntil = latest(h.minuteUntil, minuteEnd)
+	h.hourUntil = latest(h.hourUntil, hourEnd)
+
+	return stats, nil
+}
+
+// between возвращает точки с временем в [from, to).
+func between(points []HistoryPoint, from, to time.Time) []HistoryPoint {
+	start := sort.Search(len(points), func(i int) bool { return !points[i].Time.Before(from) })
+	end := sort.Search(len(points), func(i int) bool { return !points[i].Time.Before(to) })
+	if start >= end {
+		return nil
+	}
+	return points[start:end]
+}
+
+// mergeRollups добавляет новые агрегаты к series, объединяя агрегаты одного
+// интервала.
+func mergeRollups(series, rolled []HistoryPoint) []HistoryPoint {
+	for _, point := range rolled {
+		i := sort.Search(len(series), func(i int) bool { return !series[i].Time.Before(point.Time) })
+		if i < len(series) && series[i].Time.Equal(point.Time) {
+			series[i] = series[i].merge(point)
+			continue
+		}
+		series = insertPoint(series, point)
+	}
+	return series
+}
+
+// deleteBefore удаляет точки раньше cutoff и возвращает число удалённых.
+func deleteBefore(points []HistoryPoint, cutoff time.Time) ([]HistoryPoint, int) {
+	n := sort.Search(len(points), func(i int) bool { return !points[i].Time.Before(cutoff) })
+	if n == 0 {
+		return points, 0
+	}
+	return append(points[:0], points[n:]...), n
+}
+
+func earliest(a, b time.Time) time.Time {
+	if a.Before(b) {
+		return a
+	}
+	return b
+}
+
+func latest(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,328 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+
+	"github.com/Axel791/metricsalert/internal/server/db"
+	"github.com/Axel791/metricsalert/internal/server/model/domain"
+	"github.com/Axel791/metricsalert/internal/server/retention"
+)
+
+// insertSamplesSQL записывает пачку сырых значений, переданную массивами.
+const insertSamplesSQL = `
+	INSERT INTO metric_samples (name, metric_type, ts, value)
+	SELECT i.name, i.metric_type, $3, i.value
+	FROM unnest($1::text[], $2::text[], $4::double precision[]) AS i(name, metric_type, value)
+`
+
+// rollupMinuteSQL сворачивает сырые значения из [$1, $2) в минутные агрегаты.
+// Интервалы считаются в UTC независимо от часового пояса сессии.
+const rollupMinuteSQL = `
+	INSERT INTO metric_rollups_1m (name, metric_type, bucket, count, sum, min, max, last)
+	SELECT
+		name,
+		metric_type,
+		date_trunc('minute', ts AT TIME ZONE 'UTC') AT TIME ZONE 'UTC',
+		count(*),
+		sum(value),
+		min(value),
+		max(value),
+		(array_agg(value ORDER BY ts DESC))[1]
+	FROM metric_samples
+	WHERE ts >= $1 AND ts < $2
+	GROUP BY 1, 2, 3
+	ON CONFLICT (name, metric_type, bucket) DO UPDATE SET
+		count = metric_rollups_1m.count + EXCLUDED.count,
+		sum = metric_rollups_1m.sum + EXCLUDED.sum,
+		min = LEAST(metric_rollups_1m.min, EXCLUDED.min),
+		max = GREATEST(metric_rollups_1m.max, EXCLUDED.max),
+		last = EXCLUDED.last
+`
+
+// rollupHourSQL сворачивает минутные агрегаты из [$1, $2) в часовые.
+const rollupHourSQL = `
+	INSERT INTO metric_rollups_1h (name, metric_type, bucket, count, sum, min, max, last)
+	SELECT
+		name,
+		metric_type,
+		date_trunc('hour', bucket AT TIME ZONE 'UTC') AT TIME ZONE 'UTC',
+		sum(count),
+		sum(sum),
+		min(min),
+		max(max),
+		(array_agg(last ORDER BY bucket DESC))[1]
+	FROM metric_rollups_1m
+	WHERE bucket >= $1 AND bucket < $2
+	GROUP BY 1, 2, 3
+	ON CONFLICT (name, metric_type, bucket) DO UPDATE SET
+		count = metric_rollups_1h.count + EXCLUDED.count,
+		sum = metric_rollups_1h.sum + EXCLUDED.sum,
+		min = LEAST(metric_rollups_1h.min, EXCLUDED.min),
+		max = GREATEST(metric_rollups_1h.max, EXCLUDED.max),
+		last = EXCLUDED.last
+`
+
+// historyTable - таблица истории одного разрешения и её столбец времени.
+type historyTable struct {
+	name       string
+	timeColumn string
+}
+
+var historyTables = map[string]historyTable{
+	retention.ResolutionRaw:    {name: "metric_samples", timeColumn: "ts"},
+	retention.ResolutionMinute: {name: "metric_rollups_1m", timeColumn: "bucket"},
+	retention.ResolutionHour:   {name: "metric_rollups_1h", timeColumn: "bucket"},
+}
+
+// PostgresHistory хранит историю метрик в таблицах metric_samples,
+// metric_rollups_1m и metric_rollups_1h (см. миграции).
+type PostgresHistory struct {
+	db      *sqlx.DB
+	retrier *db.Retrier
+}
+
+// NewPostgresHistory создаёт историю в PostgreSQL. Запросы повторяются при
+// ошибках соединения через retrier.
+func NewPostgresHistory(conn *sqlx.DB, retrier *db.Retrier) *PostgresHistory {
+	return &PostgresHistory{db: conn, retrier: retrier}
+}
+
+func (h *PostgresHistory) Record(ctx context.Context, at time.Time, metrics []domain.Metrics) error {
+	names := make([]string, len(metrics))
+	types := make([]string, len(metrics))
+	values := make([]float64, len(metrics))
+	for i, metric := range metrics {
+		names[i] = metric.Name
+		types[i] = metric.MType
+		values[i] = sampleValue(metric)
+	}
+
+	// Вставка отсчётов не идемпотентна: после обрыва соединения запрос не
+	// повторяется, чтобы не записать отсчёты дважды.
+	return unavailable(h.retrier.DoWrite(ctx, func(ctx context.Context) error {
+		_, err := h.db.ExecContext(ctx, insertSamplesSQL, pq.Array(names), pq.Array(types), at, pq.Array(values))
+		if err != nil {
+			return fmt.Errorf("insert metric samples: %w", err)
+		}
+		return nil
+	}))
+}
+
+func (h *PostgresHistory) Query(
+	ctx context.Context,
+	key domain.MetricKey,
+	resolution string,
+	since time.Time,
+) ([]HistoryPoint, error) {
+	if err := validateResolution(resolution); err != nil {
+		return nil, err
+	}
+
+	query := `
+		SELECT bucket AS time, count, sum, min, max, last
+		FROM ` + historyTables[resolution].name + `
+		WHERE name = $1 AND metric_type = $2 AND bucket >= $3
+		ORDER BY bucket`
+	if resolution == retention.ResolutionRaw {
+		query = `
+			SELECT ts AS time, 1 AS count, value AS sum, value AS min, value AS max, value AS last
+			FROM metric_samples
+			WHERE name = $1 AND metric_type = $2 AND ts >= $3
+			ORDER BY ts`
+	}
+
+	var points []HistoryPoint
+	err := retryUnavailable(ctx, h.retrier, func(ctx context.Context) error {
+		points = nil
+		if err := h.db.SelectContext(ctx, &points, query, key.Name, key.MType, since); err != nil {
+			return fmt.Errorf("query metric history: %w", err)
+		}
+		return nil
+	})
+	return points, err
+}
+
+// Compact сворачивает и удаляет историю в одной транзакции. Метки
+// metric_rollup_watermarks блокируются, поэтому одновременные проходы
+// нескольких серверов не сворачивают одни и те же данные дважды.
+func (h *PostgresHistory) Compact(ctx context.Context, now time.Time, policies retention.Policies) (retention.Stats, error) {
+	minuteEnd, hourEnd := retention.RollupBounds(now)
+
+	var stats retention.Stats
+	err := retryUnavailable(ctx, h.retrier, func(ctx context.Context) error {
+		stats = retention.Stats{}
+
+		tx, err := h.db.BeginTxx(ctx, nil)
+		if err != nil {
+			return fmt.Errorf("compact history begin transaction: %w", err)
+		}
+		defer tx.Rollback()
+
+		minuteUntil, hourUntil, err := lockWatermarks(ctx, tx)
+		if err != nil {
+			return err
+		}
+
+		if minuteEnd.After(minuteUntil) {
+			if stats.MinuteRollups, err = rollupHistory(ctx, tx, rollupMinuteSQL, retention.ResolutionMinute,
+				minuteUntil, minuteEnd); err != nil {
+				return err
+			}
+			minuteUntil = minuteEnd
+		}
+		if hourEnd.After(hourUntil) {
+			if stats.HourRollups, err = rollupHistory(ctx, tx, rollupHourSQL, retention.ResolutionHour,
+				hourUntil, hourEnd); err != nil {
+				return err
+			}
+			hourUntil = hourEnd
+		}
+
+		if err = deleteExpiredHistory(ctx, tx, now, policies, minuteUntil, hourUntil, &stats); err != nil {
+			return err
+		}
+
+		if err = tx.Commit(); err != nil {
+			return fmt.Errorf("compact history commit: %w", err)
+		}
+		return nil
+	})
+	return stats, err
+}
+
+// lockWatermarks блокирует и читает метки свёртки.
+func lockWatermarks(ctx context.Context, tx *sqlx.Tx) (minuteUntil, hourUntil time.Time, err error) {
+	var marks []struct {
+		Resolution  string    `db:"resolution"`
+		RolledUntil time.Time `db:"rolled_until"`
+	}
+	err = tx.SelectContext(ctx, &marks, `SELECT resolution, rolled_until FROM metric_rollup_watermarks FOR UPDATE`)
+	if err != nil {
+		return minuteUntil, hourUntil, fmt.Errorf("lock rollup watermarks: %w", err)
+	}
+	for _, mark := range marks {
+		switch mark.Resolution {
+		case retention.ResolutionMinute:
+			minuteUntil = mark.RolledUntil
+		case retention.ResolutionHour:
+			hourUntil = mark.RolledUntil
+		}
+	}
+	return minuteUntil, hourUntil, nil
+}
+
+// rollupHistory выполняет свёртку rollupSQL за [from, to) и сдвигает метку
+// resolution. Возвращает число записанных агрегатов.
+func rollupHistory(
+	ctx context.Context,
+	tx *sqlx.Tx,
+	rollupSQL string,
+	resolution string,
+	from, to time.Time,
+) (int64, error) {
+	result, err := tx.ExecContext(ctx, rollupSQL, from, to)
+	if err != nil {
+		return 0, fmt.Errorf("rollup %s history: %w", resolution, err)
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("rollup %s history: %w", resolution, err)
+	}
+
+	_, err = tx.ExecContext(ctx,
+		`UPDATE metric_rollup_watermarks SET rolled_until = $2 WHERE resolution = $1`, resolution, to)
+	if err != nil {
+		return 0, fmt.Errorf("update %s rollup watermark: %w", resolution, err)
+	}
+	return rows, nil
+}
+
+// policyGroup - метрики, к которым применяется одна политика. Если
+// exclude, группа - все метрики, кроме names.
+type policyGroup struct {
+	policy  retention.Policy
+	names   []string
+	exclude bool
+}
+
+// groupByPolicy распределяет имена метрик по политикам. Метрики, которых
+// нет среди names (например, удалённые), попадают в группу по умолчанию.
+func groupByPolicy(policies retention.Policies, names []string) []policyGroup {
+	groups := make([]policyGroup, len(policies.Rules))
+	// Пустой, а не nil: nil передаётся в запрос как NULL, и условие
+	// name <> ALL(NULL) не выбрало бы ни одной строки.
+	matched := []string{}
+	for _, name := range names {
+		for i, rule := range policies.Rules {
+			if rule.Matches(name) {
+				groups[i].names = append(groups[i].names, name)
+				matched = append(matched, name)
+				break
+			}
+		}
+	}
+
+	out := make([]policyGroup, 0, len(groups)+1)
+	for _, group := range groups {
+		if len(group.names) > 0 {
+			group.policy = policies.For(group.names[0])
+			out = append(out, group)
+		}
+	}
+	return append(out, policyGroup{policy: policies.Default, names: matched, exclude: true})
+}
+
+// deleteExpiredHistory удаляет историю старше сроков политик. Сырые значения
+// и минутные агрегаты удаляются только после свёртки.
+func deleteExpiredHistory(
+	ctx context.Context,
+	tx *sqlx.Tx,
+	now time.Time,
+	policies retention.Policies,
+	minuteUntil, hourUntil time.Time,
+	stats *retention.Stats,
+) error {
+	var names []string
+	if err := tx.SelectContext(ctx, &names, `SELECT DISTINCT name FROM metrics`); err != nil {
+		return fmt.Errorf("list metric names: %w", err)
+	}
+
+	for _, group := range groupByPolicy(policies, names) {
+		cutoffs := group.policy.Cutoffs(now)
+		targets := []struct {
+			resolution string
+			cutoff     time.Time
+			deleted    *int64
+		}{
+			{retention.ResolutionRaw, earliest(cutoffs.Raw, minuteUntil), &stats.DeletedRaw},
+			{retention.ResolutionMinute, earliest(cutoffs.Minute, hourUntil), &stats.DeletedMinute},
+			{retention.ResolutionHour, cutoffs.Hour, &stats.DeletedHour},
+		}
+
+		condition := "name = ANY($1)"
+		if group.exclude {
+			condition = "name <> ALL($1)"
+		}
+		for _, target := range targets {
+			table := historyTables[target.resolution]
+			result, err := tx.ExecContext(ctx,
+				fmt.Sprintf(`DELETE FROM %s WHERE %s AND %s < $2`, table.name, condition, table.timeColumn),
+				pq.Array(group.names), target.cutoff,
+			)
+			if err != nil {
+				return fmt.Errorf("delete expired %s history: %w", target.resolution, err)
+			}
+			rows, err := result.RowsAffected()
+			if err != nil {
+				return fmt.Errorf("delete expired %s history: %w", target.resolution, err)
+			}
+			*target.deleted += rows
+		}
+	}
+	return nil
+}
@@ -0,0 +1,235 @@
+package repositories_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/guregu/null.v4"
+
+	"github.com/Axel791/metricsalert/internal/server/db"
+	"github.com/Axel791/metricsalert/internal/server/model/domain"
+	"github.com/Axel791/metricsalert/internal/server/repositories"
+	"github.com/Axel791/metricsalert/internal/server/retention"
+)
+
+var postgresHistoryPolicies = retention.Policies{
+	Default: retention.Policy{Pattern: "*", Raw: time.Hour, Minute: 24 * time.Hour, Hour: 30 * 24 * time.Hour},
+	Rules:   []retention.Policy{{Pattern: "_server.*", Raw: 10 * time.Minute}},
+}
+
+// openPostgresHistory подключается к тестовой базе и очищает метрики,
+// историю и метки свёртки.
+func openPostgresHistory(t *testing.T) (*sqlx.DB, *repositories.PostgresHistory) {
+	t.Helper()
+
+	dsn := os.Getenv(testDatabaseDSNEnv)
+	if dsn == "" {
+		t.Skipf("%s is not set", testDatabaseDSNEnv)
+	}
+
+	conn, err := db.ConnectDB(dsn, filepath.Join("..", "..", "..", "migrations"), db.PoolConfig{})
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	_, err = conn.Exec("TRUNCATE TABLE metrics, metric_samples, metric_rollups_1m, metric_rollups_1h")
+	require.NoError(t, err)
+	_, err = conn.Exec("UPDATE metric_rollup_watermarks SET rolled_until = '1970-01-01 00:00:00+00'")
+	require.NoError(t, err)
+
+	return conn, repositories.NewPostgresHistory(conn, db.NewRetrier(db.DefaultRetryConfig()))
+}
+
+func gaugeSample(name string, value float64) []domain.Metrics {
+	return []domain.Metrics{{Name: name, MType: domain.Gauge, Value: null.FloatFrom(value)}}
+}
+
+// inUTC приводит время точек к UTC: база возвращает его в часовом поясе
+// сессии.
+func inUTC(points []repositories.HistoryPoint) []repositories.HistoryPoint {
+	for i := range points {
+		points[i].Time = points[i].Time.UTC()
+	}
+	return points
+}
+
+// countRows возвращает число строк таблицы истории.
+func countRows(t *testing.T, conn *sqlx.DB, table string) int {
+	t.Helper()
+
+	var count int
+	require.NoError(t, conn.Get(&count, "SELECT count(*) FROM "+table))
+	return count
+}
+
+func TestPostgresHistory_RollsUpCompletedMinutes(t *testing.T) {
+	ctx := context.Background()
+	_, history := openPostgresHistory(t)
+	start := time.Date(2026, 10, 19, 10, 0, 0, 0, time.UTC)
+	key := domain.MetricKey{Name: "Alloc", MType: domain.Gauge}
+
+	require.NoError(t, history.Record(ctx, start.Add(10*time.Second), gaugeSample("Alloc", 3)))
+	require.NoError(t, history.Record(ctx, start.Add(20*time.Second), gaugeSample("Alloc", 1)))
+	require.NoError(t, history.Record(ctx, start.Add(50*time.Second), gaugeSample("Alloc", 2)))
+	require.NoError(t, history.Record(ctx, start.Add(70*time.Second), gaugeSample("Alloc", 5)))
+	require.NoError(t, history.Record(ctx, start.Add(-time.Minute), []domain.Metrics{
+		{Name: "PollCount", MType: domain.Counter, Delta: null.IntFrom(4)},
+	}))
+
+	// Вторая минута ещё не закончилась: свёрнута только первая.
+	stats, err := history.Compact(ctx, start.Add(80*time.Second), postgresHistoryPolicies)
+	require.NoError(t, err)
+	require.Equal(t, int64(2), stats.MinuteRollups)
+
+	minutes, err := history.Query(ctx, key, retention.ResolutionMinute, start)
+	require.NoError(t, err)
+	require.Equal(t, []repositories.HistoryPoint{{Time: start, Count: 3, Sum: 6, Min: 1, Max: 3, Last: 2}}, inUTC(minutes))
+
+	raw, err := history.Query(ctx, key, retention.ResolutionRaw, start.Add(time.Minute))
+	require.NoError(t, err)
+	require.Equal(t, []repositories.HistoryPoint{
+		{Time: start.Add(70 * time.Second), Count: 1, Sum: 5, Min: 5, Max: 5, Last: 5},
+	}, inUTC(raw))
+
+	counter, err := history.Query(ctx, domain.MetricKey{Name: "PollCount", MType: domain.Counter},
+		retention.ResolutionMinute, time.Time{})
+	require.NoError(t, err)
+	require.Len(t, counter, 1)
+	require.Equal(t, float64(4), counter[0].Sum)
+
+	// Метка свёртки сдвинута: повторный проход не сворачивает те же значения.
+	stats, err = history.Compact(ctx, start.Add(80*time.Second), postgresHistoryPolicies)
+	require.NoError(t, err)
+	require.Zero(t, stats.MinuteRollups)
+
+	_, err = history.Query(ctx, key, "5m", start)
+	require.Error(t, err)
+}
+
+func TestPostgresHistory_ConcurrentCompactionsRollUpOnce(t *testing.T) {
+	ctx := context.Background()
+	conn, history := openPostgresHistory(t)
+	other := repositories.NewPostgresHistory(conn, db.NewRetrier(db.DefaultRetryConfig()))
+	start := time.Date(2026, 10, 19, 10, 0, 0, 0, time.UTC)
+
+	for i := 0; i < 10; i++ {
+		require.NoError(t, history.Record(ctx, start.Add(time.Duration(i)*time.Minute), gaugeSample("Alloc", float64(i))))
+	}
+
+	// Метки свёртки блокируются: второй проход ждёт первый и видит уже
+	// сдвинутые метки.
+	now := start.Add(10*time.Minute + 30*time.Second)
+	var (
+		wg    sync.WaitGroup
+		stats [2]retention.Stats
+		errs  [2]error
+	)
+	for i, target := range []*repositories.PostgresHistory{history, other} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			stats[i], errs[i] = target.Compact(ctx, now, postgresHistoryPolicies)
+		}()
+	}
+	wg.Wait()
+
+	require.NoError(t, errs[0])
+	require.NoError(t, errs[1])
+	require.Equal(t, int64(10), stats[0].MinuteRollups+stats[1].MinuteRollups)
+
+	minutes, err := history.Query(ctx, domain.MetricKey{Name: "Alloc", MType: domain.Gauge},
+		retention.ResolutionMinute, time.Time{})
+	require.NoError(t, err)
+	require.Len(t, minutes, 10)
+	for _, point := range minutes {
+		require.Equal(t, int64(1), point.Count)
+	}
+}
+
+func TestPostgresHistory_AppliesRetentionPerPolicy(t *testing.T) {
+	ctx := context.Background()
+	conn, history := openPostgresHistory(t)
+	start := time.Date(2026, 10, 19, 10, 0, 0, 0, time.UTC)
+
+	// Политики применяются к метрикам, которые есть в хранилище.
+	store := repositories.NewMetricRepository(conn, db.NewRetrier(db.DefaultRetryConfig()))
+	_, err := store.UpdateGauge(ctx, "Alloc", 0)
+	require.NoError(t, err)
+	_, err = store.UpdateGauge(ctx, "_server.requests", 0)
+	require.NoError(t, err)
+
+	for i := 0; i < 120; i++ {
+		at := start.Add(time.Duration(i) * time.Minute)
+		require.NoError(t, history.Record(ctx, at, gaugeSample("Alloc", float64(i))))
+		require.NoError(t, history.Record(ctx, at, gaugeSample("_server.requests", float64(i))))
+	}
+
+	now := start.Add(2*time.Hour + 30*time.Second)
+	stats, err := history.Compact(ctx, now, postgresHistoryPolicies)
+	require.NoError(t, err)
+	require.Equal(t, int64(2*120), stats.MinuteRollups)
+	require.Equal(t, int64(2*2), stats.HourRollups)
+
+	// Alloc хранит сырые значения час, _server.* - десять минут.
+	raw, err := history.Query(ctx, domain.MetricKey{Name: "Alloc", MType: domain.Gauge}, retention.ResolutionRaw, time.Time{})
+	require.NoError(t, err)
+	require.Len(t, raw, 59)
+	require.Equal(t, start.Add(61*time.Minute), raw[0].Time.UTC())
+
+	raw, err = history.Query(ctx, domain.MetricKey{Name: "_server.requests", MType: domain.Gauge},
+		retention.ResolutionRaw, time.Time{})
+	require.NoError(t, err)
+	require.Len(t, raw, 9)
+
+	hours, err := history.Query(ctx, domain.MetricKey{Name: "Alloc", MType: domain.Gauge}, retention.ResolutionHour, time.Time{})
+	require.NoError(t, err)
+	require.Equal(t, []repositories.HistoryPoint{
+		{Time: start, Count: 60, Sum: 1770, Min: 0, Max: 59, Last: 59},
+		{Time: start.Add(time.Hour), Count: 60, Sum: 5370, Min: 60, Max: 119, Last: 119},
+	}, inUTC(hours))
+
+	// Через месяц от истории не остаётся ничего.
+	_, err = history.Compact(ctx, now.Add(31*24*time.Hour), postgresHistoryPolicies)
+	require.NoError(t, err)
+	for _, table := range []string{"metric_samples", "metric_rollups_1m", "metric_rollups_1h"} {
+		require.Zero(t, countRows(t, conn, table), table)
+	}
+}
+
+func TestPostgresHistory_ExpiresHistoryOfDeletedMetrics(t *testing.T) {
+	ctx := context.Background()
+	conn, history := openPostgresHistory(t)
+	start := time.Date(2026, 10, 19, 10, 0, 0, 0, time.UTC)
+
+	// Метрики нет в хранилище, и ни одно правило не подходит: её история
+	// удаляется по политике по умолчанию.
+	require.NoError(t, history.Record(ctx, start, gaugeSample("Removed", 1)))
+
+	stats, err := history.Compact(ctx, start.Add(2*time.Hour), postgresHistoryPolicies)
+	require.NoError(t, err)
+	require.Equal(t, int64(1), stats.DeletedRaw)
+	require.Zero(t, countRows(t, conn, "metric_samples"))
+}
+
+func TestPostgresHistory_KeepsUnrolledRawValues(t *testing.T) {
+	ctx := context.Background()
+	_, history := openPostgresHistory(t)
+	start := time.Date(2026, 10, 19, 10, 0, 0, 0, time.UTC)
+	require.NoError(t, history.Record(ctx, start.Add(30*time.Second), gaugeSample("Alloc", 1)))
+
+	// Срок хранения короче задержки свёртки: значение ещё не попало в
+	// минутный агрегат и не удаляется.
+	policies := retention.Policies{Default: retention.Policy{Pattern: "*", Raw: time.Second, Minute: time.Hour, Hour: time.Hour}}
+	stats, err := history.Compact(ctx, start.Add(65*time.Second), policies)
+	require.NoError(t, err)
+	require.Zero(t, stats.DeletedRaw)
+
+	raw, err := history.Query(ctx, domain.MetricKey{Name: "Alloc", MType: domain.Gauge}, retention.ResolutionRaw, time.Time{})
+	require.NoError(t, err)
+	require.Len(t, raw, 1)
+}
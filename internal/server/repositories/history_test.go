@@ -0,0 +1,190 @@
+package repositories
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/guregu/null.v4"
+
+	"github.com/Axel791/metricsalert/internal/server/model/domain"
+	"github.com/Axel791/metricsalert/internal/server/retention"
+)
+
+var historyPolicies = retention.Policies{
+	Default: retention.Policy{Pattern: "*", Raw: time.Hour, Minute: 24 * time.Hour, Hour: 30 * 24 * time.Hour},
+	Rules:   []retention.Policy{{Pattern: "_server.*", Raw: 10 * time.Minute}},
+}
+
+func gaugeAt(name string, value float64) []domain.Metrics {
+	return []domain.Metrics{{Name: name, MType: domain.Gauge, Value: null.FloatFrom(value)}}
+}
+
+func TestMemoryHistory_RollsUpCompletedMinutes(t *testing.T) {
+	ctx := context.Background()
+	history := NewMemoryHistory()
+	start := time.Date(2026, 10, 19, 10, 0, 0, 0, time.UTC)
+	key := domain.MetricKey{Name: "Alloc", MType: domain.Gauge}
+
+	require.NoError(t, history.Record(ctx, start.Add(10*time.Second), gaugeAt("Alloc", 3)))
+	require.NoError(t, history.Record(ctx, start.Add(20*time.Second), gaugeAt("Alloc", 1)))
+	require.NoError(t, history.Record(ctx, start.Add(50*time.Second), gaugeAt("Alloc", 2)))
+	require.NoError(t, history.Record(ctx, start.Add(70*time.Second), gaugeAt("Alloc", 5)))
+	require.NoError(t, history.Record(ctx, start.Add(-time.Minute), []domain.Metrics{
+		{Name: "PollCount", MType: domain.Counter, Delta: null.IntFrom(4)},
+	}))
+
+	// Вторая минута ещё не закончилась: свёрнута только первая.
+	stats, err := history.Compact(ctx, start.Add(80*time.Second), historyPolicies)
+	require.NoError(t, err)
+	require.Equal(t, int64(2), stats.MinuteRollups)
+
+	minutes, err := history.Query(ctx, key, retention.ResolutionMinute, start)
+	require.NoError(t, err)
+	require.Equal(t, []HistoryPoint{{Time: start, Count: 3, Sum: 6, Min: 1, Max: 3, Last: 2}}, minutes)
+
+	raw, err := history.Query(ctx, key, retention.ResolutionRaw, start.Add(time.Minute))
+	require.NoError(t, err)
+	require.Equal(t, []HistoryPoint{rawPoint(start.Add(70*time.Second), 5)}, raw)
+
+	counter, err := history.Query(ctx, domain.MetricKey{Name: "PollCount", MType: domain.Counter},
+		retention.ResolutionMinute, time.Time{})
+	require.NoError(t, err)
+	require.Len(t, counter, 1)
+	require.Equal(t, float64(4), counter[0].Sum)
+
+	// Повторный проход не сворачивает те же значения дважды.
+	stats, err = history.Compact(ctx, start.Add(80*time.Second), historyPolicies)
+	require.NoError(t, err)
+	require.Zero(t, stats.MinuteRollups)
+
+	_, err = history.Query(ctx, key, "5m", start)
+	require.Error(t, err)
+}
+
+func TestMemoryHistory_AppliesRetentionPerPolicy(t *testing.T) {
+	ctx := context.Background()
+	history := NewMemoryHistory()
+	start := time.Date(2026, 10, 19, 10, 0, 0, 0, time.UTC)
+
+	for i := 0; i < 120; i++ {
+		at := start.Add(time.Duration(i) * time.Minute)
+		require.NoError(t, history.Record(ctx, at, gaugeAt("Alloc", float64(i))))
+		require.NoError(t, history.Record(ctx, at, gaugeAt("_server.requests", float64(i))))
+	}
+
+	now := start.Add(2*time.Hour + 30*time.Second)
+	stats, err := history.Compact(ctx, now, historyPolicies)
+	require.NoError(t, err)
+	require.Equal(t, int64(2*120), stats.MinuteRollups)
+	require.Equal(t, int64(2*2), stats.HourRollups)
+
+	// Alloc хранит сырые значения час, _server.* - десять минут.
+	raw, err := history.Query(ctx, domain.MetricKey{Name: "Alloc", MType: domain.Gauge}, retention.ResolutionRaw, time.Time{})
+	require.NoError(t, err)
+	require.Len(t, raw, 59)
+	require.Equal(t, start.Add(61*time.Minute), raw[0].Time)
+
+	raw, err = history.Query(ctx, domain.MetricKey{Name: "_server.requests", MType: domain.Gauge},
+		retention.ResolutionRaw, time.Time{})
+	require.NoError(t, err)
+	require.Len(t, raw, 9)
+
+	hours, err := history.Query(ctx, domain.MetricKey{Name: "Alloc", MType: domain.Gauge}, retention.ResolutionHour, time.Time{})
+	require.NoError(t, err)
+	require.Equal(t, []HistoryPoint{
+		{Time: start, Count: 60, Sum: 1770, Min: 0, Max: 59, Last: 59},
+		{Time: start.Add(time.Hour), Count: 60, Sum: 5370, Min: 60, Max: 119, Last: 119},
+	}, hours)
+
+	// Через месяц от истории не остаётся ничего.
+	_, err = history.Compact(ctx, now.Add(31*24*time.Hour), historyPolicies)
+	require.NoError(t, err)
+	require.Empty(t, history.series)
+}
+
+func TestMemoryHistory_KeepsUnrolledRawValues(t *testing.T) {
+	ctx := context.Background()
+	history := NewMemoryHistory()
+	start := time.Date(2026, 10, 19, 10, 0, 0, 0, time.UTC)
+	require.NoError(t, history.Record(ctx, start.Add(30*time.Second), gaugeAt("Alloc", 1)))
+
+	// Срок хранения короче задержки свёртки: значение ещё не попало в
+	// минутный агрегат и не удаляется.
+	policies := retention.Policies{Default: retention.Policy{Pattern: "*", Raw: time.Second, Minute: time.Hour, Hour: time.Hour}}
+	stats, err := history.Compact(ctx, start.Add(65*time.Second), policies)
+	require.NoError(t, err)
+	require.Zero(t, stats.DeletedRaw)
+
+	raw, err := history.Query(ctx, domain.MetricKey{Name: "Alloc", MType: domain.Gauge}, retention.ResolutionRaw, time.Time{})
+	require.NoError(t, err)
+	require.Len(t, raw, 1)
+}
+
+func TestHistoryRecorder_RecordsSuccessfulWrites(t *testing.T) {
+	ctx := context.Background()
+	history := NewMemoryHistory()
+	recorder := NewHistoryRecorder(NewMetricMapRepository(), history)
+
+	_, err := recorder.UpdateCounter(ctx, "PollCount", 2)
+	require.NoError(t, err)
+	_, err = recorder.UpdateCounter(ctx, "PollCount", 3)
+	require.NoError(t, err)
+	require.Error(t, recorder.BatchUpdateMetrics(ctx, []domain.Metrics{{Name: "Bad", MType: "histogram"}}))
+	// История пишется асинхронно, Close дописывает очередь.
+	require.NoError(t, recorder.Close())
+
+	// В историю попадают приращения counter, а не накопленное значение.
+	raw, err := history.Query(ctx, domain.MetricKey{Name: "PollCount", MType: domain.Counter},
+		retention.ResolutionRaw, time.Time{})
+	require.NoError(t, err)
+	require.Len(t, raw, 2)
+	require.Equal(t, float64(2), raw[0].Last)
+	require.Equal(t, float64(3), raw[1].Last)
+
+	require.Len(t, history.series, 1)
+}
+
+// blockingHistory - история, Record которой ждёт release.
+type blockingHistory struct {
+	*MemoryHistory
+	release chan struct{}
+}
+
+func (h blockingHistory) Record(ctx context.Context, at time.Time, metrics []domain.Metrics) error {
+	<-h.release
+	return h.MemoryHistory.Record(ctx, at, metrics)
+}
+
+func TestHistoryRecorder_DoesNotWaitForHistory(t *testing.T) {
+	ctx := context.Background()
+	history := blockingHistory{MemoryHistory: NewMemoryHistory(), release: make(chan struct{})}
+	recorder := NewHistoryRecorder(NewMetricMapRepository(), history)
+
+	// Запись метрики не ждёт, пока история сохранит значения.
+	_, err := recorder.UpdateGauge(ctx, "Alloc", 1)
+	require.NoError(t, err)
+	require.NoError(t, recorder.BatchUpdateMetrics(ctx, gaugeAt("Alloc", 2)))
+
+	close(history.release)
+	require.NoError(t, recorder.Close())
+
+	raw, err := history.Query(ctx, domain.MetricKey{Name: "Alloc", MType: domain.Gauge}, retention.ResolutionRaw, time.Time{})
+	require.NoError(t, err)
+	require.Len(t, raw, 2)
+
+	// После Close значения в историю не попадают.
+	_, err = recorder.UpdateGauge(ctx, "Alloc", 3)
+	require.NoError(t, err)
+	raw, err = history.Query(ctx, domain.MetricKey{Name: "Alloc", MType: domain.Gauge}, retention.ResolutionRaw, time.Time{})
+	require.NoError(t, err)
+	require.Len(t, raw, 2)
+}
+
+func TestGroupByPolicy_DefaultGroupIsNeverNull(t *testing.T) {
+	groups := groupByPolicy(historyPolicies, nil)
+	require.Len(t, groups, 1)
+	require.True(t, groups[0].exclude)
+	require.NotNil(t, groups[0].names)
+}
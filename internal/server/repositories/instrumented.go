@@ -0,0 +1,121 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/Axel791/metricsalert/internal/server/model/domain"
+	"github.com/Axel791/metricsalert/internal/server/telemetry"
+)
+
+// Названия бэкендов в метках телеметрии.
+const (
+	BackendMemory   = "memory"
+	BackendFile     = "file"
+	BackendPostgres = "postgres"
+	BackendBolt     = "bolt"
+)
+
+// InstrumentedStore оборачивает Store и записывает длительность операций,
+// ошибки и размеры пачек в телеметрию сервера.
+type InstrumentedStore struct {
+	storeDelegate
+	backend string
+	metrics *telemetry.ServerMetrics
+}
+
+// NewInstrumentedStore создаёт обёртку над store для бэкенда backend.
+func NewInstrumentedStore(store Store, backend string, metrics *telemetry.ServerMetrics) *InstrumentedStore {
+	return &InstrumentedStore{storeDelegate: storeDelegate{store: store}, backend: backend, metrics: metrics}
+}
+
+// Backend возвращает название обёрнутого бэкенда.
+func (s *InstrumentedStore) Backend() string {
+	return s.backend
+}
+
+func (s *InstrumentedStore) UpdateGauge(ctx context.Context, name string, value float64) (domain.Metrics, error) {
+	start := time.Now()
+	metric, err := s.store.UpdateGauge(ctx, name, value)
+	s.observeWrite("update_gauge", start, err)
+	return metric, err
+}
+
+func (s *InstrumentedStore) UpdateCounter(ctx context.Context, name string, value int64) (domain.Metrics, error) {
+	start := time.Now()
+	metric, err := s.store.UpdateCounter(ctx, name, value)
+	s.observeWrite("update_counter", start, err)
+	return metric, err
+}
+
+func (s *InstrumentedStore) GetMetric(ctx context.Context, metric domain.Metrics) (domain.Metrics, error) {
+	start := time.Now()
+	result, err := s.store.GetMetric(ctx, metric)
+	if errors.Is(err, ErrNotFound) {
+		// Отсутствие метрики - штатный ответ, а не сбой хранилища.
+		s.metrics.ObserveStore(s.backend, "get_metric", start, nil)
+	} else {
+		s.metrics.ObserveStore(s.backend, "get_metric", start, err)
+	}
+	return result, err
+}
+
+func (s *InstrumentedStore) GetAllMetrics(ctx context.Context) (map[domain.MetricKey]domain.Metrics, error) {
+	start := time.Now()
+	result, err := s.store.GetAllMetrics(ctx)
+	s.metrics.ObserveStore(s.backend, "get_all_metrics", start, err)
+	return result, err
+}
+
+func (s *InstrumentedStore) BatchUpdateMetrics(ctx context.Context, metrics []domain.Metrics) error {
+	start := time.Now()
+	err := s.store.BatchUpdateMetrics(ctx, metrics)
+	s.observeWrite("batch_update", start, err)
+	s.metrics.ObserveBatch(s.backend, len(metrics))
+	return err
+}
+
+func (s *InstrumentedStore) DeleteMetric(ctx context.Context, key domain.MetricKey) error {
+	start := time.Now()
+	err := s.store.DeleteMetric(ctx, key)
+	s.observeChange("delete_metric", start, err)
+	return err
+}
+
+func (s *InstrumentedStore) ResetCounter(ctx context.Context, name string) (domain.Metrics, error) {
+	start := time.Now()
+	metric, err := s.store.ResetCounter(ctx, name)
+	s.observeChange("reset_counter", start, err)
+	return metric, err
+}
+
+func (s *InstrumentedStore) QueryMetrics(ctx context.Context, query MetricsQuery) ([]domain.Metrics, error) {
+	start := time.Now()
+	result, err := s.store.QueryMetrics(ctx, query)
+	if errors.Is(err, ErrInvalidQuery) {
+		// Некорректный запрос - ошибка клиента, а не сбой хранилища.
+		s.metrics.ObserveStore(s.backend, "query_metrics", start, nil)
+	} else {
+		s.metrics.ObserveStore(s.backend, "query_metrics", start, err)
+	}
+	return result, err
+}
+
+// observeChange записывает удаление или сброс метрики. Отсутствие метрики -
+// штатный ответ, а не сбой хранилища.
+func (s *InstrumentedStore) observeChange(operation string, start time.Time, err error) {
+	if errors.Is(err, ErrNotFound) {
+		s.metrics.ObserveStore(s.backend, operation, start, nil)
+		return
+	}
+	s.observeWrite(operation, start, err)
+}
+
+// observeWrite записывает операцию записи и время последней успешной записи.
+func (s *InstrumentedStore) observeWrite(operation string, start time.Time, err error) {
+	s.metrics.ObserveStore(s.backend, operation, start, err)
+	if err == nil {
+		s.metrics.MarkWrite(time.Now())
+	}
+}
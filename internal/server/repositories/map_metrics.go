@@ -2,80 +2,204 @@ package repositories
 
 import (
 	"context"
-	"fmt"
+	"hash/maphash"
+	"sync"
+	"time"
 
 	"gopkg.in/guregu/null.v4"
 
 	"github.com/Axel791/metricsalert/internal/server/model/domain"
 )
 
+// mapShardCount - число сегментов хранилища в памяти. Обновления разных
+// метрик от множества агентов почти не конкурируют за одну блокировку.
+const mapShardCount = 32
+
+// mapShard - сегмент хранилища со своей блокировкой.
+type mapShard struct {
+	mutex   sync.RWMutex
+	metrics map[domain.MetricKey]domain.Metrics
+}
+
+// MetricMapRepositoryHandler хранит метрики в памяти по ключу (имя, тип).
+//
+// Метрики распределены по сегментам по хешу ключа, у каждого сегмента своя
+// RW-блокировка. Пачка блокирует все затронутые сегменты сразу (в порядке
+// возрастания номера, чтобы не было взаимоблокировок), поэтому применяется
+// атомарно. GetAllMetrics возвращает копию, согласованную по всем сегментам.
 type MetricMapRepositoryHandler struct {
-	metrics map[string]domain.Metrics
+	seed   maphash.Seed
+	shards [mapShardCount]mapShard
 }
 
 func NewMetricMapRepository() *MetricMapRepositoryHandler {
-	return &MetricMapRepositoryHandler{metrics: make(map[string]domain.Metrics)}
+	r := &MetricMapRepositoryHandler{seed: maphash.MakeSeed()}
+	for i := range r.shards {
+		r.shards[i].metrics = make(map[domain.MetricKey]domain.Metrics)
+	}
+	return r
 }
 
 func (r *MetricMapRepositoryHandler) UpdateGauge(_ context.Context, name string, value float64) (domain.Metrics, error) {
-	metric, exists := r.metrics[name]
-	if exists && metric.MType == domain.Gauge {
-		metric.Value = null.FloatFrom(value)
-	} else {
-		metric = domain.Metrics{
-			ID:    0,
-			Name:  name,
-			MType: domain.Gauge,
-			Value: null.FloatFrom(value),
-		}
+	metric := domain.Metrics{
+		Name:  name,
+		MType: domain.Gauge,
+		Value: null.FloatFrom(value),
 	}
-	r.metrics[name] = metric
-	return metric, nil
+	shard := &r.shards[r.shardIndex(metric.Key())]
+	shard.mutex.Lock()
+	defer shard.mutex.Unlock()
+
+	return shard.apply(metric), nil
 }
 
 func (r *MetricMapRepositoryHandler) UpdateCounter(_ context.Context, name string, value int64) (domain.Metrics, error) {
-	metric, exists := r.metrics[name]
-	if exists && metric.MType == domain.Counter {
-		metric.Delta = null.IntFrom(metric.Delta.Int64 + value)
-	} else {
-		metric = domain.Metrics{
-			ID:    0,
-			Name:  name,
-			MType: domain.Counter,
-			Delta: null.IntFrom(value),
-		}
+	metric := domain.Metrics{
+		Name:  name,
+		MType: domain.Counter,
+		Delta: null.IntFrom(value),
 	}
-	r.metrics[name] = metric
-	return metric, nil
+	shard := &r.shards[r.shardIndex(metric.Key())]
+	shard.mutex.Lock()
+	defer shard.mutex.Unlock()
+
+	return shard.apply(metric), nil
 }
 
 func (r *MetricMapRepositoryHandler) GetMetric(_ context.Context, metricsDomain domain.Metrics) (domain.Metrics, error) {
-	if metric, exists := r.metrics[metricsDomain.Name]; exists {
+	key := metricsDomain.Key()
+	shard := &r.shards[r.shardIndex(key)]
+	shard.mutex.RLock()
+	defer shard.mutex.RUnlock()
+
+	if metric, exists := shard.metrics[key]; exists {
 		return metric, nil
 	}
-	return domain.Metrics{}, nil
+	return domain.Metrics{}, ErrNotFound
 }
 
-func (r *MetricMapRepositoryHandler) GetAllMetrics(_ context.Context) (map[string]domain.Metrics, error) {
-	return r.metrics, nil
+// GetAllMetrics возвращает копию всех метрик. Изменение результата не
+// влияет на хранилище.
+func (r *MetricMapRepositoryHandler) GetAllMetrics(_ context.Context) (map[domain.MetricKey]domain.Metrics, error) {
+	for i := range r.shards {
+		r.shards[i].mutex.RLock()
+	}
+	defer func() {
+		for i := range r.shards {
+			r.shards[i].mutex.RUnlock()
+		}
+	}()
+
+	size := 0
+	for i := range r.shards {
+		size += len(r.shards[i].metrics)
+	}
+	result := make(map[domain.MetricKey]domain.Metrics, size)
+	for i := range r.shards {
+		for key, metric := range r.shards[i].metrics {
+			metric.Labels = metric.Labels.Clone()
+			result[key] = metric
+		}
+	}
+	return result, nil
 }
 
+// BatchUpdateMetrics применяет пачку целиком: пачка проверяется до взятия
+// блокировок, после чего применение не может завершиться ошибкой.
 func (r *MetricMapRepositoryHandler) BatchUpdateMetrics(_ context.Context, metrics []domain.Metrics) error {
-	for _, metric := range metrics {
-		switch metric.MType {
-		case domain.Gauge:
-			_, err := r.UpdateGauge(context.Background(), metric.Name, metric.Value.Float64)
-			if err != nil {
-				return fmt.Errorf("failed to update gauge metric %s: %w", metric.Name, err)
-			}
-		case domain.Counter:
-			_, err := r.UpdateCounter(context.Background(), metric.Name, metric.Delta.Int64)
-			if err != nil {
-				return fmt.Errorf("failed to update counter metric %s: %w", metric.Name, err)
+	if len(metrics) == 0 {
+		return nil
+	}
+
+	if err := validateBatch(metrics); err != nil {
+		return err
+	}
+
+	var locked [mapShardCount]bool
+	indexes := make([]int, len(metrics))
+	for i, metric := range metrics {
+		indexes[i] = r.shardIndex(metric.Key())
+		locked[indexes[i]] = true
+	}
+
+	for i := range r.shards {
+		if locked[i] {
+			r.shards[i].mutex.Lock()
+		}
+	}
+	defer func() {
+		for i := range r.shards {
+			if locked[i] {
+				r.shards[i].mutex.Unlock()
 			}
-		default:
-			return fmt.Errorf("unknown metric type %s for metric %s", metric.MType, metric.Name)
 		}
+	}()
+
+	for i, metric := range metrics {
+		r.shards[indexes[i]].apply(metric)
+	}
+	return nil
+}
+
+func (r *MetricMapRepositoryHandler) DeleteMetric(_ context.Context, key domain.MetricKey) error {
+	shard := &r.shards[r.shardIndex(key)]
+	shard.mutex.Lock()
+	defer shard.mutex.Unlock()
+
+	if _, exists := shard.metrics[key]; !exists {
+		return ErrNotFound
 	}
+	delete(shard.metrics, key)
 	return nil
 }
+
+func (r *MetricMapRepositoryHandler) ResetCounter(_ context.Context, name string) (domain.Metrics, error) {
+	key := domain.MetricKey{Name: name, MType: domain.Counter}
+	shard := &r.shards[r.shardIndex(key)]
+	shard.mutex.Lock()
+	defer shard.mutex.Unlock()
+
+	stored, exists := shard.metrics[key]
+	if !exists {
+		return domain.Metrics{}, ErrNotFound
+	}
+	metric := domain.Metrics{
+		Name: name, MType: domain.Counter, Delta: null.IntFrom(0), UpdatedAt: time.Now(), Labels: stored.Labels,
+	}
+	shard.metrics[key] = metric
+	return metric, nil
+}
+
+// QueryMetrics - выборка метрик по запросу.
+func (r *MetricMapRepositoryHandler) QueryMetrics(ctx context.Context, query MetricsQuery) ([]domain.Metrics, error) {
+	return queryAll(ctx, r, query)
+}
+
+func (r *MetricMapRepositoryHandler) shardIndex(key domain.MetricKey) int {
+	return int(maphash.Comparable(r.seed, key) % mapShardCount)
+}
+
+// apply записывает gauge или прибавляет counter. Вызывается под mutex
+// сегмента. Метки копируются, поэтому сохранённые метки не меняются на месте.
+func (s *mapShard) apply(metric domain.Metrics) domain.Metrics {
+	key := metric.Key()
+	stored, exists := s.metrics[key]
+	labels := stored.Labels.Merge(metric.Labels)
+	if metric.MType == domain.Counter {
+		delta := metric.Delta.Int64
+		if exists {
+			delta += stored.Delta.Int64
+		}
+		metric = domain.Metrics{
+			Name: metric.Name, MType: domain.Counter, Delta: null.IntFrom(delta), UpdatedAt: updatedAt(metric),
+			Labels: labels,
+		}
+	} else {
+		metric = domain.Metrics{
+			Name: metric.Name, MType: domain.Gauge, Value: null.FloatFrom(metric.Value.Float64), UpdatedAt: updatedAt(metric),
+			Labels: labels,
+		}
+	}
+	s.metrics[key] = metric
+	return metric
+}
@@ -0,0 +1,84 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"testing"
+
+	"gopkg.in/guregu/null.v4"
+
+	"github.com/Axel791/metricsalert/internal/server/model/domain"
+)
+
+// agentBatch возвращает пачку, похожую на отправляемую агентом: runtime-метрики
+// агента и общий счётчик PollCount.
+func agentBatch(agent, size int) []domain.Metrics {
+	batch := make([]domain.Metrics, 0, size+1)
+	for i := 0; i < size; i++ {
+		batch = append(batch, domain.Metrics{
+			Name:  fmt.Sprintf("agent%d_gauge%d", agent, i),
+			MType: domain.Gauge,
+			Value: null.FloatFrom(float64(i)),
+		})
+	}
+	return append(batch, domain.Metrics{Name: "PollCount", MType: domain.Counter, Delta: null.IntFrom(1)})
+}
+
+// BenchmarkMapStore_ConcurrentBatch - пропускная способность пачек /updates
+// от многих агентов. Запуск: go test -race -run=^$ -bench=MapStore -cpu=1,4,16 ./internal/server/repositories
+func BenchmarkMapStore_ConcurrentBatch(b *testing.B) {
+	for _, size := range []int{10, 30, 100} {
+		b.Run(fmt.Sprintf("batch=%d", size), func(b *testing.B) {
+			ctx := context.Background()
+			store := NewMetricMapRepository()
+			var next atomic.Int64
+
+			b.ReportAllocs()
+			b.SetParallelism(8)
+			b.RunParallel(func(pb *testing.PB) {
+				// Каждая горутина - отдельный агент со своим набором gauge.
+				batch := agentBatch(int(next.Add(1)), size)
+				for pb.Next() {
+					if err := store.BatchUpdateMetrics(ctx, batch); err != nil {
+						b.Error(err)
+						return
+					}
+				}
+			})
+			b.ReportMetric(float64(b.N*(size+1))/b.Elapsed().Seconds(), "metrics/s")
+		})
+	}
+}
+
+// BenchmarkMapStore_BatchWithReaders - пачки на фоне чтения всех метрик
+// (HTML-страница, алерты, телеметрия).
+func BenchmarkMapStore_BatchWithReaders(b *testing.B) {
+	ctx := context.Background()
+	store := NewMetricMapRepository()
+	for agent := 0; agent < 16; agent++ {
+		if err := store.BatchUpdateMetrics(ctx, agentBatch(agent, 30)); err != nil {
+			b.Fatal(err)
+		}
+	}
+	var next atomic.Int64
+
+	b.ReportAllocs()
+	b.SetParallelism(8)
+	b.RunParallel(func(pb *testing.PB) {
+		agent := int(next.Add(1))
+		batch := agentBatch(agent, 30)
+		for i := 0; pb.Next(); i++ {
+			var err error
+			if agent%4 == 0 && i%10 == 0 {
+				_, err = store.GetAllMetrics(ctx)
+			} else {
+				err = store.BatchUpdateMetrics(ctx, batch)
+			}
+			if err != nil {
+				b.Error(err)
+				return
+			}
+		}
+	})
+}
@@ -2,52 +2,126 @@ package repositories
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"fmt"
+	"sort"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/Axel791/metricsalert/internal/server/db"
 
 	sq "github.com/Masterminds/squirrel"
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 
 	"github.com/Axel791/metricsalert/internal/server/model/domain"
 )
 
 var cursor = sq.StatementBuilder.PlaceholderFormat(sq.Dollar)
 
+// postgresBatchChunkSize - максимальное число метрик в одном запросе пачки.
+const postgresBatchChunkSize = 5000
+
+// upsertBatchSQL вставляет или обновляет пачку метрик, переданную массивами.
+// Повторов ключа во входных данных быть не должно (см. mergeBatch). Пустая
+// строка в массиве времени обновления означает текущее время базы, пустые
+// метки ('{}') не меняют сохранённые.
+const upsertBatchSQL = `
+	INSERT INTO metrics (name, metric_type, value, delta, updated_at, labels)
+	SELECT
+		i.name,
+		i.metric_type,
+		CASE WHEN i.metric_type = 'gauge' THEN i.val END,
+		CASE WHEN i.metric_type = 'counter' THEN i.delt END,
+		COALESCE(NULLIF(i.updated, '')::timestamptz, now()),
+		i.labels::jsonb
+	FROM unnest($1::text[], $2::text[], $3::double precision[], $4::bigint[], $5::text[], $6::text[])
+		AS i(name, metric_type, val, delt, updated, labels)
+	ON CONFLICT (name, metric_type) DO UPDATE SET
+		value = EXCLUDED.value,
+		delta = CASE
+			WHEN metrics.metric_type = 'counter' THEN metrics.delta + EXCLUDED.delta
+		END,
+		updated_at = EXCLUDED.updated_at,
+		labels = CASE
+			WHEN EXCLUDED.labels = '{}'::jsonb THEN metrics.labels
+			ELSE EXCLUDED.labels
+		END
+`
+
+// metricColumns - столбцы таблицы metrics, которые читаются в domain.Metrics.
+var metricColumns = []string{"id", "name", "metric_type", "value", "delta", "updated_at", "labels"}
+
 // MetricsRepositoryHandler хранит ссылку на БД.
 type MetricsRepositoryHandler struct {
-	db *sqlx.DB
+	db      *sqlx.DB
+	retrier *db.Retrier
+
+	stmtMutex sync.Mutex
+	upsert    *sqlx.Stmt
+}
+
+// NewMetricRepository — конструктор репозитория PostgreSQL. Запросы
+// повторяются при ошибках соединения через retrier.
+func NewMetricRepository(conn *sqlx.DB, retrier *db.Retrier) *MetricsRepositoryHandler {
+	return &MetricsRepositoryHandler{db: conn, retrier: retrier}
+}
+
+// DB возвращает подключение к базе, которым пользуется репозиторий.
+func (r *MetricsRepositoryHandler) DB() *sqlx.DB {
+	return r.db
+}
+
+// retry выполняет operation через retrier репозитория.
+func (r *MetricsRepositoryHandler) retry(ctx context.Context, operation func(ctx context.Context) error) error {
+	return retryUnavailable(ctx, r.retrier, operation)
+}
+
+// retryWrite выполняет неидемпотентную operation через retrier репозитория.
+func (r *MetricsRepositoryHandler) retryWrite(ctx context.Context, operation func(ctx context.Context) error) error {
+	return unavailable(r.retrier.DoWrite(ctx, operation))
 }
 
-// NewMetricRepository — конструктор репозитория PostgreSQL.
-func NewMetricRepository(db *sqlx.DB) *MetricsRepositoryHandler {
-	return &MetricsRepositoryHandler{db: db}
+// retryUnavailable выполняет operation через retrier. Недоступность базы
+// возвращается как ErrUnavailable.
+func retryUnavailable(ctx context.Context, retrier *db.Retrier, operation func(ctx context.Context) error) error {
+	return unavailable(retrier.Do(ctx, operation))
+}
+
+// unavailable оборачивает ошибку недоступности базы в ErrUnavailable.
+func unavailable(err error) error {
+	if errors.Is(err, db.ErrCircuitOpen) || db.IsConnectionError(err) {
+		return fmt.Errorf("%w: %w", ErrUnavailable, err)
+	}
+	return err
 }
 
 // UpdateGauge - обновление Gauge.
 func (r *MetricsRepositoryHandler) UpdateGauge(ctx context.Context, name string, gaugeVal float64) (domain.Metrics, error) {
 	var result domain.Metrics
 
-	err := db.RetryOperation(func() error {
+	err := r.retry(ctx, func(ctx context.Context) error {
 		cteSQL := `
 			WITH updated AS (
 				UPDATE metrics
 				SET value = $2,
-					delta = NULL
+					delta = NULL,
+					updated_at = now()
 				WHERE name = $1
 				  AND metric_type = 'gauge'
-				RETURNING id, name, metric_type, value, delta
+				RETURNING id, name, metric_type, value, delta, updated_at, labels
 			),
 			inserted AS (
 				INSERT INTO metrics (name, metric_type, value, delta)
 				SELECT $1, 'gauge', $2, NULL
 				WHERE NOT EXISTS (SELECT 1 FROM updated)
-				RETURNING id, name, metric_type, value, delta
+				RETURNING id, name, metric_type, value, delta, updated_at, labels
 			)
-			SELECT id, name, metric_type, value, delta FROM updated
+			SELECT id, name, metric_type, value, delta, updated_at, labels FROM updated
 			UNION ALL
-			SELECT id, name, metric_type, value, delta FROM inserted
+			SELECT id, name, metric_type, value, delta, updated_at, labels FROM inserted
 		`
 
 		if err := r.db.QueryRowxContext(ctx, cteSQL, name, gaugeVal).StructScan(&result); err != nil {
@@ -59,28 +133,31 @@ func (r *MetricsRepositoryHandler) UpdateGauge(ctx context.Context, name string,
 	return result, err
 }
 
+// UpdateCounter прибавляет value к counter. Запрос не идемпотентен, поэтому
+// после обрыва соединения он не повторяется: приращение могло примениться.
 func (r *MetricsRepositoryHandler) UpdateCounter(ctx context.Context, name string, value int64) (domain.Metrics, error) {
 	var result domain.Metrics
 
-	err := db.RetryOperation(func() error {
+	err := r.retryWrite(ctx, func(ctx context.Context) error {
 		cteSQL := `
 			WITH updated AS (
 				UPDATE metrics
 				SET delta = metrics.delta + $2,
-					value = NULL
+					value = NULL,
+					updated_at = now()
 				WHERE name = $1
 				  AND metric_type = 'counter'
-				RETURNING id, name, metric_type, value, delta
+				RETURNING id, name, metric_type, value, delta, updated_at, labels
 			),
 			inserted AS (
 				INSERT INTO metrics (name, metric_type, delta, value)
 				SELECT $1, 'counter', $2, NULL
 				WHERE NOT EXISTS (SELECT 1 FROM updated)
-				RETURNING id, name, metric_type, value, delta
+				RETURNING id, name, metric_type, value, delta, updated_at, labels
 			)
-			SELECT id, name, metric_type, value, delta FROM updated
+			SELECT id, name, metric_type, value, delta, updated_at, labels FROM updated
 			UNION ALL
-			SELECT id, name, metric_type, value, delta FROM inserted
+			SELECT id, name, metric_type, value, delta, updated_at, labels FROM inserted
 			`
 
 		if err := r.db.QueryRowxContext(ctx, cteSQL, name, value).StructScan(&result); err != nil {
@@ -97,9 +174,9 @@ func (r *MetricsRepositoryHandler) UpdateCounter(ctx context.Context, name strin
 func (r *MetricsRepositoryHandler) GetMetric(ctx context.Context, metric domain.Metrics) (domain.Metrics, error) {
 	var result domain.Metrics
 
-	err := db.RetryOperation(func() error {
+	err := r.retry(ctx, func(ctx context.Context) error {
 		query, args, err := cursor.
-			Select("id", "name", "metric_type", "value", "delta").
+			Select(metricColumns...).
 			From("metrics").
 			Where(sq.Eq{"name": metric.Name, "metric_type": metric.MType}).
 			Limit(1).
@@ -109,6 +186,9 @@ func (r *MetricsRepositoryHandler) GetMetric(ctx context.Context, metric domain.
 		}
 
 		err = r.db.GetContext(ctx, &result, query, args...)
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrNotFound
+		}
 		if err != nil {
 			return fmt.Errorf("get metric from db: %w", err)
 		}
@@ -120,12 +200,12 @@ func (r *MetricsRepositoryHandler) GetMetric(ctx context.Context, metric domain.
 }
 
 // GetAllMetrics - Получение всех метрик
-func (r *MetricsRepositoryHandler) GetAllMetrics(ctx context.Context) (map[string]domain.Metrics, error) {
-	metricsMap := make(map[string]domain.Metrics)
+func (r *MetricsRepositoryHandler) GetAllMetrics(ctx context.Context) (map[domain.MetricKey]domain.Metrics, error) {
+	metricsMap := make(map[domain.MetricKey]domain.Metrics)
 
-	err := db.RetryOperation(func() error {
+	err := r.retry(ctx, func(ctx context.Context) error {
 		query, args, err := cursor.
-			Select("id", "name", "metric_type", "value", "delta").
+			Select(metricColumns...).
 			From("metrics").
 			ToSql()
 		if err != nil {
@@ -144,7 +224,7 @@ func (r *MetricsRepositoryHandler) GetAllMetrics(ctx context.Context) (map[strin
 				return fmt.Errorf("scan metric row: %w", scanErr)
 			}
 
-			metricsMap[m.Name] = m
+			metricsMap[m.Key()] = m
 		}
 		if err = rows.Err(); err != nil {
 			return fmt.Errorf("error during rows iteration: %w", err)
@@ -156,82 +236,292 @@ func (r *MetricsRepositoryHandler) GetAllMetrics(ctx context.Context) (map[strin
 	return metricsMap, err
 }
 
+// invalidRegexpCode - SQLSTATE ошибки в регулярном выражении.
+const invalidRegexpCode = "2201B"
+
+// QueryMetrics - выборка метрик по запросу. Фильтр (метки - через jsonb
+// @>), сортировка, продолжение после query.After и ограничение выполняются
+// в SQL. Имена и типы сравниваются в collation "C", чтобы порядок совпадал
+// с побайтовым, как у остальных хранилищ, независимо от настроек базы.
+func (r *MetricsRepositoryHandler) QueryMetrics(ctx context.Context, query MetricsQuery) ([]domain.Metrics, error) {
+	if err := query.Validate(); err != nil {
+		return nil, err
+	}
+	sqlQuery, args, err := metricsQuerySQL(query)
+	if err != nil {
+		return nil, fmt.Errorf("build query metrics query: %w", err)
+	}
+
+	var result []domain.Metrics
+	err = r.retry(ctx, func(ctx context.Context) error {
+		result = result[:0]
+		if err := r.db.SelectContext(ctx, &result, sqlQuery, args...); err != nil {
+			var pqErr *pq.Error
+			if errors.As(err, &pqErr) && pqErr.Code == invalidRegexpCode {
+				return fmt.Errorf("%w: %s", ErrInvalidQuery, pqErr.Message)
+			}
+			return fmt.Errorf("query metrics: %w", err)
+		}
+		return nil
+	})
+	return result, err
+}
+
+// metricsQuerySQL строит SQL-запрос для QueryMetrics.
+func metricsQuerySQL(query MetricsQuery) (string, []interface{}, error) {
+	builder := cursor.Select(metricColumns...).From("metrics")
+	if query.MType != "" {
+		builder = builder.Where(sq.Eq{"metric_type": query.MType})
+	}
+	if query.Prefix != "" {
+		builder = builder.Where(`name LIKE ? ESCAPE '\'`, escapeLike(query.Prefix)+"%")
+	}
+	if query.Glob != "" {
+		builder = builder.Where(`name LIKE ? ESCAPE '\'`, globLike(query.Glob))
+	}
+	if query.Regex != "" {
+		builder = builder.Where("name ~ ?", query.Regex)
+	}
+	if len(query.Labels) > 0 {
+		builder = builder.Where("labels @> ?::jsonb", query.Labels)
+	}
+
+	var columns []string
+	switch query.sortField() {
+	case SortByName:
+		columns = []string{`name COLLATE "C"`, `metric_type COLLATE "C"`}
+	case SortByUpdatedAt:
+		columns = []string{"updated_at", `metric_type COLLATE "C"`, `name COLLATE "C"`}
+	default:
+		columns = []string{`metric_type COLLATE "C"`, `name COLLATE "C"`}
+	}
+	direction, operator := " ASC", ">"
+	if query.Desc {
+		direction, operator = " DESC", "<"
+	}
+
+	if after := query.After; after != nil {
+		var values []interface{}
+		switch query.sortField() {
+		case SortByName:
+			values = []interface{}{after.Name, after.MType}
+		case SortByUpdatedAt:
+			values = []interface{}{after.UpdatedAt, after.MType, after.Name}
+		default:
+			values = []interface{}{after.MType, after.Name}
+		}
+		placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(values)), ", ")
+		builder = builder.Where(
+			fmt.Sprintf("(%s) %s (%s)", strings.Join(columns, ", "), operator, placeholders), values...,
+		)
+	}
+
+	for _, column := range columns {
+		builder = builder.OrderBy(column + direction)
+	}
+	if query.Limit > 0 {
+		builder = builder.Limit(uint64(query.Limit))
+	}
+	return builder.ToSql()
+}
+
+// DeleteMetric - удаление метрики. Повтор после применённого удаления
+// вернул бы ErrNotFound, поэтому запрос повторяется как запись.
+func (r *MetricsRepositoryHandler) DeleteMetric(ctx context.Context, key domain.MetricKey) error {
+	return r.retryWrite(ctx, func(ctx context.Context) error {
+		query, args, err := cursor.
+			Delete("metrics").
+			Where(sq.Eq{"name": key.Name, "metric_type": key.MType}).
+			ToSql()
+		if err != nil {
+			return fmt.Errorf("build delete metric query: %w", err)
+		}
+
+		result, err := r.db.ExecContext(ctx, query, args...)
+		if err != nil {
+			return fmt.Errorf("delete metric from db: %w", err)
+		}
+		rows, err := result.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("delete metric from db: %w", err)
+		}
+		if rows == 0 {
+			return ErrNotFound
+		}
+		return nil
+	})
+}
+
+// ResetCounter - обнуление Counter.
+func (r *MetricsRepositoryHandler) ResetCounter(ctx context.Context, name string) (domain.Metrics, error) {
+	var result domain.Metrics
+
+	err := r.retry(ctx, func(ctx context.Context) error {
+		query := `
+			UPDATE metrics
+			SET delta = 0,
+				updated_at = now()
+			WHERE name = $1
+			  AND metric_type = 'counter'
+			RETURNING id, name, metric_type, value, delta, updated_at, labels
+		`
+
+		err := r.db.QueryRowxContext(ctx, query, name).StructScan(&result)
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrNotFound
+		}
+		if err != nil {
+			return fmt.Errorf("reset counter in db: %w", err)
+		}
+		return nil
+	})
+
+	return result, err
+}
+
+// BatchUpdateMetrics применяет пачку в одной транзакции SQL: при ошибке
+// изменения откатываются целиком.
+//
+// Метрики передаются массивами через unnest (шесть параметров на запрос
+// независимо от размера пачки) подготовленным выражением upsertBatchSQL.
+// Большие пачки делятся на части по postgresBatchChunkSize метрик.
+//
+// Пачка повторяется, только если ошибка соединения случилась до фиксации
+// транзакции: незафиксированная транзакция откатывается базой. Обрыв во
+// время Commit не повторяется, так как транзакция могла зафиксироваться.
 func (r *MetricsRepositoryHandler) BatchUpdateMetrics(ctx context.Context, metrics []domain.Metrics) error {
 	if len(metrics) == 0 {
 		return nil
 	}
+	if err := validateBatch(metrics); err != nil {
+		return fmt.Errorf("BatchUpdateMetrics: %w", err)
+	}
+	merged := mergeBatch(metrics)
+	chunks := make([][]interface{}, 0, (len(merged)+postgresBatchChunkSize-1)/postgresBatchChunkSize)
+	for start := 0; start < len(merged); start += postgresBatchChunkSize {
+		args, err := batchArrays(merged[start:min(start+postgresBatchChunkSize, len(merged))])
+		if err != nil {
+			return fmt.Errorf("BatchUpdateMetrics: %w", err)
+		}
+		chunks = append(chunks, args)
+	}
 
-	return db.RetryOperation(func() error {
-		var sb strings.Builder
-
-		sb.WriteString(`
-WITH input (name, metric_type, val, delt) AS (
-    VALUES
-`)
+	return r.retryWrite(ctx, func(ctx context.Context) error {
+		stmt, err := r.upsertStmt(ctx)
+		if err != nil {
+			return db.NotApplied(err)
+		}
 
-		args := make([]interface{}, 0, len(metrics)*4)
+		tx, err := r.db.BeginTxx(ctx, nil)
+		if err != nil {
+			return db.NotApplied(fmt.Errorf("BatchUpdateMetrics begin transaction: %w", err))
+		}
+		defer tx.Rollback()
 
-		for i, m := range metrics {
-			if i > 0 {
-				sb.WriteString(",")
+		txStmt := tx.StmtxContext(ctx, stmt)
+		for _, args := range chunks {
+			if _, err = txStmt.ExecContext(ctx, args...); err != nil {
+				return db.NotApplied(fmt.Errorf("BatchUpdateMetrics upsert: %w", err))
 			}
-			placeholderStart := len(args) + 1
-			sb.WriteString(fmt.Sprintf(
-				"($%d::text, $%d::text, $%d::double precision, $%d::bigint)",
-				placeholderStart, placeholderStart+1, placeholderStart+2, placeholderStart+3,
-			))
-
-			args = append(args,
-				m.Name,
-				m.MType,
-				m.Value.Float64,
-				m.Delta.Int64,
-			)
 		}
 
-		sb.WriteString(`
-		),
-		updated AS (
-			UPDATE metrics mt
-			SET
-				value = CASE
-					WHEN i.metric_type = 'gauge' THEN i.val
-					ELSE NULL
-				END,
-				delta = CASE
-					WHEN i.metric_type = 'counter' THEN mt.delta + i.delt
-					ELSE i.delt
-				END
-			FROM input i
-			WHERE mt.name = i.name
-			  AND mt.metric_type = i.metric_type
-			RETURNING mt.*
-		),
-		inserted AS (
-			INSERT INTO metrics (name, metric_type, value, delta)
-			SELECT
-				i.name,
-				i.metric_type,
-				CASE WHEN i.metric_type = 'gauge' THEN i.val ELSE NULL END,
-				CASE WHEN i.metric_type = 'counter' THEN i.delt ELSE NULL END
-			FROM input i
-			WHERE NOT EXISTS (
-				SELECT 1 FROM updated u
-				WHERE u.name = i.name
-				  AND u.metric_type = i.metric_type
-			)
-			RETURNING *
-		)
-		SELECT 1 FROM updated
-		UNION ALL
-		SELECT 1 FROM inserted
-		`)
+		if err = tx.Commit(); err != nil {
+			return fmt.Errorf("BatchUpdateMetrics commit: %w", err)
+		}
+		return nil
+	})
+}
 
-		cteSQL := sb.String()
+// Close освобождает подготовленные выражения. Соединение с базой
+// закрывается отдельно.
+func (r *MetricsRepositoryHandler) Close() error {
+	r.stmtMutex.Lock()
+	defer r.stmtMutex.Unlock()
 
-		if _, err := r.db.ExecContext(ctx, cteSQL, args...); err != nil {
-			return fmt.Errorf("BatchUpdateMetrics CTE error: %w", err)
-		}
+	if r.upsert == nil {
 		return nil
+	}
+	err := r.upsert.Close()
+	r.upsert = nil
+	return err
+}
+
+// upsertStmt подготавливает upsertBatchSQL при первом вызове. Пул
+// database/sql сам подготавливает выражение на каждом соединении.
+func (r *MetricsRepositoryHandler) upsertStmt(ctx context.Context) (*sqlx.Stmt, error) {
+	r.stmtMutex.Lock()
+	defer r.stmtMutex.Unlock()
+
+	if r.upsert != nil {
+		return r.upsert, nil
+	}
+	stmt, err := r.db.PreparexContext(ctx, upsertBatchSQL)
+	if err != nil {
+		return nil, fmt.Errorf("prepare batch upsert: %w", err)
+	}
+	r.upsert = stmt
+	return stmt, nil
+}
+
+// mergeBatch сводит повторы одной метрики в пачке (ON CONFLICT не может
+// изменить строку дважды за запрос): counter суммируется, для gauge остаётся
+// последнее значение, из меток - последние непустые, время обновления
+// берётся наибольшее. Результат упорядочен по ключу, чтобы параллельные
+// транзакции блокировали строки в одном порядке.
+func mergeBatch(metrics []domain.Metrics) []domain.Metrics {
+	byKey := make(map[domain.MetricKey]int, len(metrics))
+	merged := make([]domain.Metrics, 0, len(metrics))
+	for _, m := range metrics {
+		i, ok := byKey[m.Key()]
+		if !ok {
+			byKey[m.Key()] = len(merged)
+			merged = append(merged, m)
+			continue
+		}
+		if m.MType == domain.Counter {
+			merged[i].Delta.Int64 += m.Delta.Int64
+		} else {
+			merged[i].Value = m.Value
+		}
+		merged[i].Labels = merged[i].Labels.Merge(m.Labels)
+		if m.UpdatedAt.After(merged[i].UpdatedAt) {
+			merged[i].UpdatedAt = m.UpdatedAt
+		}
+	}
+
+	sort.Slice(merged, func(i, j int) bool {
+		if merged[i].Name != merged[j].Name {
+			return merged[i].Name < merged[j].Name
+		}
+		return merged[i].MType < merged[j].MType
 	})
+	return merged
+}
+
+// batchArrays раскладывает пачку в массивы параметров upsertBatchSQL. Метки
+// передаются строками JSON.
+func batchArrays(metrics []domain.Metrics) ([]interface{}, error) {
+	names := make([]string, len(metrics))
+	types := make([]string, len(metrics))
+	values := make([]float64, len(metrics))
+	deltas := make([]int64, len(metrics))
+	updated := make([]string, len(metrics))
+	labels := make([]string, len(metrics))
+	for i, m := range metrics {
+		names[i] = m.Name
+		types[i] = m.MType
+		values[i] = m.Value.Float64
+		deltas[i] = m.Delta.Int64
+		if !m.UpdatedAt.IsZero() {
+			updated[i] = m.UpdatedAt.Format(time.RFC3339Nano)
+		}
+		value, err := m.Labels.Value()
+		if err != nil {
+			return nil, fmt.Errorf("metric %s: %w", m.Key(), err)
+		}
+		labels[i] = value.(string)
+	}
+	return []interface{}{
+		pq.Array(names), pq.Array(types), pq.Array(values), pq.Array(deltas), pq.Array(updated), pq.Array(labels),
+	}, nil
 }
@@ -0,0 +1,98 @@
+package repositories
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/guregu/null.v4"
+
+	"github.com/Axel791/metricsalert/internal/server/db"
+	"github.com/Axel791/metricsalert/internal/server/model/domain"
+)
+
+func TestMetricRepository_UnreachableDatabaseIsUnavailable(t *testing.T) {
+	conn, err := sqlx.Open("postgres", "host=127.0.0.1 port=1 user=test dbname=test sslmode=disable connect_timeout=1")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = conn.Close() })
+
+	retrier := db.NewRetrier(db.RetryConfig{
+		MaxAttempts:        2,
+		BaseDelay:          time.Millisecond,
+		MaxDelay:           time.Millisecond,
+		BreakerThreshold:   2,
+		BreakerOpenTimeout: time.Minute,
+	})
+	store := NewMetricRepository(conn, retrier)
+
+	_, err = store.UpdateGauge(context.Background(), "Alloc", 1)
+	assert.ErrorIs(t, err, ErrUnavailable)
+	assert.Equal(t, db.BreakerOpen, retrier.Breaker().State())
+
+	_, err = store.GetMetric(context.Background(), domain.Metrics{Name: "Alloc", MType: domain.Gauge})
+	assert.ErrorIs(t, err, ErrUnavailable)
+	assert.ErrorIs(t, err, db.ErrCircuitOpen)
+}
+
+func TestMergeBatch(t *testing.T) {
+	merged := mergeBatch([]domain.Metrics{
+		{Name: "PollCount", MType: domain.Counter, Delta: null.IntFrom(1), Labels: domain.Labels{"host": "a"}},
+		{Name: "Alloc", MType: domain.Gauge, Value: null.FloatFrom(1)},
+		{Name: "PollCount", MType: domain.Counter, Delta: null.IntFrom(2)},
+		{Name: "PollCount", MType: domain.Gauge, Value: null.FloatFrom(5)},
+		{Name: "Alloc", MType: domain.Gauge, Value: null.FloatFrom(3), Labels: domain.Labels{"host": "b"}},
+	})
+
+	assert.Equal(t, []domain.Metrics{
+		{Name: "Alloc", MType: domain.Gauge, Value: null.FloatFrom(3), Labels: domain.Labels{"host": "b"}},
+		{Name: "PollCount", MType: domain.Counter, Delta: null.IntFrom(3), Labels: domain.Labels{"host": "a"}},
+		{Name: "PollCount", MType: domain.Gauge, Value: null.FloatFrom(5)},
+	}, merged)
+}
+
+func TestBatchArrays(t *testing.T) {
+	updatedAt := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	args, err := batchArrays([]domain.Metrics{
+		{Name: "Alloc", MType: domain.Gauge, Value: null.FloatFrom(1.5), UpdatedAt: updatedAt},
+		{Name: "PollCount", MType: domain.Counter, Delta: null.IntFrom(3), Labels: domain.Labels{"host": "a"}},
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, []interface{}{
+		pq.Array([]string{"Alloc", "PollCount"}),
+		pq.Array([]string{domain.Gauge, domain.Counter}),
+		pq.Array([]float64{1.5, 0}),
+		pq.Array([]int64{0, 3}),
+		pq.Array([]string{"2026-10-19T12:00:00Z", ""}),
+		pq.Array([]string{"{}", `{"host":"a"}`}),
+	}, args)
+}
+
+func TestMetricsQuerySQL(t *testing.T) {
+	updatedAt := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	query, args, err := metricsQuerySQL(MetricsQuery{
+		MType:  domain.Gauge,
+		Prefix: "cpu_",
+		Glob:   "*.total%",
+		Regex:  "^cpu",
+		Labels: domain.Labels{"host": "a"},
+		Sort:   SortByUpdatedAt,
+		Desc:   true,
+		After:  &domain.Metrics{Name: "cpu_1", MType: domain.Gauge, UpdatedAt: updatedAt},
+		Limit:  10,
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, "SELECT id, name, metric_type, value, delta, updated_at, labels FROM metrics"+
+		" WHERE metric_type = $1 AND name LIKE $2 ESCAPE '\\' AND name LIKE $3 ESCAPE '\\' AND name ~ $4"+
+		` AND labels @> $5::jsonb`+
+		` AND (updated_at, metric_type COLLATE "C", name COLLATE "C") < ($6, $7, $8)`+
+		` ORDER BY updated_at DESC, metric_type COLLATE "C" DESC, name COLLATE "C" DESC LIMIT 10`, query)
+	assert.Equal(t, []interface{}{
+		domain.Gauge, `cpu\_%`, `%.total\%`, "^cpu", domain.Labels{"host": "a"}, updatedAt, domain.Gauge, "cpu_1",
+	}, args)
+}
@@ -6,6 +6,7 @@ import (
 	"github.com/stretchr/testify/mock"
 
 	"github.com/Axel791/metricsalert/internal/server/model/domain"
+	"github.com/Axel791/metricsalert/internal/server/repositories"
 )
 
 type MockStore struct {
@@ -37,15 +38,36 @@ func (m *MockStore) GetMetric(ctx context.Context, metric domain.Metrics) (domai
 	return domain.Metrics{}, args.Error(1)
 }
 
-func (m *MockStore) GetAllMetrics(ctx context.Context) (map[string]domain.Metrics, error) {
+func (m *MockStore) GetAllMetrics(ctx context.Context) (map[domain.MetricKey]domain.Metrics, error) {
 	args := m.Called(ctx)
 	if res := args.Get(0); res != nil {
-		return res.(map[string]domain.Metrics), args.Error(1)
+		return res.(map[domain.MetricKey]domain.Metrics), args.Error(1)
 	}
-	return make(map[string]domain.Metrics), args.Error(1)
+	return make(map[domain.MetricKey]domain.Metrics), args.Error(1)
 }
 
 func (m *MockStore) BatchUpdateMetrics(ctx context.Context, metrics []domain.Metrics) error {
 	args := m.Called(ctx, metrics)
 	return args.Error(0)
 }
+
+func (m *MockStore) DeleteMetric(ctx context.Context, key domain.MetricKey) error {
+	args := m.Called(ctx, key)
+	return args.Error(0)
+}
+
+func (m *MockStore) ResetCounter(ctx context.Context, name string) (domain.Metrics, error) {
+	args := m.Called(ctx, name)
+	if res := args.Get(0); res != nil {
+		return res.(domain.Metrics), args.Error(1)
+	}
+	return domain.Metrics{}, args.Error(1)
+}
+
+func (m *MockStore) QueryMetrics(ctx context.Context, query repositories.MetricsQuery) ([]domain.Metrics, error) {
+	args := m.Called(ctx, query)
+	if res := args.Get(0); res != nil {
+		return res.([]domain.Metrics), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
@@ -0,0 +1,136 @@
+package repositories_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+	"gopkg.in/guregu/null.v4"
+
+	"github.com/Axel791/metricsalert/internal/server/db"
+	"github.com/Axel791/metricsalert/internal/server/model/domain"
+	"github.com/Axel791/metricsalert/internal/server/repositories"
+)
+
+// postgresMaxParams - предел числа параметров одного запроса PostgreSQL.
+const postgresMaxParams = 65535
+
+// BenchmarkPostgresBatch сравнивает пачку через unnest с прежним CTE, в
+// котором на каждую метрику приходилось четыре параметра. Запуск:
+//
+//	TEST_DATABASE_DSN=... go test -run='^$' -bench=PostgresBatch ./internal/server/repositories
+func BenchmarkPostgresBatch(b *testing.B) {
+	dsn := os.Getenv(testDatabaseDSNEnv)
+	if dsn == "" {
+		b.Skipf("%s is not set", testDatabaseDSNEnv)
+	}
+
+	conn, err := db.ConnectDB(dsn, filepath.Join("..", "..", "..", "migrations"), db.PoolConfig{})
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(func() { conn.Close() })
+
+	store := repositories.NewMetricRepository(conn, db.NewRetrier(db.DefaultRetryConfig()))
+	b.Cleanup(func() { store.Close() })
+
+	for _, size := range []int{100, 1000, 10000, 50000} {
+		batch := benchBatch(size)
+
+		b.Run(fmt.Sprintf("unnest/size=%d", size), func(b *testing.B) {
+			truncateMetrics(b, conn)
+			ctx := context.Background()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if err := store.BatchUpdateMetrics(ctx, batch); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.ReportMetric(float64(b.N*size)/b.Elapsed().Seconds(), "metrics/s")
+		})
+
+		b.Run(fmt.Sprintf("cte/size=%d", size), func(b *testing.B) {
+			if size*4 > postgresMaxParams {
+				b.Skipf("%d metrics exceed the parameter limit of the CTE query", size)
+			}
+			truncateMetrics(b, conn)
+			ctx := context.Background()
+			query, args := legacyBatchCTE(batch)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := conn.ExecContext(ctx, query, args...); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.ReportMetric(float64(b.N*size)/b.Elapsed().Seconds(), "metrics/s")
+		})
+	}
+}
+
+func truncateMetrics(tb testing.TB, conn *sqlx.DB) {
+	tb.Helper()
+	if _, err := conn.Exec("TRUNCATE TABLE metrics"); err != nil {
+		tb.Fatal(err)
+	}
+}
+
+// benchBatch - пачка из size метрик: половина gauge, половина counter.
+func benchBatch(size int) []domain.Metrics {
+	batch := make([]domain.Metrics, size)
+	for i := range batch {
+		if i%2 == 0 {
+			batch[i] = domain.Metrics{Name: fmt.Sprintf("gauge%d", i), MType: domain.Gauge, Value: null.FloatFrom(float64(i))}
+		} else {
+			batch[i] = domain.Metrics{Name: fmt.Sprintf("counter%d", i), MType: domain.Counter, Delta: null.IntFrom(1)}
+		}
+	}
+	return batch
+}
+
+// legacyBatchCTE воспроизводит запрос, которым пачка сохранялась до перехода
+// на unnest: VALUES с четырьмя параметрами на метрику и UPDATE + INSERT в CTE.
+func legacyBatchCTE(metrics []domain.Metrics) (string, []interface{}) {
+	var sb strings.Builder
+	sb.WriteString(`WITH input (name, metric_type, val, delt) AS (VALUES `)
+
+	args := make([]interface{}, 0, len(metrics)*4)
+	for i, m := range metrics {
+		if i > 0 {
+			sb.WriteString(",")
+		}
+		n := len(args) + 1
+		fmt.Fprintf(&sb, "($%d::text, $%d::text, $%d::double precision, $%d::bigint)", n, n+1, n+2, n+3)
+		args = append(args, m.Name, m.MType, m.Value.Float64, m.Delta.Int64)
+	}
+
+	sb.WriteString(`),
+	updated AS (
+		UPDATE metrics mt
+		SET
+			value = CASE WHEN i.metric_type = 'gauge' THEN i.val ELSE NULL END,
+			delta = CASE WHEN i.metric_type = 'counter' THEN mt.delta + i.delt ELSE i.delt END
+		FROM input i
+		WHERE mt.name = i.name AND mt.metric_type = i.metric_type
+		RETURNING mt.*
+	),
+	inserted AS (
+		INSERT INTO metrics (name, metric_type, value, delta)
+		SELECT
+			i.name,
+			i.metric_type,
+			CASE WHEN i.metric_type = 'gauge' THEN i.val ELSE NULL END,
+			CASE WHEN i.metric_type = 'counter' THEN i.delt ELSE NULL END
+		FROM input i
+		WHERE NOT EXISTS (
+			SELECT 1 FROM updated u WHERE u.name = i.name AND u.metric_type = i.metric_type
+		)
+		RETURNING *
+	)
+	SELECT 1 FROM updated UNION ALL SELECT 1 FROM inserted`)
+
+	return sb.String(), args
+}
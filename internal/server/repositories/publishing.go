@@ -0,0 +1,140 @@
+package repositories
+
+import (
+	"context"
+	"sort"
+
+	"github.com/Axel791/metricsalert/internal/server/model/domain"
+	"github.com/Axel791/metricsalert/internal/server/model/dto"
+	"github.com/Axel791/metricsalert/internal/server/stream"
+	"github.com/Axel791/metricsalert/internal/shared/logging"
+)
+
+// Publisher получает изменения метрик после успешной записи в хранилище
+// (stream.Broker).
+type Publisher interface {
+	Publish(events ...stream.Event)
+	// HasSubscribers сообщает, нужны ли кому-то события; без подписчиков
+	// обёртка не читает значения метрик после записи пачки.
+	HasSubscribers() bool
+}
+
+// PublishingStore оборачивает Store и после каждой успешной записи
+// публикует событие изменения метрики. Через обёртку проходят все записи
+// сервера: API, устаревшие маршруты, удаление устаревших метрик и
+// телеметрия сервера.
+type PublishingStore struct {
+	storeDelegate
+	publisher Publisher
+}
+
+// NewPublishingStore создаёт обёртку над store, публикующую изменения в
+// publisher.
+func NewPublishingStore(store Store, publisher Publisher) *PublishingStore {
+	return &PublishingStore{storeDelegate: storeDelegate{store: store}, publisher: publisher}
+}
+
+func (s *PublishingStore) UpdateGauge(ctx context.Context, name string, value float64) (domain.Metrics, error) {
+	metric, err := s.store.UpdateGauge(ctx, name, value)
+	if err == nil {
+		s.publish(stream.ActionUpdate, toEventMetric(metric))
+	}
+	return metric, err
+}
+
+func (s *PublishingStore) UpdateCounter(ctx context.Context, name string, value int64) (domain.Metrics, error) {
+	metric, err := s.store.UpdateCounter(ctx, name, value)
+	if err == nil {
+		s.publish(stream.ActionUpdate, toEventMetric(metric))
+	}
+	return metric, err
+}
+
+func (s *PublishingStore) GetMetric(ctx context.Context, metric domain.Metrics) (domain.Metrics, error) {
+	return s.store.GetMetric(ctx, metric)
+}
+
+func (s *PublishingStore) GetAllMetrics(ctx context.Context) (map[domain.MetricKey]domain.Metrics, error) {
+	return s.store.GetAllMetrics(ctx)
+}
+
+// BatchUpdateMetrics публикует метрики пачки после записи. Хранилище не
+// возвращает записанные значения (сумму counter, метки, сохранённые с прошлых
+// записей), поэтому метрики перечитываются, но только если у издателя есть
+// подписчики.
+func (s *PublishingStore) BatchUpdateMetrics(ctx context.Context, metrics []domain.Metrics) error {
+	if err := s.store.BatchUpdateMetrics(ctx, metrics); err != nil {
+		return err
+	}
+	if len(metrics) == 0 || !s.publisher.HasSubscribers() {
+		return nil
+	}
+
+	seen := make(map[domain.MetricKey]struct{}, len(metrics))
+	published := make([]dto.Metrics, 0, len(metrics))
+	for _, metric := range metrics {
+		if _, ok := seen[metric.Key()]; ok {
+			continue
+		}
+		seen[metric.Key()] = struct{}{}
+		current, err := s.store.GetMetric(ctx, metric)
+		if err != nil {
+			logging.FromContext(ctx).Warnf("error reading %s %s for the metrics stream: %v", metric.MType, metric.Name, err)
+			continue
+		}
+		published = append(published, toEventMetric(current))
+	}
+	sort.Slice(published, func(i, j int) bool {
+		if published[i].ID != published[j].ID {
+			return published[i].ID < published[j].ID
+		}
+		return published[i].MType < published[j].MType
+	})
+	s.publish(stream.ActionUpdate, published...)
+	return nil
+}
+
+func (s *PublishingStore) DeleteMetric(ctx context.Context, key domain.MetricKey) error {
+	err := s.store.DeleteMetric(ctx, key)
+	if err == nil {
+		s.publish(stream.ActionDelete, dto.Metrics{ID: key.Name, MType: key.MType})
+	}
+	return err
+}
+
+func (s *PublishingStore) ResetCounter(ctx context.Context, name string) (domain.Metrics, error) {
+	metric, err := s.store.ResetCounter(ctx, name)
+	if err == nil {
+		s.publish(stream.ActionReset, toEventMetric(metric))
+	}
+	return metric, err
+}
+
+func (s *PublishingStore) QueryMetrics(ctx context.Context, query MetricsQuery) ([]domain.Metrics, error) {
+	return s.store.QueryMetrics(ctx, query)
+}
+
+// publish отправляет события изменения метрик.
+func (s *PublishingStore) publish(action string, metrics ...dto.Metrics) {
+	if len(metrics) == 0 {
+		return
+	}
+	events := make([]stream.Event, 0, len(metrics))
+	for _, metric := range metrics {
+		events = append(events, stream.Event{Action: action, Metric: metric})
+	}
+	s.publisher.Publish(events...)
+}
+
+// toEventMetric переводит только что записанную метрику в DTO события.
+// Записанная метрика не может быть устаревшей.
+func toEventMetric(metric domain.Metrics) dto.Metrics {
+	return dto.Metrics{
+		ID:        metric.Name,
+		MType:     metric.MType,
+		Delta:     metric.Delta,
+		Value:     metric.Value,
+		UpdatedAt: metric.UpdatedAt,
+		Labels:    metric.Labels,
+	}
+}
@@ -0,0 +1,78 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/guregu/null.v4"
+
+	"github.com/Axel791/metricsalert/internal/server/model/domain"
+	"github.com/Axel791/metricsalert/internal/server/model/dto"
+	"github.com/Axel791/metricsalert/internal/server/stream"
+)
+
+func TestPublishingStore(t *testing.T) {
+	ctx := context.Background()
+	broker := stream.NewBroker(16, nil)
+	store := NewPublishingStore(NewMetricMapRepository(), broker)
+
+	// Без подписчиков пачка не перечитывается и события некому получать.
+	require.NoError(t, store.BatchUpdateMetrics(ctx, []domain.Metrics{
+		{Name: "Requests", MType: domain.Counter, Delta: null.IntFrom(2)},
+	}))
+
+	sub, err := broker.Subscribe(stream.Filter{})
+	require.NoError(t, err)
+	defer sub.Close()
+
+	_, err = store.UpdateGauge(ctx, "Alloc", 2.5)
+	require.NoError(t, err)
+	_, err = store.ResetCounter(ctx, "Missing")
+	require.ErrorIs(t, err, ErrNotFound)
+	require.NoError(t, store.BatchUpdateMetrics(ctx, []domain.Metrics{
+		{Name: "Requests", MType: domain.Counter, Delta: null.IntFrom(3)},
+		{Name: "Requests", MType: domain.Counter, Delta: null.IntFrom(3)},
+		{Name: "Heap", MType: domain.Gauge, Value: null.FloatFrom(1)},
+		{Name: "Heap", MType: domain.Gauge, Value: null.FloatFrom(2.5)},
+	}))
+	_, err = store.UpdateCounter(ctx, "Requests", 1)
+	require.NoError(t, err)
+	_, err = store.ResetCounter(ctx, "Requests")
+	require.NoError(t, err)
+	require.NoError(t, store.DeleteMetric(ctx, domain.MetricKey{Name: "Alloc", MType: domain.Gauge}))
+	require.ErrorIs(t, store.DeleteMetric(ctx, domain.MetricKey{Name: "Alloc", MType: domain.Gauge}), ErrNotFound)
+
+	var got []string
+	for len(got) < 6 {
+		select {
+		case event := <-sub.Events():
+			got = append(got, fmt.Sprintf("%s %s/%s %s", event.Action, event.Metric.MType, event.Metric.ID, metricText(event.Metric)))
+		case <-time.After(time.Second):
+			t.Fatalf("missing events, got %v", got)
+		}
+	}
+	assert.Equal(t, []string{
+		"update gauge/Alloc 2.5",
+		"update gauge/Heap 2.5",
+		"update counter/Requests 8",
+		"update counter/Requests 9",
+		"reset counter/Requests 0",
+		"delete gauge/Alloc -",
+	}, got)
+	assert.Empty(t, sub.Events())
+}
+
+func metricText(metric dto.Metrics) string {
+	switch {
+	case metric.Delta.Valid:
+		return fmt.Sprint(metric.Delta.Int64)
+	case metric.Value.Valid:
+		return fmt.Sprint(metric.Value.Float64)
+	default:
+		return "-"
+	}
+}
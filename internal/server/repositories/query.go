@@ -0,0 +1,209 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/Axel791/metricsalert/internal/server/model/domain"
+)
+
+// Поля сортировки MetricsQuery. Метрики с равным значением поля
+// упорядочиваются по оставшимся полям ключа, поэтому порядок всегда полный.
+const (
+	// SortByName - по имени, затем по типу.
+	SortByName = "name"
+	// SortByType - по типу, затем по имени.
+	SortByType = "type"
+	// SortByUpdatedAt - по времени обновления, затем по типу и имени.
+	SortByUpdatedAt = "updated_at"
+)
+
+// MetricsQuery - выборка метрик для QueryMetrics. Условия фильтра
+// объединяются через «и», пустое условие не ограничивает выборку.
+type MetricsQuery struct {
+	// MType - тип метрики.
+	MType string
+	// Prefix - начало имени метрики.
+	Prefix string
+	// Glob - шаблон имени целиком: * - любые символы, ? - один символ,
+	// остальные символы сравниваются как есть.
+	Glob string
+	// Regex - регулярное выражение, которому должна соответствовать часть
+	// имени. Используйте синтаксис, общий для Go (RE2) и PostgreSQL (POSIX).
+	Regex string
+	// Labels - метки, которые должны быть у метрики (все пары сразу).
+	Labels domain.Labels
+
+	// Sort - поле сортировки, одна из констант SortBy*; пусто - SortByType.
+	Sort string
+	// Desc - сортировка по убыванию.
+	Desc bool
+	// After - последняя метрика предыдущей страницы: выбираются только
+	// метрики, идущие после неё в порядке сортировки.
+	After *domain.Metrics
+	// Limit - наибольшее число метрик в ответе, 0 - без ограничения.
+	Limit int
+}
+
+// sortField возвращает поле сортировки с учётом значения по умолчанию.
+func (q MetricsQuery) sortField() string {
+	if q.Sort == "" {
+		return SortByType
+	}
+	return q.Sort
+}
+
+// Validate проверяет поле сортировки, выражения и метки фильтра.
+func (q MetricsQuery) Validate() error {
+	switch q.sortField() {
+	case SortByName, SortByType, SortByUpdatedAt:
+	default:
+		return fmt.Errorf("%w: unknown sort field %q", ErrInvalidQuery, q.Sort)
+	}
+	if q.Regex != "" {
+		if _, err := regexp.Compile(q.Regex); err != nil {
+			return fmt.Errorf("%w: invalid regex: %w", ErrInvalidQuery, err)
+		}
+	}
+	for key := range q.Labels {
+		if key == "" {
+			return fmt.Errorf("%w: empty label name", ErrInvalidQuery)
+		}
+	}
+	if q.Limit < 0 {
+		return fmt.Errorf("%w: negative limit", ErrInvalidQuery)
+	}
+	return nil
+}
+
+// compare сравнивает метрики в порядке сортировки запроса по возрастанию.
+func (q MetricsQuery) compare(a, b domain.Metrics) int {
+	byName := func() int {
+		if c := strings.Compare(a.Name, b.Name); c != 0 {
+			return c
+		}
+		return strings.Compare(a.MType, b.MType)
+	}
+	byType := func() int {
+		if c := strings.Compare(a.MType, b.MType); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Name, b.Name)
+	}
+
+	switch q.sortField() {
+	case SortByName:
+		return byName()
+	case SortByUpdatedAt:
+		if c := a.UpdatedAt.Compare(b.UpdatedAt); c != 0 {
+			return c
+		}
+		return byType()
+	default:
+		return byType()
+	}
+}
+
+// queryMetrics выполняет запрос над метриками в памяти. Используется
+// хранилищами, которые держат все метрики в памяти или на локальном диске.
+func queryMetrics(metrics map[domain.MetricKey]domain.Metrics, q MetricsQuery) ([]domain.Metrics, error) {
+	if err := q.Validate(); err != nil {
+		return nil, err
+	}
+	var (
+		glob  *regexp.Regexp
+		regex *regexp.Regexp
+	)
+	if q.Glob != "" {
+		glob = globRegexp(q.Glob)
+	}
+	if q.Regex != "" {
+		regex = regexp.MustCompile(q.Regex)
+	}
+
+	result := make([]domain.Metrics, 0, len(metrics))
+	for _, metric := range metrics {
+		switch {
+		case q.MType != "" && metric.MType != q.MType,
+			!strings.HasPrefix(metric.Name, q.Prefix),
+			glob != nil && !glob.MatchString(metric.Name),
+			regex != nil && !regex.MatchString(metric.Name),
+			!metric.Labels.Contains(q.Labels):
+			continue
+		}
+		if q.After != nil {
+			c := q.compare(metric, *q.After)
+			if (!q.Desc && c <= 0) || (q.Desc && c >= 0) {
+				continue
+			}
+		}
+		result = append(result, metric)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		c := q.compare(result[i], result[j])
+		if q.Desc {
+			return c > 0
+		}
+		return c < 0
+	})
+	if q.Limit > 0 && len(result) > q.Limit {
+		result = result[:q.Limit]
+	}
+	return result, nil
+}
+
+// queryAll выполняет запрос над всеми метриками store.
+func queryAll(ctx context.Context, store Store, q MetricsQuery) ([]domain.Metrics, error) {
+	metrics, err := store.GetAllMetrics(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return queryMetrics(metrics, q)
+}
+
+// globRegexp переводит шаблон MetricsQuery.Glob в регулярное выражение.
+func globRegexp(glob string) *regexp.Regexp {
+	var pattern strings.Builder
+	pattern.WriteString("^")
+	for _, r := range glob {
+		switch r {
+		case '*':
+			pattern.WriteString(".*")
+		case '?':
+			pattern.WriteString(".")
+		default:
+			pattern.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	pattern.WriteString("$")
+	return regexp.MustCompile(pattern.String())
+}
+
+// globLike переводит шаблон MetricsQuery.Glob в шаблон LIKE с экранированием
+// символом '\'.
+func globLike(glob string) string {
+	var pattern strings.Builder
+	for _, r := range glob {
+		switch r {
+		case '*':
+			pattern.WriteByte('%')
+		case '?':
+			pattern.WriteByte('_')
+		case '%', '_', '\\':
+			pattern.WriteByte('\\')
+			pattern.WriteRune(r)
+		default:
+			pattern.WriteRune(r)
+		}
+	}
+	return pattern.String()
+}
+
+// escapeLike экранирует спецсимволы LIKE в s.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
@@ -2,11 +2,16 @@ package repositories
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"io"
 	"time"
 
 	"github.com/jmoiron/sqlx"
 
+	"github.com/Axel791/metricsalert/internal/server/db"
 	"github.com/Axel791/metricsalert/internal/server/model/domain"
+	"github.com/Axel791/metricsalert/internal/server/telemetry"
 )
 
 type StoreOptions struct {
@@ -14,27 +19,174 @@ type StoreOptions struct {
 	RestoreFromFile bool
 	StoreInterval   time.Duration
 	UseFileStore    bool
+	// BoltPath - файл встроенной базы BoltDB. Используется, если не задано
+	// подключение к PostgreSQL.
+	BoltPath string
+	// DBRetrier - повторы запросов к PostgreSQL и автомат защиты. Один на
+	// подключение: тот же retrier передаётся истории метрик.
+	DBRetrier *db.Retrier
+	// Fallback - хранилище, используемое вместо PostgreSQL, если подключиться
+	// к базе при старте не удалось.
+	Fallback *FallbackStore
+	// History - история значений метрик; nil отключает её запись.
+	History History
+	// Publisher получает изменения метрик после записи; nil отключает
+	// публикацию.
+	Publisher Publisher
+	// Telemetry - метрики сервера; nil отключает инструментирование.
+	Telemetry *telemetry.ServerMetrics
 }
 
+// ErrNotFound возвращается из GetMetric, если метрики с таким именем и
+// типом нет в хранилище.
+var ErrNotFound = errors.New("metric not found")
+
+// ErrInvalidMetric возвращается из BatchUpdateMetrics, если метрику в пачке
+// нельзя сохранить (например, неизвестен тип).
+var ErrInvalidMetric = errors.New("invalid metric")
+
+// ErrUnavailable возвращается, если хранилище временно недоступно (например,
+// база не отвечает или разомкнут автомат защиты) и запрос стоит повторить позже.
+var ErrUnavailable = errors.New("store is temporarily unavailable")
+
+// ErrInvalidQuery возвращается из QueryMetrics, если запрос некорректен:
+// неизвестное поле сортировки, ошибка в регулярном выражении и т.п.
+var ErrInvalidQuery = errors.New("invalid metrics query")
+
+// Store - хранилище метрик. Все реализации обязаны вести себя одинаково;
+// общие требования проверяются набором тестов из пакета storetest.
+//
+// BatchUpdateMetrics транзакционен: пачка применяется целиком или не
+// применяется вовсе, а читатели не видят её частично применённой.
+//
+// Каждая запись ставит метрике UpdatedAt. BatchUpdateMetrics сохраняет
+// UpdatedAt из пачки, если оно задано (восстановление из файла, перенос
+// буфера резервного режима), остальные методы ставят текущее время.
 type Store interface {
 	UpdateGauge(ctx context.Context, name string, value float64) (domain.Metrics, error)
 	UpdateCounter(ctx context.Context, name string, value int64) (domain.Metrics, error)
 	GetMetric(ctx context.Context, metric domain.Metrics) (domain.Metrics, error)
-	GetAllMetrics(ctx context.Context) (map[string]domain.Metrics, error)
+	GetAllMetrics(ctx context.Context) (map[domain.MetricKey]domain.Metrics, error)
 	BatchUpdateMetrics(ctx context.Context, metrics []domain.Metrics) error
+	// DeleteMetric удаляет метрику key. Если её нет, возвращается ErrNotFound.
+	DeleteMetric(ctx context.Context, key domain.MetricKey) error
+	// ResetCounter обнуляет counter name и возвращает его. Если такого
+	// counter нет, возвращается ErrNotFound.
+	ResetCounter(ctx context.Context, name string) (domain.Metrics, error)
+	// QueryMetrics возвращает метрики, подходящие под фильтр запроса, в
+	// порядке его сортировки. Некорректный запрос - ErrInvalidQuery.
+	QueryMetrics(ctx context.Context, query MetricsQuery) ([]domain.Metrics, error)
+}
+
+// Flusher реализуется хранилищами, которым нужно сбросить состояние
+// на диск перед остановкой сервера.
+type Flusher interface {
+	Flush(ctx context.Context) error
+}
+
+// IntervalSetter реализуется хранилищами с периодическим сохранением,
+// интервал которого можно поменять при перезагрузке конфигурации.
+type IntervalSetter interface {
+	SetStoreInterval(storeInterval time.Duration)
+}
+
+// storeDelegate передаёт Flush, SetStoreInterval и Close обёрнутому
+// хранилищу, если оно их поддерживает. Встраивается в обёртки над Store.
+type storeDelegate struct {
+	store Store
+}
+
+// Flush передаёт вызов обёрнутому хранилищу, если оно умеет сохраняться.
+func (d storeDelegate) Flush(ctx context.Context) error {
+	if flusher, ok := d.store.(Flusher); ok {
+		return flusher.Flush(ctx)
+	}
+	return nil
+}
+
+// SetStoreInterval передаёт вызов обёрнутому хранилищу, если оно его поддерживает.
+func (d storeDelegate) SetStoreInterval(storeInterval time.Duration) {
+	if setter, ok := d.store.(IntervalSetter); ok {
+		setter.SetStoreInterval(storeInterval)
+	}
 }
 
-func StoreFactory(ctx context.Context, db *sqlx.DB, opts StoreOptions) (Store, error) {
+// Close закрывает обёрнутое хранилище, если ему это нужно.
+func (d storeDelegate) Close() error {
+	if closer, ok := d.store.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// validateBatch проверяет всю пачку до начала записи, чтобы хранилища не
+// откатывали изменения из-за заведомо некорректных метрик.
+func validateBatch(metrics []domain.Metrics) error {
+	for _, metric := range metrics {
+		if metric.MType != domain.Gauge && metric.MType != domain.Counter {
+			return fmt.Errorf("%w: unknown metric type %s for metric %s", ErrInvalidMetric, metric.MType, metric.Name)
+		}
+	}
+	return nil
+}
+
+// updatedAt возвращает время обновления для записи метрики: заданное в
+// самой метрике или текущее.
+func updatedAt(metric domain.Metrics) time.Time {
+	if metric.UpdatedAt.IsZero() {
+		return time.Now()
+	}
+	return metric.UpdatedAt
+}
+
+func StoreFactory(ctx context.Context, conn *sqlx.DB, opts StoreOptions) (Store, error) {
 	var store Store
+	backend := BackendMemory
 
-	if db != nil {
-		store = NewMetricRepository(db)
-	} else {
+	switch {
+	case conn != nil:
+		retrier := opts.DBRetrier
+		if retrier == nil {
+			retrier = db.NewRetrier(db.DefaultRetryConfig())
+		}
+		store = NewMetricRepository(conn, retrier)
+		backend = BackendPostgres
+	case opts.Fallback != nil:
+		store = opts.Fallback
+		backend = BackendPostgres
+	case opts.BoltPath != "":
+		boltStore, err := NewBoltStore(opts.BoltPath)
+		if err != nil {
+			return nil, err
+		}
+		store = boltStore
+		backend = BackendBolt
+	default:
 		store = NewMetricMapRepository()
 	}
 
-	if opts.UseFileStore {
-		return NewFileStore(ctx, store, opts.FilePath, opts.RestoreFromFile, opts.StoreInterval)
+	// BoltDB сам сохраняет данные на диск, файловая обёртка ему не нужна.
+	if opts.UseFileStore && backend != BackendBolt {
+		fileStore, err := NewFileStore(
+			ctx, store, opts.FilePath, opts.RestoreFromFile, opts.StoreInterval, opts.Telemetry,
+		)
+		if err != nil {
+			return nil, err
+		}
+		store = fileStore
+		backend = BackendFile
+	}
+
+	if opts.History != nil {
+		store = NewHistoryRecorder(store, opts.History)
+	}
+
+	if opts.Publisher != nil {
+		store = NewPublishingStore(store, opts.Publisher)
+	}
+
+	if opts.Telemetry != nil {
+		store = NewInstrumentedStore(store, backend, opts.Telemetry)
 	}
 	return store, nil
 }
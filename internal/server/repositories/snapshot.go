@@ -0,0 +1,120 @@
+package repositories
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/Axel791/metricsalert/internal/server/model/domain"
+	"github.com/Axel791/metricsalert/internal/shared/fileutil"
+)
+
+// snapshotVersion - версия формата файла снимка.
+//
+// Версии формата:
+//   - без версии: JSON-объект "имя -> метрика" (до появления журнала);
+//   - 1: {"version":1,"seq":N,"metrics":{"имя": метрика}};
+//   - 2: {"version":2,"seq":N,"metrics":[метрика, ...]} - список, так как
+//     метрики с одним именем и разными типами различаются.
+//
+// Файлы старых версий читаются и переписываются в текущую при следующем снимке.
+const snapshotVersion = 2
+
+// snapshot - содержимое файла снимка. Seq - номер последней записи
+// журнала, уже учтённой в Metrics.
+type snapshot struct {
+	Version int              `json:"version"`
+	Seq     uint64           `json:"seq"`
+	Metrics []domain.Metrics `json:"metrics"`
+}
+
+// snapshotV1 - снимок версии 1, в которой метрики хранились по имени.
+type snapshotV1 struct {
+	Seq     uint64                    `json:"seq"`
+	Metrics map[string]domain.Metrics `json:"metrics"`
+}
+
+// readSnapshot читает снимок любой поддерживаемой версии. Отсутствие
+// файла - не ошибка, в этом случае возвращается nil.
+func readSnapshot(path string) (*snapshot, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var fields map[string]json.RawMessage
+	if err = json.Unmarshal(data, &fields); err != nil {
+		return nil, fmt.Errorf("decode snapshot %q: %w", path, err)
+	}
+
+	var version int
+	if raw, ok := fields["version"]; !ok || json.Unmarshal(raw, &version) != nil {
+		// Старый формат: у метрики с именем "version" значение - объект, а не число.
+		var legacy map[string]domain.Metrics
+		if err = json.Unmarshal(data, &legacy); err != nil {
+			return nil, fmt.Errorf("decode snapshot %q: %w", path, err)
+		}
+		return &snapshot{Metrics: metricsFromNameMap(legacy)}, nil
+	}
+
+	switch version {
+	case 1:
+		var v1 snapshotV1
+		if err = json.Unmarshal(data, &v1); err != nil {
+			return nil, fmt.Errorf("decode snapshot %q: %w", path, err)
+		}
+		return &snapshot{Seq: v1.Seq, Metrics: metricsFromNameMap(v1.Metrics)}, nil
+	case snapshotVersion:
+		var snap snapshot
+		if err = json.Unmarshal(data, &snap); err != nil {
+			return nil, fmt.Errorf("decode snapshot %q: %w", path, err)
+		}
+		return &snap, nil
+	default:
+		return nil, fmt.Errorf("snapshot %q has unsupported version %d", path, version)
+	}
+}
+
+// metricsFromNameMap переводит метрики старых версий (по имени) в список.
+// Имя берётся из ключа: в самых старых файлах поле Name могло быть пустым.
+func metricsFromNameMap(byName map[string]domain.Metrics) []domain.Metrics {
+	metrics := make([]domain.Metrics, 0, len(byName))
+	for name, metric := range byName {
+		metric.Name = name
+		metrics = append(metrics, metric)
+	}
+	return metrics
+}
+
+// snapshotFromMap строит снимок из метрик хранилища в стабильном порядке.
+func snapshotFromMap(seq uint64, all map[domain.MetricKey]domain.Metrics) snapshot {
+	metrics := make([]domain.Metrics, 0, len(all))
+	for _, metric := range all {
+		metrics = append(metrics, metric)
+	}
+	sort.Slice(metrics, func(i, j int) bool {
+		if metrics[i].Name != metrics[j].Name {
+			return metrics[i].Name < metrics[j].Name
+		}
+		return metrics[i].MType < metrics[j].MType
+	})
+	return snapshot{Seq: seq, Metrics: metrics}
+}
+
+// writeSnapshot атомарно заменяет файл снимка.
+func writeSnapshot(path string, snap snapshot) error {
+	snap.Version = snapshotVersion
+	data, err := json.Marshal(snap)
+	if err != nil {
+		return fmt.Errorf("encode snapshot: %w", err)
+	}
+	if err = fileutil.WriteFileAtomic(path, data); err != nil {
+		return fmt.Errorf("write snapshot %q: %w", path, err)
+	}
+	return nil
+}
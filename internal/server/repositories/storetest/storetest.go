@@ -0,0 +1,749 @@
+// Package storetest содержит общий набор тестов, которому должна
+// соответствовать каждая реализация repositories.Store.
+//
+// Использование в тестах бэкенда:
+//
+//	storetest.Run(t, func(t *testing.T) storetest.Backend {
+//		return storetest.Backend{Store: repositories.NewMetricMapRepository()}
+//	})
+package storetest
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/guregu/null.v4"
+
+	"github.com/Axel791/metricsalert/internal/server/model/domain"
+	"github.com/Axel791/metricsalert/internal/server/repositories"
+)
+
+// Backend - экземпляр хранилища для одного теста.
+type Backend struct {
+	// Store - пустое хранилище.
+	Store repositories.Store
+	// Reopen закрывает Store и открывает его заново поверх тех же данных,
+	// как при перезапуске сервера. nil для хранилищ без сохранения на диск.
+	Reopen func(t *testing.T) repositories.Store
+}
+
+// Factory создаёт новый пустой Backend. Освобождение ресурсов регистрируется
+// через t.Cleanup.
+type Factory func(t *testing.T) Backend
+
+// Run запускает все проверки набора для хранилища, создаваемого factory.
+func Run(t *testing.T, factory Factory) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, b Backend)
+	}{
+		{"GaugeSetAndGet", testGaugeSetAndGet},
+		{"GaugeOverwrite", testGaugeOverwrite},
+		{"CounterAccumulates", testCounterAccumulates},
+		{"GetMissing", testGetMissing},
+		{"GetRespectsType", testGetRespectsType},
+		{"GetAllMetrics", testGetAllMetrics},
+		{"SameNameDifferentTypes", testSameNameDifferentTypes},
+		{"BatchUpdate", testBatchUpdate},
+		{"BatchEmpty", testBatchEmpty},
+		{"BatchInvalidType", testBatchInvalidType},
+		{"BatchIsAtomic", testBatchIsAtomic},
+		{"BatchDuplicates", testBatchDuplicates},
+		{"LargeBatch", testLargeBatch},
+		{"ConcurrentUpdates", testConcurrentUpdates},
+		{"GetAllReturnsCopy", testGetAllReturnsCopy},
+		{"Persistence", testPersistence},
+		{"DeleteMetric", testDeleteMetric},
+		{"DeleteMissing", testDeleteMissing},
+		{"ResetCounter", testResetCounter},
+		{"ResetMissing", testResetMissing},
+		{"DeleteAndResetPersist", testDeleteAndResetPersist},
+		{"UpdatedAtOnWrite", testUpdatedAtOnWrite},
+		{"BatchKeepsUpdatedAt", testBatchKeepsUpdatedAt},
+		{"UpdatedAtPersists", testUpdatedAtPersists},
+		{"LabelsOnWrite", testLabelsOnWrite},
+		{"LabelsPersist", testLabelsPersist},
+		{"QueryFilters", testQueryFilters},
+		{"QuerySortAndPages", testQuerySortAndPages},
+		{"QueryInvalid", testQueryInvalid},
+		{"QueryLabels", testQueryLabels},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.fn(t, factory(t))
+		})
+	}
+}
+
+func testGaugeSetAndGet(t *testing.T, b Backend) {
+	ctx := context.Background()
+
+	updated, err := b.Store.UpdateGauge(ctx, "Alloc", 1.5)
+	require.NoError(t, err)
+	assertGauge(t, updated, "Alloc", 1.5)
+
+	got, err := b.Store.GetMetric(ctx, domain.Metrics{Name: "Alloc", MType: domain.Gauge})
+	require.NoError(t, err)
+	assertGauge(t, got, "Alloc", 1.5)
+}
+
+func testGaugeOverwrite(t *testing.T, b Backend) {
+	ctx := context.Background()
+
+	_, err := b.Store.UpdateGauge(ctx, "Alloc", 1.5)
+	require.NoError(t, err)
+	updated, err := b.Store.UpdateGauge(ctx, "Alloc", -3)
+	require.NoError(t, err)
+	assertGauge(t, updated, "Alloc", -3)
+
+	got, err := b.Store.GetMetric(ctx, domain.Metrics{Name: "Alloc", MType: domain.Gauge})
+	require.NoError(t, err)
+	assertGauge(t, got, "Alloc", -3)
+}
+
+func testCounterAccumulates(t *testing.T, b Backend) {
+	ctx := context.Background()
+
+	updated, err := b.Store.UpdateCounter(ctx, "PollCount", 2)
+	require.NoError(t, err)
+	assertCounter(t, updated, "PollCount", 2)
+
+	updated, err = b.Store.UpdateCounter(ctx, "PollCount", 3)
+	require.NoError(t, err)
+	assertCounter(t, updated, "PollCount", 5)
+
+	got, err := b.Store.GetMetric(ctx, domain.Metrics{Name: "PollCount", MType: domain.Counter})
+	require.NoError(t, err)
+	assertCounter(t, got, "PollCount", 5)
+}
+
+func testGetMissing(t *testing.T, b Backend) {
+	_, err := b.Store.GetMetric(context.Background(), domain.Metrics{Name: "missing", MType: domain.Gauge})
+	assert.ErrorIs(t, err, repositories.ErrNotFound)
+}
+
+func testGetRespectsType(t *testing.T, b Backend) {
+	ctx := context.Background()
+
+	_, err := b.Store.UpdateGauge(ctx, "Alloc", 1.5)
+	require.NoError(t, err)
+
+	_, err = b.Store.GetMetric(ctx, domain.Metrics{Name: "Alloc", MType: domain.Counter})
+	assert.ErrorIs(t, err, repositories.ErrNotFound)
+}
+
+func testGetAllMetrics(t *testing.T, b Backend) {
+	ctx := context.Background()
+
+	all, err := b.Store.GetAllMetrics(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, all)
+
+	_, err = b.Store.UpdateGauge(ctx, "Alloc", 1.5)
+	require.NoError(t, err)
+	_, err = b.Store.UpdateCounter(ctx, "PollCount", 7)
+	require.NoError(t, err)
+
+	all, err = b.Store.GetAllMetrics(ctx)
+	require.NoError(t, err)
+	require.Len(t, all, 2)
+	assertGauge(t, all[gaugeKey("Alloc")], "Alloc", 1.5)
+	assertCounter(t, all[counterKey("PollCount")], "PollCount", 7)
+}
+
+func testSameNameDifferentTypes(t *testing.T, b Backend) {
+	ctx := context.Background()
+
+	_, err := b.Store.UpdateGauge(ctx, "Requests", 0.5)
+	require.NoError(t, err)
+	_, err = b.Store.UpdateCounter(ctx, "Requests", 2)
+	require.NoError(t, err)
+	require.NoError(t, b.Store.BatchUpdateMetrics(ctx, []domain.Metrics{
+		counter("Requests", 3),
+		gauge("Requests", 1.5),
+	}))
+
+	got, err := b.Store.GetMetric(ctx, domain.Metrics{Name: "Requests", MType: domain.Gauge})
+	require.NoError(t, err)
+	assertGauge(t, got, "Requests", 1.5)
+
+	got, err = b.Store.GetMetric(ctx, domain.Metrics{Name: "Requests", MType: domain.Counter})
+	require.NoError(t, err)
+	assertCounter(t, got, "Requests", 5)
+
+	all, err := b.Store.GetAllMetrics(ctx)
+	require.NoError(t, err)
+	require.Len(t, all, 2)
+	assertGauge(t, all[gaugeKey("Requests")], "Requests", 1.5)
+	assertCounter(t, all[counterKey("Requests")], "Requests", 5)
+}
+
+func testBatchUpdate(t *testing.T, b Backend) {
+	ctx := context.Background()
+
+	_, err := b.Store.UpdateCounter(ctx, "PollCount", 1)
+	require.NoError(t, err)
+
+	require.NoError(t, b.Store.BatchUpdateMetrics(ctx, []domain.Metrics{
+		counter("PollCount", 2),
+		gauge("Alloc", 1),
+		counter("Requests", 4),
+	}))
+	require.NoError(t, b.Store.BatchUpdateMetrics(ctx, []domain.Metrics{
+		counter("PollCount", 3),
+		gauge("Alloc", 2.5),
+	}))
+
+	all, err := b.Store.GetAllMetrics(ctx)
+	require.NoError(t, err)
+	require.Len(t, all, 3)
+	assertCounter(t, all[counterKey("PollCount")], "PollCount", 6)
+	assertGauge(t, all[gaugeKey("Alloc")], "Alloc", 2.5)
+	assertCounter(t, all[counterKey("Requests")], "Requests", 4)
+}
+
+func testBatchEmpty(t *testing.T, b Backend) {
+	ctx := context.Background()
+
+	require.NoError(t, b.Store.BatchUpdateMetrics(ctx, nil))
+
+	all, err := b.Store.GetAllMetrics(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, all)
+}
+
+func testBatchInvalidType(t *testing.T, b Backend) {
+	err := b.Store.BatchUpdateMetrics(context.Background(), []domain.Metrics{
+		{Name: "Broken", MType: "histogram", Value: null.FloatFrom(1)},
+	})
+	assert.Error(t, err)
+}
+
+func testBatchDuplicates(t *testing.T, b Backend) {
+	ctx := context.Background()
+
+	require.NoError(t, b.Store.BatchUpdateMetrics(ctx, []domain.Metrics{
+		counter("PollCount", 1),
+		gauge("Alloc", 1),
+		counter("PollCount", 2),
+		gauge("Alloc", 3),
+	}))
+
+	all, err := b.Store.GetAllMetrics(ctx)
+	require.NoError(t, err)
+	require.Len(t, all, 2)
+	assertCounter(t, all[counterKey("PollCount")], "PollCount", 3)
+	assertGauge(t, all[gaugeKey("Alloc")], "Alloc", 3)
+}
+
+// testLargeBatch проверяет пачку больше предела параметров одного запроса
+// PostgreSQL при четырёх параметрах на метрику.
+func testLargeBatch(t *testing.T, b Backend) {
+	const size = 20000
+	ctx := context.Background()
+
+	batch := make([]domain.Metrics, size)
+	for i := range batch {
+		batch[i] = gauge(fmt.Sprintf("Gauge%d", i), float64(i))
+	}
+	require.NoError(t, b.Store.BatchUpdateMetrics(ctx, batch))
+
+	all, err := b.Store.GetAllMetrics(ctx)
+	require.NoError(t, err)
+	require.Len(t, all, size)
+	assertGauge(t, all[gaugeKey("Gauge19999")], "Gauge19999", 19999)
+}
+
+func testBatchIsAtomic(t *testing.T, b Backend) {
+	ctx := context.Background()
+
+	_, err := b.Store.UpdateCounter(ctx, "PollCount", 1)
+	require.NoError(t, err)
+
+	err = b.Store.BatchUpdateMetrics(ctx, []domain.Metrics{
+		counter("PollCount", 10),
+		gauge("Alloc", 1),
+		{Name: "Broken", MType: "histogram", Value: null.FloatFrom(1)},
+	})
+	require.ErrorIs(t, err, repositories.ErrInvalidMetric)
+
+	check := func(store repositories.Store) {
+		all, err := store.GetAllMetrics(ctx)
+		require.NoError(t, err)
+		require.Len(t, all, 1, "failed batch must not be applied partially")
+		assertCounter(t, all[counterKey("PollCount")], "PollCount", 1)
+	}
+	check(b.Store)
+	if b.Reopen != nil {
+		check(b.Reopen(t))
+	}
+}
+
+// testConcurrentUpdates имитирует нескольких агентов, одновременно
+// отправляющих пачки. Имеет смысл прежде всего под -race.
+func testConcurrentUpdates(t *testing.T, b Backend) {
+	const (
+		agents  = 8
+		batches = 10
+	)
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, agents)
+	for agent := 0; agent < agents; agent++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < batches; i++ {
+				err := b.Store.BatchUpdateMetrics(ctx, []domain.Metrics{
+					counter("PollCount", 1),
+					gauge(fmt.Sprintf("Agent%d", agent), float64(i)),
+				})
+				if err != nil {
+					errs <- err
+					return
+				}
+				if _, err = b.Store.GetAllMetrics(ctx); err != nil {
+					errs <- err
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		require.NoError(t, err)
+	}
+
+	all, err := b.Store.GetAllMetrics(ctx)
+	require.NoError(t, err)
+	require.Len(t, all, agents+1)
+	assertCounter(t, all[counterKey("PollCount")], "PollCount", agents*batches)
+	for agent := 0; agent < agents; agent++ {
+		name := fmt.Sprintf("Agent%d", agent)
+		assertGauge(t, all[gaugeKey(name)], name, batches-1)
+	}
+}
+
+func testGetAllReturnsCopy(t *testing.T, b Backend) {
+	ctx := context.Background()
+
+	_, err := b.Store.UpdateGauge(ctx, "Alloc", 1.5)
+	require.NoError(t, err)
+
+	all, err := b.Store.GetAllMetrics(ctx)
+	require.NoError(t, err)
+	all[gaugeKey("Alloc")] = gauge("Alloc", 100)
+	all[gaugeKey("Injected")] = gauge("Injected", 1)
+
+	got, err := b.Store.GetMetric(ctx, domain.Metrics{Name: "Alloc", MType: domain.Gauge})
+	require.NoError(t, err)
+	assertGauge(t, got, "Alloc", 1.5)
+	_, err = b.Store.GetMetric(ctx, domain.Metrics{Name: "Injected", MType: domain.Gauge})
+	assert.ErrorIs(t, err, repositories.ErrNotFound)
+}
+
+func testPersistence(t *testing.T, b Backend) {
+	if b.Reopen == nil {
+		t.Skip("backend does not persist data")
+	}
+	ctx := context.Background()
+
+	_, err := b.Store.UpdateGauge(ctx, "Alloc", 1.5)
+	require.NoError(t, err)
+	_, err = b.Store.UpdateCounter(ctx, "PollCount", 2)
+	require.NoError(t, err)
+	require.NoError(t, b.Store.BatchUpdateMetrics(ctx, []domain.Metrics{
+		counter("PollCount", 3),
+		gauge("HeapAlloc", 10),
+		gauge("PollCount", 0.25),
+	}))
+
+	reopened := b.Reopen(t)
+
+	all, err := reopened.GetAllMetrics(ctx)
+	require.NoError(t, err)
+	require.Len(t, all, 4)
+	assertGauge(t, all[gaugeKey("Alloc")], "Alloc", 1.5)
+	assertCounter(t, all[counterKey("PollCount")], "PollCount", 5)
+	assertGauge(t, all[gaugeKey("HeapAlloc")], "HeapAlloc", 10)
+	assertGauge(t, all[gaugeKey("PollCount")], "PollCount", 0.25)
+}
+
+func testDeleteMetric(t *testing.T, b Backend) {
+	ctx := context.Background()
+
+	_, err := b.Store.UpdateGauge(ctx, "Alloc", 1.5)
+	require.NoError(t, err)
+	_, err = b.Store.UpdateCounter(ctx, "Alloc", 2)
+	require.NoError(t, err)
+
+	require.NoError(t, b.Store.DeleteMetric(ctx, gaugeKey("Alloc")))
+
+	_, err = b.Store.GetMetric(ctx, domain.Metrics{Name: "Alloc", MType: domain.Gauge})
+	assert.ErrorIs(t, err, repositories.ErrNotFound)
+	all, err := b.Store.GetAllMetrics(ctx)
+	require.NoError(t, err)
+	require.Len(t, all, 1)
+	assertCounter(t, all[counterKey("Alloc")], "Alloc", 2)
+
+	// После удаления counter начинается заново.
+	require.NoError(t, b.Store.DeleteMetric(ctx, counterKey("Alloc")))
+	updated, err := b.Store.UpdateCounter(ctx, "Alloc", 3)
+	require.NoError(t, err)
+	assertCounter(t, updated, "Alloc", 3)
+}
+
+func testDeleteMissing(t *testing.T, b Backend) {
+	ctx := context.Background()
+
+	assert.ErrorIs(t, b.Store.DeleteMetric(ctx, gaugeKey("missing")), repositories.ErrNotFound)
+
+	_, err := b.Store.UpdateGauge(ctx, "Alloc", 1.5)
+	require.NoError(t, err)
+	assert.ErrorIs(t, b.Store.DeleteMetric(ctx, counterKey("Alloc")), repositories.ErrNotFound)
+}
+
+func testResetCounter(t *testing.T, b Backend) {
+	ctx := context.Background()
+
+	_, err := b.Store.UpdateCounter(ctx, "PollCount", 5)
+	require.NoError(t, err)
+
+	reset, err := b.Store.ResetCounter(ctx, "PollCount")
+	require.NoError(t, err)
+	assertCounter(t, reset, "PollCount", 0)
+
+	updated, err := b.Store.UpdateCounter(ctx, "PollCount", 2)
+	require.NoError(t, err)
+	assertCounter(t, updated, "PollCount", 2)
+}
+
+func testResetMissing(t *testing.T, b Backend) {
+	ctx := context.Background()
+
+	_, err := b.Store.ResetCounter(ctx, "missing")
+	assert.ErrorIs(t, err, repositories.ErrNotFound)
+
+	_, err = b.Store.UpdateGauge(ctx, "Alloc", 1.5)
+	require.NoError(t, err)
+	_, err = b.Store.ResetCounter(ctx, "Alloc")
+	assert.ErrorIs(t, err, repositories.ErrNotFound)
+}
+
+func testDeleteAndResetPersist(t *testing.T, b Backend) {
+	if b.Reopen == nil {
+		t.Skip("backend does not persist data")
+	}
+	ctx := context.Background()
+
+	require.NoError(t, b.Store.BatchUpdateMetrics(ctx, []domain.Metrics{
+		gauge("Alloc", 1.5),
+		counter("PollCount", 5),
+		gauge("HeapAlloc", 10),
+	}))
+	require.NoError(t, b.Store.DeleteMetric(ctx, gaugeKey("Alloc")))
+	_, err := b.Store.ResetCounter(ctx, "PollCount")
+	require.NoError(t, err)
+
+	reopened := b.Reopen(t)
+
+	all, err := reopened.GetAllMetrics(ctx)
+	require.NoError(t, err)
+	require.Len(t, all, 2)
+	assertCounter(t, all[counterKey("PollCount")], "PollCount", 0)
+	assertGauge(t, all[gaugeKey("HeapAlloc")], "HeapAlloc", 10)
+}
+
+// updatedAtTolerance - допустимое расхождение времени обновления с часами
+// теста: PostgreSQL ставит время по своим часам.
+const updatedAtTolerance = time.Minute
+
+func testUpdatedAtOnWrite(t *testing.T, b Backend) {
+	ctx := context.Background()
+
+	updated, err := b.Store.UpdateGauge(ctx, "Alloc", 1.5)
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now(), updated.UpdatedAt, updatedAtTolerance)
+
+	updated, err = b.Store.UpdateCounter(ctx, "PollCount", 1)
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now(), updated.UpdatedAt, updatedAtTolerance)
+
+	require.NoError(t, b.Store.BatchUpdateMetrics(ctx, []domain.Metrics{gauge("HeapAlloc", 10)}))
+	reset, err := b.Store.ResetCounter(ctx, "PollCount")
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now(), reset.UpdatedAt, updatedAtTolerance)
+
+	all, err := b.Store.GetAllMetrics(ctx)
+	require.NoError(t, err)
+	for key, metric := range all {
+		assert.WithinDuration(t, time.Now(), metric.UpdatedAt, updatedAtTolerance, key.String())
+	}
+}
+
+func testBatchKeepsUpdatedAt(t *testing.T, b Backend) {
+	ctx := context.Background()
+	at := time.Now().Add(-time.Hour).Truncate(time.Microsecond)
+
+	stale := gauge("Alloc", 1.5)
+	stale.UpdatedAt = at
+	require.NoError(t, b.Store.BatchUpdateMetrics(ctx, []domain.Metrics{stale, counter("PollCount", 1)}))
+
+	got, err := b.Store.GetMetric(ctx, stale)
+	require.NoError(t, err)
+	assert.True(t, at.Equal(got.UpdatedAt), "want %v, got %v", at, got.UpdatedAt)
+
+	got, err = b.Store.GetMetric(ctx, counter("PollCount", 0))
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now(), got.UpdatedAt, updatedAtTolerance)
+}
+
+func testUpdatedAtPersists(t *testing.T, b Backend) {
+	if b.Reopen == nil {
+		t.Skip("backend does not persist data")
+	}
+	ctx := context.Background()
+	at := time.Now().Add(-time.Hour).Truncate(time.Microsecond)
+
+	stale := gauge("Alloc", 1.5)
+	stale.UpdatedAt = at
+	require.NoError(t, b.Store.BatchUpdateMetrics(ctx, []domain.Metrics{stale}))
+
+	reopened := b.Reopen(t)
+
+	got, err := reopened.GetMetric(ctx, stale)
+	require.NoError(t, err)
+	assert.True(t, at.Equal(got.UpdatedAt), "want %v, got %v", at, got.UpdatedAt)
+}
+
+func testLabelsOnWrite(t *testing.T, b Backend) {
+	ctx := context.Background()
+	host := domain.Labels{"host": "a"}
+
+	require.NoError(t, b.Store.BatchUpdateMetrics(ctx, []domain.Metrics{
+		withLabels(gauge("Alloc", 1), host), withLabels(counter("PollCount", 1), host),
+	}))
+
+	// Запись без меток сохраняет метки, заданные раньше.
+	got, err := b.Store.UpdateGauge(ctx, "Alloc", 2)
+	require.NoError(t, err)
+	assert.Equal(t, host, got.Labels)
+	got, err = b.Store.UpdateCounter(ctx, "PollCount", 1)
+	require.NoError(t, err)
+	assert.Equal(t, host, got.Labels)
+	require.NoError(t, b.Store.BatchUpdateMetrics(ctx, []domain.Metrics{gauge("Alloc", 3)}))
+	got, err = b.Store.GetMetric(ctx, domain.Metrics{Name: "Alloc", MType: domain.Gauge})
+	require.NoError(t, err)
+	assert.Equal(t, host, got.Labels)
+
+	// Запись с метками заменяет их целиком.
+	replaced := domain.Labels{"env": "prod"}
+	require.NoError(t, b.Store.BatchUpdateMetrics(ctx, []domain.Metrics{withLabels(gauge("Alloc", 4), replaced)}))
+	got, err = b.Store.GetMetric(ctx, domain.Metrics{Name: "Alloc", MType: domain.Gauge})
+	require.NoError(t, err)
+	assert.Equal(t, replaced, got.Labels)
+
+	// Сброс counter оставляет метки.
+	got, err = b.Store.ResetCounter(ctx, "PollCount")
+	require.NoError(t, err)
+	assert.Equal(t, host, got.Labels)
+
+	all, err := b.Store.GetAllMetrics(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, replaced, all[gaugeKey("Alloc")].Labels)
+	assert.Equal(t, host, all[counterKey("PollCount")].Labels)
+}
+
+func testLabelsPersist(t *testing.T, b Backend) {
+	if b.Reopen == nil {
+		t.Skip("backend does not persist data")
+	}
+	ctx := context.Background()
+
+	require.NoError(t, b.Store.BatchUpdateMetrics(ctx, []domain.Metrics{
+		withLabels(gauge("Alloc", 1), domain.Labels{"host": "a"}),
+	}))
+	require.NoError(t, b.Store.BatchUpdateMetrics(ctx, []domain.Metrics{
+		withLabels(counter("PollCount", 1), domain.Labels{"host": "b"}),
+	}))
+	_, err := b.Store.UpdateGauge(ctx, "Alloc", 2)
+	require.NoError(t, err)
+
+	reopened := b.Reopen(t)
+
+	all, err := reopened.GetAllMetrics(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, domain.Labels{"host": "a"}, all[gaugeKey("Alloc")].Labels)
+	assert.Equal(t, domain.Labels{"host": "b"}, all[counterKey("PollCount")].Labels)
+}
+
+func testQueryLabels(t *testing.T, b Backend) {
+	ctx := context.Background()
+	require.NoError(t, b.Store.BatchUpdateMetrics(ctx, []domain.Metrics{
+		withLabels(gauge("cpu", 1), domain.Labels{"host": "a", "env": "prod"}),
+		withLabels(gauge("mem", 2), domain.Labels{"host": "b", "env": "prod"}),
+		withLabels(counter("requests", 3), domain.Labels{"host": "a"}),
+		gauge("disk", 4),
+	}))
+
+	assert.Equal(t, []string{"counter/requests", "gauge/cpu"},
+		queryKeys(t, b, repositories.MetricsQuery{Labels: domain.Labels{"host": "a"}}))
+	assert.Equal(t, []string{"gauge/cpu"},
+		queryKeys(t, b, repositories.MetricsQuery{Labels: domain.Labels{"host": "a", "env": "prod"}}))
+	assert.Equal(t, []string{"gauge/mem"},
+		queryKeys(t, b, repositories.MetricsQuery{Labels: domain.Labels{"env": "prod"}, Prefix: "m"}))
+	assert.Equal(t, []string{},
+		queryKeys(t, b, repositories.MetricsQuery{Labels: domain.Labels{"host": "c"}}))
+
+	_, err := b.Store.QueryMetrics(ctx, repositories.MetricsQuery{Labels: domain.Labels{"": "a"}})
+	assert.ErrorIs(t, err, repositories.ErrInvalidQuery)
+}
+
+// seedQuery записывает метрики для проверок QueryMetrics: время обновления
+// растёт в порядке перечисления.
+func seedQuery(t *testing.T, b Backend) {
+	t.Helper()
+
+	at := time.Now().Add(-time.Hour).Truncate(time.Microsecond)
+	metrics := []domain.Metrics{
+		gauge("cpu_user", 1), gauge("cpu_sys", 2), counter("cpu_user", 3),
+		gauge("mem.total", 4), gauge("mem_total", 5), counter("Requests", 6),
+	}
+	for i := range metrics {
+		metrics[i].UpdatedAt = at.Add(time.Duration(i) * time.Second)
+	}
+	require.NoError(t, b.Store.BatchUpdateMetrics(context.Background(), metrics))
+}
+
+// queryKeys возвращает ключи выбранных метрик в виде "type/name".
+func queryKeys(t *testing.T, b Backend, query repositories.MetricsQuery) []string {
+	t.Helper()
+
+	metrics, err := b.Store.QueryMetrics(context.Background(), query)
+	require.NoError(t, err)
+	keys := make([]string, 0, len(metrics))
+	for _, m := range metrics {
+		keys = append(keys, m.MType+"/"+m.Name)
+	}
+	return keys
+}
+
+func testQueryFilters(t *testing.T, b Backend) {
+	seedQuery(t, b)
+
+	tests := []struct {
+		name  string
+		query repositories.MetricsQuery
+		want  []string
+	}{
+		{"type", repositories.MetricsQuery{MType: domain.Counter}, []string{"counter/Requests", "counter/cpu_user"}},
+		{"prefix", repositories.MetricsQuery{Prefix: "cpu_"}, []string{
+			"counter/cpu_user", "gauge/cpu_sys", "gauge/cpu_user",
+		}},
+		{"prefix escapes wildcards", repositories.MetricsQuery{Prefix: "mem_"}, []string{"gauge/mem_total"}},
+		{"glob", repositories.MetricsQuery{Glob: "*.total"}, []string{"gauge/mem.total"}},
+		{"glob single char", repositories.MetricsQuery{Glob: "mem?total"}, []string{"gauge/mem.total", "gauge/mem_total"}},
+		{"regex", repositories.MetricsQuery{Regex: "^cpu_(sys|user)$", MType: domain.Gauge}, []string{
+			"gauge/cpu_sys", "gauge/cpu_user",
+		}},
+		{"nothing matches", repositories.MetricsQuery{Prefix: "disk"}, []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, queryKeys(t, b, tt.query))
+		})
+	}
+}
+
+func testQuerySortAndPages(t *testing.T, b Backend) {
+	seedQuery(t, b)
+
+	assert.Equal(t, []string{
+		"counter/Requests", "counter/cpu_user", "gauge/cpu_sys", "gauge/cpu_user", "gauge/mem.total", "gauge/mem_total",
+	}, queryKeys(t, b, repositories.MetricsQuery{}))
+	assert.Equal(t, []string{
+		"counter/Requests", "gauge/cpu_sys", "counter/cpu_user", "gauge/cpu_user", "gauge/mem.total", "gauge/mem_total",
+	}, queryKeys(t, b, repositories.MetricsQuery{Sort: repositories.SortByName}))
+	assert.Equal(t, []string{
+		"counter/Requests", "gauge/mem_total", "gauge/mem.total", "counter/cpu_user", "gauge/cpu_sys", "gauge/cpu_user",
+	}, queryKeys(t, b, repositories.MetricsQuery{Sort: repositories.SortByUpdatedAt, Desc: true}))
+
+	// Постраничный обход возвращает каждую метрику ровно один раз.
+	for _, sortField := range []string{repositories.SortByName, repositories.SortByType, repositories.SortByUpdatedAt} {
+		for _, desc := range []bool{false, true} {
+			query := repositories.MetricsQuery{Sort: sortField, Desc: desc, Limit: 4}
+			want := queryKeys(t, b, repositories.MetricsQuery{Sort: sortField, Desc: desc})
+
+			var got []string
+			for {
+				page, err := b.Store.QueryMetrics(context.Background(), query)
+				require.NoError(t, err)
+				for _, m := range page {
+					got = append(got, m.MType+"/"+m.Name)
+				}
+				if len(page) < query.Limit {
+					break
+				}
+				last := page[len(page)-1]
+				query.After = &last
+			}
+			assert.Equal(t, want, got, "sort %s, desc %v", sortField, desc)
+		}
+	}
+}
+
+func testQueryInvalid(t *testing.T, b Backend) {
+	ctx := context.Background()
+
+	_, err := b.Store.QueryMetrics(ctx, repositories.MetricsQuery{Sort: "value"})
+	assert.ErrorIs(t, err, repositories.ErrInvalidQuery)
+	_, err = b.Store.QueryMetrics(ctx, repositories.MetricsQuery{Regex: "("})
+	assert.ErrorIs(t, err, repositories.ErrInvalidQuery)
+}
+
+func gauge(name string, value float64) domain.Metrics {
+	return domain.Metrics{Name: name, MType: domain.Gauge, Value: null.FloatFrom(value)}
+}
+
+func counter(name string, delta int64) domain.Metrics {
+	return domain.Metrics{Name: name, MType: domain.Counter, Delta: null.IntFrom(delta)}
+}
+
+func withLabels(m domain.Metrics, labels domain.Labels) domain.Metrics {
+	m.Labels = labels
+	return m
+}
+
+func gaugeKey(name string) domain.MetricKey {
+	return domain.MetricKey{Name: name, MType: domain.Gauge}
+}
+
+func counterKey(name string) domain.MetricKey {
+	return domain.MetricKey{Name: name, MType: domain.Counter}
+}
+
+func assertGauge(t *testing.T, m domain.Metrics, name string, value float64) {
+	t.Helper()
+
+	assert.Equal(t, name, m.Name)
+	assert.Equal(t, domain.Gauge, m.MType)
+	assert.Equal(t, null.FloatFrom(value), m.Value)
+	assert.False(t, m.Delta.Valid, "gauge must not have delta")
+}
+
+func assertCounter(t *testing.T, m domain.Metrics, name string, delta int64) {
+	t.Helper()
+
+	assert.Equal(t, name, m.Name)
+	assert.Equal(t, domain.Counter, m.MType)
+	assert.Equal(t, null.IntFrom(delta), m.Delta)
+	assert.False(t, m.Value.Valid, "counter must not have value")
+}
@@ -0,0 +1,206 @@
+package repositories
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"gopkg.in/guregu/null.v4"
+
+	"github.com/Axel791/metricsalert/internal/server/model/domain"
+)
+
+// walSuffix - расширение журнала рядом со снимком.
+const walSuffix = ".wal"
+
+// Операции журнала помимо обновления метрики (пустой Op).
+const (
+	walOpDelete = "delete"
+	walOpReset  = "reset"
+)
+
+// walRecord - одна запись журнала: обновление gauge (новое значение) или
+// counter (приращение), либо удаление или сброс метрики (Op). Seq монотонно
+// растёт и сохраняется в снимке, чтобы при восстановлении не применить уже
+// учтённые записи повторно. At - время записи, при восстановлении оно
+// становится временем обновления метрики; в журналах до его появления поле
+// отсутствует. Labels - метки из записи, пишутся, только если заданы.
+type walRecord struct {
+	Seq    uint64        `json:"seq"`
+	Op     string        `json:"op,omitempty"`
+	Name   string        `json:"name"`
+	MType  string        `json:"type"`
+	Delta  null.Int      `json:"delta"`
+	Value  null.Float    `json:"value"`
+	At     time.Time     `json:"at"`
+	Labels domain.Labels `json:"labels,omitempty"`
+}
+
+// writeAheadLog - журнал обновлений, который дописывается в конец файла.
+// Каждая запись - строка JSON; пачка пишется одним вызовом write и
+// фиксируется fsync до того, как обновление попадёт в память.
+type writeAheadLog struct {
+	path    string
+	file    *os.File
+	seq     uint64
+	records int
+	size    int64
+}
+
+// walPosition - состояние журнала, к которому можно вернуться через Rollback.
+type walPosition struct {
+	seq     uint64
+	records int
+	size    int64
+}
+
+func openWAL(path string) (*writeAheadLog, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("open wal %q: %w", path, err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("stat wal %q: %w", path, err)
+	}
+	return &writeAheadLog{path: path, file: file, size: info.Size()}, nil
+}
+
+// Append дописывает обновления метрик в журнал, присваивая им номера.
+func (w *writeAheadLog) Append(metrics ...domain.Metrics) error {
+	records := make([]walRecord, len(metrics))
+	for i, m := range metrics {
+		records[i] = walRecord{
+			Name: m.Name, MType: m.MType, Delta: m.Delta, Value: m.Value, At: updatedAt(m), Labels: m.Labels,
+		}
+	}
+	return w.write(records)
+}
+
+// AppendOp дописывает в журнал удаление или сброс метрики key.
+func (w *writeAheadLog) AppendOp(op string, key domain.MetricKey) error {
+	return w.write([]walRecord{{Op: op, Name: key.Name, MType: key.MType, At: time.Now()}})
+}
+
+// write присваивает записям номера и дописывает их одним вызовом write.
+func (w *writeAheadLog) write(records []walRecord) error {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+
+	seq := w.seq
+	for _, record := range records {
+		seq++
+		record.Seq = seq
+		if err := enc.Encode(record); err != nil {
+			return fmt.Errorf("encode wal record: %w", err)
+		}
+	}
+
+	pos := w.Position()
+	if _, err := w.file.Write(buf.Bytes()); err != nil {
+		return errors.Join(fmt.Errorf("write wal: %w", err), w.Rollback(pos))
+	}
+	if err := w.file.Sync(); err != nil {
+		return errors.Join(fmt.Errorf("sync wal: %w", err), w.Rollback(pos))
+	}
+	w.seq = seq
+	w.records += len(records)
+	w.size += int64(buf.Len())
+	return nil
+}
+
+// Position возвращает текущее состояние журнала.
+func (w *writeAheadLog) Position() walPosition {
+	return walPosition{seq: w.seq, records: w.records, size: w.size}
+}
+
+// Rollback отбрасывает записи, дописанные после pos: обрезает файл и
+// возвращает счётчики, чтобы при восстановлении они не были применены.
+func (w *writeAheadLog) Rollback(pos walPosition) error {
+	if err := w.file.Truncate(pos.size); err != nil {
+		return fmt.Errorf("truncate wal: %w", err)
+	}
+	if err := w.file.Sync(); err != nil {
+		return fmt.Errorf("sync wal: %w", err)
+	}
+	w.seq, w.records, w.size = pos.seq, pos.records, pos.size
+	return nil
+}
+
+// Reset очищает журнал после того, как его записи попали в снимок.
+func (w *writeAheadLog) Reset() error {
+	if err := w.file.Truncate(0); err != nil {
+		return fmt.Errorf("truncate wal: %w", err)
+	}
+	if err := w.file.Sync(); err != nil {
+		return fmt.Errorf("sync wal: %w", err)
+	}
+	w.records = 0
+	w.size = 0
+	return nil
+}
+
+func (w *writeAheadLog) Close() error {
+	return w.file.Close()
+}
+
+// replayWAL читает записи журнала с номером больше after и передаёт их в apply.
+// Повреждённая последняя строка (недописанная запись после сбоя) считается
+// обрывом и отбрасывается. Если после повреждённой строки есть другие записи,
+// журнал испорчен, и возвращается ошибка: отбросить их - значит потерять
+// подтверждённые записи.
+// Возвращает номер последней прочитанной записи и признак обрыва.
+func replayWAL(path string, after uint64, apply func(walRecord) error) (lastSeq uint64, torn bool, err error) {
+	lastSeq = after
+
+	file, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return lastSeq, false, nil
+		}
+		return lastSeq, false, fmt.Errorf("open wal %q: %w", path, err)
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	for {
+		line, readErr := reader.ReadBytes('\n')
+		if len(bytes.TrimSpace(line)) > 0 {
+			if readErr == io.EOF {
+				// Строка без перевода строки - запись не была дописана.
+				return lastSeq, true, nil
+			}
+			var record walRecord
+			if err := json.Unmarshal(line, &record); err != nil {
+				rest, restErr := io.ReadAll(reader)
+				if restErr != nil {
+					return lastSeq, false, fmt.Errorf("read wal %q: %w", path, restErr)
+				}
+				if len(bytes.TrimSpace(rest)) > 0 {
+					return lastSeq, false, fmt.Errorf(
+						"wal %q is corrupted after record %d, valid records follow: %w", path, lastSeq, err,
+					)
+				}
+				return lastSeq, true, nil
+			}
+			if record.Seq > after {
+				if err := apply(record); err != nil {
+					return lastSeq, false, fmt.Errorf("replay wal record %d: %w", record.Seq, err)
+				}
+				lastSeq = record.Seq
+			}
+		}
+		if readErr == io.EOF {
+			return lastSeq, false, nil
+		}
+		if readErr != nil {
+			return lastSeq, false, fmt.Errorf("read wal %q: %w", path, readErr)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package retention
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Stats - итог одного прохода уплотнения: сколько агрегатов записано и
+// сколько строк удалено на каждом разрешении.
+type Stats struct {
+	MinuteRollups int64
+	HourRollups   int64
+	DeletedRaw    int64
+	DeletedMinute int64
+	DeletedHour   int64
+}
+
+// Target - история метрик, которую уплотняет Compactor.
+//
+// Compact сворачивает сырые значения за завершённые минуты в минутные
+// агрегаты, минутные агрегаты за завершённые часы - в часовые, а затем
+// удаляет данные старше сроков политики каждой метрики.
+type Target interface {
+	Compact(ctx context.Context, now time.Time, policies Policies) (Stats, error)
+}
+
+// Compactor периодически уплотняет историю метрик. Политики можно менять
+// на лету.
+type Compactor struct {
+	target Target
+	logger *log.Logger
+
+	mutex    sync.RWMutex
+	policies Policies
+}
+
+// NewCompactor создаёт Compactor с начальным набором политик.
+func NewCompactor(target Target, policies Policies, logger *log.Logger) *Compactor {
+	return &Compactor{target: target, policies: policies, logger: logger}
+}
+
+// SetPolicies заменяет набор политик, применяемый со следующего прохода.
+func (c *Compactor) SetPolicies(policies Policies) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.policies = policies
+}
+
+// Run уплотняет историю раз в interval до отмены ctx.
+func (c *Compactor) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.Compact(ctx, time.Now())
+		}
+	}
+}
+
+// Compact выполняет один проход уплотнения на момент now.
+func (c *Compactor) Compact(ctx context.Context, now time.Time) {
+	c.mutex.RLock()
+	policies := c.policies
+	c.mutex.RUnlock()
+
+	stats, err := c.target.Compact(ctx, now, policies)
+	if err != nil {
+		c.logger.Warnf("error compacting metrics history: %v", err)
+		return
+	}
+	c.logger.WithFields(log.Fields{
+		"minute_rollups": stats.MinuteRollups,
+		"hour_rollups":   stats.HourRollups,
+		"deleted_raw":    stats.DeletedRaw,
+		"deleted_minute": stats.DeletedMinute,
+		"deleted_hour":   stats.DeletedHour,
+	}).Debug("metrics history compacted")
+}
@@ -0,0 +1,39 @@
+package retention
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeTarget struct {
+	policies []Policies
+	err      error
+}
+
+func (f *fakeTarget) Compact(_ context.Context, _ time.Time, policies Policies) (Stats, error) {
+	f.policies = append(f.policies, policies)
+	return Stats{DeletedRaw: 1}, f.err
+}
+
+func TestCompactorUsesCurrentPolicies(t *testing.T) {
+	logger := log.New()
+	logger.SetOutput(io.Discard)
+
+	target := &fakeTarget{}
+	first := Policies{Default: Policy{Pattern: "*", Raw: time.Hour}}
+	compactor := NewCompactor(target, first, logger)
+	compactor.Compact(context.Background(), time.Now())
+
+	second := Policies{Default: Policy{Pattern: "*", Raw: 2 * time.Hour}}
+	compactor.SetPolicies(second)
+	target.err = errors.New("database is down")
+	compactor.Compact(context.Background(), time.Now())
+
+	require.Equal(t, []Policies{first, second}, target.policies)
+}
@@ -0,0 +1,129 @@
+// Package retention задаёт сроки хранения истории метрик и периодически
+// сворачивает её в агрегаты и удаляет устаревшие данные.
+package retention
+
+import (
+	"fmt"
+	"path"
+	"time"
+)
+
+// Разрешения истории: сырые значения и агрегаты за минуту и за час.
+const (
+	ResolutionRaw    = "raw"
+	ResolutionMinute = "1m"
+	ResolutionHour   = "1h"
+)
+
+// Policy - сроки хранения истории метрик, имя которых подходит под Pattern.
+// Нулевой срок берётся из политики по умолчанию.
+//
+// Пример в YAML-файле конфигурации:
+//
+//	retention:
+//	  policies:
+//	    - pattern: "_server.*"
+//	      raw: 1h
+//	      minute: 24h
+//	      hour: 720h
+type Policy struct {
+	// Pattern - шаблон имени метрики: "*" - любая последовательность
+	// символов, "?" - один символ.
+	Pattern string `mapstructure:"pattern"`
+	// Raw - сколько хранить сырые значения.
+	Raw time.Duration `mapstructure:"raw"`
+	// Minute - сколько хранить минутные агрегаты.
+	Minute time.Duration `mapstructure:"minute"`
+	// Hour - сколько хранить часовые агрегаты.
+	Hour time.Duration `mapstructure:"hour"`
+}
+
+// String возвращает политику в читаемом виде для логов.
+func (p Policy) String() string {
+	return fmt.Sprintf("%s(raw=%s, 1m=%s, 1h=%s)", p.Pattern, p.Raw, p.Minute, p.Hour)
+}
+
+// Validate проверяет корректность политики.
+func (p Policy) Validate() error {
+	if p.Pattern == "" {
+		return fmt.Errorf("retention policy: pattern is required")
+	}
+	if _, err := path.Match(p.Pattern, ""); err != nil {
+		return fmt.Errorf("retention policy %s: invalid pattern: %w", p.Pattern, err)
+	}
+	if p.Raw < 0 || p.Minute < 0 || p.Hour < 0 {
+		return fmt.Errorf("retention policy %s: durations must not be negative", p.Pattern)
+	}
+	return nil
+}
+
+// Matches сообщает, относится ли политика к метрике name.
+func (p Policy) Matches(name string) bool {
+	ok, _ := path.Match(p.Pattern, name)
+	return ok
+}
+
+// Policies - набор политик и политика по умолчанию для метрик, не
+// подходящих ни под один шаблон.
+type Policies struct {
+	Default Policy
+	Rules   []Policy
+}
+
+// Validate проверяет все политики набора.
+func (ps Policies) Validate() error {
+	for _, p := range ps.Rules {
+		if err := p.Validate(); err != nil {
+			return err
+		}
+	}
+	if ps.Default.Raw < 0 || ps.Default.Minute < 0 || ps.Default.Hour < 0 {
+		return fmt.Errorf("default retention policy: durations must not be negative")
+	}
+	return nil
+}
+
+// For возвращает политику для метрики name: первую подходящую из Rules с
+// недостающими сроками из Default, иначе Default.
+func (ps Policies) For(name string) Policy {
+	for _, p := range ps.Rules {
+		if !p.Matches(name) {
+			continue
+		}
+		if p.Raw == 0 {
+			p.Raw = ps.Default.Raw
+		}
+		if p.Minute == 0 {
+			p.Minute = ps.Default.Minute
+		}
+		if p.Hour == 0 {
+			p.Hour = ps.Default.Hour
+		}
+		return p
+	}
+	return ps.Default
+}
+
+// Cutoffs - границы хранения для одной политики: данные с меткой времени
+// раньше границы удаляются.
+type Cutoffs struct {
+	Raw    time.Time
+	Minute time.Time
+	Hour   time.Time
+}
+
+// Cutoffs возвращает границы хранения политики на момент now.
+func (p Policy) Cutoffs(now time.Time) Cutoffs {
+	return Cutoffs{Raw: now.Add(-p.Raw), Minute: now.Add(-p.Minute), Hour: now.Add(-p.Hour)}
+}
+
+// RollupDelay - задержка построения агрегатов после конца минуты: значения,
+// записанные на границе минуты, успевают попасть в историю до её свёртки.
+const RollupDelay = 10 * time.Second
+
+// RollupBounds возвращает, до какого момента на время now можно свернуть
+// сырые значения в минутные агрегаты и минутные агрегаты - в часовые.
+func RollupBounds(now time.Time) (minuteEnd, hourEnd time.Time) {
+	minuteEnd = now.Add(-RollupDelay).Truncate(time.Minute)
+	return minuteEnd, minuteEnd.Truncate(time.Hour)
+}
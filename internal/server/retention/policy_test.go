@@ -0,0 +1,60 @@
+package retention
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPoliciesFor(t *testing.T) {
+	policies := Policies{
+		Default: Policy{Pattern: "*", Raw: 24 * time.Hour, Minute: 7 * 24 * time.Hour, Hour: 90 * 24 * time.Hour},
+		Rules: []Policy{
+			{Pattern: "_server.*", Raw: time.Hour},
+			{Pattern: "_server.store*", Raw: 2 * time.Hour},
+			{Pattern: "Heap?lloc", Raw: time.Hour, Minute: time.Hour, Hour: time.Hour},
+		},
+	}
+	require.NoError(t, policies.Validate())
+
+	tests := []struct {
+		name   string
+		metric string
+		want   Policy
+	}{
+		{"default", "PollCount", policies.Default},
+		{"inherits missing durations", "_server.requests", Policy{
+			Pattern: "_server.*", Raw: time.Hour, Minute: 7 * 24 * time.Hour, Hour: 90 * 24 * time.Hour,
+		}},
+		{"first match wins", "_server.store_ops", Policy{
+			Pattern: "_server.*", Raw: time.Hour, Minute: 7 * 24 * time.Hour, Hour: 90 * 24 * time.Hour,
+		}},
+		{"single character", "HeapAlloc", policies.Rules[2]},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.want, policies.For(tt.metric))
+		})
+	}
+}
+
+func TestPoliciesValidate(t *testing.T) {
+	require.Error(t, Policies{Rules: []Policy{{Raw: time.Hour}}}.Validate())
+	require.Error(t, Policies{Rules: []Policy{{Pattern: "[", Raw: time.Hour}}}.Validate())
+	require.Error(t, Policies{Rules: []Policy{{Pattern: "*", Raw: -time.Hour}}}.Validate())
+	require.Error(t, Policies{Default: Policy{Pattern: "*", Hour: -time.Hour}}.Validate())
+	require.NoError(t, Policies{}.Validate())
+}
+
+func TestRollupBounds(t *testing.T) {
+	now := time.Date(2026, 10, 19, 12, 0, 5, 0, time.UTC)
+	minuteEnd, hourEnd := RollupBounds(now)
+	require.Equal(t, time.Date(2026, 10, 19, 11, 59, 0, 0, time.UTC), minuteEnd)
+	require.Equal(t, time.Date(2026, 10, 19, 11, 0, 0, 0, time.UTC), hourEnd)
+
+	minuteEnd, hourEnd = RollupBounds(now.Add(10 * time.Second))
+	require.Equal(t, time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC), minuteEnd)
+	require.Equal(t, minuteEnd, hourEnd)
+}
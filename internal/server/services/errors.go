@@ -0,0 +1,73 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrInvalidMetricKey возвращается, если имя или тип метрики в запросе
+// некорректны.
+var ErrInvalidMetricKey = errors.New("invalid metric key")
+
+// ErrInvalidMetric возвращается, если метрика в запросе на обновление не
+// прошла проверку: пустое имя, неизвестный тип, нет значения и т.п.
+var ErrInvalidMetric = errors.New("invalid metric")
+
+// Коды причин, по которым метрика из пачки отклонена.
+const (
+	ReasonMissingID     = "missing_id"
+	ReasonInvalidType   = "invalid_type"
+	ReasonReservedName  = "reserved_name"
+	ReasonMissingDelta  = "missing_delta"
+	ReasonMissingValue  = "missing_value"
+	ReasonInvalidLabels = "invalid_labels"
+)
+
+// BatchItem - метрика из пачки, принятая сервером.
+type BatchItem struct {
+	// Index - позиция метрики в запросе.
+	Index int
+	ID    string
+	MType string
+}
+
+// BatchResult - итог пакетного обновления: какие метрики пачки сохранены,
+// а какие отклонены и почему.
+type BatchResult struct {
+	Accepted []BatchItem
+	Rejected []MetricError
+}
+
+// MetricError - ошибка проверки одной метрики из пачки.
+type MetricError struct {
+	// Index - позиция метрики в запросе.
+	Index int
+	ID    string
+	MType string
+	// Code - код причины, одна из констант Reason*.
+	Code string
+	Err  error
+}
+
+func (e MetricError) Error() string {
+	return fmt.Sprintf("metric #%d '%s': %v", e.Index, e.ID, e.Err)
+}
+
+func (e MetricError) Unwrap() error {
+	return e.Err
+}
+
+// BatchValidationError возвращается из BatchMetricsUpdate в строгом режиме,
+// если в пачке есть некорректные метрики. Содержит ошибки по каждой из них.
+type BatchValidationError struct {
+	Errors []MetricError
+}
+
+func (e *BatchValidationError) Error() string {
+	messages := make([]string, len(e.Errors))
+	for i, metricErr := range e.Errors {
+		messages[i] = metricErr.Error()
+	}
+	return "invalid metrics in batch: " + strings.Join(messages, "; ")
+}
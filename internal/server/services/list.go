@@ -0,0 +1,152 @@
+package services
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Axel791/metricsalert/internal/server/model/domain"
+	"github.com/Axel791/metricsalert/internal/server/model/dto"
+	"github.com/Axel791/metricsalert/internal/server/repositories"
+)
+
+// Размер страницы списка метрик.
+const (
+	DefaultListLimit = 100
+	MaxListLimit     = 1000
+)
+
+// ListQuery - параметры списка метрик.
+type ListQuery struct {
+	// MType, Prefix, Glob, Regex и Labels - фильтр, см.
+	// repositories.MetricsQuery.
+	MType  string
+	Prefix string
+	Glob   string
+	Regex  string
+	Labels map[string]string
+	// Sort - поле сортировки (name, type или updated_at), с "-" в начале -
+	// по убыванию. Пусто - по типу и имени.
+	Sort string
+	// Cursor - NextCursor предыдущей страницы; пусто - первая страница.
+	Cursor string
+	// Limit - размер страницы: 0 - DefaultListLimit, больше MaxListLimit
+	// уменьшается до MaxListLimit.
+	Limit int
+}
+
+// MetricsPage - страница списка метрик.
+type MetricsPage struct {
+	Metrics []dto.Metrics
+	// NextCursor - курсор следующей страницы; пусто, если страница последняя.
+	NextCursor string
+}
+
+// listCursor - содержимое курсора: сортировка и ключ последней метрики
+// страницы.
+type listCursor struct {
+	Sort      string    `json:"sort"`
+	Name      string    `json:"name"`
+	MType     string    `json:"type"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// ListMetrics - страница метрик, подходящих под фильтр. Фильтр и сортировка
+// выполняются хранилищем. Страницы продолжаются с места, где закончилась
+// предыдущая, поэтому при сортировке по имени и типу записи между запросами
+// не приводят к пропускам и повторам. При сортировке по updated_at запись
+// переносит метрику в конец порядка: по возрастанию она может встретиться
+// повторно, по убыванию - быть пропущена. Ошибки в параметрах оборачивают
+// repositories.ErrInvalidQuery.
+func (ms *MetricsService) ListMetrics(ctx context.Context, query ListQuery) (MetricsPage, error) {
+	storeQuery, err := query.storeQuery()
+	if err != nil {
+		return MetricsPage{}, err
+	}
+
+	limit := storeQuery.Limit
+	storeQuery.Limit++
+	metrics, err := ms.store.QueryMetrics(ctx, storeQuery)
+	if err != nil {
+		return MetricsPage{}, fmt.Errorf("ListMetrics: %w", err)
+	}
+
+	var page MetricsPage
+	if len(metrics) > limit {
+		metrics = metrics[:limit]
+		last := metrics[limit-1]
+		page.NextCursor = encodeCursor(listCursor{
+			Sort: query.Sort, Name: last.Name, MType: last.MType, UpdatedAt: last.UpdatedAt,
+		})
+	}
+
+	now := time.Now()
+	page.Metrics = make([]dto.Metrics, 0, len(metrics))
+	for _, metric := range metrics {
+		page.Metrics = append(page.Metrics, ms.toDTO(metric, now))
+	}
+	return page, nil
+}
+
+// storeQuery проверяет параметры и переводит их в запрос к хранилищу.
+func (q ListQuery) storeQuery() (repositories.MetricsQuery, error) {
+	storeQuery := repositories.MetricsQuery{
+		MType:  q.MType,
+		Prefix: q.Prefix,
+		Glob:   q.Glob,
+		Regex:  q.Regex,
+		Labels: q.Labels,
+		Limit:  q.Limit,
+	}
+	storeQuery.Sort, storeQuery.Desc = strings.CutPrefix(q.Sort, "-")
+	if storeQuery.Desc && storeQuery.Sort == "" {
+		return storeQuery, fmt.Errorf("%w: sort field is required after '-'", repositories.ErrInvalidQuery)
+	}
+
+	if q.MType != "" && q.MType != domain.Gauge && q.MType != domain.Counter {
+		return storeQuery, fmt.Errorf("%w: invalid metric type %q", repositories.ErrInvalidQuery, q.MType)
+	}
+	switch {
+	case q.Limit < 0:
+		return storeQuery, fmt.Errorf("%w: limit must not be negative", repositories.ErrInvalidQuery)
+	case q.Limit == 0:
+		storeQuery.Limit = DefaultListLimit
+	case q.Limit > MaxListLimit:
+		storeQuery.Limit = MaxListLimit
+	}
+	if err := storeQuery.Validate(); err != nil {
+		return storeQuery, err
+	}
+
+	if q.Cursor != "" {
+		cursor, err := decodeCursor(q.Cursor)
+		if err != nil {
+			return storeQuery, err
+		}
+		if cursor.Sort != q.Sort {
+			return storeQuery, fmt.Errorf("%w: cursor was issued for another sort order", repositories.ErrInvalidQuery)
+		}
+		storeQuery.After = &domain.Metrics{Name: cursor.Name, MType: cursor.MType, UpdatedAt: cursor.UpdatedAt}
+	}
+	return storeQuery, nil
+}
+
+func encodeCursor(cursor listCursor) string {
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(raw string) (listCursor, error) {
+	var cursor listCursor
+	data, err := base64.RawURLEncoding.DecodeString(raw)
+	if err == nil {
+		err = json.Unmarshal(data, &cursor)
+	}
+	if err != nil {
+		return cursor, fmt.Errorf("%w: malformed cursor", repositories.ErrInvalidQuery)
+	}
+	return cursor, nil
+}
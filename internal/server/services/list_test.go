@@ -0,0 +1,67 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Axel791/metricsalert/internal/server/repositories"
+)
+
+func TestListMetricsPages(t *testing.T) {
+	ctx := context.Background()
+	store := repositories.NewMetricMapRepository()
+	for i := 0; i < 5; i++ {
+		_, err := store.UpdateGauge(ctx, fmt.Sprintf("cpu%d", i), float64(i))
+		require.NoError(t, err)
+	}
+	_, err := store.UpdateCounter(ctx, "cpu_requests", 1)
+	require.NoError(t, err)
+	service := NewMetricsService(store)
+
+	query := ListQuery{Prefix: "cpu", MType: "gauge", Sort: "-name", Limit: 2}
+	var names []string
+	for pages := 0; ; pages++ {
+		require.Less(t, pages, 5, "pagination does not terminate")
+		page, err := service.ListMetrics(ctx, query)
+		require.NoError(t, err)
+		for _, metric := range page.Metrics {
+			names = append(names, metric.ID)
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		query.Cursor = page.NextCursor
+	}
+	assert.Equal(t, []string{"cpu4", "cpu3", "cpu2", "cpu1", "cpu0"}, names)
+}
+
+func TestListMetricsInvalidQuery(t *testing.T) {
+	service := NewMetricsService(repositories.NewMetricMapRepository())
+
+	first, err := service.ListMetrics(context.Background(), ListQuery{Limit: 1})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name  string
+		query ListQuery
+	}{
+		{"unknown type", ListQuery{MType: "histogram"}},
+		{"unknown sort", ListQuery{Sort: "value"}},
+		{"bare minus", ListQuery{Sort: "-"}},
+		{"negative limit", ListQuery{Limit: -1}},
+		{"invalid regex", ListQuery{Regex: "("}},
+		{"malformed cursor", ListQuery{Cursor: "!"}},
+		{"cursor for another sort", ListQuery{Sort: "name", Cursor: encodeCursor(listCursor{Sort: "-name"})}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := service.ListMetrics(context.Background(), tt.query)
+			assert.ErrorIs(t, err, repositories.ErrInvalidQuery)
+		})
+	}
+	assert.Empty(t, first.NextCursor)
+}
@@ -4,23 +4,60 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"sync"
+	"time"
 
 	"github.com/Axel791/metricsalert/internal/server/model/api"
 	"github.com/Axel791/metricsalert/internal/server/model/domain"
 	"github.com/Axel791/metricsalert/internal/server/model/dto"
 	"github.com/Axel791/metricsalert/internal/server/repositories"
+	"github.com/Axel791/metricsalert/internal/server/staleness"
+	"github.com/Axel791/metricsalert/internal/shared/logging"
+
+	"github.com/sirupsen/logrus"
 )
 
 // MetricsService - сервис, работающий с метриками
 type MetricsService struct {
 	store repositories.Store
+
+	stalenessMutex sync.RWMutex
+	staleness      staleness.Policy
 }
 
 func NewMetricsService(store repositories.Store) *MetricsService {
 	return &MetricsService{store: store}
 }
 
-// GetMetric - получение метрики по (type, name).
+// SetStalenessPolicy задаёт политику, по которой метрики в ответах
+// помечаются устаревшими. Без неё метрики не устаревают.
+func (ms *MetricsService) SetStalenessPolicy(policy staleness.Policy) {
+	ms.stalenessMutex.Lock()
+	defer ms.stalenessMutex.Unlock()
+
+	ms.staleness = policy
+}
+
+// toDTO переводит метрику из хранилища в DTO, отмечая, устарела ли она на
+// момент now.
+func (ms *MetricsService) toDTO(metric domain.Metrics, now time.Time) dto.Metrics {
+	ms.stalenessMutex.RLock()
+	_, stale := ms.staleness.Stale(metric, now)
+	ms.stalenessMutex.RUnlock()
+
+	return dto.Metrics{
+		ID:        metric.Name,
+		MType:     metric.MType,
+		Delta:     metric.Delta,
+		Value:     metric.Value,
+		UpdatedAt: metric.UpdatedAt,
+		Labels:    metric.Labels,
+		Stale:     stale,
+	}
+}
+
+// GetMetric - получение метрики по (type, name). Некорректные имя или тип
+// дают ErrInvalidMetricKey, отсутствие метрики - repositories.ErrNotFound.
 func (ms *MetricsService) GetMetric(ctx context.Context, metricType, name string) (dto.Metrics, error) {
 	var metricsDTO dto.Metrics
 
@@ -28,71 +65,71 @@ func (ms *MetricsService) GetMetric(ctx context.Context, metricType, name string
 		Name:  name,
 		MType: metricType,
 	}
-
-	if err := metric.ValidateMetricID(); err != nil {
-		return metricsDTO, err
-	}
-	if err := metric.ValidateMetricsType(); err != nil {
+	if err := validateMetricKey(metric); err != nil {
 		return metricsDTO, err
 	}
 
 	metricsDomain, err := ms.store.GetMetric(ctx, metric)
+	if errors.Is(err, repositories.ErrNotFound) {
+		return metricsDTO, repositories.ErrNotFound
+	}
 	if err != nil {
 		return metricsDTO, fmt.Errorf("GetMetric: error getting metric domain: %w", err)
 	}
 
-	if metricsDomain.Name == "" {
-		return metricsDTO, errors.New("metric not found")
-	}
-
-	metricsDTO = dto.Metrics{
-		ID:    metricsDomain.Name,
-		MType: metricsDomain.MType,
-		Delta: metricsDomain.Delta,
-		Value: metricsDomain.Value,
-	}
-
-	return metricsDTO, nil
+	return ms.toDTO(metricsDomain, time.Now()), nil
 }
 
-// CreateOrUpdateMetric - создаёт или обновляет метрику.
+// CreateOrUpdateMetric - создаёт или обновляет метрику. Ошибки проверки
+// метрики оборачивают ErrInvalidMetric.
 func (ms *MetricsService) CreateOrUpdateMetric(ctx context.Context, metricAPI api.Metrics) (dto.Metrics, error) {
 	var metricsDTO dto.Metrics
 
 	if metricAPI.ID == "" {
-		return metricsDTO, errors.New("metric name (ID) is required")
+		return metricsDTO, fmt.Errorf("%w: metric name (ID) is required", ErrInvalidMetric)
 	}
 
 	if metricAPI.MType != domain.Counter && metricAPI.MType != domain.Gauge {
-		return metricsDTO, fmt.Errorf("invalid metric type: %s", metricAPI.MType)
+		return metricsDTO, fmt.Errorf("%w: invalid metric type: %s", ErrInvalidMetric, metricAPI.MType)
 	}
 
 	switch metricAPI.MType {
 	case domain.Counter:
 		if metricAPI.Delta == nil {
-			return metricsDTO, fmt.Errorf("missing delta for counter '%s'", metricAPI.ID)
+			return metricsDTO, fmt.Errorf("%w: missing delta for counter '%s'", ErrInvalidMetric, metricAPI.ID)
 		}
 	case domain.Gauge:
 		if metricAPI.Value == nil {
-			return metricsDTO, fmt.Errorf("missing value for gauge '%s'", metricAPI.ID)
+			return metricsDTO, fmt.Errorf("%w: missing value for gauge '%s'", ErrInvalidMetric, metricAPI.ID)
 		}
 	}
 
 	metric := domain.Metrics{
-		Name:  metricAPI.ID,
-		MType: metricAPI.MType,
+		Name:   metricAPI.ID,
+		MType:  metricAPI.MType,
+		Labels: metricAPI.Labels,
+	}
+	if err := metric.ValidateWritable(); err != nil {
+		return metricsDTO, fmt.Errorf("%w: %w", ErrInvalidMetric, err)
+	}
+	if err := metric.ValidateLabels(); err != nil {
+		return metricsDTO, fmt.Errorf("%w: %w", ErrInvalidMetric, err)
 	}
 
 	if metricAPI.MType == domain.Counter {
 		if err := metric.SetMetricValue(*metricAPI.Delta); err != nil {
-			return metricsDTO, err
+			return metricsDTO, fmt.Errorf("%w: %w", ErrInvalidMetric, err)
 		}
 	} else {
 		if err := metric.SetMetricValue(*metricAPI.Value); err != nil {
-			return metricsDTO, err
+			return metricsDTO, fmt.Errorf("%w: %w", ErrInvalidMetric, err)
 		}
 	}
 
+	if len(metric.Labels) > 0 {
+		return ms.updateLabeledMetric(ctx, metric)
+	}
+
 	var updatedMetric domain.Metrics
 	var err error
 
@@ -111,14 +148,21 @@ func (ms *MetricsService) CreateOrUpdateMetric(ctx context.Context, metricAPI ap
 		return metricsDTO, fmt.Errorf("unsupported metric type: %s", metric.MType)
 	}
 
-	metricsDTO = dto.Metrics{
-		ID:    updatedMetric.Name, // !!!
-		MType: updatedMetric.MType,
-		Delta: updatedMetric.Delta,
-		Value: updatedMetric.Value,
-	}
+	return ms.toDTO(updatedMetric, time.Now()), nil
+}
 
-	return metricsDTO, nil
+// updateLabeledMetric записывает метрику с метками. UpdateGauge и
+// UpdateCounter хранилища меток не принимают, поэтому метрика пишется пачкой
+// из одного элемента и затем перечитывается.
+func (ms *MetricsService) updateLabeledMetric(ctx context.Context, metric domain.Metrics) (dto.Metrics, error) {
+	if err := ms.store.BatchUpdateMetrics(ctx, []domain.Metrics{metric}); err != nil {
+		return dto.Metrics{}, fmt.Errorf("UpdateMetric (%s): %w", metric.MType, err)
+	}
+	updatedMetric, err := ms.store.GetMetric(ctx, metric)
+	if err != nil {
+		return dto.Metrics{}, fmt.Errorf("UpdateMetric (%s): %w", metric.MType, err)
+	}
+	return ms.toDTO(updatedMetric, time.Now()), nil
 }
 
 // GetAllMetric - получение всех метрик
@@ -130,69 +174,48 @@ func (ms *MetricsService) GetAllMetric(ctx context.Context) ([]dto.Metrics, erro
 		return metricsDTO, fmt.Errorf("GetAllMetrics: error getting from store: %w", err)
 	}
 
+	now := time.Now()
 	for _, domainM := range metricsMap {
-		metricsDTO = append(metricsDTO, dto.Metrics{
-			ID:    domainM.Name, // DTO.ID = domainM.Name
-			MType: domainM.MType,
-			Delta: domainM.Delta,
-			Value: domainM.Value,
-		})
+		metricsDTO = append(metricsDTO, ms.toDTO(domainM, now))
 	}
 	return metricsDTO, nil
 }
 
-// BatchMetricsUpdate - батчевое обновление
-func (ms *MetricsService) BatchMetricsUpdate(ctx context.Context, metrics []api.Metrics) error {
+// BatchMetricsUpdate - батчевое обновление. Корректные метрики пачки
+// сохраняются атомарно, некорректные отклоняются и перечисляются в
+// BatchResult.Rejected с кодом причины.
+//
+// В строгом режиме (strict) при хотя бы одной некорректной метрике не
+// сохраняется ни одна, а возвращается *BatchValidationError.
+func (ms *MetricsService) BatchMetricsUpdate(
+	ctx context.Context,
+	metrics []api.Metrics,
+	strict bool,
+) (BatchResult, error) {
+	var result BatchResult
 	if len(metrics) == 0 {
-		return nil
+		return result, nil
 	}
 
 	domainMetrics := make([]domain.Metrics, 0, len(metrics))
 
-	for _, m := range metrics {
-		if m.ID == "" {
-			return fmt.Errorf("BatchMetricsUpdate: metric name (ID) is empty")
-		}
-
-		d := domain.Metrics{
-			Name:  m.ID,
-			MType: m.MType,
-		}
-
-		if err := d.ValidateMetricsType(); err != nil {
-			return fmt.Errorf("metric '%s': %w", m.ID, err)
-		}
-		if err := d.ValidateMetricID(); err != nil {
-			return fmt.Errorf("metric '%s': %w", m.ID, err)
-		}
-
-		switch d.MType {
-		case domain.Counter:
-			if m.Delta == nil {
-				return fmt.Errorf(
-					"BatchMetricsUpdate: metric '%s': delta is required for counter",
-					m.ID,
-				)
-			}
-			if err := d.SetMetricValue(*m.Delta); err != nil {
-				return fmt.Errorf("BatchMetricsUpdate: metric '%s': %w", m.ID, err)
-			}
-		case domain.Gauge:
-			if m.Value == nil {
-				return fmt.Errorf(
-					"BatchMetricsUpdate: metric '%s': value is required for gauge",
-					m.ID,
-				)
-			}
-			if err := d.SetMetricValue(*m.Value); err != nil {
-				return fmt.Errorf("BatchMetricsUpdate: metric '%s': %w", m.ID, err)
-			}
-		default:
-			return fmt.Errorf("BatchMetricsUpdate: metric '%s': unsupported metric type '%s'", m.ID, m.MType)
+	for i, m := range metrics {
+		d, code, err := batchMetricToDomain(m)
+		if err != nil {
+			result.Rejected = append(result.Rejected, MetricError{
+				Index: i, ID: m.ID, MType: m.MType, Code: code, Err: err,
+			})
+			continue
 		}
-
+		result.Accepted = append(result.Accepted, BatchItem{Index: i, ID: m.ID, MType: m.MType})
 		domainMetrics = append(domainMetrics, d)
 	}
+	if strict && len(result.Rejected) > 0 {
+		return BatchResult{Rejected: result.Rejected}, &BatchValidationError{Errors: result.Rejected}
+	}
+	if len(domainMetrics) == 0 {
+		return result, nil
+	}
 
 	uniqMap := make(map[string]domain.Metrics, len(domainMetrics))
 
@@ -202,11 +225,11 @@ func (ms *MetricsService) BatchMetricsUpdate(ctx context.Context, metrics []api.
 		if existing, ok := uniqMap[key]; ok {
 			if m.MType == "counter" {
 				existing.Delta.Int64 += m.Delta.Int64
-				uniqMap[key] = existing
 			} else if m.MType == "gauge" {
 				existing.Value.Float64 = m.Value.Float64
-				uniqMap[key] = existing
 			}
+			existing.Labels = existing.Labels.Merge(m.Labels)
+			uniqMap[key] = existing
 		} else {
 			uniqMap[key] = m
 		}
@@ -218,7 +241,88 @@ func (ms *MetricsService) BatchMetricsUpdate(ctx context.Context, metrics []api.
 	}
 
 	if err := ms.store.BatchUpdateMetrics(ctx, uniqMetrics); err != nil {
-		return fmt.Errorf("BatchMetricsUpdate: error batch update failed: %w", err)
+		return BatchResult{}, fmt.Errorf("BatchMetricsUpdate: error batch update failed: %w", err)
+	}
+
+	logging.FromContext(ctx).WithFields(logrus.Fields{
+		"received": len(metrics),
+		"rejected": len(result.Rejected),
+		"stored":   len(uniqMetrics),
+	}).Debug("metrics batch stored")
+	return result, nil
+}
+
+// DeleteMetric - удаление метрики по (type, name). Если метрики нет,
+// возвращается repositories.ErrNotFound.
+func (ms *MetricsService) DeleteMetric(ctx context.Context, metricType, name string) error {
+	metric := domain.Metrics{Name: name, MType: metricType}
+	if err := validateMetricKey(metric); err != nil {
+		return err
+	}
+
+	if err := ms.store.DeleteMetric(ctx, metric.Key()); err != nil {
+		return fmt.Errorf("DeleteMetric: %w", err)
+	}
+	return nil
+}
+
+// ResetCounter - обнуление counter. Если его нет, возвращается
+// repositories.ErrNotFound.
+func (ms *MetricsService) ResetCounter(ctx context.Context, name string) (dto.Metrics, error) {
+	if err := validateMetricKey(domain.Metrics{Name: name, MType: domain.Counter}); err != nil {
+		return dto.Metrics{}, err
+	}
+
+	metric, err := ms.store.ResetCounter(ctx, name)
+	if err != nil {
+		return dto.Metrics{}, fmt.Errorf("ResetCounter: %w", err)
+	}
+	return ms.toDTO(metric, time.Now()), nil
+}
+
+// validateMetricKey проверяет имя и тип метрики в запросе.
+func validateMetricKey(metric domain.Metrics) error {
+	if err := metric.ValidateMetricID(); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidMetricKey, err)
+	}
+	if err := metric.ValidateMetricsType(); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidMetricKey, err)
 	}
 	return nil
 }
+
+// batchMetricToDomain проверяет метрику из пачки и переводит её в domain.Metrics.
+// При ошибке возвращает также код причины.
+func batchMetricToDomain(m api.Metrics) (domain.Metrics, string, error) {
+	d := domain.Metrics{
+		Name:   m.ID,
+		MType:  m.MType,
+		Labels: m.Labels,
+	}
+
+	if err := d.ValidateMetricID(); err != nil {
+		return d, ReasonMissingID, err
+	}
+	if err := d.ValidateMetricsType(); err != nil {
+		return d, ReasonInvalidType, err
+	}
+	if err := d.ValidateWritable(); err != nil {
+		return d, ReasonReservedName, err
+	}
+	if err := d.ValidateLabels(); err != nil {
+		return d, ReasonInvalidLabels, err
+	}
+
+	switch d.MType {
+	case domain.Counter:
+		if m.Delta == nil {
+			return d, ReasonMissingDelta, errors.New("delta is required for counter")
+		}
+		return d, "", d.SetMetricValue(*m.Delta)
+	default:
+		if m.Value == nil {
+			return d, ReasonMissingValue, errors.New("value is required for gauge")
+		}
+		return d, "", d.SetMetricValue(*m.Value)
+	}
+}
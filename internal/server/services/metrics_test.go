@@ -0,0 +1,176 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/guregu/null.v4"
+
+	"github.com/Axel791/metricsalert/internal/server/model/api"
+	"github.com/Axel791/metricsalert/internal/server/model/domain"
+	"github.com/Axel791/metricsalert/internal/server/repositories"
+	"github.com/Axel791/metricsalert/internal/server/staleness"
+)
+
+func batchWithInvalid() []api.Metrics {
+	value := 1.5
+	delta := int64(2)
+	return []api.Metrics{
+		{ID: "Alloc", MType: domain.Gauge, Value: &value},
+		{ID: "PollCount", MType: domain.Counter},
+		{ID: "", MType: domain.Gauge, Value: &value},
+		{ID: "Frees", MType: "histogram", Value: &value},
+		{ID: domain.ReservedPrefix + "x", MType: domain.Gauge, Value: &value},
+		{ID: "Gauge", MType: domain.Gauge},
+		{ID: "Requests", MType: domain.Counter, Delta: &delta},
+		{ID: "Labeled", MType: domain.Gauge, Value: &value, Labels: map[string]string{"": "x"}},
+	}
+}
+
+func TestBatchMetricsUpdate_PartialSuccess(t *testing.T) {
+	ctx := context.Background()
+	store := repositories.NewMetricMapRepository()
+	service := NewMetricsService(store)
+
+	result, err := service.BatchMetricsUpdate(ctx, batchWithInvalid(), false)
+	require.NoError(t, err)
+
+	assert.Equal(t, []BatchItem{
+		{Index: 0, ID: "Alloc", MType: domain.Gauge},
+		{Index: 6, ID: "Requests", MType: domain.Counter},
+	}, result.Accepted)
+
+	codes := make(map[int]string, len(result.Rejected))
+	for _, rejected := range result.Rejected {
+		codes[rejected.Index] = rejected.Code
+	}
+	assert.Equal(t, map[int]string{
+		1: ReasonMissingDelta,
+		2: ReasonMissingID,
+		3: ReasonInvalidType,
+		4: ReasonReservedName,
+		5: ReasonMissingValue,
+		7: ReasonInvalidLabels,
+	}, codes)
+
+	all, err := store.GetAllMetrics(ctx)
+	require.NoError(t, err)
+	assert.Len(t, all, 2)
+}
+
+func TestBatchMetricsUpdate_StrictRejectsWholeBatch(t *testing.T) {
+	ctx := context.Background()
+	store := repositories.NewMetricMapRepository()
+	service := NewMetricsService(store)
+
+	result, err := service.BatchMetricsUpdate(ctx, batchWithInvalid(), true)
+
+	var validationErr *BatchValidationError
+	require.ErrorAs(t, err, &validationErr)
+	assert.Len(t, validationErr.Errors, 6)
+	assert.Empty(t, result.Accepted)
+	assert.Len(t, result.Rejected, 6)
+
+	all, err := store.GetAllMetrics(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, all)
+}
+
+func TestDeleteMetricAndResetCounter(t *testing.T) {
+	ctx := context.Background()
+	store := repositories.NewMetricMapRepository()
+	service := NewMetricsService(store)
+
+	_, err := store.UpdateCounter(ctx, "PollCount", 4)
+	require.NoError(t, err)
+
+	reset, err := service.ResetCounter(ctx, "PollCount")
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), reset.Delta.Int64)
+
+	require.NoError(t, service.DeleteMetric(ctx, domain.Counter, "PollCount"))
+	assert.ErrorIs(t, service.DeleteMetric(ctx, domain.Counter, "PollCount"), repositories.ErrNotFound)
+	_, err = service.ResetCounter(ctx, "PollCount")
+	assert.ErrorIs(t, err, repositories.ErrNotFound)
+
+	assert.ErrorIs(t, service.DeleteMetric(ctx, "histogram", "PollCount"), ErrInvalidMetricKey)
+	_, err = service.ResetCounter(ctx, "")
+	assert.ErrorIs(t, err, ErrInvalidMetricKey)
+}
+
+func TestGetMetricMarksStale(t *testing.T) {
+	ctx := context.Background()
+	store := repositories.NewMetricMapRepository()
+	service := NewMetricsService(store)
+	service.SetStalenessPolicy(staleness.Policy{
+		Default: staleness.Rule{Action: staleness.ActionMark},
+		Rules:   []staleness.Rule{{Prefix: "agent.", TTL: time.Minute}},
+	})
+
+	updatedAt := time.Now().Add(-time.Hour)
+	require.NoError(t, store.BatchUpdateMetrics(ctx, []domain.Metrics{
+		{Name: "agent.Alloc", MType: domain.Gauge, Value: null.FloatFrom(1), UpdatedAt: updatedAt},
+		{Name: "Alloc", MType: domain.Gauge, Value: null.FloatFrom(1), UpdatedAt: updatedAt},
+	}))
+
+	stale, err := service.GetMetric(ctx, domain.Gauge, "agent.Alloc")
+	require.NoError(t, err)
+	assert.True(t, stale.Stale)
+	assert.True(t, updatedAt.Equal(stale.UpdatedAt))
+
+	fresh, err := service.GetMetric(ctx, domain.Gauge, "Alloc")
+	require.NoError(t, err)
+	assert.False(t, fresh.Stale, "metrics without a rule never expire with zero default TTL")
+
+	value := 2.0
+	updated, err := service.CreateOrUpdateMetric(ctx, api.Metrics{ID: "agent.Alloc", MType: domain.Gauge, Value: &value})
+	require.NoError(t, err)
+	assert.False(t, updated.Stale)
+}
+
+func TestCreateOrUpdateMetricWithLabels(t *testing.T) {
+	ctx := context.Background()
+	service := NewMetricsService(repositories.NewMetricMapRepository())
+	delta := int64(2)
+
+	metric, err := service.CreateOrUpdateMetric(ctx, api.Metrics{
+		ID: "Requests", MType: domain.Counter, Delta: &delta, Labels: map[string]string{"host": "a"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), metric.Delta.Int64)
+	assert.Equal(t, map[string]string{"host": "a"}, metric.Labels)
+
+	// Запись без меток оставляет метки, заданные раньше.
+	metric, err = service.CreateOrUpdateMetric(ctx, api.Metrics{ID: "Requests", MType: domain.Counter, Delta: &delta})
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), metric.Delta.Int64)
+	assert.Equal(t, map[string]string{"host": "a"}, metric.Labels)
+}
+
+func TestCreateOrUpdateMetricInvalid(t *testing.T) {
+	service := NewMetricsService(repositories.NewMetricMapRepository())
+	value := 1.0
+
+	tests := []struct {
+		name   string
+		metric api.Metrics
+	}{
+		{"missing id", api.Metrics{MType: domain.Gauge, Value: &value}},
+		{"unknown type", api.Metrics{ID: "Alloc", MType: "histogram", Value: &value}},
+		{"missing value", api.Metrics{ID: "Alloc", MType: domain.Gauge}},
+		{"reserved name", api.Metrics{ID: domain.ReservedPrefix + "x", MType: domain.Gauge, Value: &value}},
+		{"empty label name", api.Metrics{ID: "Alloc", MType: domain.Gauge, Value: &value, Labels: map[string]string{"": "x"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := service.CreateOrUpdateMetric(context.Background(), tt.metric)
+			assert.ErrorIs(t, err, ErrInvalidMetric)
+		})
+	}
+
+	_, err := service.GetMetric(context.Background(), "histogram", "Alloc")
+	assert.ErrorIs(t, err, ErrInvalidMetricKey)
+}
@@ -10,6 +10,7 @@ import (
 
 	api "github.com/Axel791/metricsalert/internal/server/model/api"
 	dto "github.com/Axel791/metricsalert/internal/server/model/dto"
+	services "github.com/Axel791/metricsalert/internal/server/services"
 	gomock "github.com/golang/mock/gomock"
 )
 
@@ -37,17 +38,18 @@ func (m *MockMetric) EXPECT() *MockMetricMockRecorder {
 }
 
 // BatchMetricsUpdate mocks base method.
-func (m *MockMetric) BatchMetricsUpdate(ctx context.Context, metrics []api.Metrics) error {
+func (m *MockMetric) BatchMetricsUpdate(ctx context.Context, metrics []api.Metrics, strict bool) (services.BatchResult, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "BatchMetricsUpdate", ctx, metrics)
-	ret0, _ := ret[0].(error)
-	return ret0
+	ret := m.ctrl.Call(m, "BatchMetricsUpdate", ctx, metrics, strict)
+	ret0, _ := ret[0].(services.BatchResult)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
 }
 
 // BatchMetricsUpdate indicates an expected call of BatchMetricsUpdate.
-func (mr *MockMetricMockRecorder) BatchMetricsUpdate(ctx, metrics interface{}) *gomock.Call {
+func (mr *MockMetricMockRecorder) BatchMetricsUpdate(ctx, metrics, strict interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "BatchMetricsUpdate", reflect.TypeOf((*MockMetric)(nil).BatchMetricsUpdate), ctx, metrics)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "BatchMetricsUpdate", reflect.TypeOf((*MockMetric)(nil).BatchMetricsUpdate), ctx, metrics, strict)
 }
 
 // CreateOrUpdateMetric mocks base method.
@@ -65,6 +67,20 @@ func (mr *MockMetricMockRecorder) CreateOrUpdateMetric(ctx, metricAPI interface{
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateOrUpdateMetric", reflect.TypeOf((*MockMetric)(nil).CreateOrUpdateMetric), ctx, metricAPI)
 }
 
+// DeleteMetric mocks base method.
+func (m *MockMetric) DeleteMetric(ctx context.Context, metricType, name string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteMetric", ctx, metricType, name)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteMetric indicates an expected call of DeleteMetric.
+func (mr *MockMetricMockRecorder) DeleteMetric(ctx, metricType, name interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteMetric", reflect.TypeOf((*MockMetric)(nil).DeleteMetric), ctx, metricType, name)
+}
+
 // GetAllMetric mocks base method.
 func (m *MockMetric) GetAllMetric(ctx context.Context) ([]dto.Metrics, error) {
 	m.ctrl.T.Helper()
@@ -95,6 +111,36 @@ func (mr *MockMetricMockRecorder) GetMetric(ctx, metricType, name interface{}) *
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetMetric", reflect.TypeOf((*MockMetric)(nil).GetMetric), ctx, metricType, name)
 }
 
+// ListMetrics mocks base method.
+func (m *MockMetric) ListMetrics(ctx context.Context, query services.ListQuery) (services.MetricsPage, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListMetrics", ctx, query)
+	ret0, _ := ret[0].(services.MetricsPage)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListMetrics indicates an expected call of ListMetrics.
+func (mr *MockMetricMockRecorder) ListMetrics(ctx, query interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListMetrics", reflect.TypeOf((*MockMetric)(nil).ListMetrics), ctx, query)
+}
+
+// ResetCounter mocks base method.
+func (m *MockMetric) ResetCounter(ctx context.Context, name string) (dto.Metrics, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ResetCounter", ctx, name)
+	ret0, _ := ret[0].(dto.Metrics)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ResetCounter indicates an expected call of ResetCounter.
+func (mr *MockMetricMockRecorder) ResetCounter(ctx, name interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ResetCounter", reflect.TypeOf((*MockMetric)(nil).ResetCounter), ctx, name)
+}
+
 // MockSignService is a mock of SignService interface.
 type MockSignService struct {
 	ctrl     *gomock.Controller
@@ -12,7 +12,10 @@ type Metric interface {
 	GetMetric(ctx context.Context, metricType, name string) (dto.Metrics, error)
 	CreateOrUpdateMetric(ctx context.Context, metricAPI api.Metrics) (dto.Metrics, error)
 	GetAllMetric(ctx context.Context) ([]dto.Metrics, error)
-	BatchMetricsUpdate(ctx context.Context, metrics []api.Metrics) error
+	ListMetrics(ctx context.Context, query ListQuery) (MetricsPage, error)
+	BatchMetricsUpdate(ctx context.Context, metrics []api.Metrics, strict bool) (BatchResult, error)
+	DeleteMetric(ctx context.Context, metricType, name string) error
+	ResetCounter(ctx context.Context, name string) (dto.Metrics, error)
 }
 
 // SignService - интерфейс подписи
@@ -0,0 +1,110 @@
+package staleness
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/Axel791/metricsalert/internal/server/model/domain"
+	"github.com/Axel791/metricsalert/internal/server/repositories"
+)
+
+// Store - хранилище, из которого Evictor удаляет устаревшие метрики.
+type Store interface {
+	GetMetric(ctx context.Context, metric domain.Metrics) (domain.Metrics, error)
+	GetAllMetrics(ctx context.Context) (map[domain.MetricKey]domain.Metrics, error)
+	DeleteMetric(ctx context.Context, key domain.MetricKey) error
+}
+
+// Evictor периодически удаляет метрики, устаревшие по правилам с действием
+// ActionEvict. Политику можно менять на лету.
+type Evictor struct {
+	store  Store
+	logger *log.Logger
+
+	mutex  sync.RWMutex
+	policy Policy
+}
+
+// NewEvictor создаёт Evictor с начальной политикой.
+func NewEvictor(store Store, policy Policy, logger *log.Logger) *Evictor {
+	return &Evictor{store: store, policy: policy, logger: logger}
+}
+
+// SetPolicy заменяет политику, применяемую со следующего прохода.
+func (e *Evictor) SetPolicy(policy Policy) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	e.policy = policy
+}
+
+// Run удаляет устаревшие метрики раз в interval до отмены ctx.
+func (e *Evictor) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			e.Evict(ctx, time.Now())
+		}
+	}
+}
+
+// Evict выполняет один проход на момент now и возвращает число удалённых
+// метрик.
+//
+// Перед удалением метрика перечитывается: если её успели обновить после
+// чтения списка, она остаётся. Удаление не атомарно с проверкой: запись,
+// пришедшая между перечитыванием и удалением, удаляется вместе с метрикой.
+func (e *Evictor) Evict(ctx context.Context, now time.Time) int {
+	e.mutex.RLock()
+	policy := e.policy
+	e.mutex.RUnlock()
+
+	metrics, err := e.store.GetAllMetrics(ctx)
+	if err != nil {
+		e.logger.Warnf("error listing metrics for eviction: %v", err)
+		return 0
+	}
+
+	evicted := 0
+	for key, metric := range metrics {
+		if !evictable(policy, metric, now) {
+			continue
+		}
+		current, err := e.store.GetMetric(ctx, metric)
+		if errors.Is(err, repositories.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			e.logger.Warnf("error reading metric %s before eviction: %v", key, err)
+			continue
+		}
+		if !evictable(policy, current, now) {
+			continue
+		}
+		if err = e.store.DeleteMetric(ctx, key); err != nil && !errors.Is(err, repositories.ErrNotFound) {
+			e.logger.Warnf("error evicting metric %s: %v", key, err)
+			continue
+		}
+		evicted++
+		e.logger.WithFields(log.Fields{
+			"metric":     key.String(),
+			"updated_at": metric.UpdatedAt,
+		}).Info("stale metric evicted")
+	}
+	return evicted
+}
+
+// evictable сообщает, устарела ли метрика по правилу с действием ActionEvict.
+func evictable(policy Policy, metric domain.Metrics, now time.Time) bool {
+	rule, stale := policy.Stale(metric, now)
+	return stale && rule.Action == ActionEvict
+}
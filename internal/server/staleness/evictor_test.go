@@ -0,0 +1,50 @@
+package staleness
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/guregu/null.v4"
+
+	"github.com/Axel791/metricsalert/internal/server/model/domain"
+	"github.com/Axel791/metricsalert/internal/server/repositories"
+)
+
+func TestEvictorRemovesOnlyEvictableMetrics(t *testing.T) {
+	ctx := context.Background()
+	logger := log.New()
+	logger.SetOutput(io.Discard)
+
+	now := time.Now()
+	gauge := func(name string, age time.Duration) domain.Metrics {
+		return domain.Metrics{Name: name, MType: domain.Gauge, Value: null.FloatFrom(1), UpdatedAt: now.Add(-age)}
+	}
+	store := repositories.NewMetricMapRepository()
+	require.NoError(t, store.BatchUpdateMetrics(ctx, []domain.Metrics{
+		gauge("agent.Alloc", time.Hour),
+		gauge("agent.HeapAlloc", time.Second),
+		gauge("Marked", time.Hour),
+	}))
+
+	evictor := NewEvictor(store, Policy{
+		Default: Rule{TTL: time.Minute, Action: ActionMark},
+		Rules:   []Rule{{Prefix: "agent.", Action: ActionEvict}},
+	}, logger)
+	assert.Equal(t, 1, evictor.Evict(ctx, now))
+
+	all, err := store.GetAllMetrics(ctx)
+	require.NoError(t, err)
+	assert.Len(t, all, 2)
+	assert.NotContains(t, all, domain.MetricKey{Name: "agent.Alloc", MType: domain.Gauge})
+
+	evictor.SetPolicy(Policy{Default: Rule{TTL: time.Minute, Action: ActionEvict}})
+	assert.Equal(t, 1, evictor.Evict(ctx, now))
+	all, err = store.GetAllMetrics(ctx)
+	require.NoError(t, err)
+	assert.Len(t, all, 1)
+}
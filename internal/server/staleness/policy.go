@@ -0,0 +1,114 @@
+// Package staleness определяет, какие метрики давно не обновлялись, и
+// периодически удаляет те из них, для которых это задано правилами.
+package staleness
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Axel791/metricsalert/internal/server/model/domain"
+)
+
+// Действия с устаревшей метрикой: пометить (метрика остаётся и отдаётся с
+// признаком stale) или удалить из хранилища.
+const (
+	ActionMark  = "mark"
+	ActionEvict = "evict"
+)
+
+// Rule - срок жизни метрик, имя которых начинается с Prefix. Нулевой TTL и
+// пустое действие берутся из правила по умолчанию.
+//
+// Пример в YAML-файле конфигурации:
+//
+//	staleness:
+//	  rules:
+//	    - prefix: "runtime."
+//	      ttl: 5m
+//	      action: evict
+type Rule struct {
+	// Prefix - начало имени метрики.
+	Prefix string `mapstructure:"prefix"`
+	// TTL - через сколько после последнего обновления метрика устаревает.
+	TTL time.Duration `mapstructure:"ttl"`
+	// Action - что делать с устаревшей метрикой: ActionMark или ActionEvict.
+	Action string `mapstructure:"action"`
+}
+
+// String возвращает правило в читаемом виде для логов.
+func (r Rule) String() string {
+	return fmt.Sprintf("%s*(ttl=%s, action=%s)", r.Prefix, r.TTL, r.Action)
+}
+
+// Validate проверяет корректность правила.
+func (r Rule) Validate() error {
+	if r.Prefix == "" {
+		return fmt.Errorf("staleness rule: prefix is required")
+	}
+	if r.TTL < 0 {
+		return fmt.Errorf("staleness rule %s: ttl must not be negative", r.Prefix)
+	}
+	if r.Action != "" && r.Action != ActionMark && r.Action != ActionEvict {
+		return fmt.Errorf("staleness rule %s: unknown action %q", r.Prefix, r.Action)
+	}
+	return nil
+}
+
+// Policy - правила по префиксам и правило по умолчанию для остальных
+// метрик. Нулевой TTL правила по умолчанию отключает проверку для метрик без
+// своего правила.
+type Policy struct {
+	Default Rule
+	Rules   []Rule
+}
+
+// Validate проверяет все правила политики.
+func (p Policy) Validate() error {
+	for _, r := range p.Rules {
+		if err := r.Validate(); err != nil {
+			return err
+		}
+	}
+	if p.Default.TTL < 0 {
+		return fmt.Errorf("default staleness rule: ttl must not be negative")
+	}
+	if p.Default.Action != ActionMark && p.Default.Action != ActionEvict {
+		return fmt.Errorf("default staleness rule: unknown action %q", p.Default.Action)
+	}
+	return nil
+}
+
+// For возвращает правило для метрики name: правило с самым длинным
+// подходящим префиксом с недостающими полями из Default, иначе Default.
+func (p Policy) For(name string) Rule {
+	match := -1
+	for i, r := range p.Rules {
+		if strings.HasPrefix(name, r.Prefix) && (match < 0 || len(r.Prefix) > len(p.Rules[match].Prefix)) {
+			match = i
+		}
+	}
+	if match < 0 {
+		return p.Default
+	}
+
+	rule := p.Rules[match]
+	if rule.TTL == 0 {
+		rule.TTL = p.Default.TTL
+	}
+	if rule.Action == "" {
+		rule.Action = p.Default.Action
+	}
+	return rule
+}
+
+// Stale сообщает, устарела ли метрика на момент now, и возвращает
+// применённое к ней правило. Метрики с неизвестным временем обновления не
+// устаревают.
+func (p Policy) Stale(metric domain.Metrics, now time.Time) (Rule, bool) {
+	rule := p.For(metric.Name)
+	if rule.TTL <= 0 || metric.UpdatedAt.IsZero() {
+		return rule, false
+	}
+	return rule, now.Sub(metric.UpdatedAt) > rule.TTL
+}
@@ -0,0 +1,58 @@
+package staleness
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Axel791/metricsalert/internal/server/model/domain"
+)
+
+func TestPolicyFor(t *testing.T) {
+	policy := Policy{
+		Default: Rule{TTL: time.Hour, Action: ActionMark},
+		Rules: []Rule{
+			{Prefix: "runtime.", TTL: 5 * time.Minute, Action: ActionEvict},
+			{Prefix: "runtime.gc.", TTL: time.Minute},
+			{Prefix: "batch.", Action: ActionEvict},
+		},
+	}
+	require.NoError(t, policy.Validate())
+
+	assert.Equal(t, Rule{Prefix: "runtime.", TTL: 5 * time.Minute, Action: ActionEvict}, policy.For("runtime.Alloc"))
+	assert.Equal(t, Rule{Prefix: "runtime.gc.", TTL: time.Minute, Action: ActionMark}, policy.For("runtime.gc.Pause"))
+	assert.Equal(t, Rule{Prefix: "batch.", TTL: time.Hour, Action: ActionEvict}, policy.For("batch.Jobs"))
+	assert.Equal(t, policy.Default, policy.For("PollCount"))
+}
+
+func TestPolicyStale(t *testing.T) {
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	policy := Policy{
+		Default: Rule{Action: ActionMark},
+		Rules:   []Rule{{Prefix: "runtime.", TTL: 5 * time.Minute}},
+	}
+	metric := func(name string, age time.Duration) domain.Metrics {
+		return domain.Metrics{Name: name, MType: domain.Gauge, UpdatedAt: now.Add(-age)}
+	}
+
+	_, stale := policy.Stale(metric("runtime.Alloc", 6*time.Minute), now)
+	assert.True(t, stale)
+	_, stale = policy.Stale(metric("runtime.Alloc", 5*time.Minute), now)
+	assert.False(t, stale, "metric expires only after TTL has passed")
+	_, stale = policy.Stale(metric("PollCount", 24*time.Hour), now)
+	assert.False(t, stale, "zero default TTL disables the check")
+	_, stale = policy.Stale(domain.Metrics{Name: "runtime.Alloc", MType: domain.Gauge}, now)
+	assert.False(t, stale, "metric with unknown update time never expires")
+}
+
+func TestPolicyValidate(t *testing.T) {
+	valid := Rule{Action: ActionMark}
+	assert.Error(t, Policy{Default: valid, Rules: []Rule{{TTL: time.Minute}}}.Validate())
+	assert.Error(t, Policy{Default: valid, Rules: []Rule{{Prefix: "a", TTL: -time.Minute}}}.Validate())
+	assert.Error(t, Policy{Default: valid, Rules: []Rule{{Prefix: "a", Action: "drop"}}}.Validate())
+	assert.Error(t, Policy{Default: Rule{Action: "drop"}}.Validate())
+	assert.Error(t, Policy{Default: Rule{TTL: -time.Second, Action: ActionMark}}.Validate())
+	assert.NoError(t, Policy{Default: valid}.Validate())
+}
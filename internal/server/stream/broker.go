@@ -0,0 +1,167 @@
+package stream
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Axel791/metricsalert/internal/server/telemetry"
+)
+
+// ErrClosed - брокер закрыт при остановке сервера.
+var ErrClosed = errors.New("stream is closed")
+
+// Broker рассылает события всем подписчикам, фильтр которых их пропускает.
+//
+// Publish не блокируется: у каждого подписчика свой буфер, и подписчик,
+// не успевший забрать события, отключается (Subscription.Lagged), а не
+// задерживает запись метрик. Клиент при переподключении заново получает
+// текущие значения.
+type Broker struct {
+	bufferSize int
+	metrics    *telemetry.ServerMetrics
+
+	// mutex: отправка в каналы идёт под RLock, закрытие каналов - под Lock.
+	mutex       sync.RWMutex
+	closed      bool
+	subscribers map[*Subscription]struct{}
+
+	lastID atomic.Uint64
+}
+
+// Subscription - подписка на события. Канал Events закрывается при Close,
+// отключении отстающего подписчика и закрытии брокера.
+type Subscription struct {
+	broker *Broker
+	filter Filter
+	events chan Event
+	lagged atomic.Bool
+}
+
+// NewBroker создаёт брокер с буфером bufferSize событий на подписчика.
+// metrics может быть nil.
+func NewBroker(bufferSize int, metrics *telemetry.ServerMetrics) *Broker {
+	return &Broker{
+		bufferSize:  bufferSize,
+		metrics:     metrics,
+		subscribers: make(map[*Subscription]struct{}),
+	}
+}
+
+// Subscribe регистрирует подписчика с фильтром filter. После Close
+// возвращает ErrClosed.
+func (b *Broker) Subscribe(filter Filter) (*Subscription, error) {
+	if err := filter.Validate(); err != nil {
+		return nil, err
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.closed {
+		return nil, ErrClosed
+	}
+	sub := &Subscription{broker: b, filter: filter, events: make(chan Event, b.bufferSize)}
+	b.subscribers[sub] = struct{}{}
+	b.metrics.SetStreamSubscribers(len(b.subscribers))
+	return sub, nil
+}
+
+// HasSubscribers сообщает, есть ли подписчики. Издатель может не готовить
+// события, если их некому отправлять.
+func (b *Broker) HasSubscribers() bool {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+
+	return len(b.subscribers) > 0
+}
+
+// Publish назначает событиям номера и рассылает их подписчикам.
+func (b *Broker) Publish(events ...Event) {
+	if len(events) == 0 {
+		return
+	}
+	now := time.Now()
+	for i := range events {
+		events[i].ID = b.lastID.Add(1)
+		if events[i].Time.IsZero() {
+			events[i].Time = now
+		}
+	}
+
+	var lagging []*Subscription
+	b.mutex.RLock()
+	for sub := range b.subscribers {
+		if !sub.offer(events) {
+			lagging = append(lagging, sub)
+		}
+	}
+	b.mutex.RUnlock()
+
+	for _, sub := range lagging {
+		if b.remove(sub, true) {
+			b.metrics.IncStreamLagging()
+		}
+	}
+}
+
+// Close отключает всех подписчиков; новые подписки не принимаются.
+func (b *Broker) Close() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.closed = true
+	for sub := range b.subscribers {
+		close(sub.events)
+		delete(b.subscribers, sub)
+	}
+	b.metrics.SetStreamSubscribers(0)
+}
+
+// remove отключает подписчика и сообщает, был ли он подключён. Признак
+// lagged выставляется до закрытия канала, чтобы читатель увидел его сразу.
+func (b *Broker) remove(sub *Subscription, lagged bool) bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if _, ok := b.subscribers[sub]; !ok {
+		return false
+	}
+	sub.lagged.Store(lagged)
+	close(sub.events)
+	delete(b.subscribers, sub)
+	b.metrics.SetStreamSubscribers(len(b.subscribers))
+	return true
+}
+
+// offer кладёт подходящие события в буфер подписки, не блокируясь, и
+// сообщает, хватило ли места. Вызывается под RLock брокера.
+func (s *Subscription) offer(events []Event) bool {
+	for _, event := range events {
+		if !s.filter.Matches(event.Metric) {
+			continue
+		}
+		select {
+		case s.events <- event:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// Events возвращает канал событий подписки.
+func (s *Subscription) Events() <-chan Event {
+	return s.events
+}
+
+// Lagged сообщает, отключена ли подписка из-за переполнения буфера.
+func (s *Subscription) Lagged() bool {
+	return s.lagged.Load()
+}
+
+// Close отменяет подписку. Повторный вызов безопасен.
+func (s *Subscription) Close() {
+	s.broker.remove(s, false)
+}
@@ -0,0 +1,145 @@
+package stream
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/guregu/null.v4"
+
+	"github.com/Axel791/metricsalert/internal/server/model/domain"
+	"github.com/Axel791/metricsalert/internal/server/model/dto"
+	"github.com/Axel791/metricsalert/internal/server/telemetry"
+)
+
+func gaugeEvent(name string, value float64) Event {
+	return Event{Action: ActionUpdate, Metric: dto.Metrics{ID: name, MType: domain.Gauge, Value: null.FloatFrom(value)}}
+}
+
+func counterEvent(name string, delta int64) Event {
+	return Event{Action: ActionUpdate, Metric: dto.Metrics{ID: name, MType: domain.Counter, Delta: null.IntFrom(delta)}}
+}
+
+// drain возвращает события, уже лежащие в буфере подписки.
+func drain(sub *Subscription) []Event {
+	var events []Event
+	for {
+		select {
+		case event, ok := <-sub.Events():
+			if !ok {
+				return events
+			}
+			events = append(events, event)
+		default:
+			return events
+		}
+	}
+}
+
+func TestFilter(t *testing.T) {
+	tests := []struct {
+		name    string
+		filter  Filter
+		metric  dto.Metrics
+		matches bool
+	}{
+		{"empty filter", Filter{}, dto.Metrics{ID: "Alloc", MType: domain.Gauge}, true},
+		{"name pattern", Filter{Names: []string{"Heap*"}}, dto.Metrics{ID: "HeapAlloc", MType: domain.Gauge}, true},
+		{"name mismatch", Filter{Names: []string{"Heap*"}}, dto.Metrics{ID: "Alloc", MType: domain.Gauge}, false},
+		{"any of patterns", Filter{Names: []string{"Heap*", "Alloc"}}, dto.Metrics{ID: "Alloc", MType: domain.Gauge}, true},
+		{"type", Filter{Types: []string{domain.Counter}}, dto.Metrics{ID: "PollCount", MType: domain.Counter}, true},
+		{"type mismatch", Filter{Types: []string{domain.Counter}}, dto.Metrics{ID: "Alloc", MType: domain.Gauge}, false},
+		{
+			"name and type", Filter{Names: []string{"Poll?ount"}, Types: []string{domain.Counter}},
+			dto.Metrics{ID: "PollCount", MType: domain.Counter}, true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.matches, tt.filter.Matches(tt.metric))
+		})
+	}
+
+	assert.Error(t, Filter{Names: []string{"["}}.Validate())
+	assert.Error(t, Filter{Types: []string{"histogram"}}.Validate())
+	assert.NoError(t, Filter{Names: []string{"*"}, Types: []string{domain.Gauge}}.Validate())
+}
+
+func TestBrokerPublishesToMatchingSubscribers(t *testing.T) {
+	broker := NewBroker(8, nil)
+	assert.False(t, broker.HasSubscribers())
+
+	all, err := broker.Subscribe(Filter{})
+	require.NoError(t, err)
+	counters, err := broker.Subscribe(Filter{Types: []string{domain.Counter}})
+	require.NoError(t, err)
+	assert.True(t, broker.HasSubscribers())
+
+	broker.Publish(gaugeEvent("Alloc", 1), counterEvent("PollCount", 5))
+
+	events := drain(all)
+	require.Len(t, events, 2)
+	assert.Equal(t, uint64(1), events[0].ID)
+	assert.Equal(t, uint64(2), events[1].ID)
+	assert.False(t, events[0].Time.IsZero())
+
+	events = drain(counters)
+	require.Len(t, events, 1)
+	assert.Equal(t, "PollCount", events[0].Metric.ID)
+	assert.Equal(t, uint64(2), events[0].ID)
+
+	counters.Close()
+	counters.Close()
+	_, ok := <-counters.Events()
+	assert.False(t, ok)
+	assert.False(t, counters.Lagged())
+
+	broker.Publish(counterEvent("PollCount", 6))
+	assert.Len(t, drain(all), 1)
+}
+
+func TestBrokerDisconnectsLaggingSubscriber(t *testing.T) {
+	metrics := telemetry.NewServerMetrics(telemetry.NewRegistry())
+	broker := NewBroker(2, metrics)
+
+	slow, err := broker.Subscribe(Filter{})
+	require.NoError(t, err)
+	fast, err := broker.Subscribe(Filter{})
+	require.NoError(t, err)
+	assert.Equal(t, float64(2), metrics.StreamClients.Value())
+
+	broker.Publish(gaugeEvent("A", 1), gaugeEvent("B", 2))
+	assert.Len(t, drain(fast), 2)
+	broker.Publish(gaugeEvent("C", 3))
+
+	assert.Len(t, drain(slow), 2, "buffered events are delivered before the channel is closed")
+	assert.True(t, slow.Lagged())
+	assert.Len(t, drain(fast), 1)
+	assert.False(t, fast.Lagged())
+	assert.Equal(t, float64(1), metrics.StreamLagging.Value())
+	assert.Equal(t, float64(1), metrics.StreamClients.Value())
+}
+
+func TestBrokerClose(t *testing.T) {
+	broker := NewBroker(1, nil)
+	sub, err := broker.Subscribe(Filter{})
+	require.NoError(t, err)
+
+	broker.Close()
+	select {
+	case _, ok := <-sub.Events():
+		assert.False(t, ok)
+	case <-time.After(time.Second):
+		t.Fatal("subscription is not closed")
+	}
+	assert.False(t, sub.Lagged())
+	sub.Close()
+
+	_, err = broker.Subscribe(Filter{})
+	assert.ErrorIs(t, err, ErrClosed)
+	broker.Publish(gaugeEvent("Alloc", 1))
+
+	_, err = NewBroker(1, nil).Subscribe(Filter{Names: []string{"["}})
+	assert.Error(t, err)
+}
@@ -0,0 +1,87 @@
+// Package stream рассылает изменения метрик подписчикам внутри процесса.
+//
+// repositories.PublishingStore публикует событие после каждой успешной
+// записи в хранилище, а обработчик GET /api/v1/metrics/stream передаёт события
+// клиентам по Server-Sent Events.
+package stream
+
+import (
+	"fmt"
+	"path"
+	"time"
+
+	"github.com/Axel791/metricsalert/internal/server/model/domain"
+	"github.com/Axel791/metricsalert/internal/server/model/dto"
+)
+
+// Действия событий.
+const (
+	// ActionUpdate - метрика записана; Metric содержит значение после записи.
+	ActionUpdate = "update"
+	// ActionReset - counter обнулён.
+	ActionReset = "reset"
+	// ActionDelete - метрика удалена; в Metric заполнены только ID и MType.
+	ActionDelete = "delete"
+)
+
+// Event - изменение одной метрики.
+type Event struct {
+	// ID - порядковый номер события, назначается Broker.Publish.
+	ID     uint64
+	Action string
+	Metric dto.Metrics
+	Time   time.Time
+}
+
+// Filter отбирает события подписчика. Пустой список не ограничивает выбор.
+type Filter struct {
+	// Names - шаблоны имени метрики в синтаксисе path.Match: "*" - любая
+	// последовательность символов, "?" - один символ.
+	Names []string
+	// Types - типы метрик (counter, gauge).
+	Types []string
+}
+
+// Validate проверяет шаблоны и типы фильтра.
+func (f Filter) Validate() error {
+	for _, pattern := range f.Names {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid name pattern %q: %w", pattern, err)
+		}
+	}
+	for _, metricType := range f.Types {
+		if metricType != domain.Counter && metricType != domain.Gauge {
+			return fmt.Errorf("invalid metric type %q", metricType)
+		}
+	}
+	return nil
+}
+
+// Matches сообщает, подходит ли метрика под фильтр.
+func (f Filter) Matches(metric dto.Metrics) bool {
+	return f.matchesType(metric.MType) && f.matchesName(metric.ID)
+}
+
+func (f Filter) matchesType(metricType string) bool {
+	if len(f.Types) == 0 {
+		return true
+	}
+	for _, t := range f.Types {
+		if t == metricType {
+			return true
+		}
+	}
+	return false
+}
+
+func (f Filter) matchesName(name string) bool {
+	if len(f.Names) == 0 {
+		return true
+	}
+	for _, pattern := range f.Names {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
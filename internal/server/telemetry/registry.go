@@ -0,0 +1,433 @@
+// Package telemetry собирает метрики о работе самого сервера: число и
+// длительность HTTP-запросов, размеры пачек, задержки хранилища, повторы
+// запросов к БД и длительность сохранения файла.
+//
+// Метрики отдаются в текстовом формате Prometheus на внутреннем адресе и
+// при желании записываются в собственное хранилище сервера под
+// зарезервированным префиксом (см. Reporter).
+//
+// Все методы безопасны для nil-получателя: если телеметрия не настроена,
+// инструментированный код просто ничего не записывает.
+package telemetry
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// DefaultBuckets - границы корзин гистограмм длительностей в секундах.
+var DefaultBuckets = []float64{0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5}
+
+// SizeBuckets - границы корзин гистограмм размеров пачек.
+var SizeBuckets = []float64{1, 5, 10, 25, 50, 100, 250, 500, 1000, 5000}
+
+// Registry хранит все семейства метрик процесса.
+type Registry struct {
+	mu       sync.RWMutex
+	families map[string]family
+}
+
+type family interface {
+	name() string
+	write(w io.Writer) error
+	samples() []Sample
+}
+
+// Sample - одно значение серии метрик для записи в хранилище.
+type Sample struct {
+	Name   string
+	Labels []string
+	Value  float64
+}
+
+// NewRegistry создаёт пустой реестр.
+func NewRegistry() *Registry {
+	return &Registry{families: make(map[string]family)}
+}
+
+// Counter возвращает счётчик name с заданными именами меток, создавая его
+// при первом обращении.
+func (r *Registry) Counter(name, help string, labelNames ...string) *Counter {
+	if r == nil {
+		return nil
+	}
+	return register(r, name, func() *Counter {
+		return &Counter{meta: newMeta(name, help, labelNames), series: make(map[string]*counterSeries)}
+	})
+}
+
+// Gauge возвращает измеритель name с заданными именами меток, создавая его
+// при первом обращении.
+func (r *Registry) Gauge(name, help string, labelNames ...string) *Gauge {
+	if r == nil {
+		return nil
+	}
+	return register(r, name, func() *Gauge {
+		return &Gauge{Counter{meta: newMeta(name, help, labelNames), series: make(map[string]*counterSeries)}}
+	})
+}
+
+// Histogram возвращает гистограмму name с границами buckets, создавая её
+// при первом обращении.
+func (r *Registry) Histogram(name, help string, buckets []float64, labelNames ...string) *Histogram {
+	if r == nil {
+		return nil
+	}
+	return register(r, name, func() *Histogram {
+		return &Histogram{
+			meta:    newMeta(name, help, labelNames),
+			buckets: append([]float64(nil), buckets...),
+			series:  make(map[string]*histogramSeries),
+		}
+	})
+}
+
+func register[T family](r *Registry, name string, create func() T) T {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if existing, ok := r.families[name]; ok {
+		f, ok := existing.(T)
+		if !ok {
+			panic(fmt.Sprintf("telemetry: metric %q registered with another type", name))
+		}
+		return f
+	}
+	f := create()
+	r.families[name] = f
+	return f
+}
+
+// WritePrometheus пишет все метрики в текстовом формате Prometheus.
+func (r *Registry) WritePrometheus(w io.Writer) error {
+	if r == nil {
+		return nil
+	}
+	for _, f := range r.sortedFamilies() {
+		if err := f.write(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Samples возвращает плоский список значений всех серий. Гистограммы
+// раскладываются на _count и _sum.
+func (r *Registry) Samples() []Sample {
+	if r == nil {
+		return nil
+	}
+	var out []Sample
+	for _, f := range r.sortedFamilies() {
+		out = append(out, f.samples()...)
+	}
+	return out
+}
+
+func (r *Registry) sortedFamilies() []family {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	out := make([]family, 0, len(r.families))
+	for _, f := range r.families {
+		out = append(out, f)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].name() < out[j].name() })
+	return out
+}
+
+type meta struct {
+	metricName string
+	help       string
+	labelNames []string
+}
+
+func newMeta(name, help string, labelNames []string) meta {
+	return meta{metricName: name, help: help, labelNames: labelNames}
+}
+
+func (m meta) name() string { return m.metricName }
+
+// key склеивает значения меток в ключ серии.
+func (m meta) key(labelValues []string) string {
+	if len(labelValues) != len(m.labelNames) {
+		panic(fmt.Sprintf(
+			"telemetry: metric %q expects %d label values, got %d",
+			m.metricName, len(m.labelNames), len(labelValues),
+		))
+	}
+	return strings.Join(labelValues, "\xff")
+}
+
+func (m meta) writeHeader(w io.Writer, kind string) error {
+	_, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", m.metricName, m.help, m.metricName, kind)
+	return err
+}
+
+// labels форматирует метки серии, extra добавляется последней парой.
+func (m meta) labels(values []string, extra ...string) string {
+	pairs := make([]string, 0, len(values)+1)
+	for i, v := range values {
+		pairs = append(pairs, fmt.Sprintf("%s=%q", m.labelNames[i], v))
+	}
+	if len(extra) == 2 {
+		pairs = append(pairs, fmt.Sprintf("%s=%q", extra[0], extra[1]))
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func (m meta) labelPairs(values []string) []string {
+	out := make([]string, 0, 2*len(values))
+	for i, v := range values {
+		out = append(out, m.labelNames[i], v)
+	}
+	return out
+}
+
+// Counter - монотонно растущий счётчик с метками.
+type Counter struct {
+	meta
+	mu     sync.Mutex
+	series map[string]*counterSeries
+}
+
+type counterSeries struct {
+	labelValues []string
+	value       float64
+}
+
+// Inc увеличивает счётчик серии с метками labelValues на единицу.
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add увеличивает счётчик серии с метками labelValues на delta.
+func (c *Counter) Add(delta float64, labelValues ...string) {
+	if c == nil {
+		return
+	}
+	key := c.key(labelValues)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	s, ok := c.series[key]
+	if !ok {
+		s = &counterSeries{labelValues: append([]string(nil), labelValues...)}
+		c.series[key] = s
+	}
+	s.value += delta
+}
+
+// Value возвращает текущее значение серии.
+func (c *Counter) Value(labelValues ...string) float64 {
+	if c == nil {
+		return 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if s, ok := c.series[c.key(labelValues)]; ok {
+		return s.value
+	}
+	return 0
+}
+
+func (c *Counter) sorted() []counterSeries {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	out := make([]counterSeries, 0, len(c.series))
+	for _, s := range c.series {
+		out = append(out, *s)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return strings.Join(out[i].labelValues, "\xff") < strings.Join(out[j].labelValues, "\xff")
+	})
+	return out
+}
+
+func (c *Counter) write(w io.Writer) error {
+	if err := c.writeHeader(w, "counter"); err != nil {
+		return err
+	}
+	for _, s := range c.sorted() {
+		if _, err := fmt.Fprintf(w, "%s%s %s\n", c.metricName, c.labels(s.labelValues), formatFloat(s.value)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Counter) samples() []Sample {
+	var out []Sample
+	for _, s := range c.sorted() {
+		out = append(out, Sample{Name: c.metricName, Labels: c.labelPairs(s.labelValues), Value: s.value})
+	}
+	return out
+}
+
+// Gauge - текущее значение с метками, которое может и уменьшаться.
+type Gauge struct {
+	Counter
+}
+
+// Set устанавливает значение серии с метками labelValues.
+func (g *Gauge) Set(v float64, labelValues ...string) {
+	if g == nil {
+		return
+	}
+	key := g.key(labelValues)
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	s, ok := g.series[key]
+	if !ok {
+		s = &counterSeries{labelValues: append([]string(nil), labelValues...)}
+		g.series[key] = s
+	}
+	s.value = v
+}
+
+// Value возвращает текущее значение серии.
+func (g *Gauge) Value(labelValues ...string) float64 {
+	if g == nil {
+		return 0
+	}
+	return g.Counter.Value(labelValues...)
+}
+
+func (g *Gauge) write(w io.Writer) error {
+	if err := g.writeHeader(w, "gauge"); err != nil {
+		return err
+	}
+	for _, s := range g.sorted() {
+		if _, err := fmt.Fprintf(w, "%s%s %s\n", g.metricName, g.labels(s.labelValues), formatFloat(s.value)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Histogram - распределение наблюдаемых значений по корзинам с метками.
+type Histogram struct {
+	meta
+	buckets []float64
+	mu      sync.Mutex
+	series  map[string]*histogramSeries
+}
+
+type histogramSeries struct {
+	labelValues []string
+	counts      []uint64
+	count       uint64
+	sum         float64
+}
+
+// Observe добавляет значение v в серию с метками labelValues.
+func (h *Histogram) Observe(v float64, labelValues ...string) {
+	if h == nil {
+		return
+	}
+	key := h.key(labelValues)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	s, ok := h.series[key]
+	if !ok {
+		s = &histogramSeries{
+			labelValues: append([]string(nil), labelValues...),
+			counts:      make([]uint64, len(h.buckets)),
+		}
+		h.series[key] = s
+	}
+	for i, upper := range h.buckets {
+		if v <= upper {
+			s.counts[i]++
+		}
+	}
+	s.count++
+	s.sum += v
+}
+
+// Count возвращает число наблюдений в серии.
+func (h *Histogram) Count(labelValues ...string) uint64 {
+	if h == nil {
+		return 0
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if s, ok := h.series[h.key(labelValues)]; ok {
+		return s.count
+	}
+	return 0
+}
+
+func (h *Histogram) sorted() []histogramSeries {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	out := make([]histogramSeries, 0, len(h.series))
+	for _, s := range h.series {
+		cp := *s
+		cp.counts = append([]uint64(nil), s.counts...)
+		out = append(out, cp)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return strings.Join(out[i].labelValues, "\xff") < strings.Join(out[j].labelValues, "\xff")
+	})
+	return out
+}
+
+func (h *Histogram) write(w io.Writer) error {
+	if err := h.writeHeader(w, "histogram"); err != nil {
+		return err
+	}
+	for _, s := range h.sorted() {
+		for i, upper := range h.buckets {
+			if _, err := fmt.Fprintf(
+				w, "%s_bucket%s %d\n", h.metricName, h.labels(s.labelValues, "le", formatFloat(upper)), s.counts[i],
+			); err != nil {
+				return err
+			}
+		}
+		if _, err := fmt.Fprintf(
+			w, "%s_bucket%s %d\n%s_sum%s %s\n%s_count%s %d\n",
+			h.metricName, h.labels(s.labelValues, "le", "+Inf"), s.count,
+			h.metricName, h.labels(s.labelValues), formatFloat(s.sum),
+			h.metricName, h.labels(s.labelValues), s.count,
+		); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (h *Histogram) samples() []Sample {
+	var out []Sample
+	for _, s := range h.sorted() {
+		labels := h.labelPairs(s.labelValues)
+		out = append(out,
+			Sample{Name: h.metricName + "_count", Labels: labels, Value: float64(s.count)},
+			Sample{Name: h.metricName + "_sum", Labels: labels, Value: s.sum},
+		)
+	}
+	return out
+}
+
+func formatFloat(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	return fmt.Sprintf("%g", v)
+}
@@ -0,0 +1,117 @@
+package telemetry
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Axel791/metricsalert/internal/server/model/domain"
+)
+
+func TestRegistry_WritePrometheus(t *testing.T) {
+	r := NewRegistry()
+	requests := r.Counter("requests_total", "Requests.", "route", "status")
+	requests.Inc("/update", "200")
+	requests.Inc("/update", "200")
+	requests.Inc("/value", "404")
+
+	latency := r.Histogram("latency_seconds", "Latency.", []float64{0.1, 1})
+	latency.Observe(0.05)
+	latency.Observe(0.5)
+
+	var buf bytes.Buffer
+	require.NoError(t, r.WritePrometheus(&buf))
+
+	expected := `# HELP latency_seconds Latency.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{le="0.1"} 1
+latency_seconds_bucket{le="1"} 2
+latency_seconds_bucket{le="+Inf"} 2
+latency_seconds_sum 0.55
+latency_seconds_count 2
+# HELP requests_total Requests.
+# TYPE requests_total counter
+requests_total{route="/update",status="200"} 2
+requests_total{route="/value",status="404"} 1
+`
+	assert.Equal(t, expected, buf.String())
+	assert.Equal(t, float64(2), requests.Value("/update", "200"))
+	assert.Equal(t, uint64(2), latency.Count())
+}
+
+func TestGauge_WritePrometheus(t *testing.T) {
+	r := NewRegistry()
+	inFlight := r.Gauge("in_flight", "In flight.", "route")
+	inFlight.Set(3, "/update")
+	inFlight.Set(1, "/update")
+
+	var buf bytes.Buffer
+	require.NoError(t, r.WritePrometheus(&buf))
+
+	expected := `# HELP in_flight In flight.
+# TYPE in_flight gauge
+in_flight{route="/update"} 1
+`
+	assert.Equal(t, expected, buf.String())
+	assert.Equal(t, float64(1), inFlight.Value("/update"))
+}
+
+func TestServerMetrics_LastWrite(t *testing.T) {
+	m := NewServerMetrics(NewRegistry())
+	assert.True(t, m.LastWrite().IsZero())
+
+	at := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	m.MarkWrite(at)
+	assert.WithinDuration(t, at, m.LastWrite(), time.Microsecond)
+}
+
+func TestRegistry_SameNameReturnsSameMetric(t *testing.T) {
+	r := NewRegistry()
+	assert.Same(t, r.Counter("c", "help"), r.Counter("c", "help"))
+	assert.Panics(t, func() { r.Histogram("c", "help", DefaultBuckets) })
+}
+
+func TestNilMetricsAreNoop(t *testing.T) {
+	var m *ServerMetrics
+	assert.NotPanics(t, func() {
+		m.IncDBRetry()
+		m.ObserveBatch("memory", 10)
+		m.MarkWrite(time.Now())
+	})
+	assert.True(t, m.LastWrite().IsZero())
+
+	var r *Registry
+	assert.Nil(t, r.Counter("c", "help"))
+	assert.NotPanics(t, func() { r.Counter("c", "help").Inc() })
+}
+
+type batchRecorder struct {
+	metrics []domain.Metrics
+}
+
+func (b *batchRecorder) BatchUpdateMetrics(_ context.Context, metrics []domain.Metrics) error {
+	b.metrics = append(b.metrics, metrics...)
+	return nil
+}
+
+func TestReporter_Report(t *testing.T) {
+	r := NewRegistry()
+	m := NewServerMetrics(r)
+	m.HTTPRequests.Inc("/update/{metricType}", "POST", "200")
+	m.IncDBRetry()
+
+	store := &batchRecorder{}
+	require.NoError(t, NewReporter(r, store, nil).Report(context.Background()))
+
+	values := make(map[string]float64, len(store.metrics))
+	for _, metric := range store.metrics {
+		assert.Equal(t, domain.Gauge, metric.MType)
+		values[metric.Name] = metric.Value.Float64
+	}
+	assert.Equal(t, float64(1), values["_server.http_requests_total:_update__metricType_:POST:200"])
+	assert.Equal(t, float64(1), values["_server.db_retries_total"])
+}
@@ -0,0 +1,90 @@
+package telemetry
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/guregu/null.v4"
+
+	"github.com/Axel791/metricsalert/internal/server/model/domain"
+)
+
+// BatchWriter - хранилище, в которое Reporter записывает метрики сервера.
+type BatchWriter interface {
+	BatchUpdateMetrics(ctx context.Context, metrics []domain.Metrics) error
+}
+
+// Reporter периодически записывает метрики сервера в его же хранилище
+// как gauge под префиксом domain.ReservedPrefix.
+type Reporter struct {
+	registry *Registry
+	store    BatchWriter
+	logger   *log.Logger
+}
+
+// NewReporter создаёт Reporter.
+func NewReporter(registry *Registry, store BatchWriter, logger *log.Logger) *Reporter {
+	return &Reporter{registry: registry, store: store, logger: logger}
+}
+
+// Run записывает метрики раз в interval до отмены ctx.
+func (r *Reporter) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := r.Report(ctx); err != nil {
+				r.logger.Warnf("error writing server telemetry to store: %v", err)
+			}
+		}
+	}
+}
+
+// Report однократно записывает текущие значения метрик.
+func (r *Reporter) Report(ctx context.Context) error {
+	samples := r.registry.Samples()
+	if len(samples) == 0 {
+		return nil
+	}
+
+	metrics := make([]domain.Metrics, 0, len(samples))
+	for _, s := range samples {
+		metrics = append(metrics, domain.Metrics{
+			Name:  StoreName(s),
+			MType: domain.Gauge,
+			Value: null.FloatFrom(s.Value),
+		})
+	}
+	return r.store.BatchUpdateMetrics(ctx, metrics)
+}
+
+// StoreName строит имя метрики в хранилище: префикс, имя и значения меток
+// через двоеточие, например "_server.http_requests_total:_update:POST:200".
+// Символы, мешающие использовать имя в URL, заменяются на "_".
+func StoreName(s Sample) string {
+	var b strings.Builder
+	b.WriteString(domain.ReservedPrefix)
+	b.WriteString(s.Name)
+	for i := 1; i < len(s.Labels); i += 2 {
+		b.WriteByte(':')
+		b.WriteString(sanitize(s.Labels[i]))
+	}
+	return b.String()
+}
+
+func sanitize(value string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_', r == '-', r == '.':
+			return r
+		default:
+			return '_'
+		}
+	}, value)
+}
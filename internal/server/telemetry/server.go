@@ -0,0 +1,183 @@
+package telemetry
+
+import (
+	"net/http"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// ServerMetrics - набор метрик сервера. Нулевой указатель допустим и
+// означает, что телеметрия выключена.
+type ServerMetrics struct {
+	Registry *Registry
+
+	HTTPRequests     *Counter
+	HTTPDuration     *Histogram
+	BatchSize        *Histogram
+	StoreDuration    *Histogram
+	StoreErrors      *Counter
+	DBRetries        *Counter
+	DBBreakerState   *Gauge
+	FileSaveDuration *Histogram
+	StoreLastWrite   *Gauge
+	AuditDropped     *Counter
+	AuditErrors      *Counter
+	StreamClients    *Gauge
+	StreamLagging    *Counter
+}
+
+// NewServerMetrics регистрирует метрики сервера в реестре r.
+func NewServerMetrics(r *Registry) *ServerMetrics {
+	return &ServerMetrics{
+		Registry: r,
+		HTTPRequests: r.Counter(
+			"http_requests_total", "Number of HTTP requests.", "route", "method", "status",
+		),
+		HTTPDuration: r.Histogram(
+			"http_request_duration_seconds", "HTTP request latency.", DefaultBuckets, "route", "method", "status",
+		),
+		BatchSize: r.Histogram(
+			"metrics_batch_size", "Number of metrics in batch updates.", SizeBuckets, "backend",
+		),
+		StoreDuration: r.Histogram(
+			"store_operation_duration_seconds", "Store operation latency.", DefaultBuckets, "backend", "operation",
+		),
+		StoreErrors: r.Counter(
+			"store_operation_errors_total", "Number of failed store operations.", "backend", "operation",
+		),
+		DBRetries: r.Counter(
+			"db_retries_total", "Number of retried database operations.",
+		),
+		DBBreakerState: r.Gauge(
+			"db_circuit_breaker_state", "Database circuit breaker state: 0 closed, 1 half-open, 2 open.",
+		),
+		FileSaveDuration: r.Histogram(
+			"file_store_save_duration_seconds", "Duration of saving metrics to file.", DefaultBuckets,
+		),
+		StoreLastWrite: r.Gauge(
+			"store_last_write_timestamp_seconds", "Unix time of the last successful write to the store.",
+		),
+		AuditDropped: r.Counter(
+			"audit_events_dropped_total", "Number of audit events dropped because the delivery queue was full.",
+		),
+		AuditErrors: r.Counter(
+			"audit_events_failed_total", "Number of audit events that could not be delivered to a sink.", "sink",
+		),
+		StreamClients: r.Gauge(
+			"stream_subscribers", "Number of active metrics stream subscribers.",
+		),
+		StreamLagging: r.Counter(
+			"stream_subscribers_lagging_total", "Number of metrics stream subscribers disconnected for falling behind.",
+		),
+	}
+}
+
+// ObserveStore записывает длительность операции хранилища и ошибку, если она есть.
+func (m *ServerMetrics) ObserveStore(backend, operation string, start time.Time, err error) {
+	if m == nil {
+		return
+	}
+	m.StoreDuration.Observe(time.Since(start).Seconds(), backend, operation)
+	if err != nil {
+		m.StoreErrors.Inc(backend, operation)
+	}
+}
+
+// MarkWrite отмечает момент успешной записи в хранилище.
+func (m *ServerMetrics) MarkWrite(at time.Time) {
+	if m == nil {
+		return
+	}
+	m.StoreLastWrite.Set(float64(at.UnixNano()) / float64(time.Second))
+}
+
+// LastWrite возвращает момент последней успешной записи в хранилище или
+// нулевое время, если записей ещё не было.
+func (m *ServerMetrics) LastWrite() time.Time {
+	if m == nil {
+		return time.Time{}
+	}
+	seconds := m.StoreLastWrite.Value()
+	if seconds == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, int64(seconds*float64(time.Second)))
+}
+
+// ObserveBatch записывает размер пачки метрик.
+func (m *ServerMetrics) ObserveBatch(backend string, size int) {
+	if m == nil {
+		return
+	}
+	m.BatchSize.Observe(float64(size), backend)
+}
+
+// ObserveFileSave записывает длительность сохранения файла.
+func (m *ServerMetrics) ObserveFileSave(start time.Time) {
+	if m == nil {
+		return
+	}
+	m.FileSaveDuration.Observe(time.Since(start).Seconds())
+}
+
+// IncDBRetry увеличивает счётчик повторов запросов к БД.
+func (m *ServerMetrics) IncDBRetry() {
+	if m == nil {
+		return
+	}
+	m.DBRetries.Inc()
+}
+
+// SetDBBreakerState записывает состояние автомата защиты БД.
+func (m *ServerMetrics) SetDBBreakerState(state float64) {
+	if m == nil {
+		return
+	}
+	m.DBBreakerState.Set(state)
+}
+
+// IncAuditDropped увеличивает счётчик событий аудита, не попавших в очередь.
+func (m *ServerMetrics) IncAuditDropped() {
+	if m == nil {
+		return
+	}
+	m.AuditDropped.Inc()
+}
+
+// AddAuditErrors увеличивает счётчик событий аудита, не доставленных в sink.
+func (m *ServerMetrics) AddAuditErrors(sink string, events int) {
+	if m == nil {
+		return
+	}
+	m.AuditErrors.Add(float64(events), sink)
+}
+
+// SetStreamSubscribers записывает число подписчиков потока метрик.
+func (m *ServerMetrics) SetStreamSubscribers(n int) {
+	if m == nil {
+		return
+	}
+	m.StreamClients.Set(float64(n))
+}
+
+// IncStreamLagging увеличивает счётчик отключённых отстающих подписчиков.
+func (m *ServerMetrics) IncStreamLagging() {
+	if m == nil {
+		return
+	}
+	m.StreamLagging.Inc()
+}
+
+// Handler отдаёт метрики в текстовом формате Prometheus.
+func (m *ServerMetrics) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		if m == nil {
+			return
+		}
+		if err := m.Registry.WritePrometheus(w); err != nil {
+			log.Errorf("error writing telemetry: %v", err)
+		}
+	})
+}
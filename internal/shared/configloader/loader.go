@@ -0,0 +1,303 @@
+// Package configloader собирает типизированную конфигурацию из нескольких
+// источников и запоминает, откуда взято каждое значение.
+//
+// Приоритет источников (от высшего к низшему):
+//
+//	флаги командной строки > переменные окружения > файл .env >
+//	файл конфигурации (-c/-config или CONFIG) > значения по умолчанию
+//
+// Файл конфигурации может быть в формате YAML, TOML или JSON (определяется по
+// расширению) и содержит вложенные секции, например:
+//
+//	storage:
+//	  file_path: ./data.json
+//	  store_interval: 5m
+//
+// Для совместимости в файле также принимаются плоские ключи с именами
+// переменных окружения ("STORE_INTERVAL": "300"), как в прежних
+// server_config.json/agent_config.json.
+//
+// Интервалы задаются либо числом секунд ("300"), либо строкой time.Duration ("5m").
+package configloader
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// Source - источник, из которого взято значение настройки.
+type Source string
+
+const (
+	SourceDefault Source = "default"
+	SourceFile    Source = "file"
+	SourceDotEnv  Source = ".env"
+	SourceEnv     Source = "env"
+	SourceFlag    Source = "flag"
+)
+
+// ConfigEnv - переменная окружения с путём к файлу конфигурации.
+const ConfigEnv = "CONFIG"
+
+// dotEnvPath - файл с переменными окружения в рабочем каталоге.
+const dotEnvPath = ".env"
+
+// Option описывает одну настройку.
+//
+// Key - путь в файле конфигурации через точку ("storage.file_path"),
+// он же ключ в итоговой структуре (теги mapstructure). Env и Flag
+// необязательны. Тип настройки определяется типом Default: string, bool,
+// int, int64, float64 или time.Duration. Настройки другого типа (например,
+// списки правил) читаются только из файла.
+type Option struct {
+	Key     string
+	Env     string
+	Flag    string
+	Usage   string
+	Default any
+	Secret  bool
+}
+
+// Loader загружает настройки и хранит их значения вместе с источником.
+type Loader struct {
+	options     []Option
+	defaultFile string
+
+	values      map[string]any
+	sources     map[string]Source
+	file        string
+	printConfig bool
+}
+
+// New создаёт загрузчик для набора настроек. defaultFile используется,
+// если путь к файлу не задан ни флагом, ни переменной CONFIG; его
+// отсутствие не считается ошибкой.
+func New(options []Option, defaultFile string) *Loader {
+	return &Loader{
+		options:     options,
+		defaultFile: defaultFile,
+	}
+}
+
+// Load читает все источники. args - аргументы командной строки без имени программы.
+func (l *Loader) Load(name string, args []string) error {
+	l.values = make(map[string]any, len(l.options))
+	l.sources = make(map[string]Source, len(l.options))
+
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	flagValues := l.registerFlags(fs)
+
+	var configPath string
+	fs.StringVar(&configPath, "c", "", "path to config file (YAML, TOML or JSON)")
+	fs.StringVar(&configPath, "config", "", "path to config file (YAML, TOML or JSON)")
+	fs.BoolVar(&l.printConfig, "print-config", false, "print effective configuration with sources and exit")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	for _, opt := range l.options {
+		l.set(opt, opt.Default, SourceDefault)
+	}
+
+	if err := l.loadFile(configPath); err != nil {
+		return err
+	}
+	if err := l.loadDotEnv(); err != nil {
+		return err
+	}
+	if err := l.loadEnv(); err != nil {
+		return err
+	}
+
+	var flagErr error
+	fs.Visit(func(f *flag.Flag) {
+		value, ok := flagValues[f.Name]
+		if !ok || flagErr != nil {
+			return
+		}
+		parsed, err := parseValue(value.opt.Default, value.raw)
+		if err != nil {
+			flagErr = fmt.Errorf("flag -%s: %w", f.Name, err)
+			return
+		}
+		l.set(value.opt, parsed, SourceFlag)
+	})
+	return flagErr
+}
+
+// Decode заполняет out (указатель на структуру с тегами mapstructure)
+// итоговыми значениями настроек.
+func (l *Loader) Decode(out any) error {
+	v := viper.New()
+	for _, opt := range l.options {
+		v.Set(opt.Key, l.values[opt.Key])
+	}
+	return v.Unmarshal(out)
+}
+
+// File возвращает путь к прочитанному файлу конфигурации или "".
+func (l *Loader) File() string {
+	return l.file
+}
+
+// PrintConfig сообщает, запрошен ли вывод итоговой конфигурации.
+func (l *Loader) PrintConfig() bool {
+	return l.printConfig
+}
+
+// Source возвращает источник значения настройки key.
+func (l *Loader) Source(key string) Source {
+	return l.sources[key]
+}
+
+func (l *Loader) set(opt Option, value any, source Source) {
+	l.values[opt.Key] = value
+	l.sources[opt.Key] = source
+}
+
+func (l *Loader) loadFile(path string) error {
+	explicit := path != ""
+	if !explicit {
+		path = os.Getenv(ConfigEnv)
+		explicit = path != ""
+	}
+	if !explicit {
+		path = l.defaultFile
+	}
+	if path == "" {
+		return nil
+	}
+
+	if info, err := os.Stat(path); err != nil || info.IsDir() {
+		if explicit {
+			return fmt.Errorf("config file %q not found", path)
+		}
+		return nil
+	}
+
+	v := viper.New()
+	v.SetConfigFile(path)
+	if ext := strings.TrimPrefix(filepath.Ext(path), "."); ext == "" {
+		v.SetConfigType("json")
+	}
+	if err := v.ReadInConfig(); err != nil {
+		return fmt.Errorf("read config file %q: %w", path, err)
+	}
+
+	for _, opt := range l.options {
+		raw, ok := lookupFile(v, opt)
+		if !ok {
+			continue
+		}
+		value, err := convertFileValue(opt.Default, raw)
+		if err != nil {
+			return fmt.Errorf("config file %q, key %s: %w", path, opt.Key, err)
+		}
+		l.set(opt, value, SourceFile)
+	}
+	l.file = path
+	return nil
+}
+
+func (l *Loader) loadDotEnv() error {
+	if _, err := os.Stat(dotEnvPath); err != nil {
+		return nil
+	}
+
+	v := viper.New()
+	v.SetConfigFile(dotEnvPath)
+	v.SetConfigType("env")
+	if err := v.ReadInConfig(); err != nil {
+		return fmt.Errorf("read %s: %w", dotEnvPath, err)
+	}
+
+	for _, opt := range l.options {
+		if opt.Env == "" || !v.IsSet(opt.Env) {
+			continue
+		}
+		value, err := parseValue(opt.Default, v.GetString(opt.Env))
+		if err != nil {
+			return fmt.Errorf("%s, %s: %w", dotEnvPath, opt.Env, err)
+		}
+		l.set(opt, value, SourceDotEnv)
+	}
+	return nil
+}
+
+func (l *Loader) loadEnv() error {
+	var errs []error
+	for _, opt := range l.options {
+		if opt.Env == "" {
+			continue
+		}
+		raw, ok := os.LookupEnv(opt.Env)
+		if !ok {
+			continue
+		}
+		value, err := parseValue(opt.Default, raw)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("env %s: %w", opt.Env, err))
+			continue
+		}
+		l.set(opt, value, SourceEnv)
+	}
+	return errors.Join(errs...)
+}
+
+// lookupFile ищет значение сначала по вложенному ключу, затем по
+// плоскому имени переменной окружения (старый формат файлов).
+func lookupFile(v *viper.Viper, opt Option) (any, bool) {
+	if v.IsSet(opt.Key) {
+		return v.Get(opt.Key), true
+	}
+	if opt.Env != "" && v.IsSet(opt.Env) {
+		return v.Get(opt.Env), true
+	}
+	return nil, false
+}
+
+// flagValue хранит строку флага до разбора в тип настройки.
+type flagValue struct {
+	opt Option
+	raw string
+}
+
+func (f *flagValue) String() string {
+	if f == nil {
+		return ""
+	}
+	return formatValue(f.opt.Default, false)
+}
+
+func (f *flagValue) Set(raw string) error {
+	if _, err := parseValue(f.opt.Default, raw); err != nil {
+		return err
+	}
+	f.raw = raw
+	return nil
+}
+
+func (f *flagValue) IsBoolFlag() bool {
+	_, ok := f.opt.Default.(bool)
+	return ok
+}
+
+func (l *Loader) registerFlags(fs *flag.FlagSet) map[string]*flagValue {
+	values := make(map[string]*flagValue)
+	for _, opt := range l.options {
+		if opt.Flag == "" {
+			continue
+		}
+		value := &flagValue{opt: opt}
+		fs.Var(value, opt.Flag, opt.Usage)
+		values[opt.Flag] = value
+	}
+	return values
+}
@@ -0,0 +1,130 @@
+package configloader
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type testConfig struct {
+	Address string `mapstructure:"address"`
+	Storage struct {
+		FilePath      string        `mapstructure:"file_path"`
+		StoreInterval time.Duration `mapstructure:"store_interval"`
+		Restore       bool          `mapstructure:"restore"`
+	} `mapstructure:"storage"`
+	Security struct {
+		Key string `mapstructure:"key"`
+	} `mapstructure:"security"`
+}
+
+func testOptions() []Option {
+	return []Option{
+		{Key: "address", Env: "TEST_ADDRESS", Flag: "a", Default: "localhost:8080"},
+		{Key: "storage.file_path", Env: "TEST_FILE_STORAGE_PATH", Flag: "f", Default: "./data.txt"},
+		{Key: "storage.store_interval", Env: "TEST_STORE_INTERVAL", Flag: "i", Default: 300 * time.Second},
+		{Key: "storage.restore", Env: "TEST_RESTORE", Flag: "r", Default: true},
+		{Key: "security.key", Env: "TEST_KEY", Flag: "k", Default: "", Secret: true},
+	}
+}
+
+func writeFile(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+func TestLoaderPrecedence(t *testing.T) {
+	dir := t.TempDir()
+	t.Chdir(dir)
+
+	configPath := writeFile(t, dir, "config.yaml", `
+address: file:1
+storage:
+  file_path: /file/data.json
+  store_interval: 1m
+  restore: false
+`)
+	writeFile(t, dir, ".env", "TEST_FILE_STORAGE_PATH=/dotenv/data.json\nTEST_STORE_INTERVAL=20\n")
+	t.Setenv("TEST_STORE_INTERVAL", "30")
+	t.Setenv("TEST_ADDRESS", "env:1")
+
+	loader := New(testOptions(), "")
+	require.NoError(t, loader.Load("test", []string{"-c", configPath, "-a", "flag:1", "-k", "secret"}))
+
+	var cfg testConfig
+	require.NoError(t, loader.Decode(&cfg))
+
+	require.Equal(t, "flag:1", cfg.Address)
+	require.Equal(t, SourceFlag, loader.Source("address"))
+	require.Equal(t, 30*time.Second, cfg.Storage.StoreInterval)
+	require.Equal(t, SourceEnv, loader.Source("storage.store_interval"))
+	require.Equal(t, "/dotenv/data.json", cfg.Storage.FilePath)
+	require.Equal(t, SourceDotEnv, loader.Source("storage.file_path"))
+	require.False(t, cfg.Storage.Restore)
+	require.Equal(t, SourceFile, loader.Source("storage.restore"))
+	require.Equal(t, "secret", cfg.Security.Key)
+
+	var report bytes.Buffer
+	require.NoError(t, loader.Report(&report))
+	require.Contains(t, report.String(), "***")
+	require.NotContains(t, report.String(), "secret")
+}
+
+func TestLoaderDefaultsAndLegacyFile(t *testing.T) {
+	dir := t.TempDir()
+	t.Chdir(dir)
+
+	writeFile(t, dir, "legacy.json", `{"TEST_STORE_INTERVAL": "5", "TEST_RESTORE": "false"}`)
+
+	loader := New(testOptions(), "legacy.json")
+	require.NoError(t, loader.Load("test", nil))
+
+	var cfg testConfig
+	require.NoError(t, loader.Decode(&cfg))
+
+	require.Equal(t, "localhost:8080", cfg.Address)
+	require.Equal(t, SourceDefault, loader.Source("address"))
+	require.Equal(t, 5*time.Second, cfg.Storage.StoreInterval)
+	require.False(t, cfg.Storage.Restore)
+	require.Equal(t, "legacy.json", loader.File())
+}
+
+func TestLoaderFormats(t *testing.T) {
+	dir := t.TempDir()
+	t.Chdir(dir)
+
+	files := map[string]string{
+		"config.json": `{"storage": {"store_interval": "2s"}}`,
+		"config.toml": "[storage]\nstore_interval = \"2s\"\n",
+		"config.yml":  "storage:\n  store_interval: 2\n",
+	}
+	for name, content := range files {
+		t.Run(name, func(t *testing.T) {
+			path := writeFile(t, dir, name, content)
+
+			loader := New(testOptions(), "")
+			require.NoError(t, loader.Load("test", []string{"-config", path}))
+
+			var cfg testConfig
+			require.NoError(t, loader.Decode(&cfg))
+			require.Equal(t, 2*time.Second, cfg.Storage.StoreInterval)
+		})
+	}
+}
+
+func TestLoaderErrors(t *testing.T) {
+	t.Chdir(t.TempDir())
+
+	loader := New(testOptions(), "")
+	require.Error(t, loader.Load("test", []string{"-c", "missing.yaml"}))
+	require.Error(t, loader.Load("test", []string{"-i", "soon"}))
+
+	t.Setenv("TEST_RESTORE", "maybe")
+	require.Error(t, loader.Load("test", nil))
+}
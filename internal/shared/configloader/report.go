@@ -0,0 +1,29 @@
+package configloader
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+)
+
+// Report печатает итоговое значение каждой настройки и его источник.
+// Значения секретов скрываются.
+func (l *Loader) Report(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+	if l.file != "" {
+		fmt.Fprintf(tw, "# config file: %s\n", l.file)
+	}
+	fmt.Fprintln(tw, "KEY\tVALUE\tSOURCE\tENV\tFLAG")
+	for _, opt := range l.options {
+		flagName := ""
+		if opt.Flag != "" {
+			flagName = "-" + opt.Flag
+		}
+		fmt.Fprintf(
+			tw, "%s\t%s\t%s\t%s\t%s\n",
+			opt.Key, formatValue(l.values[opt.Key], opt.Secret), l.sources[opt.Key], opt.Env, flagName,
+		)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,71 @@
+package configloader
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// parseValue разбирает строку из флага или окружения в тип значения по умолчанию.
+func parseValue(def any, raw string) (any, error) {
+	raw = strings.TrimSpace(raw)
+
+	switch def.(type) {
+	case string:
+		return raw, nil
+	case bool:
+		return strconv.ParseBool(raw)
+	case int:
+		return strconv.Atoi(raw)
+	case int64:
+		return strconv.ParseInt(raw, 10, 64)
+	case float64:
+		return strconv.ParseFloat(raw, 64)
+	case time.Duration:
+		return ParseSeconds(raw)
+	default:
+		return nil, fmt.Errorf("setting of type %T can only be set in config file", def)
+	}
+}
+
+// convertFileValue приводит значение из файла к типу значения по умолчанию.
+// Значения составных типов передаются как есть и разбираются при Decode.
+func convertFileValue(def any, raw any) (any, error) {
+	switch def.(type) {
+	case string, bool, int, int64, float64, time.Duration:
+		return parseValue(def, fmt.Sprint(raw))
+	default:
+		return raw, nil
+	}
+}
+
+// ParseSeconds разбирает интервал: целое число трактуется как секунды,
+// иначе ожидается строка в формате time.ParseDuration ("1m30s").
+func ParseSeconds(raw string) (time.Duration, error) {
+	if seconds, err := strconv.ParseInt(raw, 10, 64); err == nil {
+		return time.Duration(seconds) * time.Second, nil
+	}
+	d, err := time.ParseDuration(raw)
+	if err != nil {
+		return 0, fmt.Errorf("invalid duration %q: expected seconds or Go duration", raw)
+	}
+	return d, nil
+}
+
+func formatValue(value any, secret bool) string {
+	if secret {
+		if s, ok := value.(string); ok && s == "" {
+			return ""
+		}
+		return "***"
+	}
+	switch v := value.(type) {
+	case string:
+		return v
+	case time.Duration:
+		return v.String()
+	default:
+		return fmt.Sprint(v)
+	}
+}
@@ -0,0 +1,53 @@
+// Package fileutil содержит вспомогательные функции для надёжной записи файлов.
+package fileutil
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// WriteFileAtomic заменяет содержимое path на data так, чтобы при сбое на
+// диске оставалась либо старая, либо новая версия файла целиком: данные
+// пишутся во временный файл в том же каталоге, фиксируются fsync и
+// переименовываются поверх path, после чего fsync выполняется для каталога.
+func WriteFileAtomic(path string, data []byte) error {
+	dir := filepath.Dir(path)
+
+	tmp, err := os.CreateTemp(dir, filepath.Base(path)+".tmp*")
+	if err != nil {
+		return fmt.Errorf("create temp file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err = tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("write temp file: %w", err)
+	}
+	if err = tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("sync temp file: %w", err)
+	}
+	if err = tmp.Close(); err != nil {
+		return fmt.Errorf("close temp file: %w", err)
+	}
+	if err = os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("rename temp file: %w", err)
+	}
+	return syncDir(dir)
+}
+
+// syncDir фиксирует на диске запись каталога, чтобы переименование
+// пережило отключение питания.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return fmt.Errorf("open dir %q: %w", dir, err)
+	}
+	defer d.Close()
+
+	if err = d.Sync(); err != nil {
+		return fmt.Errorf("sync dir %q: %w", dir, err)
+	}
+	return nil
+}
@@ -0,0 +1,5 @@
+package shared
+
+// AgentIDHeader - заголовок, в котором агент передаёт серверу свой
+// идентификатор. Сервер записывает его в журнал аудита обновлений метрик.
+const AgentIDHeader = "X-Agent-ID"
@@ -0,0 +1,81 @@
+// Package logging настраивает logrus и передаёт логгер с идентификатором
+// запроса через context.Context, чтобы все записи одного запроса в
+// хэндлерах, сервисах и репозиториях можно было связать между собой.
+package logging
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// FormatJSON - структурированные логи, по одной JSON-записи на строку.
+	FormatJSON = "json"
+	// FormatText - человекочитаемые логи.
+	FormatText = "text"
+)
+
+// RequestIDField - имя поля с идентификатором запроса в записях лога.
+const RequestIDField = "request_id"
+
+type loggerKey struct{}
+
+// Configure применяет уровень и формат к logger и к глобальному логгеру
+// logrus, которым пользуются сторонние библиотеки.
+func Configure(logger *logrus.Logger, level, format string) error {
+	lvl, err := logrus.ParseLevel(level)
+	if err != nil {
+		return fmt.Errorf("invalid log level %q: %w", level, err)
+	}
+	formatter, err := newFormatter(format)
+	if err != nil {
+		return err
+	}
+
+	for _, l := range []*logrus.Logger{logger, logrus.StandardLogger()} {
+		l.SetLevel(lvl)
+		l.SetFormatter(formatter)
+	}
+	return nil
+}
+
+func newFormatter(format string) (logrus.Formatter, error) {
+	switch format {
+	case FormatJSON:
+		return &logrus.JSONFormatter{TimestampFormat: "2006-01-02T15:04:05.000Z07:00"}, nil
+	case FormatText:
+		return &logrus.TextFormatter{
+			FullTimestamp:   true,
+			TimestampFormat: "2006-01-02 15:04:05",
+		}, nil
+	default:
+		return nil, fmt.Errorf("invalid log format %q: expected %q or %q", format, FormatJSON, FormatText)
+	}
+}
+
+// WithLogger возвращает контекст, несущий запись лога entry.
+func WithLogger(ctx context.Context, entry *logrus.Entry) context.Context {
+	return context.WithValue(ctx, loggerKey{}, entry)
+}
+
+// FromContext возвращает запись лога из контекста. Если её нет,
+// используется глобальный логгер logrus.
+func FromContext(ctx context.Context) *logrus.Entry {
+	return Entry(ctx, nil)
+}
+
+// Entry возвращает запись лога из контекста, а при её отсутствии -
+// запись поверх fallback (или глобального логгера, если fallback == nil).
+func Entry(ctx context.Context, fallback *logrus.Logger) *logrus.Entry {
+	if ctx != nil {
+		if entry, ok := ctx.Value(loggerKey{}).(*logrus.Entry); ok {
+			return entry
+		}
+	}
+	if fallback == nil {
+		fallback = logrus.StandardLogger()
+	}
+	return logrus.NewEntry(fallback)
+}
@@ -0,0 +1,48 @@
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+)
+
+// RequestIDHeader - заголовок, в котором агент и сервер передают идентификатор запроса.
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLen ограничивает длину идентификатора, пришедшего от клиента.
+const maxRequestIDLen = 128
+
+type requestIDKey struct{}
+
+// NewRequestID генерирует случайный идентификатор запроса.
+func NewRequestID() string {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(buf)
+}
+
+// ValidRequestID сообщает, можно ли использовать идентификатор от клиента.
+func ValidRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLen {
+		return false
+	}
+	for _, r := range id {
+		if r < 0x21 || r > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// WithRequestID сохраняет идентификатор запроса в контексте.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestIDFromContext возвращает идентификатор запроса или "".
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
@@ -0,0 +1,110 @@
+package shared
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Change описывает изменение одной настройки при перезагрузке конфигурации.
+// Hot означает, что новое значение применяется без перезапуска процесса.
+type Change struct {
+	Name string
+	Old  any
+	New  any
+	Hot  bool
+}
+
+// CatchReload возвращает канал, в который приходит событие при получении
+// SIGHUP или при изменении любого из файлов paths. Файлы проверяются
+// раз в watchInterval; нулевой интервал отключает слежение за файлами.
+func CatchReload(ctx context.Context, watchInterval time.Duration, paths ...string) <-chan struct{} {
+	reloadCh := make(chan struct{}, 1)
+	notify := func() {
+		select {
+		case reloadCh <- struct{}{}:
+		default:
+		}
+	}
+
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGHUP)
+
+	go func() {
+		defer signal.Stop(sigCh)
+
+		var tick <-chan time.Time
+		if watchInterval > 0 {
+			ticker := time.NewTicker(watchInterval)
+			defer ticker.Stop()
+			tick = ticker.C
+		}
+
+		modTimes := fileModTimes(paths)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-sigCh:
+				notify()
+			case <-tick:
+				current := fileModTimes(paths)
+				for _, path := range paths {
+					if !current[path].Equal(modTimes[path]) {
+						notify()
+						break
+					}
+				}
+				modTimes = current
+			}
+		}
+	}()
+
+	return reloadCh
+}
+
+// LogChanges пишет в лог, какие настройки изменились и какие из них
+// вступят в силу только после перезапуска.
+func LogChanges(logger *logrus.Logger, changes []Change) {
+	if len(changes) == 0 {
+		logger.Info("config reloaded: no changes")
+		return
+	}
+	for _, c := range changes {
+		if c.Hot {
+			logger.Infof("config reloaded: %s changed from %v to %v (applied)", c.Name, c.Old, c.New)
+		} else {
+			logger.Warnf("config reloaded: %s changed from %v to %v (requires restart)", c.Name, c.Old, c.New)
+		}
+	}
+}
+
+// CompareSetting добавляет в changes запись, если значение настройки изменилось.
+func CompareSetting[T comparable](changes []Change, name string, oldValue, newValue T, hot bool) []Change {
+	if oldValue == newValue {
+		return changes
+	}
+	return append(changes, Change{Name: name, Old: oldValue, New: newValue, Hot: hot})
+}
+
+// CompareSecret как CompareSetting, но не выводит сами значения в лог.
+func CompareSecret(changes []Change, name, oldValue, newValue string, hot bool) []Change {
+	if oldValue == newValue {
+		return changes
+	}
+	return append(changes, Change{Name: name, Old: "***", New: "***", Hot: hot})
+}
+
+func fileModTimes(paths []string) map[string]time.Time {
+	modTimes := make(map[string]time.Time, len(paths))
+	for _, path := range paths {
+		if info, err := os.Stat(path); err == nil {
+			modTimes[path] = info.ModTime()
+		}
+	}
+	return modTimes
+}
@@ -0,0 +1,53 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE metric_samples (
+    name VARCHAR(255) NOT NULL,
+    metric_type VARCHAR(10) NOT NULL CHECK (metric_type IN ('gauge', 'counter')),
+    ts TIMESTAMPTZ NOT NULL,
+    value DOUBLE PRECISION NOT NULL
+);
+CREATE INDEX metric_samples_ts_idx ON metric_samples (ts);
+CREATE INDEX metric_samples_name_ts_idx ON metric_samples (name, metric_type, ts);
+
+CREATE TABLE metric_rollups_1m (
+    name VARCHAR(255) NOT NULL,
+    metric_type VARCHAR(10) NOT NULL CHECK (metric_type IN ('gauge', 'counter')),
+    bucket TIMESTAMPTZ NOT NULL,
+    count BIGINT NOT NULL,
+    sum DOUBLE PRECISION NOT NULL,
+    min DOUBLE PRECISION NOT NULL,
+    max DOUBLE PRECISION NOT NULL,
+    last DOUBLE PRECISION NOT NULL,
+    PRIMARY KEY (name, metric_type, bucket)
+);
+CREATE INDEX metric_rollups_1m_bucket_idx ON metric_rollups_1m (bucket);
+
+CREATE TABLE metric_rollups_1h (
+    name VARCHAR(255) NOT NULL,
+    metric_type VARCHAR(10) NOT NULL CHECK (metric_type IN ('gauge', 'counter')),
+    bucket TIMESTAMPTZ NOT NULL,
+    count BIGINT NOT NULL,
+    sum DOUBLE PRECISION NOT NULL,
+    min DOUBLE PRECISION NOT NULL,
+    max DOUBLE PRECISION NOT NULL,
+    last DOUBLE PRECISION NOT NULL,
+    PRIMARY KEY (name, metric_type, bucket)
+);
+CREATE INDEX metric_rollups_1h_bucket_idx ON metric_rollups_1h (bucket);
+
+-- До какого момента история уже свёрнута в агрегаты каждого разрешения.
+CREATE TABLE metric_rollup_watermarks (
+    resolution VARCHAR(10) PRIMARY KEY,
+    rolled_until TIMESTAMPTZ NOT NULL
+);
+INSERT INTO metric_rollup_watermarks (resolution, rolled_until)
+VALUES ('1m', '1970-01-01 00:00:00+00'), ('1h', '1970-01-01 00:00:00+00');
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS metric_rollup_watermarks;
+DROP TABLE IF EXISTS metric_rollups_1h;
+DROP TABLE IF EXISTS metric_rollups_1m;
+DROP TABLE IF EXISTS metric_samples;
+-- +goose StatementEnd
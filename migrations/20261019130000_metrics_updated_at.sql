@@ -0,0 +1,11 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Время последнего обновления метрики. Существующим строкам ставится время
+-- миграции: до неё время обновления не сохранялось.
+ALTER TABLE metrics ADD COLUMN updated_at TIMESTAMPTZ NOT NULL DEFAULT now();
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE metrics DROP COLUMN IF EXISTS updated_at;
+-- +goose StatementEnd
@@ -0,0 +1,12 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Метки метрики. Фильтр по меткам (labels @> ...) использует GIN-индекс.
+ALTER TABLE metrics ADD COLUMN labels JSONB NOT NULL DEFAULT '{}'::jsonb;
+CREATE INDEX metrics_labels_idx ON metrics USING GIN (labels);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS metrics_labels_idx;
+ALTER TABLE metrics DROP COLUMN IF EXISTS labels;
+-- +goose StatementEnd